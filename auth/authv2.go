@@ -1,17 +1,21 @@
 package auth
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/hmac"
 	"errors"
+	"fmt"
 	"log"
-	"net/http"
 	"smart-chat/config"
 	"smart-chat/internal/constants"
 	"smart-chat/internal/models"
+	"smart-chat/internal/otp"
+	sessionService "smart-chat/internal/services/session"
+	"smart-chat/internal/services/slack"
+	"smart-chat/internal/tokenhash"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-resty/resty/v2"
 	"gorm.io/gorm"
 )
 
@@ -27,18 +31,50 @@ type RefreshTokenInfo struct {
 }
 
 type AuthV2Service struct {
-	DB             *gorm.DB
-	Fast2SMSAPIKey string
-	SecretToken    string
+	DB          *gorm.DB
+	OTPSender   otp.OTPSender
+	SecretToken string
+	// OTPHashKey keys the HMAC under which login codes are stored.
+	OTPHashKey string
+	OTPLimits  OTPLimits
+	// Slack receives abuse alerts (lockouts, daily limits). Optional.
+	Slack *slack.SlackService
+	// Tokens hashes access and challenge tokens before they are stored. Defaults to tokenhash.Default().
+	Tokens *tokenhash.Hasher
+	// Sessions issues and manages login sessions. Defaults to one with sessionService.DefaultPolicy.
+	Sessions *sessionService.Service
 }
 
-func NewAuthV2Service(db *gorm.DB) *AuthV2Service {
+func NewAuthV2Service(db *gorm.DB, slackService *slack.SlackService) *AuthV2Service {
 	cfg := config.Load()
+	otpSender, err := otp.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure OTP delivery: %v", err)
+	}
 	return &AuthV2Service{
-		DB:             db,
-		Fast2SMSAPIKey: cfg.FAST2SMS_API_KEY,
-		SecretToken:    cfg.SecretToken,
+		DB:          db,
+		OTPSender:   otpSender,
+		SecretToken: cfg.SecretToken,
+		OTPHashKey:  cfg.OTPHashKey,
+		OTPLimits:   OTPLimitsFromConfig(cfg),
+		Slack:       slackService,
+		Tokens:      tokenhash.Default(),
+		Sessions:    sessionService.NewService(db, sessionService.PolicyFromConfig(cfg)),
+	}
+}
+
+func (s *AuthV2Service) sessions() *sessionService.Service {
+	if s.Sessions == nil {
+		s.Sessions = sessionService.NewService(s.DB, sessionService.DefaultPolicy)
 	}
+	return s.Sessions
+}
+
+func (s *AuthV2Service) tokens() *tokenhash.Hasher {
+	if s.Tokens != nil {
+		return s.Tokens
+	}
+	return tokenhash.Default()
 }
 
 func (s *AuthV2Service) NewLoginWA(info UserLoginInfoWA) (gin.H, error) {
@@ -75,182 +111,212 @@ func (s *AuthV2Service) NewLoginWA(info UserLoginInfoWA) (gin.H, error) {
 		}
 	}
 
-	// Generate an access token for the user
-	accessToken, err := generateSecretToken(32)
+	// Create a session for the user
+	tokens, err := s.sessions().Issue(user.ID, constants.WhatsAppSource)
 	if err != nil {
-		return gin.H{"error": "Failed to generate access token", "success": false}, err
+		return gin.H{"error": "Failed to create session", "success": false}, err
 	}
 
 	// Update user with the generated access token and set its expiration time
-	user.AccessToken = accessToken
-	user.AccessExpireAt = time.Now().Add(7 * 24 * time.Hour)
+	user.AccessToken = s.tokens().Hash(tokens.AccessToken)
+	user.AccessExpireAt = tokens.ExpiresAt
 
 	// Save the user with the updated access token
 	if err := s.DB.Save(&user).Error; err != nil {
 		return gin.H{"error": "Failed to update user with access token", "success": false}, err
 	}
 
-	// Create a session for the user
-	session := models.Session{
-		UserID:    user.ID,
-		AuthToken: accessToken,
-		Source:    constants.WhatsAppSource,
-		ExpireAt:  time.Now().Add(1 * time.Hour),
-	}
+	return tokensResponse(tokens), nil
+}
 
-	if err := s.DB.Create(&session).Error; err != nil {
-		return gin.H{"error": "Failed to create session", "success": false}, err
+// InitLogin sends a login code to info.Mobile and returns the token to validate it with.
+// Requests over the resend cooldown or daily limits, or for a locked-out mobile, get ErrOTPThrottled
+// with the same response whatever the reason.
+func (s *AuthV2Service) InitLogin(info UserLoginInfo, clientIP string) (gin.H, error) {
+	recipient, err := otp.ParseMobile(info.Mobile)
+	if err != nil {
+		return gin.H{"error": "Invalid mobile number", "success": false}, err
 	}
+	mobile := recipient.E164
+	limits := s.OTPLimits.withDefaults()
 
-	// Return the access token
-	return gin.H{"accessToken": accessToken, "success": true}, nil
-}
-
-func (s *AuthV2Service) InitLogin(info UserLoginInfo) (gin.H, error) {
-	otp, err := generateOTP(4) // 4-digit OTP
+	code, err := generateOTP(4) // 4-digit OTP
 	if err != nil {
 		return gin.H{"error": err.Error(), "success": false}, err
 	}
-
-	// Assuming the mobile number is unique for each user
-	var user models.User
-	result := s.DB.Where("mobile = ?", info.Mobile).First(&user)
-	accessToken, err := generateSecretToken(32)
+	token, err := generateSecretToken(32)
 	if err != nil {
 		return gin.H{"error": "Failed to generate access token"}, err
 	}
 
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		// Create a new user if not exists
-		user = models.User{
-			Name:           info.Name,
-			Mobile:         info.Mobile,
-			OTP:            otp,
-			AccessToken:    accessToken,
-			AccessExpireAt: time.Now().Add(5 * time.Minute), // Example expiry time
+	now := time.Now()
+	var (
+		reason    string
+		challenge models.OTPChallenge
+	)
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOTPRequests(tx, mobile, clientIP); err != nil {
+			return err
 		}
-	} else {
-		// Update existing user's OTP and expiry
-		user.OTP = otp
-		user.AccessToken = accessToken
-		user.AccessExpireAt = time.Now().Add(5 * time.Minute)
+		var err error
+		reason, err = otpThrottleReason(tx, mobile, clientIP, now, limits)
+		if err != nil || reason != "" {
+			return err
+		}
+
+		user, err := loginUser(tx, recipient, info.Mobile, info.Name, now)
+		if err != nil {
+			return err
+		}
+
+		challenge = models.OTPChallenge{
+			UserID:    user.ID,
+			Mobile:    mobile,
+			IPAddress: clientIP,
+			Token:     s.tokens().Hash(token),
+			CodeHash:  s.hashOTP(token, code),
+			ExpiresAt: now.Add(limits.Expiry),
+		}
+		return tx.Create(&challenge).Error
+	})
+	if err != nil {
+		return gin.H{"error": "internal server error", "success": false}, err
 	}
-	// Save or update user in the database
-	if err := s.DB.Save(&user).Error; err != nil {
-		return gin.H{"error": err.Error(), "success": false}, err
+	if reason != "" {
+		log.Printf("OTP request for %s from IP %s throttled: %s", otp.MaskMobile(mobile), clientIP, reason)
+		return gin.H{"error": otpThrottledMessage, "success": false}, ErrOTPThrottled
 	}
 
-	log.Printf("otp: %v", otp)
-
-	otp_err := s.sendOTPMessage(info.Mobile, otp)
-	if otp_err != nil {
-		return gin.H{"error": "failed to send OTP", "success": false}, otp_err
+	if err := s.OTPSender.Send(context.Background(), mobile, code); err != nil {
+		log.Printf("Failed to send OTP to %s via %s: %v", otp.MaskMobile(mobile), s.OTPSender.Name(), err)
+		// An undelivered code should not hold the user back from retrying.
+		s.DB.Delete(&challenge)
+		return gin.H{"error": "failed to send OTP", "success": false}, err
 	}
+	s.alertOnDailyLimits(mobile, clientIP, now, limits)
 
-	return gin.H{"authToken": accessToken, "success": true}, nil
+	return gin.H{"authToken": token, "success": true}, nil
 }
 
-func (s *AuthV2Service) ValidateLogin(accessToken, otp string) (gin.H, error) {
-	var user models.User
-	result := s.DB.Where("access_token = ? AND otp = ? AND access_expire_at > ?", accessToken, otp, time.Now()).First(&user)
-	if result.Error != nil {
-		return gin.H{"error": "Invalid OTP or expired"}, errors.New("invalid OTP or expired")
-	}
+// ValidateLogin exchanges a challenge token and its code for a session token. Every failure,
+// including a wrong code, an expired or used challenge and a lockout, returns ErrInvalidOTP.
+func (s *AuthV2Service) ValidateLogin(token, code string) (gin.H, error) {
+	invalid := gin.H{"error": otpInvalidMessage}
+	limits := s.OTPLimits.withDefaults()
+	now := time.Now()
 
-	// Generate a new session for the user
-	authToken, err := generateSecretToken(32)
-	if err != nil {
-		return gin.H{"error": "Failed to generate session token"}, err
+	var challenge models.OTPChallenge
+	if err := s.tokens().Where(s.DB, "token", token).First(&challenge).Error; err != nil {
+		return invalid, ErrInvalidOTP
+	}
+	if challenge.ConsumedAt != nil || challenge.LockedUntil != nil || !now.Before(challenge.ExpiresAt) {
+		return invalid, ErrInvalidOTP
 	}
 
-	session := models.Session{
-		UserID:    user.ID,
-		AuthToken: authToken,
-		Source:    constants.WebsiteSource,
-		ExpireAt:  time.Now().Add(1 * time.Hour),
+	// Count the attempt before comparing, so parallel guesses cannot get past MaxAttempts.
+	counted := s.DB.Model(&models.OTPChallenge{}).
+		Where("id = ? AND attempts < ? AND consumed_at IS NULL AND locked_until IS NULL", challenge.ID, limits.MaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if counted.Error != nil {
+		return gin.H{"error": "internal server error"}, counted.Error
+	}
+	if counted.RowsAffected == 0 {
+		return invalid, ErrInvalidOTP
+	}
+	challenge.Attempts++
+
+	if !hmac.Equal([]byte(s.hashOTP(token, code)), []byte(challenge.CodeHash)) {
+		if challenge.Attempts >= limits.MaxAttempts {
+			lockedUntil := now.Add(limits.Lockout)
+			if err := s.DB.Model(&challenge).UpdateColumn("locked_until", lockedUntil).Error; err != nil {
+				log.Printf("Failed to lock OTP challenge %d: %v", challenge.ID, err)
+			}
+			log.Printf("OTP challenge %d for %s locked after %d failed attempts", challenge.ID, otp.MaskMobile(challenge.Mobile), challenge.Attempts)
+			s.alert(fmt.Sprintf("OTP lockout: %d wrong codes for %s (requested from IP %s); no new codes until %s",
+				challenge.Attempts, otp.MaskMobile(challenge.Mobile), challenge.IPAddress, lockedUntil.UTC().Format(time.RFC3339)))
+		}
+		return invalid, ErrInvalidOTP
 	}
 
-	log.Printf("session %v", session)
+	consumed := s.DB.Model(&models.OTPChallenge{}).
+		Where("id = ? AND consumed_at IS NULL", challenge.ID).
+		UpdateColumn("consumed_at", now)
+	if consumed.Error != nil {
+		return gin.H{"error": "internal server error"}, consumed.Error
+	}
+	if consumed.RowsAffected == 0 {
+		return invalid, ErrInvalidOTP
+	}
 
-	if err := s.DB.Create(&session).Error; err != nil {
+	tokens, err := s.sessions().Issue(challenge.UserID, constants.WebsiteSource)
+	if err != nil {
 		return gin.H{"error": "Failed to create session"}, err
 	}
 
-	return gin.H{"accessToken": authToken, "success": true}, nil
+	return tokensResponse(tokens), nil
 }
 
-func (s *AuthV2Service) sendOTPMessage(mobile, otp string) error {
-	client := resty.New()
-	resp, err := client.R().
-		SetQueryParams(map[string]string{
-			"authorization":    s.Fast2SMSAPIKey,
-			"variables_values": otp,
-			"route":            "otp",
-			"numbers":          mobile[3:],
-		}).
-		SetHeaders(map[string]string{
-			"cache-control": "no-cache",
-		}).
-		Get("https://www.fast2sms.com/dev/bulkV2")
-
+// RefreshToken is the WhatsApp integration's refresh: with the shared secret it gives the session
+// behind accessToken new tokens, whether or not the access token has expired.
+func (s *AuthV2Service) RefreshToken(info RefreshTokenInfo, accessToken string) (gin.H, error) {
+	if info.SecretToken != s.SecretToken {
+		return gin.H{"error": "Invalid secret token", "success": false}, errors.New("invalid secret token")
+	}
+	session, err := s.sessions().Find(accessToken)
 	if err != nil {
-		log.Printf("Error sending OTP message: %v", err)
-		return err
+		return sessionErrorResponse(err), err
 	}
-
-	// Log response body for debugging
-	respString := resp.String()
-	log.Printf("Response from Fast2SMS: %s", respString)
-
-	// Parse the response JSON
-	var responseJSON map[string]interface{}
-	if err := json.Unmarshal([]byte(respString), &responseJSON); err != nil {
-		log.Printf("Error parsing response JSON: %v", err)
-		return err
+	tokens, err := s.sessions().Rotate(session)
+	if err != nil {
+		return sessionErrorResponse(err), err
 	}
+	return tokensResponse(tokens), nil
+}
 
-	// Check if the "return" key is present and false
-	if val, ok := responseJSON["return"].(bool); ok && !val {
-		log.Printf("Failed to send OTP: return is false")
-		return errors.New("failed to send OTP")
+// Refresh exchanges a refresh token for new access and refresh tokens.
+func (s *AuthV2Service) Refresh(refreshToken string) (gin.H, error) {
+	tokens, err := s.sessions().Refresh(refreshToken)
+	if err != nil {
+		return sessionErrorResponse(err), err
 	}
+	return tokensResponse(tokens), nil
+}
 
-	// Check if response status code is not 200
-	if resp.StatusCode() != http.StatusOK {
-		log.Printf("Failed to send OTP: Status Code %d", resp.StatusCode())
-		return errors.New("failed to send OTP")
+// Logout revokes the session behind accessToken, along with its refresh token.
+func (s *AuthV2Service) Logout(accessToken string) (gin.H, error) {
+	if err := s.sessions().Revoke(accessToken); err != nil {
+		return sessionErrorResponse(err), err
 	}
-
-	return nil
+	return gin.H{"success": true}, nil
 }
 
-func (s *AuthV2Service) RefreshToken(info RefreshTokenInfo, accessToken string) (gin.H, error) {
-	if info.SecretToken != s.SecretToken {
-		return gin.H{"error": "Invalid secret token", "success": false}, errors.New("invalid secret token")
+// ListSessions lists the active sessions of the user behind accessToken.
+func (s *AuthV2Service) ListSessions(accessToken string) (gin.H, error) {
+	session, err := s.sessions().Authenticate(accessToken)
+	if err != nil {
+		return sessionErrorResponse(err), err
 	}
-	var session models.Session
-	result := s.DB.Where("auth_token = ?", accessToken).First(&session)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			log.Println("Session not found for token:", accessToken)
-			return gin.H{"error": "session not found"}, result.Error
-		} else {
-			log.Println("Database error:", result.Error)
-			return gin.H{"error": "internal server error"}, result.Error
-		}
+	active, err := s.sessions().ListActiveForUser(session.UserID, session.ID)
+	if err != nil {
+		return gin.H{"error": "internal server error"}, err
 	}
-	if time.Now().After(session.ExpireAt) {
-		log.Println("Session expired for user:", session.User.ID)
-		authToken, err := generateSecretToken(32)
-		if err != nil {
-			return gin.H{"error": "Failed to generate session token"}, err
-		}
-		session.AuthToken = authToken
-		session.ExpireAt = time.Now().Add(7 * 24 * time.Hour)
-		if err := s.DB.Save(&session).Error; err != nil {
-			return gin.H{"error": "Failed to update session"}, err
-		}
-		return gin.H{"accessToken": authToken, "success": true}, nil
+	return gin.H{"sessions": active}, nil
+}
+
+func tokensResponse(tokens sessionService.Tokens) gin.H {
+	return gin.H{
+		"accessToken":      tokens.AccessToken,
+		"refreshToken":     tokens.RefreshToken,
+		"expiresAt":        tokens.ExpiresAt,
+		"refreshExpiresAt": tokens.RefreshExpiresAt,
+		"success":          true,
+	}
+}
+
+func sessionErrorResponse(err error) gin.H {
+	if isSessionError(err) {
+		return gin.H{"error": err.Error(), "success": false}
 	}
-	return gin.H{"error": "session not expired"}, nil
+	log.Println("Database error:", err)
+	return gin.H{"error": "internal server error", "success": false}
 }
@@ -2,8 +2,12 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 
+	"smart-chat/internal/otp"
+	sessionService "smart-chat/internal/services/session"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,9 +29,9 @@ func InitLoginHandler(authService *AuthService) gin.HandlerFunc {
 			return
 		}
 
-		token, err := authService.InitLogin(info)
+		token, err := authService.InitLogin(info, c.ClientIP())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+			initLoginError(c, token, err)
 			return
 		}
 
@@ -45,10 +49,45 @@ func ValidateLoginHandler(authService *AuthService) gin.HandlerFunc {
 
 		accessToken, err := authService.ValidateLogin(req.Token, req.OTP)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate login", "success": false})
+			validateLoginError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, accessToken)
 	}
 }
+
+// initLoginError writes the response for a failed InitLogin. Throttled requests all get the same
+// generic 429, whichever limit was hit.
+func initLoginError(c *gin.Context, response gin.H, err error) {
+	switch {
+	case errors.Is(err, ErrOTPThrottled):
+		c.JSON(http.StatusTooManyRequests, response)
+	case errors.Is(err, otp.ErrInvalidMobile):
+		c.JSON(http.StatusBadRequest, response)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+	}
+}
+
+func validateLoginError(c *gin.Context, err error) {
+	if errors.Is(err, ErrInvalidOTP) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": otpInvalidMessage, "success": false})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate login", "success": false})
+}
+
+func isSessionError(err error) bool {
+	return errors.Is(err, sessionService.ErrSessionNotFound) ||
+		errors.Is(err, sessionService.ErrSessionExpired) ||
+		errors.Is(err, sessionService.ErrSessionRevoked) ||
+		errors.Is(err, sessionService.ErrRefreshTokenReused)
+}
+
+func sessionErrorStatus(err error) int {
+	if isSessionError(err) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -16,9 +16,9 @@ func InitLoginHandlerv2(authService *AuthV2Service) gin.HandlerFunc {
 			return
 		}
 
-		token, err := authService.InitLogin(info)
+		token, err := authService.InitLogin(info, c.ClientIP())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+			initLoginError(c, token, err)
 			return
 		}
 
@@ -42,6 +42,10 @@ func WARefreshTokenHandler(authService *AuthV2Service) gin.HandlerFunc {
 		}
 		token, err := authService.RefreshToken(info, accessToken)
 		if err != nil {
+			if isSessionError(err) {
+				c.JSON(http.StatusUnauthorized, token)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login"})
 			return
 		}
@@ -78,10 +82,68 @@ func ValidateLoginHandlerv2(authService *AuthV2Service) gin.HandlerFunc {
 
 		accessToken, err := authService.ValidateLogin(req.Token, req.OTP)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate login", "success": false})
+			validateLoginError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, accessToken)
 	}
 }
+
+type RefreshSessionInfo struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+func RefreshSessionHandler(authService *AuthV2Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshSessionInfo
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refreshToken is required", "success": false})
+			return
+		}
+
+		tokens, err := authService.Refresh(req.RefreshToken)
+		if err != nil {
+			c.JSON(sessionErrorStatus(err), tokens)
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func LogoutHandler(authService *AuthV2Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accessToken := c.GetHeader("Authorization")
+		if accessToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+			return
+		}
+
+		response, err := authService.Logout(accessToken)
+		if err != nil {
+			c.JSON(sessionErrorStatus(err), response)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func ListSessionsHandler(authService *AuthV2Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accessToken := c.GetHeader("Authorization")
+		if accessToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+			return
+		}
+
+		response, err := authService.ListSessions(accessToken)
+		if err != nil {
+			c.JSON(sessionErrorStatus(err), response)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/otp"
+
+	"gorm.io/gorm"
+)
+
+// OTP lookups never tell the client why they failed, so a caller cannot learn whether a number
+// is locked, capped or simply mistyped.
+var (
+	ErrOTPThrottled = errors.New("too many OTP requests")
+	ErrInvalidOTP   = errors.New("invalid OTP or expired")
+)
+
+const (
+	otpThrottledMessage = "Too many OTP requests, please try again later"
+	otpInvalidMessage   = "Invalid OTP or expired"
+)
+
+// OTPLimits bounds how often codes are sent and how many guesses a code gets.
+type OTPLimits struct {
+	Expiry time.Duration
+	// A challenge is locked after MaxAttempts wrong codes, and its mobile gets no new code for Lockout.
+	MaxAttempts int
+	Lockout     time.Duration
+	// ResendCooldown applies to the mobile and to the client IP separately.
+	ResendCooldown time.Duration
+	// DailyLimit and IPDailyLimit cap the codes sent to a mobile and from an IP per 24 hours.
+	DailyLimit   int
+	IPDailyLimit int
+}
+
+// DefaultOTPLimits is used for any zero field of AuthV2Service.OTPLimits.
+var DefaultOTPLimits = OTPLimits{
+	Expiry:         5 * time.Minute,
+	MaxAttempts:    5,
+	Lockout:        30 * time.Minute,
+	ResendCooldown: time.Minute,
+	DailyLimit:     10,
+	IPDailyLimit:   50,
+}
+
+// OTPLimitsFromConfig builds OTPLimits from the application config.
+func OTPLimitsFromConfig(cfg *config.Config) OTPLimits {
+	return OTPLimits{
+		Expiry:         time.Duration(cfg.OTPExpiryMinutes) * time.Minute,
+		MaxAttempts:    cfg.OTPMaxAttempts,
+		Lockout:        time.Duration(cfg.OTPLockoutMinutes) * time.Minute,
+		ResendCooldown: time.Duration(cfg.OTPResendCooldownSeconds) * time.Second,
+		DailyLimit:     cfg.OTPDailyLimit,
+		IPDailyLimit:   cfg.OTPIPDailyLimit,
+	}
+}
+
+func (l OTPLimits) withDefaults() OTPLimits {
+	if l.Expiry <= 0 {
+		l.Expiry = DefaultOTPLimits.Expiry
+	}
+	if l.MaxAttempts <= 0 {
+		l.MaxAttempts = DefaultOTPLimits.MaxAttempts
+	}
+	if l.Lockout <= 0 {
+		l.Lockout = DefaultOTPLimits.Lockout
+	}
+	if l.ResendCooldown <= 0 {
+		l.ResendCooldown = DefaultOTPLimits.ResendCooldown
+	}
+	if l.DailyLimit <= 0 {
+		l.DailyLimit = DefaultOTPLimits.DailyLimit
+	}
+	if l.IPDailyLimit <= 0 {
+		l.IPDailyLimit = DefaultOTPLimits.IPDailyLimit
+	}
+	return l
+}
+
+// hashOTP binds the code to its challenge token, so equal codes never share a hash.
+func (s *AuthV2Service) hashOTP(token, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.OTPHashKey))
+	mac.Write([]byte(token))
+	mac.Write([]byte{0})
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lockOTPRequests holds Postgres advisory locks on mobile and ip until tx ends, so the throttle
+// check and the insert of the new challenge are atomic across instances. The mobile is always
+// locked first, and the IP in its own key space, so two requests cannot deadlock.
+func lockOTPRequests(tx *gorm.DB, mobile, ip string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", mobile).Error; err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('otp_ip'), hashtext(?))", ip).Error
+}
+
+// loginUser returns the user for recipient, creating it when missing. Users are keyed by the E.164
+// mobile, as WhatsApp stores them; a user saved under another spelling by an older login is moved
+// to the E.164 form rather than duplicated.
+func loginUser(tx *gorm.DB, recipient otp.Recipient, typed, name string, now time.Time) (models.User, error) {
+	var user models.User
+	err := tx.Where("mobile = ?", recipient.E164).First(&user).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	forms := []string{typed, recipient.Digits}
+	if recipient.National != "" {
+		forms = append(forms, recipient.National)
+	}
+	err = tx.Where("mobile IN ?", forms).Order("id").First(&user).Error
+	if err == nil {
+		return user, tx.Model(&user).Update("mobile", recipient.E164).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	user = models.User{
+		Name:           name,
+		Mobile:         recipient.E164,
+		AccessExpireAt: now,
+	}
+	return user, tx.Create(&user).Error
+}
+
+// otpThrottleReason returns why a new code must not be sent to mobile from ip, or "" when it may.
+func otpThrottleReason(tx *gorm.DB, mobile, ip string, now time.Time, limits OTPLimits) (string, error) {
+	var count int64
+	if err := tx.Model(&models.OTPChallenge{}).
+		Where("mobile = ? AND locked_until > ?", mobile, now).
+		Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "mobile locked out", nil
+	}
+
+	checks := []struct {
+		column, value, reason string
+		since                 time.Time
+		limit                 int64
+	}{
+		{"mobile", mobile, "mobile resend cooldown", now.Add(-limits.ResendCooldown), 1},
+		{"ip_address", ip, "IP resend cooldown", now.Add(-limits.ResendCooldown), 1},
+		{"mobile", mobile, "mobile daily limit", now.Add(-24 * time.Hour), int64(limits.DailyLimit)},
+		{"ip_address", ip, "IP daily limit", now.Add(-24 * time.Hour), int64(limits.IPDailyLimit)},
+	}
+	for _, check := range checks {
+		if check.value == "" {
+			continue
+		}
+		if err := tx.Model(&models.OTPChallenge{}).
+			Where(check.column+" = ? AND created_at > ?", check.value, check.since).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count >= check.limit {
+			return check.reason, nil
+		}
+	}
+	return "", nil
+}
+
+// alertOnDailyLimits alerts once per 24 hours when a mobile or an IP uses up its daily codes.
+// Both usually mean someone is pumping SMS through init-login.
+func (s *AuthV2Service) alertOnDailyLimits(mobile, ip string, now time.Time, limits OTPLimits) {
+	since := now.Add(-24 * time.Hour)
+
+	var sent int64
+	if err := s.DB.Model(&models.OTPChallenge{}).Where("mobile = ? AND created_at > ?", mobile, since).Count(&sent).Error; err != nil {
+		log.Printf("Failed to count OTPs for %s: %v", otp.MaskMobile(mobile), err)
+	} else if sent == int64(limits.DailyLimit) {
+		s.alert(fmt.Sprintf("OTP daily limit reached: %d codes sent to %s in 24h (last request from IP %s)", sent, otp.MaskMobile(mobile), ip))
+	}
+
+	if ip == "" {
+		return
+	}
+	if err := s.DB.Model(&models.OTPChallenge{}).Where("ip_address = ? AND created_at > ?", ip, since).Count(&sent).Error; err != nil {
+		log.Printf("Failed to count OTPs from IP %s: %v", ip, err)
+		return
+	}
+	if sent == int64(limits.IPDailyLimit) {
+		var mobiles int64
+		s.DB.Model(&models.OTPChallenge{}).Where("ip_address = ? AND created_at > ?", ip, since).Distinct("mobile").Count(&mobiles)
+		s.alert(fmt.Sprintf("OTP daily limit reached: %d codes requested from IP %s in 24h for %d different mobiles", sent, ip, mobiles))
+	}
+}
+
+func (s *AuthV2Service) alert(message string) {
+	if s.Slack != nil {
+		s.Slack.SendSlackAlertAsync(message)
+	}
+}
@@ -15,4 +15,7 @@ func RegisterV2AuthRoutes(group *gin.RouterGroup, authService *AuthV2Service) {
 	group.POST("/validate-login", ValidateLoginHandlerv2(authService))
 	group.POST("/login-for-whatsapp", WALoginHandler(authService))
 	group.POST("/refresh-token", WARefreshTokenHandler(authService))
+	group.POST("/refresh", RefreshSessionHandler(authService))
+	group.POST("/logout", LogoutHandler(authService))
+	group.GET("/sessions", ListSessionsHandler(authService))
 }
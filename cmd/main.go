@@ -11,21 +11,35 @@ import (
 	"smart-chat/cache"
 	"smart-chat/config"
 	apidocs "smart-chat/docs"
-	"smart-chat/external/indian_travellers"
 	"smart-chat/external/notification"
+	"smart-chat/internal/authservice/local"
 	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/blobstore"
 	middleware "smart-chat/internal/middlewares"
 	"smart-chat/internal/models"
 	"smart-chat/internal/routes"
 	"smart-chat/internal/services/analytics"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/audit"
+	authUserService "smart-chat/internal/services/auth_user"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	"smart-chat/internal/services/conversation"
 	convHistory "smart-chat/internal/services/conversation_history"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/internal/services/escalation"
+	"smart-chat/internal/services/export"
 	"smart-chat/internal/services/human"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/note"
 	notifications_job "smart-chat/internal/services/notifications_job"
+	"smart-chat/internal/services/reengagement"
+	sessionService "smart-chat/internal/services/session"
+	"smart-chat/internal/services/sla"
 	"smart-chat/internal/services/slack"
+	"smart-chat/internal/services/tag"
 	userService "smart-chat/internal/services/user"
-	utils "smart-chat/internal/utils"
+	"smart-chat/internal/services/whatsapp"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -34,6 +48,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// v1DeprecatedAt is sent in the Deprecation header of every /v1 response.
+var v1DeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
 func main() {
 	cache.Initialize("localhost:11211")
 	cfg := config.Load()
@@ -45,7 +62,7 @@ func main() {
 	}
 
 	// Perform the conditional migration to add the "analysed" column if it doesn't exist
-	err = applyConditionalMigrations(db)
+	err = applyConditionalMigrations(db, "migrations")
 	if err != nil {
 		log.Fatalf("Failed to apply migration: %v", err)
 	}
@@ -60,11 +77,33 @@ func main() {
 		&models.Button{},
 		&models.ConvAnalysis{},
 		&models.AuthUserConversation{},
+		&models.WhatsAppMessage{},
+		&models.MessageAttachment{},
+		&models.ReengagementNudge{},
+		&models.OTPChallenge{},
+		&models.AuthUserSession{},
+		&models.AuditEvent{},
+		&models.Escalation{},
+		&models.ConversationAssignment{},
+		&models.SLAAlert{},
+		&models.InboxEvent{},
+		&models.Tag{},
+		&models.ConversationTag{},
+		&models.ExportJob{},
+		&models.ConversationNote{},
+		&models.ConversationNoteRevision{},
+		&models.ConversationNoteMention{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Migrations on tables GORM creates, such as triggers and constraints, run once they exist
+	err = applyConditionalMigrations(db, "migrations/post")
+	if err != nil {
+		log.Fatalf("Failed to apply post-automigration migration: %v", err)
+	}
+
 	router := gin.Default()
 	if err := apidocs.RegisterRoutes(router, cfg.SwaggerUsername, cfg.SwaggerPassword); err != nil {
 		log.Fatalf("Failed to register API docs routes: %v", err)
@@ -72,54 +111,105 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Last-Event-ID"}
 	router.Use(cors.New(config))
 
-	v1 := router.Group("/v1")
+	// v1 is kept for old clients on top of the v2 session and conversation model.
+	v1 := router.Group("/v1", middleware.DeprecationMiddleware(v1DeprecatedAt, "/v2"))
 
-	authService := auth.NewAuthService()
+	slackService := slack.NewSlackService(cfg, db)
+	authService := auth.NewAuthService(db, slackService)
 	authGroup := v1.Group("/auth")
 	auth.RegisterAuthRoutes(authGroup, authService)
 
-	indian_travellers := indian_travellers.NewClient(cfg)
+	conversationService := conversation.NewConversationService(db)
 	chatGroup := v1.Group("/chat")
-	chatGroup.Use(middleware.AuthMiddleware())
-	routes.RegisterRoutes(chatGroup, indian_travellers)
+	chatGroup.Use(middleware.AuthMiddleware(db))
+	routes.RegisterRoutes(chatGroup, conversationService)
 
 	v2 := router.Group("/v2")
-	authServicev2 := auth.NewAuthV2Service(db)
+	authServicev2 := auth.NewAuthV2Service(db, slackService)
 	authGroupv2 := v2.Group("/auth")
 	auth.RegisterV2AuthRoutes(authGroupv2, authServicev2)
 
-	conversationService := conversation.NewConversationService(db)
 	notifClient := notification.NewClient(cfg.NotificationServiceURL)
 	jobService := notifications_job.NewJobService(notifClient, db)
-	slackService := slack.NewSlackService(cfg, db)
+	attachmentService := attachment.NewService(db, blobstore.New(cfg), cfg.AttachmentMaxBytes)
+	reengagementService := reengagement.NewReengagementService(db, reengagement.SettingsFromConfig(cfg), reengagement.LLMNudgeGenerator{}, notifClient, slackService)
 
 	chatGroupV2 := v2.Group("/chat")
 	chatGroupV2.Use(middleware.AuthSessionMiddleware(db))
-	routes.RegisterV2Routes(chatGroupV2, conversationService, jobService, slackService)
+	routes.RegisterV2Routes(chatGroupV2, conversationService, jobService, slackService, attachmentService, reengagementService)
+
+	whatsappSender := whatsapp.NewOutboundSender(cfg, notifClient)
+	whatsappService := whatsapp.NewWhatsAppService(cfg, db, conversationService, whatsappSender, attachmentService, reengagementService, slackService)
+	whatsappGroup := v2.Group("/whatsapp")
+	routes.RegisterWhatsAppRoutes(whatsappGroup, whatsappService)
 
 	conversationHistoryService := convHistory.NewConvHistoryService(db)
 	analyticsService := analytics.NewAnalyticsService(db)
 	us := userService.NewUserService(db)
 	authUserConversationService := authUserConversation.NewService(db)
-	tokenValidator, err := zitadel.NewService(context.Background(), zitadel.ZitadelConfig{AuthServiceBaseURL: cfg.AuthServiceBaseURL})
+	zitadelValidator, err := zitadel.NewService(context.Background(), zitadel.ZitadelConfig{AuthServiceBaseURL: cfg.AuthServiceBaseURL})
 	if err != nil {
 		log.Fatalf("Failed to initialize auth service token validator: %v", err)
 	}
+	zitadelTokens := zitadel.Tiered{Introspection: zitadel.NewCachingValidator(zitadelValidator, zitadel.CacheConfigFromConfig(cfg))}
+	if jwksConfig := zitadel.JWKSConfigFromConfig(cfg); jwksConfig.JWKSURL != "" {
+		jwksValidator, err := zitadel.NewJWKSValidator(jwksConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize JWKS token validator: %v", err)
+		}
+		zitadelTokens.JWT = jwksValidator
+	}
+	localAuth := local.NewService(db, local.SettingsFromConfig(cfg), slackService)
+	// Tokens from POST /v2/client/login are checked locally before falling back to Zitadel.
+	tokenValidator := zitadel.Chain{localAuth, zitadelTokens}
 
+	auditService := audit.NewService(db, audit.RetentionFromConfig(cfg), slackService)
+	authUsers := authUserService.NewService(db, authUserService.SettingsFromConfig(cfg), slackService)
 	humanService := human.NewHumanService(db)
+	conversationModes := conversationMode.NewService(db, conversationMode.SettingsFromConfig(cfg), slackService)
+	assignments := authUserConversation.NewEngine(db, authUserConversation.EngineSettingsFromConfig(cfg))
+	escalations := escalation.NewService(db, escalation.SettingsFromConfig(cfg), assignments, conversationModes, slackService)
+	sessions := sessionService.NewService(db, sessionService.PolicyFromConfig(cfg))
+	slaService := sla.NewService(db, sla.SettingsFromConfig(cfg), slackService)
+	tagService := tag.NewService(db, tag.LLMSuggester{})
+	noteService := note.NewService(db)
+	exportService := export.NewService(db, blobstore.New(cfg), export.SettingsFromConfig(cfg))
+	exportService.Start(context.Background())
+	inboxHub := inbox.NewHub(db, inbox.HubSettingsFromConfig(cfg))
+	if err := inboxHub.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start inbox hub: %v", err)
+	}
 
 	clientGroupV2 := v2.Group("/client")
-	routes.ClientRoutes(clientGroupV2, conversationHistoryService, analyticsService, us, humanService, jobService, slackService, authUserConversationService, tokenValidator)
+	routes.ClientRoutes(clientGroupV2, conversationHistoryService, analyticsService, us, humanService, jobService, slackService, authUserConversationService, attachmentService, reengagementService, sessions, localAuth, authUsers, auditService, conversationModes, escalations, assignments, slaService, inboxHub, tagService, exportService, noteService, tokenValidator)
 
 	// Start cron jobs
 	//cron_jobs.StartCronJobs(db)
 
 	c := cron.New()
-	if _, err := c.AddFunc("0 0 * * *", utils.PushConversationsToS3); err != nil {
-		log.Fatalf("Failed to schedule cron job: %v", err)
+	if _, err := c.AddFunc("*/15 * * * *", reengagementService.Run); err != nil {
+		log.Fatalf("Failed to schedule re-engagement job: %v", err)
+	}
+	if _, err := c.AddFunc("30 3 * * *", auditService.RunRetention); err != nil {
+		log.Fatalf("Failed to schedule audit retention job: %v", err)
+	}
+	if _, err := c.AddFunc("* * * * *", conversationModes.RunAutoReturn); err != nil {
+		log.Fatalf("Failed to schedule conversation mode auto-return job: %v", err)
+	}
+	if _, err := c.AddFunc("*/5 * * * *", slaService.RunAlerts); err != nil {
+		log.Fatalf("Failed to schedule SLA alert job: %v", err)
+	}
+	if _, err := c.AddFunc("15 * * * *", inboxHub.RunRetention); err != nil {
+		log.Fatalf("Failed to schedule inbox retention job: %v", err)
+	}
+	if _, err := c.AddFunc("45 * * * *", exportService.RunRetention); err != nil {
+		log.Fatalf("Failed to schedule export retention job: %v", err)
+	}
+	if _, err := c.AddFunc("*/5 * * * *", whatsappService.RetryPending); err != nil {
+		log.Fatalf("Failed to schedule WhatsApp retry job: %v", err)
 	}
 	c.Start()
 
@@ -128,13 +218,14 @@ func main() {
 	}
 }
 
-// applyConditionalMigrations finds all migration files in the migrations directory and applies them
-func applyConditionalMigrations(db *gorm.DB) error {
+// applyConditionalMigrations finds all migration files in dir, relative to the repository root,
+// and applies them in name order
+func applyConditionalMigrations(db *gorm.DB, dir string) error {
 
 	// Get the current file path and calculate the migrations directory path relative to the current file
 	_, currentFilePath, _, _ := runtime.Caller(0)
 	baseDir := filepath.Dir(currentFilePath)
-	migrationsDir := filepath.Join(baseDir, "../migrations")
+	migrationsDir := filepath.Join(baseDir, "..", dir)
 
 	// Open the migrations directory
 	files, err := os.ReadDir(migrationsDir)
@@ -0,0 +1,44 @@
+// Command migrate_v1 imports the legacy v1 conversations that are still in memcache into Postgres.
+//
+// Run it once after deploying the v1 adapters, which no longer write to memcache:
+//
+//	go run ./cmd/migrate_v1 -delete
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	legacyImport "smart-chat/internal/services/legacy_import"
+	"smart-chat/internal/store"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	deleteImported := flag.Bool("delete", false, "delete conversations from memcache once they are imported")
+	flag.Parse()
+
+	cfg := config.Load()
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=require TimeZone=Asia/Kolkata", cfg.DBHost, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBPort)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.User{}, &models.Session{}, &models.Conversation{}, &models.MessagePair{}); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	result, err := legacyImport.NewImporter(db, store.Memcache{}).Import(*deleteImported)
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	log.Printf("Imported %d v1 conversations (%d messages), skipped %d already imported, %d failed, %d deleted from memcache",
+		result.Imported, result.Messages, result.Skipped, result.Failed, result.Deleted)
+}
@@ -0,0 +1,55 @@
+// Command set_client_password sets the local-credentials password of an auth user, so the user can
+// sign in through POST /v2/client/login. The password is read from stdin so it stays out of the
+// shell history and process list:
+//
+//	read -rs PASSWORD && echo "$PASSWORD" | go run ./cmd/set_client_password -email agent@example.com
+//
+// Setting a password clears any lockout and signs the user out of existing local sessions.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"smart-chat/config"
+	"smart-chat/internal/authservice/local"
+	"smart-chat/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the auth user")
+	flag.Parse()
+	if strings.TrimSpace(*email) == "" {
+		log.Fatal("-email is required")
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalf("Failed to read password from stdin: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	cfg := config.Load()
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=require TimeZone=Asia/Kolkata", cfg.DBHost, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBPort)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.AuthUser{}, &models.AuthUserSession{}); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if err := local.NewService(db, local.SettingsFromConfig(cfg), nil).SetPassword(*email, password); err != nil {
+		log.Fatalf("Failed to set password for %s: %v", *email, err)
+	}
+	log.Printf("Password set for %s", *email)
+}
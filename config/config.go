@@ -1,57 +1,182 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/gin-gonic/gin"
 )
 
 type Config struct {
-	OpenAIKey              string
-	FAST2SMS_API_KEY       string
-	DBHost                 string
-	DBPort                 string
-	DBUser                 string
-	DBPassword             string
-	DBName                 string
-	Email                  string
-	EmailPassword          string
-	SecretToken            string
-	IndianTeavellersURL    string
-	NotificationServiceURL string
-	AuthServiceBaseURL     string
-	SlackNotificationURL   string
-	SlackAlertURL          string
-	SwaggerUsername        string
-	SwaggerPassword        string
+	OpenAIKey                   string
+	FAST2SMS_API_KEY            string
+	DBHost                      string
+	DBPort                      string
+	DBUser                      string
+	DBPassword                  string
+	DBName                      string
+	Email                       string
+	EmailPassword               string
+	SecretToken                 string
+	IndianTeavellersURL         string
+	NotificationServiceURL      string
+	AuthServiceBaseURL          string
+	SlackNotificationURL        string
+	SlackAlertURL               string
+	SwaggerUsername             string
+	SwaggerPassword             string
 	EnableLocalIndianTravellers bool
+	WhatsAppVerifyToken         string
+	WhatsAppAppSecret           string
+	WhatsAppAccessToken         string
+	WhatsAppPhoneNumberID       string
+	WhatsAppGraphBaseURL        string
+	WhatsAppOutboundSender      string
+	BlobStoreBackend            string
+	BlobStoreLocalDir           string
+	BlobStoreS3Bucket           string
+	AttachmentMaxBytes          int64
+	ReengagementEnabled         bool
+	ReengagementIdleHours       int
+	ReengagementMaxIdleHours    int
+	ReengagementQuietStartHour  int
+	ReengagementQuietEndHour    int
+	ReengagementMaxPerUser      int
+	ReengagementCapWindowHours  int
+	OTPProviders                string
+	OTPFast2SMSURL              string
+	OTPHTTPMethod               string
+	OTPHTTPURL                  string
+	OTPHTTPHeaders              string
+	OTPHTTPBodyTemplate         string
+	OTPWhatsAppTemplate         string
+	OTPWhatsAppLanguage         string
+	OTPFilePath                 string
+	OTPHashKey                  string
+	OTPExpiryMinutes            int
+	OTPMaxAttempts              int
+	OTPLockoutMinutes           int
+	OTPResendCooldownSeconds    int
+	OTPDailyLimit               int
+	OTPIPDailyLimit             int
+	TokenPeppers                string
+	SessionIdleMinutes          int
+	SessionRefreshDays          int
+	ClientSessionHours          int
+	ClientLoginMaxAttempts      int
+	ClientLoginLockoutMinutes   int
+	ZitadelJWKSURL              string
+	ZitadelIssuer               string
+	ZitadelAudience             string
+	JWKSRefreshMinutes          int
+	TokenClockSkewSeconds       int
+	TokenCacheSeconds           int
+	TokenNegativeCacheSeconds   int
+	AuthJITEnabled              bool
+	AuthDefaultRole             string
+	AuditRetentionDays          int
+	HumanModeTimeoutMinutes     int
+	HumanModeAckMessage         string
+	EscalationHandoffMessage    string
+	ClientAppBaseURL            string
+	AssignmentStrategy          string
+	AssignmentTriggers          string
+	AssignmentRules             string
+	AssignmentMaxOpenPerAgent   int
+	SLAPolicies                 string
+	SLAWarnPercent              int
+	InboxPollSeconds            int
+	InboxRetentionHours         int
+	ExportLinkKey               string
+	ExportLinkMinutes           int
+	ExportRetentionHours        int
+	ExportMaxConversations      int64
+	ExportPollSeconds           int
 }
 
 func Load() *Config {
 	config := &Config{
-		OpenAIKey:              "default-openai-key",
-		FAST2SMS_API_KEY:       "default-fast2sms-api-key",
-		DBHost:                 "localhost",
-		DBPort:                 "3306",
-		DBUser:                 "root",
-		DBPassword:             "password",
-		DBName:                 "smart_chat",
-		Email:                  "test@email.com",
-		EmailPassword:          "test_pwd",
-		SecretToken:            "secret_token",
-		IndianTeavellersURL:    "http://127.0.0.1:8000",
-		NotificationServiceURL: "http://127.0.0.1:8001",
-		AuthServiceBaseURL:     "http://127.0.0.1:8002",
-		SlackNotificationURL:   "https://hooks.slack.com/services/xx",
-		SlackAlertURL:          "https://hooks.slack.com/services/xx",
-		SwaggerUsername:        "swagger",
-		SwaggerPassword:        "swagger",
+		OpenAIKey:                   "default-openai-key",
+		FAST2SMS_API_KEY:            "default-fast2sms-api-key",
+		DBHost:                      "localhost",
+		DBPort:                      "3306",
+		DBUser:                      "root",
+		DBPassword:                  "password",
+		DBName:                      "smart_chat",
+		Email:                       "test@email.com",
+		EmailPassword:               "test_pwd",
+		SecretToken:                 "secret_token",
+		IndianTeavellersURL:         "http://127.0.0.1:8000",
+		NotificationServiceURL:      "http://127.0.0.1:8001",
+		AuthServiceBaseURL:          "http://127.0.0.1:8002",
+		SlackNotificationURL:        "https://hooks.slack.com/services/xx",
+		SlackAlertURL:               "https://hooks.slack.com/services/xx",
+		SwaggerUsername:             "swagger",
+		SwaggerPassword:             "swagger",
 		EnableLocalIndianTravellers: true,
+		WhatsAppVerifyToken:         "whatsapp_verify_token",
+		WhatsAppAppSecret:           "whatsapp_app_secret",
+		WhatsAppAccessToken:         "whatsapp_access_token",
+		WhatsAppPhoneNumberID:       "000000000000000",
+		WhatsAppGraphBaseURL:        "https://graph.facebook.com/v19.0",
+		WhatsAppOutboundSender:      "notification",
+		BlobStoreBackend:            "local",
+		BlobStoreLocalDir:           "data/blobs",
+		BlobStoreS3Bucket:           "smart-chat-attachments",
+		AttachmentMaxBytes:          16 << 20,
+		ReengagementEnabled:         false,
+		ReengagementIdleHours:       4,
+		ReengagementMaxIdleHours:    23,
+		ReengagementQuietStartHour:  21,
+		ReengagementQuietEndHour:    9,
+		ReengagementMaxPerUser:      2,
+		ReengagementCapWindowHours:  168,
+		OTPProviders:                "fast2sms",
+		OTPFast2SMSURL:              "https://www.fast2sms.com/dev/bulkV2",
+		OTPHTTPMethod:               "POST",
+		OTPWhatsAppLanguage:         "en",
+		OTPFilePath:                 "data/otp.log",
+		OTPExpiryMinutes:            5,
+		OTPMaxAttempts:              5,
+		OTPLockoutMinutes:           30,
+		OTPResendCooldownSeconds:    60,
+		OTPDailyLimit:               10,
+		OTPIPDailyLimit:             50,
+		TokenPeppers:                "default:default_token_pepper",
+		SessionIdleMinutes:          60,
+		SessionRefreshDays:          30,
+		ClientSessionHours:          12,
+		ClientLoginMaxAttempts:      5,
+		ClientLoginLockoutMinutes:   15,
+		JWKSRefreshMinutes:          60,
+		TokenClockSkewSeconds:       60,
+		TokenCacheSeconds:           30,
+		TokenNegativeCacheSeconds:   5,
+		AuthJITEnabled:              false,
+		AuthDefaultRole:             "AGENT",
+		AuditRetentionDays:          365,
+		HumanModeTimeoutMinutes:     120,
+		HumanModeAckMessage:         "Thanks for your message. An executive will reply shortly.",
+		EscalationHandoffMessage:    "I'm connecting you with one of our travel executives. They will reply here shortly.",
+		ClientAppBaseURL:            "http://localhost:3000",
+		AssignmentStrategy:          "least_open",
+		AssignmentTriggers:          "escalation,lead",
+		AssignmentMaxOpenPerAgent:   20,
+		SLAPolicies:                 `[{"first_response_minutes":15,"resolution_minutes":1440}]`,
+		SLAWarnPercent:              80,
+		InboxPollSeconds:            2,
+		InboxRetentionHours:         24,
+		ExportLinkKey:               "default_export_link_key",
+		ExportLinkMinutes:           60,
+		ExportRetentionHours:        72,
+		ExportMaxConversations:      50000,
+		ExportPollSeconds:           30,
 	}
 	if os.Getenv("SMART_CHAT_ENV") == "prod" {
 		gin.SetMode(gin.ReleaseMode)
@@ -77,6 +202,24 @@ func Load() *Config {
 			return *param.Parameter.Value
 		}
 
+		// getOptionalParameter is for parameters that may be left out to turn a feature off,
+		// since SSM cannot store an empty string.
+		getOptionalParameter := func(name string) string {
+			withDecryption := true
+			param, err := ssmSvc.GetParameter(&ssm.GetParameterInput{
+				Name:           &name,
+				WithDecryption: &withDecryption,
+			})
+			var awsErr awserr.Error
+			if errors.As(err, &awsErr) && awsErr.Code() == ssm.ErrCodeParameterNotFound {
+				return ""
+			}
+			if err != nil {
+				log.Fatalf("Failed to get parameter: %v", err)
+			}
+			return *param.Parameter.Value
+		}
+
 		config.OpenAIKey = getParameter("OpenAIKey")
 		config.FAST2SMS_API_KEY = getParameter("FAST2SMS_API_KEY")
 		config.DBHost = getParameter("SmartChatDBHost")
@@ -102,27 +245,136 @@ func Load() *Config {
 			enableLocal = true
 		}
 		config.EnableLocalIndianTravellers = enableLocal
+		config.WhatsAppVerifyToken = getParameter("WHATSAPP_VERIFY_TOKEN")
+		config.WhatsAppAppSecret = getParameter("WHATSAPP_APP_SECRET")
+		config.WhatsAppAccessToken = getParameter("WHATSAPP_ACCESS_TOKEN")
+		config.WhatsAppPhoneNumberID = getParameter("WHATSAPP_PHONE_NUMBER_ID")
+		config.WhatsAppGraphBaseURL = getParameter("WHATSAPP_GRAPH_BASE_URL")
+		config.WhatsAppOutboundSender = getParameter("WHATSAPP_OUTBOUND_SENDER")
+		config.BlobStoreBackend = getParameter("BLOB_STORE_BACKEND")
+		config.BlobStoreS3Bucket = getParameter("BLOB_STORE_S3_BUCKET")
+
+		maxBytesStr := getParameter("ATTACHMENT_MAX_BYTES")
+		maxBytes, err := strconv.ParseInt(maxBytesStr, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			log.Printf("Invalid ATTACHMENT_MAX_BYTES value %q in SSM, defaulting to %d", maxBytesStr, config.AttachmentMaxBytes)
+		} else {
+			config.AttachmentMaxBytes = maxBytes
+		}
+
+		reengagementStr := getParameter("REENGAGEMENT_ENABLED")
+		reengagementEnabled, err := strconv.ParseBool(reengagementStr)
+		if err != nil {
+			log.Printf("Invalid REENGAGEMENT_ENABLED value %q in SSM, defaulting to false", reengagementStr)
+			reengagementEnabled = false
+		}
+		config.ReengagementEnabled = reengagementEnabled
+		config.OTPProviders = getParameter("OTP_PROVIDERS")
+		config.OTPHTTPURL = getOptionalParameter("OTP_HTTP_URL")
+		config.OTPHTTPHeaders = getOptionalParameter("OTP_HTTP_HEADERS")
+		config.OTPHTTPBodyTemplate = getOptionalParameter("OTP_HTTP_BODY_TEMPLATE")
+		config.OTPWhatsAppTemplate = getOptionalParameter("OTP_WHATSAPP_TEMPLATE")
+		config.OTPHashKey = getParameter("OTP_HASH_KEY")
+		config.TokenPeppers = getParameter("TOKEN_PEPPERS")
+		config.ExportLinkKey = getParameter("EXPORT_LINK_KEY")
+		config.ZitadelJWKSURL = getOptionalParameter("ZITADEL_JWKS_URL")
+		config.ZitadelIssuer = getOptionalParameter("ZITADEL_ISSUER")
+		config.ZitadelAudience = getOptionalParameter("ZITADEL_AUDIENCE")
+		config.AuthDefaultRole = getParameter("AUTH_DEFAULT_ROLE")
+		config.HumanModeAckMessage = getOptionalParameter("HUMAN_MODE_ACK_MESSAGE")
+		config.EscalationHandoffMessage = getParameter("ESCALATION_HANDOFF_MESSAGE")
+		config.ClientAppBaseURL = getParameter("CLIENT_APP_BASE_URL")
+		config.AssignmentStrategy = getParameter("ASSIGNMENT_STRATEGY")
+		config.AssignmentTriggers = getParameter("ASSIGNMENT_TRIGGERS")
+		config.AssignmentRules = getOptionalParameter("ASSIGNMENT_RULES")
+		config.SLAPolicies = getOptionalParameter("SLA_POLICIES")
+
+		authJITStr := getParameter("AUTH_JIT_ENABLED")
+		authJITEnabled, err := strconv.ParseBool(authJITStr)
+		if err != nil {
+			log.Printf("Invalid AUTH_JIT_ENABLED value %q in SSM, defaulting to false", authJITStr)
+			authJITEnabled = false
+		}
+		config.AuthJITEnabled = authJITEnabled
 	} else {
 		gin.SetMode(gin.DebugMode)
 		return &Config{
-			OpenAIKey:              "sk-xxxxx",
-			FAST2SMS_API_KEY:       "xxxxxxx",
-			DBHost:                 "localhost",
-			DBPort:                 "5432",
-			DBUser:                 "postgres",
-			DBPassword:             "somepass",
-			DBName:                 "smart_chat",
-			Email:                  "test@test.com",
-			EmailPassword:          "xxxxxxxxxx",
-			SecretToken:            "secret_token",
-			IndianTeavellersURL:    "http://127.0.0.1:8000",
-			NotificationServiceURL: "http://127.0.0.1:8001",
-			AuthServiceBaseURL:     "http://127.0.0.1:8002",
-			SlackNotificationURL:   "https://hooks.slack.com/services/xx",
-			SlackAlertURL:          "https://hooks.slack.com/services/xx",
-			SwaggerUsername:        "swagger",
-			SwaggerPassword:        "swagger",
+			OpenAIKey:                   "sk-xxxxx",
+			FAST2SMS_API_KEY:            "xxxxxxx",
+			DBHost:                      "localhost",
+			DBPort:                      "5432",
+			DBUser:                      "postgres",
+			DBPassword:                  "somepass",
+			DBName:                      "smart_chat",
+			Email:                       "test@test.com",
+			EmailPassword:               "xxxxxxxxxx",
+			SecretToken:                 "secret_token",
+			IndianTeavellersURL:         "http://127.0.0.1:8000",
+			NotificationServiceURL:      "http://127.0.0.1:8001",
+			AuthServiceBaseURL:          "http://127.0.0.1:8002",
+			SlackNotificationURL:        "https://hooks.slack.com/services/xx",
+			SlackAlertURL:               "https://hooks.slack.com/services/xx",
+			SwaggerUsername:             "swagger",
+			SwaggerPassword:             "swagger",
 			EnableLocalIndianTravellers: true,
+			WhatsAppVerifyToken:         "whatsapp_verify_token",
+			WhatsAppAppSecret:           "whatsapp_app_secret",
+			WhatsAppAccessToken:         "xxxxxxx",
+			WhatsAppPhoneNumberID:       "000000000000000",
+			WhatsAppGraphBaseURL:        "http://127.0.0.1:8003",
+			WhatsAppOutboundSender:      "notification",
+			BlobStoreBackend:            "local",
+			BlobStoreLocalDir:           "data/blobs",
+			BlobStoreS3Bucket:           "smart-chat-attachments-dev",
+			AttachmentMaxBytes:          16 << 20,
+			ReengagementEnabled:         false,
+			ReengagementIdleHours:       4,
+			ReengagementMaxIdleHours:    23,
+			ReengagementQuietStartHour:  21,
+			ReengagementQuietEndHour:    9,
+			ReengagementMaxPerUser:      2,
+			ReengagementCapWindowHours:  168,
+			OTPProviders:                "console",
+			OTPFast2SMSURL:              "https://www.fast2sms.com/dev/bulkV2",
+			OTPHTTPMethod:               "POST",
+			OTPWhatsAppLanguage:         "en",
+			OTPFilePath:                 "data/otp.log",
+			OTPHashKey:                  "local_otp_hash_key",
+			OTPExpiryMinutes:            5,
+			OTPMaxAttempts:              5,
+			OTPLockoutMinutes:           30,
+			OTPResendCooldownSeconds:    60,
+			OTPDailyLimit:               10,
+			OTPIPDailyLimit:             50,
+			TokenPeppers:                "local:local_token_pepper",
+			SessionIdleMinutes:          60,
+			SessionRefreshDays:          30,
+			ClientSessionHours:          12,
+			ClientLoginMaxAttempts:      5,
+			ClientLoginLockoutMinutes:   15,
+			JWKSRefreshMinutes:          60,
+			TokenClockSkewSeconds:       60,
+			TokenCacheSeconds:           30,
+			TokenNegativeCacheSeconds:   5,
+			AuthJITEnabled:              true,
+			AuthDefaultRole:             "AGENT",
+			AuditRetentionDays:          365,
+			HumanModeTimeoutMinutes:     120,
+			HumanModeAckMessage:         "Thanks for your message. An executive will reply shortly.",
+			EscalationHandoffMessage:    "I'm connecting you with one of our travel executives. They will reply here shortly.",
+			ClientAppBaseURL:            "http://localhost:3000",
+			AssignmentStrategy:          "round_robin",
+			AssignmentTriggers:          "start,escalation,lead",
+			AssignmentMaxOpenPerAgent:   5,
+			SLAPolicies:                 `[{"source":"whatsapp","first_response_minutes":10,"resolution_minutes":480},{"first_response_minutes":15,"resolution_minutes":1440}]`,
+			SLAWarnPercent:              80,
+			InboxPollSeconds:            1,
+			InboxRetentionHours:         24,
+			ExportLinkKey:               "local_export_link_key",
+			ExportLinkMinutes:           60,
+			ExportRetentionHours:        72,
+			ExportMaxConversations:      50000,
+			ExportPollSeconds:           5,
 		}
 	}
 
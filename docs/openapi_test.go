@@ -33,8 +33,9 @@ func TestOpenAPISpecCoversRegisteredRoutes(t *testing.T) {
 
 	v2 := router.Group("/v2")
 	auth.RegisterV2AuthRoutes(v2.Group("/auth"), nil)
-	routes.RegisterV2Routes(v2.Group("/chat"), nil, nil, nil)
-	routes.ClientRoutes(v2.Group("/client"), nil, nil, nil, nil, nil, nil, nil, nil)
+	routes.RegisterV2Routes(v2.Group("/chat"), nil, nil, nil, nil, nil)
+	routes.RegisterWhatsAppRoutes(v2.Group("/whatsapp"), nil)
+	routes.ClientRoutes(v2.Group("/client"), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 
 	var document openAPIDocument
 	if err := yaml.Unmarshal(Spec(), &document); err != nil {
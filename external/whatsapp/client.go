@@ -0,0 +1,171 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxResponseBodyBytes = 1 << 20 // 1 MiB
+
+// Client sends messages through the WhatsApp Cloud API (Meta Graph API).
+type Client struct {
+	baseURL       string
+	phoneNumberID string
+	accessToken   string
+	client        *http.Client
+}
+
+// NewClient returns a Graph API client for the given business phone number.
+// baseURL includes the API version, e.g. https://graph.facebook.com/v19.0.
+func NewClient(baseURL, phoneNumberID, accessToken string) *Client {
+	return &Client{
+		baseURL:       strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		phoneNumberID: strings.TrimSpace(phoneNumberID),
+		accessToken:   strings.TrimSpace(accessToken),
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SendTextMessage sends a plain text message to the given wa_id and returns the message ID assigned by Meta.
+func (c *Client) SendTextMessage(to, body string) (string, error) {
+	if strings.TrimSpace(to) == "" {
+		return "", errors.New("recipient is required")
+	}
+
+	payload := SendMessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "text",
+		Text:             &SendText{Body: body},
+	}
+
+	return c.sendMessage(context.Background(), payload)
+}
+
+// SendTemplateMessage sends a pre-approved template message to the given wa_id and returns the message ID.
+func (c *Client) SendTemplateMessage(ctx context.Context, to string, template SendTemplate) (string, error) {
+	if strings.TrimSpace(to) == "" {
+		return "", errors.New("recipient is required")
+	}
+
+	payload := SendMessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "template",
+		Template:         &template,
+	}
+
+	return c.sendMessage(ctx, payload)
+}
+
+// GetMedia looks up the download URL and metadata of an inbound media object.
+func (c *Client) GetMedia(mediaID string) (*MediaInfo, error) {
+	if strings.TrimSpace(mediaID) == "" {
+		return nil, errors.New("media id is required")
+	}
+
+	resp, err := c.get(fmt.Sprintf("%s/%s", c.baseURL, mediaID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph api response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("graph api returned status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var info MediaInfo
+	if err := json.Unmarshal(respBody, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode media info: %w", err)
+	}
+	if info.URL == "" {
+		return nil, errors.New("graph api response did not include a media url")
+	}
+	return &info, nil
+}
+
+// DownloadMedia streams the content of an inbound media object and returns its MIME type.
+// The caller must close the returned reader.
+func (c *Client) DownloadMedia(mediaID string) (io.ReadCloser, string, error) {
+	info, err := c.GetMedia(mediaID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := c.get(info.URL)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("media download returned status %s", resp.Status)
+	}
+	return resp.Body, info.MimeType, nil
+}
+
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call graph api: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *Client) sendMessage(ctx context.Context, payload SendMessageRequest) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal message payload: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/%s/messages", c.baseURL, c.phoneNumberID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call graph api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read graph api response: %w", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", fmt.Errorf("graph api returned status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var result SendMessageResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to decode graph api response: %w", err)
+	}
+	if len(result.Messages) == 0 {
+		return "", errors.New("graph api response did not include a message id")
+	}
+
+	return result.Messages[0].ID, nil
+}
@@ -0,0 +1,170 @@
+package whatsapp
+
+// WebhookPayload is the envelope Meta posts to the webhook for every change notification.
+type WebhookPayload struct {
+	Object string  `json:"object"`
+	Entry  []Entry `json:"entry"`
+}
+
+// Entry groups the changes for a single WhatsApp Business Account.
+type Entry struct {
+	ID      string   `json:"id"`
+	Changes []Change `json:"changes"`
+}
+
+// Change carries the actual messages or delivery statuses for a phone number.
+type Change struct {
+	Field string `json:"field"`
+	Value Value  `json:"value"`
+}
+
+// Value holds the contacts, messages and statuses included in a change.
+type Value struct {
+	MessagingProduct string    `json:"messaging_product"`
+	Metadata         Metadata  `json:"metadata"`
+	Contacts         []Contact `json:"contacts"`
+	Messages         []Message `json:"messages"`
+	Statuses         []Status  `json:"statuses"`
+}
+
+// Metadata identifies the business phone number that received the change.
+type Metadata struct {
+	DisplayPhoneNumber string `json:"display_phone_number"`
+	PhoneNumberID      string `json:"phone_number_id"`
+}
+
+// Contact is the sender profile attached to inbound messages.
+type Contact struct {
+	WaID    string  `json:"wa_id"`
+	Profile Profile `json:"profile"`
+}
+
+// Profile contains the sender's WhatsApp display name.
+type Profile struct {
+	Name string `json:"name"`
+}
+
+// Message is a single inbound message. Only the field matching Type is populated.
+type Message struct {
+	ID          string              `json:"id"`
+	From        string              `json:"from"`
+	Timestamp   string              `json:"timestamp"`
+	Type        string              `json:"type"`
+	Text        *TextBody           `json:"text,omitempty"`
+	Button      *ButtonReply        `json:"button,omitempty"`
+	Interactive *InteractiveMessage `json:"interactive,omitempty"`
+	Image       *Media              `json:"image,omitempty"`
+	Audio       *Media              `json:"audio,omitempty"`
+	Video       *Media              `json:"video,omitempty"`
+	Document    *Media              `json:"document,omitempty"`
+	Sticker     *Media              `json:"sticker,omitempty"`
+	Location    *Location           `json:"location,omitempty"`
+}
+
+// TextBody is the payload of a text message.
+type TextBody struct {
+	Body string `json:"body"`
+}
+
+// Media references an uploaded file. The content is fetched separately with the media ID.
+type Media struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Voice    bool   `json:"voice,omitempty"`
+}
+
+// Location is a shared location pin.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// ButtonReply is sent when the user taps a template quick-reply button.
+type ButtonReply struct {
+	Text    string `json:"text"`
+	Payload string `json:"payload"`
+}
+
+// InteractiveMessage is sent when the user answers an interactive button or list message.
+type InteractiveMessage struct {
+	Type        string            `json:"type"`
+	ButtonReply *InteractiveReply `json:"button_reply,omitempty"`
+	ListReply   *InteractiveReply `json:"list_reply,omitempty"`
+}
+
+// InteractiveReply identifies the option chosen in an interactive message.
+type InteractiveReply struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Status is a delivery status update for a message we sent.
+type Status struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Timestamp   string `json:"timestamp"`
+	RecipientID string `json:"recipient_id"`
+}
+
+// SendMessageRequest is the body of POST /{phone-number-id}/messages.
+type SendMessageRequest struct {
+	MessagingProduct string        `json:"messaging_product"`
+	RecipientType    string        `json:"recipient_type"`
+	To               string        `json:"to"`
+	Type             string        `json:"type"`
+	Text             *SendText     `json:"text,omitempty"`
+	Template         *SendTemplate `json:"template,omitempty"`
+}
+
+// MediaInfo is returned by GET /{media-id}. URL is short-lived and requires the access token.
+type MediaInfo struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+	FileSize int64  `json:"file_size"`
+}
+
+// SendText is the text part of an outbound message.
+type SendText struct {
+	PreviewURL bool   `json:"preview_url"`
+	Body       string `json:"body"`
+}
+
+// SendTemplate is the template part of an outbound message. Templates must be approved in
+// WhatsApp Manager before they can be sent.
+type SendTemplate struct {
+	Name       string              `json:"name"`
+	Language   TemplateLanguage    `json:"language"`
+	Components []TemplateComponent `json:"components,omitempty"`
+}
+
+type TemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+// TemplateComponent fills the variables of one part (body, button, ...) of a template.
+type TemplateComponent struct {
+	Type       string              `json:"type"`
+	SubType    string              `json:"sub_type,omitempty"`
+	Index      string              `json:"index,omitempty"`
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+}
+
+type TemplateParameter struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SendMessageResponse is returned by the Graph API for an accepted message.
+type SendMessageResponse struct {
+	MessagingProduct string `json:"messaging_product"`
+	Messages         []struct {
+		ID string `json:"id"`
+	} `json:"messages"`
+}
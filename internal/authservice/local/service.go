@@ -0,0 +1,268 @@
+// Package local signs agents and admins in with a password stored on their auth_users row, as an
+// alternative to Zitadel. Its tokens are validated through the same zitadel.TokenValidator
+// interface as Zitadel tokens, so client routes accept either.
+package local
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/slack"
+	"smart-chat/internal/tokenhash"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MinPasswordLength is the shortest password SetPassword accepts.
+const MinPasswordLength = 12
+
+var (
+	// ErrInvalidCredentials is returned for an unknown user, a wrong password and a locked
+	// account alike, so the response does not reveal which accounts exist.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid access token")
+	ErrPasswordTooShort   = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+// dummyHash is compared against when the user does not exist, so unknown usernames take as long
+// to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("smart-chat-dummy-password"), bcrypt.DefaultCost)
+
+// Settings bounds client sessions and failed logins.
+type Settings struct {
+	SessionTTL  time.Duration
+	MaxAttempts int
+	Lockout     time.Duration
+}
+
+// DefaultSettings is used for any zero field of Settings.
+var DefaultSettings = Settings{
+	SessionTTL:  12 * time.Hour,
+	MaxAttempts: 5,
+	Lockout:     15 * time.Minute,
+}
+
+// SettingsFromConfig builds Settings from the application config.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	return Settings{
+		SessionTTL:  time.Duration(cfg.ClientSessionHours) * time.Hour,
+		MaxAttempts: cfg.ClientLoginMaxAttempts,
+		Lockout:     time.Duration(cfg.ClientLoginLockoutMinutes) * time.Minute,
+	}
+}
+
+// LoginResult is returned to the client once; only the token hash is stored.
+type LoginResult struct {
+	AuthToken string    `json:"authToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Service logs auth users in with their password and validates the tokens it issued.
+type Service struct {
+	db       *gorm.DB
+	settings Settings
+	tokens   *tokenhash.Hasher
+	slack    *slack.SlackService
+}
+
+// NewService returns a Service. slackService may be nil, in which case lockouts are only logged.
+func NewService(db *gorm.DB, settings Settings, slackService *slack.SlackService) *Service {
+	if settings.SessionTTL <= 0 {
+		settings.SessionTTL = DefaultSettings.SessionTTL
+	}
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = DefaultSettings.MaxAttempts
+	}
+	if settings.Lockout <= 0 {
+		settings.Lockout = DefaultSettings.Lockout
+	}
+	return &Service{db: db, settings: settings, tokens: tokenhash.Default(), slack: slackService}
+}
+
+// Login checks the password of the auth user whose email is username and issues a session token.
+// After MaxAttempts consecutive failures the account is locked for Lockout.
+func (s *Service) Login(username, password, ip string) (LoginResult, error) {
+	var user models.AuthUser
+	err := s.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(username))).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.PasswordHash == nil) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return LoginResult{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	now := time.Now()
+	if user.DisabledAt != nil {
+		return LoginResult{}, ErrInvalidCredentials
+	}
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(password)) != nil {
+		if err := s.recordFailure(user, ip, now); err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return LoginResult{}, err
+	}
+	result := LoginResult{AuthToken: token, ExpiresAt: now.Add(s.settings.SessionTTL)}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.AuthUser{}).Where("user_id = ?", user.UserID).UpdateColumns(map[string]any{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+			"last_login_at":         now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuthUserSession{
+			AuthUserID: user.UserID,
+			Token:      s.tokens.Hash(token),
+			IPAddress:  ip,
+			ExpiresAt:  result.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return result, nil
+}
+
+// recordFailure counts a wrong password and locks the account once the count reaches MaxAttempts.
+func (s *Service) recordFailure(user models.AuthUser, ip string, now time.Time) error {
+	if err := s.db.Model(&models.AuthUser{}).Where("user_id = ?", user.UserID).
+		UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error; err != nil {
+		return err
+	}
+	var attempts int
+	if err := s.db.Model(&models.AuthUser{}).Where("user_id = ?", user.UserID).
+		Pluck("failed_login_attempts", &attempts).Error; err != nil {
+		return err
+	}
+	if attempts < s.settings.MaxAttempts {
+		return nil
+	}
+
+	if err := s.db.Model(&models.AuthUser{}).Where("user_id = ?", user.UserID).UpdateColumns(map[string]any{
+		"failed_login_attempts": 0,
+		"locked_until":          now.Add(s.settings.Lockout),
+	}).Error; err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Client login lockout: auth user %d locked for %s after %d failed passwords (last attempt from IP %s)",
+		user.UserID, s.settings.Lockout, attempts, ip)
+	log.Print(message)
+	if s.slack != nil {
+		s.slack.SendSlackAlertAsync(message)
+	}
+	return nil
+}
+
+// ValidateToken implements zitadel.TokenValidator for tokens issued by Login. The returned ID is
+// the auth user's zitadel_user_id, which is how client handlers look up the caller.
+func (s *Service) ValidateToken(_ context.Context, rawToken string) (*zitadel.ValidateTokenUser, error) {
+	rawToken = strings.TrimSpace(rawToken)
+	if rawToken == "" {
+		return nil, ErrInvalidToken
+	}
+	var session models.AuthUserSession
+	err := s.tokens.Where(s.db, "token", rawToken).
+		Where("revoked_at IS NULL AND expires_at > ?", time.Now()).
+		Preload("AuthUser").
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var role models.AuthRole
+	var roleName *string
+	if err := s.db.First(&role, session.AuthUser.RoleID).Error; err == nil {
+		roleName = &role.Name
+	}
+	return &zitadel.ValidateTokenUser{
+		ID:    &session.AuthUser.ZitadelUserID,
+		Name:  session.AuthUser.Name,
+		Email: session.AuthUser.Email,
+		Role:  roleName,
+	}, nil
+}
+
+// Logout revokes the session of a token issued by Login.
+func (s *Service) Logout(rawToken string) error {
+	if strings.TrimSpace(rawToken) == "" {
+		return ErrInvalidToken
+	}
+	result := s.tokens.Where(s.db.Model(&models.AuthUserSession{}), "token", rawToken).
+		Where("revoked_at IS NULL").
+		UpdateColumn("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// SetPassword stores a new password for the auth user with this email, clears any lockout and
+// revokes the user's existing local sessions.
+func (s *Service) SetPassword(email, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.AuthUser
+		if err := tx.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).UpdateColumns(map[string]any{
+			"password_hash":         hash,
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.AuthUserSession{}).
+			Where("auth_user_id = ? AND revoked_at IS NULL", user.UserID).
+			UpdateColumn("revoked_at", time.Now()).Error
+	})
+}
+
+// HashPassword returns the bcrypt hash stored in auth_users.password_hash.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
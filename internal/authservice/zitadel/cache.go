@@ -0,0 +1,161 @@
+package zitadel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"smart-chat/config"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig configures a CachingValidator.
+type CacheConfig struct {
+	// TTL is how long a successful validation is reused.
+	TTL time.Duration
+	// NegativeTTL is how long a rejection (ErrTokenRejected) is reused. Transport errors are never cached.
+	NegativeTTL time.Duration
+	// MaxEntries bounds the cache; it is cleared of expired entries, then emptied, when full.
+	MaxEntries int
+}
+
+var DefaultCacheConfig = CacheConfig{
+	TTL:         30 * time.Second,
+	NegativeTTL: 5 * time.Second,
+	MaxEntries:  10000,
+}
+
+// CacheConfigFromConfig builds a CacheConfig from the application config.
+func CacheConfigFromConfig(cfg *config.Config) CacheConfig {
+	return CacheConfig{
+		TTL:         time.Duration(cfg.TokenCacheSeconds) * time.Second,
+		NegativeTTL: time.Duration(cfg.TokenNegativeCacheSeconds) * time.Second,
+	}
+}
+
+type cacheEntry struct {
+	user      *ValidateTokenUser
+	err       error
+	expiresAt time.Time
+}
+
+// CachingValidator wraps a remote validator, such as introspection against the auth service,
+// with a short-lived result cache. Concurrent validations of the same token share one call.
+// Entries are keyed by a SHA-256 of the token so raw tokens are not held in memory.
+type CachingValidator struct {
+	next TokenValidator
+	cfg  CacheConfig
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	group   singleflight.Group
+}
+
+func NewCachingValidator(next TokenValidator, cfg CacheConfig) *CachingValidator {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheConfig.TTL
+	}
+	if cfg.NegativeTTL < 0 {
+		cfg.NegativeTTL = 0
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultCacheConfig.MaxEntries
+	}
+	return &CachingValidator{
+		next:    next,
+		cfg:     cfg,
+		now:     time.Now,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+func (v *CachingValidator) ValidateToken(ctx context.Context, rawToken string) (*ValidateTokenUser, error) {
+	sum := sha256.Sum256([]byte(rawToken))
+	key := hex.EncodeToString(sum[:])
+
+	if entry, ok := v.lookup(key); ok {
+		return copyUser(entry.user), entry.err
+	}
+
+	result, err, _ := v.group.Do(key, func() (any, error) {
+		// The shared call must not be cut short because the first caller went away.
+		user, err := v.next.ValidateToken(context.WithoutCancel(ctx), rawToken)
+		v.store(key, user, err)
+		return user, err
+	})
+	user, _ := result.(*ValidateTokenUser)
+	return copyUser(user), err
+}
+
+func (v *CachingValidator) lookup(key string) (cacheEntry, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	entry, ok := v.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	if !v.now().Before(entry.expiresAt) {
+		delete(v.entries, key)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (v *CachingValidator) store(key string, user *ValidateTokenUser, err error) {
+	ttl := v.cfg.TTL
+	if err != nil || user == nil {
+		if !errors.Is(err, ErrTokenRejected) || v.cfg.NegativeTTL == 0 {
+			return
+		}
+		ttl = v.cfg.NegativeTTL
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	if len(v.entries) >= v.cfg.MaxEntries {
+		for k, entry := range v.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(v.entries, k)
+			}
+		}
+		if len(v.entries) >= v.cfg.MaxEntries {
+			v.entries = map[string]cacheEntry{}
+		}
+	}
+	v.entries[key] = cacheEntry{user: user, err: err, expiresAt: now.Add(ttl)}
+}
+
+func copyUser(user *ValidateTokenUser) *ValidateTokenUser {
+	if user == nil {
+		return nil
+	}
+	clone := *user
+	return &clone
+}
+
+// Tiered verifies JWT access tokens offline and sends everything else to introspection.
+// A JWT is only introspected when its signing keys cannot be fetched at all; a JWT that fails
+// verification is rejected without a remote call.
+type Tiered struct {
+	JWT           TokenValidator
+	Introspection TokenValidator
+}
+
+func (t Tiered) ValidateToken(ctx context.Context, rawToken string) (*ValidateTokenUser, error) {
+	if t.JWT != nil && LooksLikeJWT(rawToken) {
+		user, err := t.JWT.ValidateToken(ctx, rawToken)
+		if err == nil || !errors.Is(err, ErrKeysUnavailable) || t.Introspection == nil {
+			return user, err
+		}
+	}
+	if t.Introspection == nil {
+		return nil, errors.New("no token validator configured")
+	}
+	return t.Introspection.ValidateToken(ctx, rawToken)
+}
@@ -0,0 +1,445 @@
+package zitadel
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/rbac"
+
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrMalformedToken    = errors.New("malformed jwt")
+	ErrInvalidSignature  = errors.New("invalid token signature")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrTokenNotYetValid  = errors.New("token not yet valid")
+	ErrInvalidIssuer     = errors.New("invalid token issuer")
+	ErrInvalidAudience   = errors.New("invalid token audience")
+	ErrUnknownSigningKey = errors.New("unknown token signing key")
+	// ErrKeysUnavailable means the JWKS could not be fetched and no keys are cached, so the token
+	// could not be checked either way.
+	ErrKeysUnavailable = errors.New("signing keys unavailable")
+)
+
+// JWKSConfig configures offline JWT verification.
+type JWKSConfig struct {
+	JWKSURL string
+	Issuer  string
+	// Audience, when set, must appear in the token's aud claim.
+	Audience string
+	// ClockSkew is tolerated on exp, nbf and iat.
+	ClockSkew time.Duration
+	// RefreshInterval is how long fetched keys are used before the JWKS is fetched again.
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetches triggered by tokens signed with an unknown key id.
+	MinRefreshInterval time.Duration
+}
+
+// DefaultJWKSConfig holds the defaults for zero durations of a JWKSConfig.
+var DefaultJWKSConfig = JWKSConfig{
+	ClockSkew:          time.Minute,
+	RefreshInterval:    time.Hour,
+	MinRefreshInterval: 30 * time.Second,
+}
+
+// JWKSConfigFromConfig builds a JWKSConfig from the application config. An empty JWKSURL
+// means offline verification is not configured.
+func JWKSConfigFromConfig(cfg *config.Config) JWKSConfig {
+	return JWKSConfig{
+		JWKSURL:         strings.TrimSpace(cfg.ZitadelJWKSURL),
+		Issuer:          strings.TrimSpace(cfg.ZitadelIssuer),
+		Audience:        strings.TrimSpace(cfg.ZitadelAudience),
+		ClockSkew:       time.Duration(cfg.TokenClockSkewSeconds) * time.Second,
+		RefreshInterval: time.Duration(cfg.JWKSRefreshMinutes) * time.Minute,
+	}
+}
+
+// JWKSValidator verifies JWT access tokens against the issuer's published keys without calling
+// the auth service per request. Keys are cached and refetched when they age out or when a token
+// names a key id that is not cached yet, which is how signing key rotation shows up.
+type JWKSValidator struct {
+	client *resty.Client
+	cfg    JWKSConfig
+	now    func() time.Time
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	group       singleflight.Group
+}
+
+func NewJWKSValidator(cfg JWKSConfig) (*JWKSValidator, error) {
+	if strings.TrimSpace(cfg.JWKSURL) == "" {
+		return nil, errors.New("jwks url is required")
+	}
+	if strings.TrimSpace(cfg.Issuer) == "" {
+		return nil, errors.New("token issuer is required")
+	}
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = DefaultJWKSConfig.ClockSkew
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultJWKSConfig.RefreshInterval
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = DefaultJWKSConfig.MinRefreshInterval
+	}
+	return &JWKSValidator{
+		client: resty.New().SetTimeout(10 * time.Second),
+		cfg:    cfg,
+		now:    time.Now,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	IssuedAt  *float64        `json:"iat"`
+	Name      *string         `json:"name"`
+	Email     *string         `json:"email"`
+	// ProjectRoles is Zitadel's role claim, keyed by role name.
+	ProjectRoles map[string]json.RawMessage `json:"urn:zitadel:iam:org:project:roles"`
+}
+
+// LooksLikeJWT reports whether a token has the three-part compact JWS shape.
+func LooksLikeJWT(rawToken string) bool {
+	return strings.Count(rawToken, ".") == 2
+}
+
+func (v *JWKSValidator) ValidateToken(ctx context.Context, rawToken string) (*ValidateTokenUser, error) {
+	parts := strings.Split(strings.TrimSpace(rawToken), ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	hash, ok := signingHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrInvalidSignature, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, hash, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	subject := claims.Subject
+	return &ValidateTokenUser{ID: &subject, Name: claims.Name, Email: claims.Email, Role: claimedRole(claims.ProjectRoles)}, nil
+}
+
+// claimedRole picks one role from Zitadel's role claim: the most privileged role rbac knows
+// about, otherwise the alphabetically first one.
+func claimedRole(projectRoles map[string]json.RawMessage) *string {
+	if len(projectRoles) == 0 {
+		return nil
+	}
+	claimed := make(map[string]string, len(projectRoles))
+	for name := range projectRoles {
+		claimed[rbac.NormalizeRole(name)] = name
+	}
+	for i := len(rbac.Roles) - 1; i >= 0; i-- {
+		if _, ok := claimed[rbac.Roles[i]]; ok {
+			role := rbac.Roles[i]
+			return &role
+		}
+	}
+	names := make([]string, 0, len(claimed))
+	for name := range claimed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &names[0]
+}
+
+func (v *JWKSValidator) checkClaims(claims jwtClaims) error {
+	now := v.now()
+	skew := v.cfg.ClockSkew
+	if claims.ExpiresAt == nil || now.After(unixTime(*claims.ExpiresAt).Add(skew)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(skew).Before(unixTime(*claims.NotBefore)) {
+		return ErrTokenNotYetValid
+	}
+	if claims.IssuedAt != nil && now.Add(skew).Before(unixTime(*claims.IssuedAt)) {
+		return ErrTokenNotYetValid
+	}
+	if strings.TrimRight(claims.Issuer, "/") != strings.TrimRight(v.cfg.Issuer, "/") {
+		return ErrInvalidIssuer
+	}
+	if v.cfg.Audience != "" && !audienceContains(claims.Audience, v.cfg.Audience) {
+		return ErrInvalidAudience
+	}
+	if strings.TrimSpace(claims.Subject) == "" {
+		return ErrMalformedToken
+	}
+	return nil
+}
+
+// key returns the public key for kid, fetching the JWKS when the cache is stale or the key id is
+// new. A stale cache is still used when the refetch fails.
+func (v *JWKSValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, fresh, known := v.cachedKey(kid)
+	if known && fresh {
+		return key, nil
+	}
+
+	v.mu.RLock()
+	recentlyTried := v.now().Sub(v.lastAttempt) < v.cfg.MinRefreshInterval
+	v.mu.RUnlock()
+	if !known && recentlyTried && v.hasKeys() {
+		return nil, ErrUnknownSigningKey
+	}
+
+	if err := v.refresh(ctx); err != nil {
+		if known {
+			log.Printf("Failed to refresh JWKS, using cached keys: %v", err)
+			return key, nil
+		}
+		if !v.hasKeys() {
+			return nil, fmt.Errorf("%w: %v", ErrKeysUnavailable, err)
+		}
+		return nil, ErrUnknownSigningKey
+	}
+
+	if key, _, known = v.cachedKey(kid); known {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// cachedKey looks kid up. An empty kid matches when exactly one key is published.
+func (v *JWKSValidator) cachedKey(kid string) (crypto.PublicKey, bool, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	fresh := v.now().Sub(v.fetchedAt) < v.cfg.RefreshInterval
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, fresh, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, fresh, ok
+}
+
+func (v *JWKSValidator) hasKeys() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.keys) > 0
+}
+
+// refresh fetches the JWKS once for all concurrent callers.
+func (v *JWKSValidator) refresh(ctx context.Context) error {
+	_, err, _ := v.group.Do("jwks", func() (any, error) {
+		v.mu.Lock()
+		v.lastAttempt = v.now()
+		v.mu.Unlock()
+
+		keys, err := v.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		v.mu.Lock()
+		v.keys = keys
+		v.fetchedAt = v.now()
+		v.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *JWKSValidator) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	resp, err := v.client.R().SetContext(ctx).SetResult(&document).Get(v.cfg.JWKSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("jwks endpoint returned status %d", resp.StatusCode())
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signingInput string, signature []byte) error {
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") || rsa.VerifyPKCS1v15(pub, hash, digest, signature) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return ErrInvalidSignature
+	}
+}
+
+func decodeSegment(segment string, target any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, candidate := range many {
+			if candidate == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
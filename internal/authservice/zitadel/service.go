@@ -10,6 +10,16 @@ import (
 	"github.com/go-resty/resty/v2"
 )
 
+// ErrTokenRejected marks a definitive answer that the token is not valid, as opposed to the
+// auth service being unreachable. Only rejections are cached by CachingValidator.
+var ErrTokenRejected = errors.New("token rejected")
+
+// rejectedError keeps the auth service's message while matching ErrTokenRejected.
+type rejectedError struct{ message string }
+
+func (e rejectedError) Error() string        { return e.message }
+func (e rejectedError) Is(target error) bool { return target == ErrTokenRejected }
+
 type TokenValidator interface {
 	ValidateToken(ctx context.Context, rawToken string) (*ValidateTokenUser, error)
 }
@@ -61,12 +71,15 @@ func (s *Service) ValidateToken(ctx context.Context, rawToken string) (*Validate
 		return nil, fmt.Errorf("failed to call auth service validate api: %w", err)
 	}
 
+	if resp.StatusCode() >= 400 && resp.StatusCode() < 500 {
+		return nil, rejectedError{fmt.Sprintf("auth service validate api returned status %d", resp.StatusCode())}
+	}
 	if resp.IsError() {
 		return nil, fmt.Errorf("auth service validate api returned status %d", resp.StatusCode())
 	}
 
 	if responsePayload.Error != nil && strings.TrimSpace(*responsePayload.Error) != "" {
-		return nil, errors.New(strings.TrimSpace(*responsePayload.Error))
+		return nil, rejectedError{strings.TrimSpace(*responsePayload.Error)}
 	}
 
 	if responsePayload.User == nil {
@@ -75,3 +88,20 @@ func (s *Service) ValidateToken(ctx context.Context, rawToken string) (*Validate
 
 	return responsePayload.User, nil
 }
+
+// Chain validates a token with each validator in turn and returns the first user found.
+type Chain []TokenValidator
+
+func (c Chain) ValidateToken(ctx context.Context, rawToken string) (*ValidateTokenUser, error) {
+	err := errors.New("no token validator configured")
+	for _, validator := range c {
+		user, validateErr := validator.ValidateToken(ctx, rawToken)
+		if validateErr == nil && user != nil {
+			return user, nil
+		}
+		if validateErr != nil {
+			err = validateErr
+		}
+	}
+	return nil, err
+}
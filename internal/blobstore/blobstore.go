@@ -0,0 +1,41 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"smart-chat/config"
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned by Get when no object exists for the key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store persists binary objects (attachments, exports) under opaque keys.
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the store selected by BlobStoreBackend. Unknown values fall back to the local filesystem.
+// An S3 store that cannot be created is fatal: files written to one instance's disk would be lost.
+func New(cfg *config.Config) Store {
+	switch strings.ToLower(strings.TrimSpace(cfg.BlobStoreBackend)) {
+	case BackendS3:
+		store, err := NewS3Store(cfg.BlobStoreS3Bucket)
+		if err != nil {
+			log.Fatalf("Failed to create S3 blob store: %v", err)
+		}
+		return store
+	default:
+		return NewLocalStore(cfg.BlobStoreLocalDir)
+	}
+}
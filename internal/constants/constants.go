@@ -20,6 +20,8 @@ const (
 	ErrDateRangeRequired     = "Both startdate and enddate are required"
 	ErrInvalidDateRange      = "enddate should be greater than or equal to startdate"
 	ErrDateRangeExceedsLimit = "Date range cannot exceed 30 days"
+	ErrInvalidCursor         = "Invalid cursor"
+	ErrCursorSortMismatch    = "sort does not match the cursor"
 
 	WhatsAppSource = "whatsapp"
 
@@ -4,11 +4,14 @@ import (
 	"log"
 	"smart-chat/internal/llm_service"
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/tag"
 
 	"gorm.io/gorm"
 )
 
 func GenerateConversationAnalysis(db *gorm.DB) {
+	tags := tag.NewService(db, tag.LLMSuggester{})
+
 	// Fetch conversations that are not yet analyzed
 	var conversations []models.Conversation
 
@@ -37,6 +40,13 @@ func GenerateConversationAnalysis(db *gorm.DB) {
 			log.Printf("Error storing analysis for conversation %d: %v", conversation.ID, err)
 		}
 
+		// Suggest tags from the admin-managed vocabulary
+		if suggested, err := tags.Suggest(conversation); err != nil {
+			log.Printf("Error suggesting tags for conversation %d: %v", conversation.ID, err)
+		} else if len(suggested) > 0 {
+			log.Printf("Suggested tags for conversation %d: %v", conversation.ID, suggested)
+		}
+
 		// Mark the conversation as analyzed
 		conversation.Analysed = true
 		if err := db.Save(&conversation).Error; err != nil {
@@ -1,8 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	conversationMode "smart-chat/internal/services/conversation_mode"
 	"smart-chat/internal/services/human"
 	"smart-chat/internal/services/notifications_job"
 	"smart-chat/internal/services/slack"
@@ -11,25 +20,73 @@ import (
 )
 
 // AddMessageHandler handles POST /add-message requests.
-// It expects a JSON body containing conversation_id and message.
-func AddMessageHandler(hs *human.HumanService, jobService *notifications_job.JobService, slackServie *slack.SlackService) gin.HandlerFunc {
+// It expects a JSON body containing conversation_id and a message and/or attachment_ids
+// of attachments uploaded to the conversation beforehand.
+// Agents may only add messages to conversations assigned to them; the caller is stored as the author.
+func AddMessageHandler(hs *human.HumanService, historyService *convHistory.ConvHistoryService, jobService *notifications_job.JobService, slackServie *slack.SlackService, auditLog *audit.Service, modes *conversationMode.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
 		var req struct {
 			ConversationID uint   `json:"conversation_id" binding:"required"`
-			Message        string `json:"message" binding:"required"`
+			Message        string `json:"message"`
+			AttachmentIDs  []uint `json:"attachment_ids"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if strings.TrimSpace(req.Message) == "" && len(req.AttachmentIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "message or attachment_ids is required"})
+			return
+		}
 
-		if err := hs.AddMessage(req.ConversationID, req.Message); err != nil {
+		allowed, err := canAccessConversation(historyService, principal, req.ConversationID, rbac.ConversationsWriteAll)
+		if err != nil {
+			log.Printf("Error checking conversation access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+
+		err = hs.AddMessageWithAttachments(req.ConversationID, principal.AuthUserID, req.Message, req.AttachmentIDs)
+		if errors.Is(err, attachment.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "attachment not found"})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		go jobService.SendConversationNotificationByID("", req.Message, req.ConversationID, slackServie)
+		changes := map[string]audit.Change{"message": {After: req.Message}}
+		if len(req.AttachmentIDs) > 0 {
+			changes["attachment_ids"] = audit.Change{After: req.AttachmentIDs}
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationAddMessage,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(req.ConversationID), 10),
+			Changes:    changes,
+		})
+
+		// An agent replying keeps a human or paired conversation from returning to bot mode.
+		if modes != nil {
+			if err := modes.Extend(req.ConversationID); err != nil {
+				log.Printf("Error extending conversation mode: %v", err)
+			}
+		}
+
+		if jobService != nil {
+			go jobService.SendConversationNotificationByID("", req.Message, req.ConversationID, slackServie)
+		}
 
 		c.JSON(http.StatusOK, gin.H{"status": "Message added successfully"})
 	}
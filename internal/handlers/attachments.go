@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverheadBytes leaves room for form fields and boundaries on top of the file itself.
+const multipartOverheadBytes = 1 << 20 // 1 MiB
+
+// storeAttachmentFromRequest stores the multipart upload in the request for a conversation.
+// The form carries either a "file" (with an optional "caption") or a shared location as
+// "latitude", "longitude" and an optional "location_name".
+// It writes the error response and returns false on failure.
+func storeAttachmentFromRequest(c *gin.Context, attachmentService *attachment.Service, conversationID uint, uploadedBy string) (*models.MessageAttachment, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, attachmentService.MaxBytes()+multipartOverheadBytes)
+
+	if latitude, longitude := c.PostForm("latitude"), c.PostForm("longitude"); latitude != "" || longitude != "" {
+		lat, latErr := strconv.ParseFloat(latitude, 64)
+		lng, lngErr := strconv.ParseFloat(longitude, 64)
+		if latErr != nil || lngErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": attachment.ErrInvalidLocation.Error()})
+			return nil, false
+		}
+		stored, err := attachmentService.CreateLocation(attachment.LocationInput{
+			ConversationID: conversationID,
+			UploadedBy:     uploadedBy,
+			Latitude:       lat,
+			Longitude:      lng,
+			Name:           c.PostForm("location_name"),
+		})
+		if err != nil {
+			writeAttachmentError(c, err)
+			return nil, false
+		}
+		return stored, true
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeAttachmentError(c, attachment.ErrTooLarge)
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return nil, false
+	}
+	if fileHeader.Size > attachmentService.MaxBytes() {
+		writeAttachmentError(c, attachment.ErrTooLarge)
+		return nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return nil, false
+	}
+	defer file.Close()
+
+	stored, err := attachmentService.Upload(c.Request.Context(), attachment.UploadInput{
+		ConversationID:   conversationID,
+		UploadedBy:       uploadedBy,
+		FileName:         fileHeader.Filename,
+		DeclaredMimeType: fileHeader.Header.Get("Content-Type"),
+		Caption:          c.PostForm("caption"),
+		Body:             file,
+	})
+	if err != nil {
+		writeAttachmentError(c, err)
+		return nil, false
+	}
+	return stored, true
+}
+
+func writeAttachmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, attachment.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, attachment.ErrEmpty), errors.Is(err, attachment.ErrInvalidLocation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, attachment.ErrNotFound), errors.Is(err, attachment.ErrNoContent), errors.Is(err, blobstore.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+	default:
+		log.Printf("Attachment error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process attachment"})
+	}
+}
+
+// serveAttachment streams the stored content of an attachment as a download.
+func serveAttachment(c *gin.Context, attachmentService *attachment.Service, stored *models.MessageAttachment) {
+	reader, err := attachmentService.Open(c.Request.Context(), stored)
+	if err != nil {
+		writeAttachmentError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": stored.FileName})
+	c.DataFromReader(http.StatusOK, stored.SizeBytes, stored.MimeType, reader, map[string]string{
+		"Content-Disposition":    disposition,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+func attachmentView(a models.MessageAttachment) gin.H {
+	view := gin.H{
+		"id":          a.ID,
+		"kind":        a.Kind,
+		"uploaded_by": a.UploadedBy,
+		"created_at":  a.CreatedAt,
+	}
+	if a.Kind == models.AttachmentKindLocation {
+		view["latitude"] = a.Latitude
+		view["longitude"] = a.Longitude
+		view["location_name"] = a.LocationName
+		return view
+	}
+	view["file_name"] = a.FileName
+	view["mime_type"] = a.MimeType
+	view["size_bytes"] = a.SizeBytes
+	view["caption"] = a.Caption
+	return view
+}
+
+// messageHistoryEntry formats a visible message pair for history responses.
+// Attachments are only included when the message has any, so text-only history is unchanged.
+func messageHistoryEntry(pair models.MessagePair) gin.H {
+	entry := gin.H{
+		"UserMessage": pair.User,
+		"BotMessage":  pair.Bot,
+	}
+	if len(pair.Attachments) > 0 {
+		attachments := make([]gin.H, 0, len(pair.Attachments))
+		for _, a := range pair.Attachments {
+			attachments = append(attachments, attachmentView(a))
+		}
+		entry["Attachments"] = attachments
+	}
+	return entry
+}
+
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(strings.TrimSpace(c.Param(name)), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/conversation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadChatAttachmentHandler handles POST /v2/chat/attachments.
+// The upload is stored against the session's conversation; send its ID in attachment_ids
+// on POST /v2/chat/message to include it in the next message.
+func UploadChatAttachmentHandler(convService *conversation.ConversationService, attachmentService *attachment.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, exists := c.Get("session")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - No session found"})
+			return
+		}
+
+		authSession, ok := session.(models.Session)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error - Session casting issue"})
+			return
+		}
+
+		conv, err := convService.GetOrCreateConversation(authSession.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load conversation"})
+			return
+		}
+
+		stored, ok := storeAttachmentFromRequest(c, attachmentService, conv.ID, models.AttachmentUploaderUser)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"attachment": attachmentView(*stored)})
+	}
+}
+
+// GetChatAttachmentHandler handles GET /v2/chat/attachments/:id.
+// Chat users can download attachments from any of their own conversations.
+func GetChatAttachmentHandler(attachmentService *attachment.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, exists := c.Get("session")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - No session found"})
+			return
+		}
+
+		authSession, ok := session.(models.Session)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error - Session casting issue"})
+			return
+		}
+
+		id, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID format"})
+			return
+		}
+
+		stored, err := attachmentService.GetForUser(id, authSession.UserID)
+		if err != nil {
+			writeAttachmentError(c, err)
+			return
+		}
+
+		serveAttachment(c, attachmentService, stored)
+	}
+}
@@ -1,11 +1,12 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"log"
 	"net/http"
 
+	"smart-chat/internal/authservice/local"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,31 +15,51 @@ type ClientLoginInfo struct {
 	Password string `json:"password" binding:"required"`
 }
 
-func ClientAdminLoginHandler() gin.HandlerFunc {
+// ClientAdminLoginHandler signs an agent or admin in with the email and password of their auth user.
+// The returned authToken is accepted by the client routes like a Zitadel token.
+func ClientAdminLoginHandler(localAuth *local.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var info ClientLoginInfo
 		if err := c.ShouldBindJSON(&info); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Both username and password are required"})
 			return
 		}
-		log.Printf("username %v", info.Username)
-		log.Printf("password %v", info.Password)
-		token, err := generateSecretToken(32)
+
+		result, err := localAuth.Login(info.Username, info.Password, c.ClientIP())
+		if errors.Is(err, local.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+			log.Printf("Client login failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"authToken": token})
+		c.JSON(http.StatusOK, result)
 	}
 }
 
-func generateSecretToken(length int) (string, error) {
-	b := make([]byte, length)
-	_, err := rand.Read(b)
-	if err != nil {
-		return "", err
-	}
+// ClientAdminLogoutHandler revokes a token issued by ClientAdminLoginHandler.
+func ClientAdminLogoutHandler(localAuth *local.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawToken := tokenFromAuthorizationHeader(c.GetHeader("Authorization"))
+		if rawToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+			return
+		}
 
-	return base64.URLEncoding.EncodeToString(b), nil
+		err := localAuth.Logout(rawToken)
+		if errors.Is(err, local.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+			return
+		}
+		if err != nil {
+			log.Printf("Client logout failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
 }
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateAgentAvailabilityRequest struct {
+	Availability string `json:"availability" binding:"required"`
+}
+
+// GetAgentAvailabilityHandler handles GET /v2/client/agents/me/availability.
+// It returns the caller's availability and how many unresolved conversations they hold.
+func GetAgentAvailabilityHandler(assignments *authUserConversation.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		status, err := assignments.Status(principal.AuthUserID)
+		if err != nil {
+			log.Printf("Error fetching agent availability: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch availability"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"agent": status})
+	}
+}
+
+// UpdateAgentAvailabilityHandler handles PATCH /v2/client/agents/me/availability.
+// Agents mark themselves available or away; away agents get no automatic assignments.
+func UpdateAgentAvailabilityHandler(assignments *authUserConversation.Engine, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		var req UpdateAgentAvailabilityRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "availability is required"})
+			return
+		}
+
+		before, _ := assignments.Status(principal.AuthUserID)
+		status, err := assignments.SetAvailability(principal.AuthUserID, req.Availability)
+		if errors.Is(err, authUserConversation.ErrInvalidAvailability) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating agent availability: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update availability"})
+			return
+		}
+
+		changes := map[string]audit.Change{"availability": {After: status.Availability}}
+		if before != nil {
+			changes["availability"] = audit.Change{Before: before.Availability, After: status.Availability}
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionAuthUserAvailability,
+			TargetType: audit.TargetAuthUser,
+			TargetID:   strconv.FormatUint(uint64(principal.AuthUserID), 10),
+			Changes:    changes,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"agent": status})
+	}
+}
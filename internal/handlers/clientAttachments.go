@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadConversationAttachmentHandler handles POST /v2/client/conversation/:id/attachments.
+// Agents upload brochures or itineraries here and then send them with attachment_ids on
+// POST /v2/client/add-message. Agents may only upload to conversations assigned to them.
+func UploadConversationAttachmentHandler(
+	historyService *convHistory.ConvHistoryService,
+	attachmentService *attachment.Service,
+	auditLog *audit.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		conversationID, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID format"})
+			return
+		}
+
+		allowed, err := canAccessConversation(historyService, principal, conversationID, rbac.ConversationsWriteAll)
+		if err != nil {
+			log.Printf("Error checking conversation access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+
+		stored, ok := storeAttachmentFromRequest(c, attachmentService, conversationID, models.AttachmentUploaderAgent)
+		if !ok {
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationAttachment,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes: map[string]audit.Change{
+				"attachment_id": {After: stored.ID},
+				"file_name":     {After: stored.FileName},
+				"size_bytes":    {After: stored.SizeBytes},
+			},
+		})
+
+		c.JSON(http.StatusCreated, gin.H{"attachment": attachmentView(*stored)})
+	}
+}
+
+// GetClientAttachmentHandler handles GET /v2/client/attachments/:id.
+// Admins can download any attachment; agents only those in conversations assigned to them.
+func GetClientAttachmentHandler(
+	historyService *convHistory.ConvHistoryService,
+	attachmentService *attachment.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		id, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID format"})
+			return
+		}
+
+		stored, err := attachmentService.GetByID(id)
+		if err != nil {
+			writeAttachmentError(c, err)
+			return
+		}
+
+		allowed, err := canAccessConversation(historyService, principal, stored.ConversationID, rbac.ConversationsReadAll)
+		if err != nil {
+			log.Printf("Error checking conversation access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation"})
+			return
+		}
+		if !allowed {
+			writeAttachmentError(c, attachment.ErrNotFound)
+			return
+		}
+
+		serveAttachment(c, attachmentService, stored)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-chat/internal/constants"
+	"smart-chat/internal/services/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditLimit caps the page size of GET /v2/client/audit.
+const maxAuditLimit = 100
+
+// GetAuditEventsHandler lists audit events, newest first. Filters: actor_id, action, target_type,
+// target_id, and from/to as RFC 3339 timestamps; paginated with page and limit.
+func GetAuditEventsHandler(auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := audit.Filter{
+			Action:     strings.TrimSpace(c.Query("action")),
+			TargetType: strings.TrimSpace(c.Query("target_type")),
+			TargetID:   strings.TrimSpace(c.Query("target_id")),
+		}
+		if actorStr := strings.TrimSpace(c.Query("actor_id")); actorStr != "" {
+			actorID, err := strconv.ParseUint(actorStr, 10, 64)
+			if err != nil || actorID == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor_id"})
+				return
+			}
+			filter.ActorAuthUserID = uint(actorID)
+		}
+		for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			value := strings.TrimSpace(c.Query(param))
+			if value == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", expected RFC 3339"})
+				return
+			}
+			*target = parsed
+		}
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", constants.DefaultPageStr))
+		if err != nil || page < 1 {
+			page = constants.DefaultPage
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", constants.DefaultLimitStr))
+		if err != nil || limit < 1 {
+			limit = constants.DefaultLimit
+		}
+		if limit > maxAuditLimit {
+			limit = maxAuditLimit
+		}
+
+		events, total, err := auditLog.List(filter, (page-1)*limit, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch audit events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"events": events,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		})
+	}
+}
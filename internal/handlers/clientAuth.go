@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/conversation_history/specification"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalFromContext returns the caller stored by the Authorizer middleware.
+// It writes a 401 and returns false when the route was registered without it.
+func principalFromContext(c *gin.Context) (*rbac.Principal, bool) {
+	value, exists := c.Get(rbac.PrincipalKey)
+	principal, ok := value.(*rbac.Principal)
+	if !exists || !ok || principal == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+		return nil, false
+	}
+	return principal, true
+}
+
+// assignedScope returns the specification limiting a query to conversations assigned to the
+// principal, or nil when the principal holds the unscoped permission.
+func assignedScope(principal *rbac.Principal, all rbac.Permission) specification.Specification {
+	if principal.Can(all) {
+		return nil
+	}
+	return specification.ByAssignedAuthUser{AuthUserID: principal.AuthUserID}
+}
+
+// canAccessConversation reports whether the principal may act on the conversation. Holders of
+// the all permission may act on every conversation; others only on those assigned to them.
+func canAccessConversation(
+	historyService *convHistory.ConvHistoryService,
+	principal *rbac.Principal,
+	conversationID uint,
+	all rbac.Permission,
+) (bool, error) {
+	specs := []specification.Specification{specification.ByID{ID: conversationID}}
+	if scope := assignedScope(principal, all); scope != nil {
+		specs = append(specs, scope)
+	}
+
+	count, err := historyService.CountConversations(specs...)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// auditActor describes the caller of a client request for the audit log.
+func auditActor(c *gin.Context, principal *rbac.Principal) audit.Actor {
+	return audit.Actor{
+		AuthUserID:    principal.AuthUserID,
+		ZitadelUserID: principal.ZitadelUserID,
+		Role:          principal.Role,
+		IPAddress:     c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	authUserService "smart-chat/internal/services/auth_user"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAuthUserRequest struct {
+	ZitadelUserID string  `json:"zitadel_user_id"`
+	Name          *string `json:"name"`
+	Email         *string `json:"email"`
+	Role          string  `json:"role" binding:"required"`
+}
+
+type UpdateAuthUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type CreateAuthRoleRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// ListAuthUsersHandler lists every auth user, disabled ones included.
+func ListAuthUsersHandler(authUsers *authUserService.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		users, err := authUsers.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch auth users"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"auth_users": users})
+	}
+}
+
+// CreateAuthUserHandler pre-provisions an auth user.
+func CreateAuthUserHandler(authUsers *authUserService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		var req CreateAuthUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
+			return
+		}
+		if strings.TrimSpace(req.ZitadelUserID) == "" && (req.Email == nil || strings.TrimSpace(*req.Email) == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "zitadel_user_id or email is required"})
+			return
+		}
+
+		user, err := authUsers.Create(authUserService.CreateInput{
+			ZitadelUserID: req.ZitadelUserID,
+			Name:          req.Name,
+			Email:         req.Email,
+			Role:          req.Role,
+		})
+		if err != nil {
+			respondAuthUserError(c, err, "failed to create auth user")
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionAuthUserCreate,
+			TargetType: audit.TargetAuthUser,
+			TargetID:   strconv.FormatUint(uint64(user.UserID), 10),
+			Changes:    audit.Diff(nil, authUserFields(user)),
+		})
+		c.JSON(http.StatusCreated, gin.H{"auth_user": user})
+	}
+}
+
+// UpdateAuthUserRoleHandler changes an auth user's role.
+func UpdateAuthUserRoleHandler(authUsers *authUserService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+		userID, ok := authUserIDParam(c)
+		if !ok {
+			return
+		}
+		var req UpdateAuthUserRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
+			return
+		}
+
+		before, _ := authUsers.Get(userID)
+		user, err := authUsers.SetRole(userID, req.Role, principal.AuthUserID)
+		if err != nil {
+			respondAuthUserError(c, err, "failed to update auth user role")
+			return
+		}
+		recordAuthUserChange(c, auditLog, principal, audit.ActionAuthUserRoleChange, before, user)
+		c.JSON(http.StatusOK, gin.H{"auth_user": user})
+	}
+}
+
+// DisableAuthUserHandler disables an auth user and revokes their local-credentials sessions.
+func DisableAuthUserHandler(authUsers *authUserService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+		userID, ok := authUserIDParam(c)
+		if !ok {
+			return
+		}
+
+		before, _ := authUsers.Get(userID)
+		user, err := authUsers.Disable(userID, principal.AuthUserID)
+		if err != nil {
+			respondAuthUserError(c, err, "failed to disable auth user")
+			return
+		}
+		recordAuthUserChange(c, auditLog, principal, audit.ActionAuthUserDisable, before, user)
+		c.JSON(http.StatusOK, gin.H{"auth_user": user})
+	}
+}
+
+// EnableAuthUserHandler re-enables a disabled auth user.
+func EnableAuthUserHandler(authUsers *authUserService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+		userID, ok := authUserIDParam(c)
+		if !ok {
+			return
+		}
+
+		before, _ := authUsers.Get(userID)
+		user, err := authUsers.Enable(userID)
+		if err != nil {
+			respondAuthUserError(c, err, "failed to enable auth user")
+			return
+		}
+		recordAuthUserChange(c, auditLog, principal, audit.ActionAuthUserEnable, before, user)
+		c.JSON(http.StatusOK, gin.H{"auth_user": user})
+	}
+}
+
+// ListAuthRolesHandler lists the roles with the permissions each one holds.
+func ListAuthRolesHandler(authUsers *authUserService.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, err := authUsers.ListRoles()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch roles"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"roles": roles})
+	}
+}
+
+// CreateAuthRoleHandler adds a role. Roles the permission matrix does not know hold no permissions.
+func CreateAuthRoleHandler(authUsers *authUserService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		var req CreateAuthRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+
+		role, err := authUsers.CreateRole(req.Name)
+		if err != nil {
+			respondAuthUserError(c, err, "failed to create role")
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionAuthRoleCreate,
+			TargetType: audit.TargetAuthRole,
+			TargetID:   strconv.FormatUint(uint64(role.RoleID), 10),
+			Changes:    map[string]audit.Change{"name": {After: role.Name}},
+		})
+		c.JSON(http.StatusCreated, gin.H{"role": role})
+	}
+}
+
+// DeleteAuthRoleHandler deletes a custom role that no auth user holds.
+func DeleteAuthRoleHandler(authUsers *authUserService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || roleID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role id"})
+			return
+		}
+
+		if err := authUsers.DeleteRole(uint(roleID)); err != nil {
+			respondAuthUserError(c, err, "failed to delete role")
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionAuthRoleDelete,
+			TargetType: audit.TargetAuthRole,
+			TargetID:   strconv.FormatUint(roleID, 10),
+		})
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	}
+}
+
+// recordAuthUserChange audits the fields of an auth user that an admin action changed.
+func recordAuthUserChange(c *gin.Context, auditLog *audit.Service, principal *rbac.Principal, action string, before, after *authUserService.AuthUser) {
+	auditLog.Record(auditActor(c, principal), audit.Entry{
+		Action:     action,
+		TargetType: audit.TargetAuthUser,
+		TargetID:   strconv.FormatUint(uint64(after.UserID), 10),
+		Changes:    audit.Diff(authUserFields(before), authUserFields(after)),
+	})
+}
+
+func authUserFields(user *authUserService.AuthUser) map[string]any {
+	if user == nil {
+		return nil
+	}
+	return map[string]any{
+		"zitadel_user_id": user.ZitadelUserID,
+		"name":            user.Name,
+		"email":           user.Email,
+		"role":            user.Role,
+		"disabled":        user.Disabled,
+	}
+}
+
+func authUserIDParam(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid auth user id"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+func respondAuthUserError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, authUserService.ErrAuthUserNotFound), errors.Is(err, authUserService.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, authUserService.ErrAuthUserExists),
+		errors.Is(err, authUserService.ErrRoleExists),
+		errors.Is(err, authUserService.ErrRoleInUse),
+		errors.Is(err, authUserService.ErrBuiltInRole),
+		errors.Is(err, authUserService.ErrLastAdmin),
+		errors.Is(err, authUserService.ErrSelfChange):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, authUserService.ErrInvalidRoleName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
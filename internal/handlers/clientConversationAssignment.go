@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	convHistory "smart-chat/internal/services/conversation_history"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReassignConversationRequest struct {
+	ToUserID   uint `json:"to_user_id" binding:"required"`
+	FromUserID uint `json:"from_user_id"`
+	// CarryTracking defaults to true.
+	CarryTracking *bool `json:"carry_tracking"`
+}
+
+type ConversationAssigneeRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// GetConversationAssignmentsHandler handles GET /v2/client/conversation/:id/assignments.
+// It returns the current assignees, primary first, and every assignment period with its tracking
+// state. Agents only see conversations assigned to them.
+func GetConversationAssignmentsHandler(
+	historyService *convHistory.ConvHistoryService,
+	service *authUserConversation.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsReadAll)
+		if !ok {
+			return
+		}
+
+		assignees, err := service.Assignees(conversationID)
+		if err != nil {
+			log.Printf("Error fetching conversation assignees: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch assignments"})
+			return
+		}
+		history, err := service.History(conversationID)
+		if err != nil {
+			log.Printf("Error fetching assignment history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch assignments"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"assignees": assignees, "assignments": history})
+	}
+}
+
+// ReassignConversationHandler handles POST /v2/client/conversation/:id/reassign.
+// It moves the conversation from from_user_id, or the primary assignee when omitted, to
+// to_user_id. Tracking state moves with it unless carry_tracking is false; the previous
+// assignee's state is archived in the history either way.
+func ReassignConversationHandler(
+	historyService *convHistory.ConvHistoryService,
+	service *authUserConversation.Service,
+	auditLog *audit.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		var req ReassignConversationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to_user_id is required"})
+			return
+		}
+		carryTracking := req.CarryTracking == nil || *req.CarryTracking
+
+		before, err := service.Assignees(conversationID)
+		if err != nil {
+			log.Printf("Error fetching conversation assignees: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reassign conversation"})
+			return
+		}
+		err = service.Reassign(authUserConversation.ReassignInput{
+			ConversationID: conversationID,
+			FromUserID:     req.FromUserID,
+			ToUserID:       req.ToUserID,
+			ActorID:        principal.AuthUserID,
+			CarryTracking:  carryTracking,
+		})
+		if !writeAssignmentError(c, err, "failed to reassign conversation") {
+			return
+		}
+
+		assignees := respondWithAssignees(c, service, conversationID)
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationReassign,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes: map[string]audit.Change{
+				"assignees":      {Before: assigneeIDs(before), After: assigneeIDs(assignees)},
+				"carry_tracking": {After: carryTracking},
+			},
+		})
+	}
+}
+
+// UnassignConversationHandler handles POST /v2/client/conversation/:id/unassign.
+// It removes user_id from the conversation and archives their tracking state. When the primary
+// assignee is removed, the longest-assigned remaining agent becomes primary.
+func UnassignConversationHandler(
+	historyService *convHistory.ConvHistoryService,
+	service *authUserConversation.Service,
+	auditLog *audit.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		var req ConversationAssigneeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+			return
+		}
+
+		before, err := service.Assignees(conversationID)
+		if err != nil {
+			log.Printf("Error fetching conversation assignees: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unassign conversation"})
+			return
+		}
+		err = service.Unassign(conversationID, req.UserID, principal.AuthUserID)
+		if !writeAssignmentError(c, err, "failed to unassign conversation") {
+			return
+		}
+
+		assignees := respondWithAssignees(c, service, conversationID)
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationUnassign,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes: map[string]audit.Change{
+				"assignees": {Before: assigneeIDs(before), After: assigneeIDs(assignees)},
+			},
+		})
+	}
+}
+
+// SetConversationPrimaryHandler handles PUT /v2/client/conversation/:id/primary.
+// It makes an assigned auth user the conversation's primary assignee.
+func SetConversationPrimaryHandler(
+	historyService *convHistory.ConvHistoryService,
+	service *authUserConversation.Service,
+	auditLog *audit.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		var req ConversationAssigneeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+			return
+		}
+
+		before, err := service.Assignees(conversationID)
+		if err != nil {
+			log.Printf("Error fetching conversation assignees: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update primary assignee"})
+			return
+		}
+		err = service.SetPrimary(conversationID, req.UserID)
+		if !writeAssignmentError(c, err, "failed to update primary assignee") {
+			return
+		}
+
+		respondWithAssignees(c, service, conversationID)
+		var previous any
+		if len(before) > 0 && before[0].Primary {
+			previous = before[0].UserID
+		}
+		if previous != req.UserID {
+			auditLog.Record(auditActor(c, principal), audit.Entry{
+				Action:     audit.ActionConversationPrimary,
+				TargetType: audit.TargetConversation,
+				TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+				Changes: map[string]audit.Change{
+					"primary": {Before: previous, After: req.UserID},
+				},
+			})
+		}
+	}
+}
+
+// conversationFromRequest parses the :id param and checks the caller may access the conversation,
+// writing the error response when not.
+func conversationFromRequest(
+	c *gin.Context,
+	historyService *convHistory.ConvHistoryService,
+	all rbac.Permission,
+) (*rbac.Principal, uint, bool) {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return nil, 0, false
+	}
+
+	conversationID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID format"})
+		return nil, 0, false
+	}
+	allowed, err := canAccessConversation(historyService, principal, conversationID, all)
+	if err != nil {
+		log.Printf("Error checking conversation access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation"})
+		return nil, 0, false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, 0, false
+	}
+	return principal, conversationID, true
+}
+
+// writeAssignmentError maps assignment errors to responses and reports whether err was nil.
+func writeAssignmentError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authUserConversation.ErrNotAssigned), errors.Is(err, authUserConversation.ErrNoPrimaryAssignee):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, authUserConversation.ErrSameAssignee), errors.Is(err, authUserConversation.ErrInvalidAssignee):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error updating conversation assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
+
+// respondWithAssignees writes the conversation's current assignees and returns them.
+func respondWithAssignees(c *gin.Context, service *authUserConversation.Service, conversationID uint) []authUserConversation.Assignee {
+	assignees, err := service.Assignees(conversationID)
+	if err != nil {
+		log.Printf("Error fetching conversation assignees: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch assignees"})
+		return nil
+	}
+	c.JSON(http.StatusOK, gin.H{"assignees": assignees})
+	return assignees
+}
+
+func assigneeIDs(assignees []authUserConversation.Assignee) []uint {
+	ids := make([]uint, 0, len(assignees))
+	for _, assignee := range assignees {
+		ids = append(ids, assignee.UserID)
+	}
+	return ids
+}
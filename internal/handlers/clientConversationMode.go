@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateConversationModeRequest struct {
+	Mode string `json:"mode" binding:"required"`
+}
+
+// UpdateConversationModeHandler handles PATCH /v2/client/conversation/:id/mode.
+// It switches a conversation between bot, human and paired mode. Agents may only switch
+// conversations assigned to them.
+func UpdateConversationModeHandler(
+	historyService *convHistory.ConvHistoryService,
+	modes *conversationMode.Service,
+	auditLog *audit.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		conversationID, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID format"})
+			return
+		}
+		var req UpdateConversationModeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode is required"})
+			return
+		}
+		mode := strings.ToLower(strings.TrimSpace(req.Mode))
+		if !conversationMode.ValidMode(mode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": conversationMode.ErrInvalidMode.Error()})
+			return
+		}
+
+		allowed, err := canAccessConversation(historyService, principal, conversationID, rbac.ConversationsWriteAll)
+		if err != nil {
+			log.Printf("Error checking conversation access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+
+		before, _ := modes.Get(conversationID)
+		state, err := modes.Set(conversationID, mode, principal.AuthUserID)
+		if errors.Is(err, conversationMode.ErrConversationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating conversation mode: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update conversation mode"})
+			return
+		}
+
+		changes := map[string]audit.Change{"mode": {After: state.Mode}}
+		if before != nil {
+			changes["mode"] = audit.Change{Before: before.Mode, After: state.Mode}
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationMode,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes:    changes,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"conversation": state})
+	}
+}
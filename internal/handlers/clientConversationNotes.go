@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/note"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateConversationNoteRequest struct {
+	Body string `json:"body" binding:"required"`
+	// ParentID makes the note a reply in that note's thread.
+	ParentID *uint `json:"parent_id"`
+}
+
+type UpdateConversationNoteRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// ListConversationNotesHandler handles GET /v2/client/conversations/:id/notes.
+// It returns the note threads, pinned notes first.
+func ListConversationNotesHandler(historyService *convHistory.ConvHistoryService, notes *note.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsReadAll)
+		if !ok {
+			return
+		}
+		list, err := notes.ForConversation(conversationID)
+		if err != nil {
+			log.Printf("Error fetching conversation notes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notes"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"notes": list})
+	}
+}
+
+// CreateConversationNoteHandler handles POST /v2/client/conversations/:id/notes.
+// Users @mentioned by email are notified through the inbox stream.
+func CreateConversationNoteHandler(historyService *convHistory.ConvHistoryService, notes *note.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		var req CreateConversationNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+			return
+		}
+
+		created, err := notes.Create(conversationID, principal.AuthUserID, req.ParentID, req.Body)
+		if !writeNoteError(c, err, "failed to create note") {
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"note": created})
+	}
+}
+
+// UpdateConversationNoteHandler handles PATCH /v2/client/conversations/:id/notes/:noteId.
+// Only the author edits a note; the previous body is kept in its history.
+func UpdateConversationNoteHandler(historyService *convHistory.ConvHistoryService, notes *note.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, noteID, ok := noteFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		var req UpdateConversationNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+			return
+		}
+
+		updated, _, err := notes.Update(conversationID, noteID, principal.AuthUserID, req.Body)
+		if !writeNoteError(c, err, "failed to update note") {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"note": updated})
+	}
+}
+
+// GetConversationNoteHistoryHandler handles GET /v2/client/conversations/:id/notes/:noteId/history.
+// It lists the note's earlier bodies, oldest first.
+func GetConversationNoteHistoryHandler(historyService *convHistory.ConvHistoryService, notes *note.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, conversationID, noteID, ok := noteFromRequest(c, historyService, rbac.ConversationsReadAll)
+		if !ok {
+			return
+		}
+		revisions, err := notes.History(conversationID, noteID)
+		if !writeNoteError(c, err, "failed to fetch note history") {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"history": revisions})
+	}
+}
+
+// PinConversationNoteHandler handles PUT and DELETE /v2/client/conversations/:id/notes/:noteId/pin.
+func PinConversationNoteHandler(historyService *convHistory.ConvHistoryService, notes *note.Service, auditLog *audit.Service, pinned bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, noteID, ok := noteFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		updated, err := notes.SetPinned(conversationID, noteID, principal.AuthUserID, pinned)
+		if !writeNoteError(c, err, "failed to pin note") {
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationNotePin,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes:    map[string]audit.Change{"note_id": {After: noteID}, "pinned": {After: pinned}},
+		})
+		c.JSON(http.StatusOK, gin.H{"note": updated})
+	}
+}
+
+// DeleteConversationNoteHandler handles DELETE /v2/client/conversations/:id/notes/:noteId.
+// Authors delete their own notes and admins any note; a top-level note takes its replies with it.
+func DeleteConversationNoteHandler(historyService *convHistory.ConvHistoryService, notes *note.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, noteID, ok := noteFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		deleted, err := notes.Delete(conversationID, noteID, principal.AuthUserID, principal.Can(rbac.ConversationsWriteAll))
+		if !writeNoteError(c, err, "failed to delete note") {
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationNoteDelete,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes: map[string]audit.Change{
+				"note_id": {Before: deleted.ID},
+				"author":  {Before: deleted.AuthorAuthUserID},
+				"body":    {Before: deleted.Body},
+			},
+		})
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	}
+}
+
+// noteFromRequest is conversationFromRequest that also parses the noteId path parameter.
+func noteFromRequest(
+	c *gin.Context,
+	historyService *convHistory.ConvHistoryService,
+	all rbac.Permission,
+) (*rbac.Principal, uint, uint, bool) {
+	principal, conversationID, ok := conversationFromRequest(c, historyService, all)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	noteID, ok := parseIDParam(c, "noteId")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note id"})
+		return nil, 0, 0, false
+	}
+	return principal, conversationID, noteID, true
+}
+
+// writeNoteError maps note errors to responses and reports whether err was nil.
+func writeNoteError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, note.ErrInvalidBody), errors.Is(err, note.ErrInvalidParent),
+		errors.Is(err, note.ErrPinReply), errors.Is(err, note.ErrInvalidMention):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, note.ErrNotAuthor), errors.Is(err, note.ErrCannotDelete):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, note.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error updating notes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/constants"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/escalation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxEscalationLimit caps the page size of GET /v2/client/escalations.
+const maxEscalationLimit = 100
+
+// GetEscalationsHandler handles GET /v2/client/escalations.
+// It lists escalations raised by the bot, most urgent and oldest first. status is open (default),
+// resolved or all; paginated with page and limit. Agents only see conversations assigned to them.
+func GetEscalationsHandler(escalations *escalation.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		filter := escalation.ListFilter{Status: c.Query("status")}
+		if !principal.Can(rbac.ConversationsReadAll) {
+			filter.AssignedTo = &principal.AuthUserID
+		}
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", constants.DefaultPageStr))
+		if err != nil || page < 1 {
+			page = constants.DefaultPage
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", constants.DefaultLimitStr))
+		if err != nil || limit < 1 {
+			limit = constants.DefaultLimit
+		}
+		if limit > maxEscalationLimit {
+			limit = maxEscalationLimit
+		}
+
+		items, total, err := escalations.List(filter, (page-1)*limit, limit)
+		if errors.Is(err, escalation.ErrInvalidStatus) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error listing escalations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch escalations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"escalations": items,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		})
+	}
+}
+
+// ResolveEscalationHandler handles POST /v2/client/escalations/:id/resolve.
+// Agents may only resolve escalations of conversations assigned to them.
+func ResolveEscalationHandler(
+	historyService *convHistory.ConvHistoryService,
+	escalations *escalation.Service,
+	auditLog *audit.Service,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		escalationID, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid escalation ID format"})
+			return
+		}
+		existing, err := escalations.Get(escalationID)
+		if errors.Is(err, escalation.ErrEscalationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Escalation not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching escalation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch escalation"})
+			return
+		}
+
+		allowed, err := canAccessConversation(historyService, principal, existing.ConversationID, rbac.ConversationsWriteAll)
+		if err != nil {
+			log.Printf("Error checking conversation access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Escalation not found"})
+			return
+		}
+
+		resolved, err := escalations.Resolve(escalationID, principal.AuthUserID)
+		if err != nil {
+			log.Printf("Error resolving escalation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve escalation"})
+			return
+		}
+
+		if existing.Status != models.EscalationStatusResolved {
+			auditLog.Record(auditActor(c, principal), audit.Entry{
+				Action:     audit.ActionEscalationResolve,
+				TargetType: audit.TargetEscalation,
+				TargetID:   strconv.FormatUint(uint64(escalationID), 10),
+				Changes: map[string]audit.Change{
+					"status": {Before: existing.Status, After: resolved.Status},
+				},
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"escalation": gin.H{
+			"id":              resolved.ID,
+			"conversation_id": resolved.ConversationID,
+			"reason":          resolved.Reason,
+			"urgency":         resolved.Urgency,
+			"status":          resolved.Status,
+			"assigned_to":     resolved.AssignedAuthUserID,
+			"created_at":      resolved.CreatedAt,
+			"resolved_at":     resolved.ResolvedAt,
+			"resolved_by":     resolved.ResolvedBy,
+		}})
+	}
+}
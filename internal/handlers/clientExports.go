@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/export"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportListLimit is how many recent exports GET /v2/client/exports returns.
+const exportListLimit = 50
+
+type CreateExportRequest struct {
+	Format string `json:"format" binding:"required"`
+}
+
+// CreateExportHandler handles POST /v2/client/exports.
+// It queues an export of the conversations the list endpoint would return for the same query
+// string filters. Agents without conversations:read:all only export their own conversations.
+func CreateExportHandler(exports *export.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		var req CreateExportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format is required"})
+			return
+		}
+
+		var scope *uint
+		if !principal.Can(rbac.ConversationsReadAll) {
+			scope = &principal.AuthUserID
+		}
+		filters := conversationFiltersFromQuery(c)
+		job, err := exports.Create(principal.AuthUserID, scope, req.Format, filters)
+		var filterErr *convHistory.FilterError
+		switch {
+		case errors.As(err, &filterErr), errors.Is(err, export.ErrInvalidFormat), errors.Is(err, export.ErrTooManyConversations):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, export.ErrTooManyPending):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Error creating export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create export"})
+			return
+		}
+
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionExportCreate,
+			TargetType: audit.TargetExport,
+			TargetID:   strconv.FormatUint(uint64(job.ID), 10),
+			Changes: map[string]audit.Change{
+				"format":  {After: job.Format},
+				"filters": {After: filters},
+			},
+		})
+		c.JSON(http.StatusAccepted, gin.H{"export": job})
+	}
+}
+
+// ListExportsHandler handles GET /v2/client/exports.
+// It lists the caller's recent exports, newest first.
+func ListExportsHandler(exports *export.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+		jobs, err := exports.List(principal.AuthUserID, exportListLimit)
+		if err != nil {
+			log.Printf("Error listing exports: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exports"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"exports": jobs})
+	}
+}
+
+// GetExportHandler handles GET /v2/client/exports/:id.
+// A completed export carries a fresh download link.
+func GetExportHandler(exports *export.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+		exportID, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+		job, err := exports.Get(exportID, principal.AuthUserID)
+		if errors.Is(err, export.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch export"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"export": job})
+	}
+}
+
+// DownloadExportHandler handles GET /v2/client/exports/:id/download.
+// It needs no token: the signed expires and signature parameters of the download link are the
+// credential, so the link can be opened directly in a browser.
+func DownloadExportHandler(exports *export.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportID, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+
+		download, err := exports.Open(c.Request.Context(), exportID, c.Query("expires"), c.Query("signature"))
+		switch {
+		case errors.Is(err, export.ErrInvalidLink):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, export.ErrLinkExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, export.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, export.ErrNotReady):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Error opening export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open export"})
+			return
+		}
+		defer download.Body.Close()
+
+		c.Header("Content-Disposition", `attachment; filename="`+download.FileName+`"`)
+		c.Header("Cache-Control", "private, no-store")
+		c.DataFromReader(http.StatusOK, download.SizeBytes, download.ContentType, download.Body, nil)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/inbox"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// inboxReplayLimit caps how many missed events are replayed on reconnect before the client is
+	// told to reload instead.
+	inboxReplayLimit = 1000
+	// inboxHeartbeat keeps idle streams open through proxies.
+	inboxHeartbeat = 25 * time.Second
+)
+
+// GetInboxEventsHandler handles GET /v2/client/inbox/events.
+// It streams inbox events as server-sent events: new conversations, new messages, assignment and
+// tracking changes, and escalations. Agents only receive events of conversations assigned to them.
+// A client reconnecting with the Last-Event-ID header, or the cursor query parameter, first gets
+// the events it missed; when those cannot be replayed it gets a reset event and should reload
+// its conversations.
+func GetInboxEventsHandler(hub *inbox.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		cursor := strings.TrimSpace(c.GetHeader("Last-Event-ID"))
+		if cursor == "" {
+			cursor = strings.TrimSpace(c.Query("cursor"))
+		}
+		var last uint
+		if cursor != "" {
+			parsed, err := strconv.ParseUint(cursor, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+				return
+			}
+			last = uint(parsed)
+		}
+
+		viewer := inbox.Viewer{AuthUserID: principal.AuthUserID, All: principal.Can(rbac.ConversationsReadAll)}
+		// Subscribe before replaying so nothing recorded in between is missed.
+		sub := hub.Subscribe(viewer)
+		defer hub.Unsubscribe(sub)
+
+		var missed []inbox.Event
+		truncated := false
+		if last > 0 {
+			var err error
+			missed, truncated, err = hub.Replay(viewer, last, inboxReplayLimit)
+			if err != nil {
+				log.Printf("Error replaying inbox events: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch inbox events"})
+				return
+			}
+		}
+
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		if truncated {
+			fmt.Fprint(c.Writer, "event: reset\ndata: {}\n\n")
+		}
+		for _, event := range missed {
+			if err := writeInboxEvent(c.Writer, event); err != nil {
+				return
+			}
+			last = event.ID
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(inboxHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, open := <-sub.Events:
+				if !open {
+					return
+				}
+				if event.ID <= last {
+					continue
+				}
+				if err := writeInboxEvent(c.Writer, event); err != nil {
+					return
+				}
+				last = event.ID
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeInboxEvent(w io.Writer, event inbox.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding inbox event %d: %v", event.ID, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
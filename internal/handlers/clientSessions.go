@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"smart-chat/internal/services/audit"
+	sessionService "smart-chat/internal/services/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RevokeUserSessionsRequest struct {
+	Mobile string `json:"mobile" binding:"required"`
+}
+
+// GetUserSessionsHandler lists the active chat sessions of the user with the given mobile number.
+func GetUserSessionsHandler(sessions *sessionService.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mobile := strings.TrimSpace(c.Query("mobile"))
+		if mobile == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mobile is required"})
+			return
+		}
+
+		active, err := sessions.ListActiveForMobile(mobile)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": active})
+	}
+}
+
+// RevokeUserSessionsHandler revokes every session of the user with the given mobile number.
+func RevokeUserSessionsHandler(sessions *sessionService.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		var req RevokeUserSessionsRequest
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Mobile) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mobile is required"})
+			return
+		}
+
+		revoked, err := sessions.RevokeAllForMobile(strings.TrimSpace(req.Mobile))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionSessionsRevoke,
+			TargetType: audit.TargetUser,
+			TargetID:   strings.TrimSpace(req.Mobile),
+			Changes:    map[string]audit.Change{"revoked_count": {After: revoked}},
+		})
+
+		c.JSON(http.StatusOK, gin.H{"status": "revoked", "revoked_count": revoked})
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/audit"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/tag"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateTagRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type AddConversationTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// ListTagsHandler handles GET /v2/client/tags.
+// It lists tags by name with how many conversations carry each; vocabulary=true leaves out free tags.
+func ListTagsHandler(tags *tag.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := tags.List(c.Query("vocabulary") == "true")
+		if err != nil {
+			log.Printf("Error listing tags: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tags"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": list})
+	}
+}
+
+// CreateTagHandler handles POST /v2/client/tags.
+// It adds a tag to the vocabulary the analysis job suggests from.
+func CreateTagHandler(tags *tag.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		var req CreateTagRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+
+		created, err := tags.Create(req.Name, principal.AuthUserID)
+		if !writeTagError(c, err, "failed to create tag") {
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionTagCreate,
+			TargetType: audit.TargetTag,
+			TargetID:   strconv.FormatUint(uint64(created.ID), 10),
+			Changes:    map[string]audit.Change{"name": {After: created.Name}},
+		})
+		c.JSON(http.StatusCreated, gin.H{"tag": gin.H{"id": created.ID, "name": created.Name, "vocabulary": true}})
+	}
+}
+
+// DeleteTagHandler handles DELETE /v2/client/tags/:id.
+// It deletes the tag and removes it from every conversation.
+func DeleteTagHandler(tags *tag.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
+		tagID, ok := parseIDParam(c, "id")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag id"})
+			return
+		}
+
+		deleted, err := tags.Delete(tagID)
+		if !writeTagError(c, err, "failed to delete tag") {
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionTagDelete,
+			TargetType: audit.TargetTag,
+			TargetID:   strconv.FormatUint(uint64(deleted.ID), 10),
+			Changes:    map[string]audit.Change{"name": {Before: deleted.Name}},
+		})
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	}
+}
+
+// GetConversationTagsHandler handles GET /v2/client/conversation/:id/tags.
+func GetConversationTagsHandler(historyService *convHistory.ConvHistoryService, tags *tag.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsReadAll)
+		if !ok {
+			return
+		}
+		respondWithConversationTags(c, tags, conversationID)
+	}
+}
+
+// AddConversationTagsHandler handles POST /v2/client/conversation/:id/tags.
+// Unknown names become free tags. Adding a suggested tag confirms it.
+func AddConversationTagsHandler(historyService *convHistory.ConvHistoryService, tags *tag.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+
+		var req AddConversationTagsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tags is required"})
+			return
+		}
+
+		err := tags.Add(conversationID, req.Tags, principal.AuthUserID)
+		if !writeTagError(c, err, "failed to tag conversation") {
+			return
+		}
+		names, _ := tag.NormalizeNames(req.Tags)
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationTagsAdd,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes:    map[string]audit.Change{"tags": {After: names}},
+		})
+		respondWithConversationTags(c, tags, conversationID)
+	}
+}
+
+// RemoveConversationTagHandler handles DELETE /v2/client/conversation/:id/tags/:tagId.
+func RemoveConversationTagHandler(historyService *convHistory.ConvHistoryService, tags *tag.Service, auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, conversationID, ok := conversationFromRequest(c, historyService, rbac.ConversationsWriteAll)
+		if !ok {
+			return
+		}
+		tagID, ok := parseIDParam(c, "tagId")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag id"})
+			return
+		}
+
+		err := tags.Remove(conversationID, tagID)
+		if !writeTagError(c, err, "failed to remove tag") {
+			return
+		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationTagRemove,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(conversationID), 10),
+			Changes:    map[string]audit.Change{"tag_id": {Before: tagID}},
+		})
+		respondWithConversationTags(c, tags, conversationID)
+	}
+}
+
+// writeTagError maps tag errors to responses and reports whether err was nil.
+func writeTagError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, tag.ErrInvalidName), errors.Is(err, tag.ErrTooManyTags):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, tag.ErrTagExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, tag.ErrTagNotFound), errors.Is(err, tag.ErrNotTagged), errors.Is(err, tag.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error updating tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
+
+func respondWithConversationTags(c *gin.Context, tags *tag.Service, conversationID uint) {
+	list, err := tags.ForConversation(conversationID)
+	if err != nil {
+		log.Printf("Error fetching conversation tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tags"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": list})
+}
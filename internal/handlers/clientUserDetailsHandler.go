@@ -7,6 +7,8 @@ import (
 	"strconv"
 
 	"smart-chat/cache"
+	"smart-chat/internal/rbac"
+	convHistory "smart-chat/internal/services/conversation_history"
 	userService "smart-chat/internal/services/user"
 
 	"github.com/gin-gonic/gin"
@@ -14,8 +16,14 @@ import (
 
 // ClientUserDetailsHandler fetches user details based on a conversation ID provided as a query parameter.
 // It first checks the cache, and if not found, calls the user service and then caches the result.
-func ClientUserDetailsHandler(us *userService.UserService) gin.HandlerFunc {
+// Agents may only look up the users of conversations assigned to them.
+func ClientUserDetailsHandler(us *userService.UserService, historyService *convHistory.ConvHistoryService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return
+		}
+
 		convIDStr := c.Query("conv_id")
 		if convIDStr == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "conv_id query parameter is required"})
@@ -28,6 +36,17 @@ func ClientUserDetailsHandler(us *userService.UserService) gin.HandlerFunc {
 			return
 		}
 
+		allowed, err := canAccessConversation(historyService, principal, uint(convID), rbac.ConversationsReadAll)
+		if err != nil {
+			log.Printf("Error checking conversation access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user details"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+
 		// Build the cache key using the format defined in cache.CacheKeys.UserDetails.Key
 		cacheKey := fmt.Sprintf(cache.CacheKeys.UserDetails.Key, convID)
 
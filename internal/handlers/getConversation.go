@@ -43,10 +43,7 @@ func GetConversationHandler(conversationService *conversation.ConversationServic
 		formattedHistory := []gin.H{}
 		for _, messagePair := range firstConversation.MessagePairs {
 			if messagePair.Visible {
-				formattedHistory = append(formattedHistory, gin.H{
-					"UserMessage": messagePair.User,
-					"BotMessage":  messagePair.Bot,
-				})
+				formattedHistory = append(formattedHistory, messageHistoryEntry(messagePair))
 			}
 		}
 
@@ -3,12 +3,14 @@ package handlers
 import (
 	"log"
 	"net/http"
-	"strings"
 
-	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
 	convHistory "smart-chat/internal/services/conversation_history"
 	"smart-chat/internal/services/conversation_history/specification"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/note"
+	"smart-chat/internal/services/sla"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -17,35 +19,12 @@ import (
 func GetConversationByIDHandler(
 	historyService *convHistory.ConvHistoryService,
 	authUserConversationService *authUserConversation.Service,
-	tokenValidator zitadel.TokenValidator,
+	slaService *sla.Service,
+	notes *note.Service,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		rawToken := tokenFromAuthorizationHeader(c.GetHeader("Authorization"))
-		if rawToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
-			return
-		}
-
-		validatedUser, err := tokenValidator.ValidateToken(c.Request.Context(), rawToken)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
-		}
-
-		if validatedUser == nil || validatedUser.ID == nil || strings.TrimSpace(*validatedUser.ID) == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
-		}
-
-		principal, err := authUserConversationService.GetAuthPrincipalByZitadelUserID(*validatedUser.ID)
-		if err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "auth user not found"})
-			return
-		}
-
-		roleName := strings.ToUpper(strings.TrimSpace(principal.RoleName))
-		if roleName != "ADMIN" && roleName != "AGENT" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "agent or admin role required"})
+		principal, ok := principalFromContext(c)
+		if !ok {
 			return
 		}
 
@@ -59,8 +38,9 @@ func GetConversationByIDHandler(
 		}
 
 		specs := []specification.Specification{specification.ByID{ID: uint(id)}}
-		if roleName != "ADMIN" {
-			specs = append(specs, specification.ByAssignedAuthUser{AuthUserID: principal.UserID})
+		scope := assignedScope(principal, rbac.ConversationsReadAll)
+		if scope != nil {
+			specs = append(specs, scope)
 		}
 
 		// Since we only want one conversation, pass offset=0 and limit=1.
@@ -78,8 +58,8 @@ func GetConversationByIDHandler(
 
 		conversation := conversations[0]
 		var trackingAuthUserID *uint
-		if roleName != "ADMIN" {
-			trackingAuthUserID = &principal.UserID
+		if scope != nil {
+			trackingAuthUserID = &principal.AuthUserID
 		}
 
 		tracking, err := authUserConversationService.GetConversationTracking(conversation.ID, trackingAuthUserID)
@@ -89,6 +69,20 @@ func GetConversationByIDHandler(
 			return
 		}
 
+		slaStatus, err := slaService.ForConversation(conversation.ID)
+		if err != nil {
+			log.Printf("Error fetching conversation SLA: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation SLA"})
+			return
+		}
+
+		conversationNotes, err := notes.ForConversation(conversation.ID)
+		if err != nil {
+			log.Printf("Error fetching conversation notes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation notes"})
+			return
+		}
+
 		started := false
 		resolved := false
 		comments := ""
@@ -101,10 +95,7 @@ func GetConversationByIDHandler(
 		formattedHistory := make([]gin.H, 0)
 		for _, messagePair := range conversation.MessagePairs {
 			if messagePair.Visible {
-				formattedHistory = append(formattedHistory, gin.H{
-					"UserMessage": messagePair.User,
-					"BotMessage":  messagePair.Bot,
-				})
+				formattedHistory = append(formattedHistory, clientMessageHistoryEntry(messagePair))
 			}
 		}
 
@@ -113,7 +104,37 @@ func GetConversationByIDHandler(
 			"started":             started,
 			"resolved":            resolved,
 			"comments":            comments,
+			"mode":                conversationModeOf(conversation),
+			"modeExpiresAt":       conversation.ModeExpiresAt,
+			"sla":                 slaStatus,
+			"notes":               conversationNotes,
 			"conversationHistory": formattedHistory,
 		})
 	}
 }
+
+// clientMessageHistoryEntry is messageHistoryEntry with who sent the reply: the bot, or the agent
+// who wrote it through add-message.
+func clientMessageHistoryEntry(pair models.MessagePair) gin.H {
+	entry := messageHistoryEntry(pair)
+	entry["SentBy"] = "bot"
+	if pair.Type == models.MessageTypeAgentAssumedAssistant {
+		entry["SentBy"] = "agent"
+		entry["Agent"] = nil
+		if pair.AuthorAuthUserID != nil {
+			agent := gin.H{"user_id": *pair.AuthorAuthUserID, "name": nil}
+			if pair.AuthorAuthUser != nil {
+				agent["name"] = pair.AuthorAuthUser.Name
+			}
+			entry["Agent"] = agent
+		}
+	}
+	return entry
+}
+
+func conversationModeOf(conversation models.Conversation) string {
+	if conversation.Mode == "" {
+		return models.ConversationModeBot
+	}
+	return conversation.Mode
+}
@@ -1,151 +1,158 @@
 package handlers
 
 import (
-	"errors"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"smart-chat/internal/authservice/zitadel"
 	"smart-chat/internal/constants"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
 	convHistory "smart-chat/internal/services/conversation_history"
 	"smart-chat/internal/services/conversation_history/specification"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/sla"
+	"smart-chat/internal/services/tag"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // GetConversationsWithFiltersHandler fetches conversations with optional filters and pagination.
 func GetConversationsWithFiltersHandler(
 	historyService *convHistory.ConvHistoryService,
 	authUserConversationService *authUserConversation.Service,
-	tokenValidator zitadel.TokenValidator,
+	slaService *sla.Service,
+	tagService *tag.Service,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var specs []specification.Specification
 
-		rawToken := tokenFromAuthorizationHeader(c.GetHeader("Authorization"))
-		if rawToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+		principal, ok := principalFromContext(c)
+		if !ok {
 			return
 		}
 
-		validatedUser, err := tokenValidator.ValidateToken(c.Request.Context(), rawToken)
+		scope := assignedScope(principal, rbac.ConversationsReadAll)
+		if scope != nil {
+			specs = append(specs, scope)
+		}
+
+		// 1. Handle the optional filters: date range, mobile, source, conversation ID, tags and text search.
+		filters := conversationFiltersFromQuery(c)
+		filterSpecs, err := filters.Specifications()
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		specs = append(specs, filterSpecs...)
+		query := strings.TrimSpace(filters.Query)
 
-		if validatedUser == nil || validatedUser.ID == nil || strings.TrimSpace(*validatedUser.ID) == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
+		// 2. Read pagination parameters (defaults: page=1, limit=20). A cursor from a previous
+		// response's next_cursor switches to keyset pagination, which skips the count unless
+		// include_total=true.
+		pageStr := c.DefaultQuery("page", constants.DefaultPageStr)
+		limitStr := c.DefaultQuery("limit", constants.DefaultLimitStr)
+
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			page = constants.DefaultPage
 		}
 
-		principal, err := authUserConversationService.GetAuthPrincipalByZitadelUserID(*validatedUser.ID)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "auth user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve auth user"})
-			return
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			limit = constants.DefaultLimit
 		}
 
-		isAdmin := strings.EqualFold(strings.TrimSpace(principal.RoleName), "ADMIN")
-		if !isAdmin {
-			specs = append(specs, specification.ByAssignedAuthUser{AuthUserID: principal.UserID})
+		sortOrder := strings.ToLower(c.DefaultQuery("sort", constants.DefaultSortStr))
+		if sortOrder != constants.SortAsc && sortOrder != constants.SortDesc {
+			sortOrder = constants.DefaultSortStr
 		}
 
-		// 1. Handle optional date range filters.
-		startDateStr, endDateStr := c.Query("startdate"), c.Query("enddate")
-		if startDateStr != "" && endDateStr != "" {
-			startDate, err := time.Parse(constants.DateFormat, startDateStr)
+		var cursor *convHistory.Cursor
+		if cursorStr := c.Query("cursor"); cursorStr != "" {
+			decoded, err := convHistory.DecodeCursor(cursorStr)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": constants.ErrInvalidStartDate})
+				c.JSON(http.StatusBadRequest, gin.H{"error": constants.ErrInvalidCursor})
 				return
 			}
-
-			endDate, err := time.Parse(constants.DateFormat, endDateStr)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": constants.ErrInvalidEndDate})
+			if c.Query("sort") != "" && strings.ToLower(c.Query("sort")) != decoded.Sort {
+				c.JSON(http.StatusBadRequest, gin.H{"error": constants.ErrCursorSortMismatch})
 				return
 			}
-
-			specs = append(specs, specification.ByDateRange{
-				StartDate: startDate,
-				EndDate:   endDate,
-			})
+			cursor = &decoded
+			sortOrder = decoded.Sort
 		}
+		withTotal := cursor == nil || c.Query("include_total") == "true"
 
-		// 2. Handle mobile filter.
-		if mobile := c.Query("mobile"); mobile != "" {
-			specs = append(specs, specification.ByMobile{Mobile: mobile})
-		}
-
-		// 3. Handle source filter.
-		if source := strings.TrimSpace(c.Query("source")); source != "" {
-			specs = append(specs, specification.BySource{Source: source})
-		}
+		offset := (page - 1) * limit
 
-		// 4. Handle conversation ID filter.
-		if conversationIDStr := strings.TrimSpace(c.Query("conversationid")); conversationIDStr != "" {
-			conversationID, err := strconv.ParseUint(conversationIDStr, 10, 64)
-			if err != nil || conversationID == 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": constants.ErrInvalidConversationID})
+		// 3. Fetch total count (for pagination metadata).
+		var total int64
+		if withTotal {
+			total, err = historyService.CountConversations(specs...)
+			if err != nil {
+				log.Printf("Error counting conversations: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversations count"})
 				return
 			}
-			specs = append(specs, specification.ByID{ID: uint(conversationID)})
 		}
 
-		// 5. Read pagination parameters (defaults: page=1, limit=20).
-		pageStr := c.DefaultQuery("page", constants.DefaultPageStr)
-		limitStr := c.DefaultQuery("limit", constants.DefaultLimitStr)
-
-		page, err := strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			page = constants.DefaultPage
+		// 4. Fetch the paginated conversations (lean: no MessagePairs/FunctionCalls for list performance).
+		// One extra row tells whether there is a next page.
+		var conversations []models.Conversation
+		if cursor != nil {
+			conversations, err = historyService.ListConversationsAfter(*cursor, limit+1, specs...)
+		} else {
+			conversations, err = historyService.ListConversations(offset, limit+1, sortOrder, specs...)
 		}
-
-		limit, err := strconv.Atoi(limitStr)
-		if err != nil || limit < 1 {
-			limit = constants.DefaultLimit
+		if err != nil {
+			log.Printf("Error fetching conversations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversations"})
+			return
 		}
 
-		sortOrder := strings.ToLower(c.DefaultQuery("sort", constants.DefaultSortStr))
-		if sortOrder != constants.SortAsc && sortOrder != constants.SortDesc {
-			sortOrder = constants.DefaultSortStr
+		var nextCursor *string
+		if len(conversations) > limit {
+			conversations = conversations[:limit]
+			encoded := convHistory.CursorAfter(conversations[limit-1], sortOrder).Encode()
+			nextCursor = &encoded
 		}
 
-		offset := (page - 1) * limit
+		conversationIDs := make([]uint, 0, len(conversations))
+		for _, conv := range conversations {
+			conversationIDs = append(conversationIDs, conv.ID)
+		}
 
-		// 6. Fetch total count (for pagination metadata).
-		total, err := historyService.CountConversations(specs...)
+		slaByConversation, err := slaService.ForConversations(conversationIDs)
 		if err != nil {
-			log.Printf("Error counting conversations: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversations count"})
+			log.Printf("Error fetching conversation SLAs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation SLAs"})
 			return
 		}
 
-		// 7. Fetch the paginated conversations (lean: no MessagePairs/FunctionCalls for list performance).
-		conversations, err := historyService.ListConversations(offset, limit, sortOrder, specs...)
+		tagsByConversation, err := tagService.NamesForConversations(conversationIDs)
 		if err != nil {
-			log.Printf("Error fetching conversations: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversations"})
+			log.Printf("Error fetching conversation tags: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching conversation tags"})
 			return
 		}
 
-		// For admin users, skip the auth_user_conversation lookup entirely — all
-		// conversations are already returned and assigned-agent data is not required.
-		var assignedAgentByConversation map[uint]*authUserConversation.AgentUser
-		if !isAdmin {
-			conversationIDs := make([]uint, 0, len(conversations))
-			for _, conv := range conversations {
-				conversationIDs = append(conversationIDs, conv.ID)
+		var matchesByConversation map[uint]*convHistory.TextMatches
+		if query != "" {
+			matchesByConversation, err = historyService.SearchMatches(conversationIDs, query)
+			if err != nil {
+				log.Printf("Error fetching search matches: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching search matches"})
+				return
 			}
+		}
 
+		// For callers who see every conversation (admins), skip the auth_user_conversation lookup entirely — all
+		// conversations are already returned and assigned-agent data is not required.
+		var assignedAgentByConversation map[uint]*authUserConversation.AgentUser
+		if scope != nil {
 			assignedAgentByConversation, err = authUserConversationService.GetAssignedAgentsByConversationIDs(conversationIDs)
 			if err != nil {
 				log.Printf("Error fetching assigned agents: %v", err)
@@ -154,7 +161,7 @@ func GetConversationsWithFiltersHandler(
 			}
 		}
 
-		// 8. Format the response.
+		// 5. Format the response.
 		formattedConversations := make([]gin.H, 0, len(conversations))
 		for _, conv := range conversations {
 			assignedAgent := any(nil)
@@ -165,24 +172,58 @@ func GetConversationsWithFiltersHandler(
 				}
 			}
 
-			formattedConversations = append(formattedConversations, gin.H{
+			formatted := gin.H{
 				"id":             conv.ID,
 				"createdAt":      conv.CreatedAt.Format(time.RFC3339),
 				"username":       conv.Session.User.Name,
 				"mobile":         conv.Session.User.Mobile,
 				"source":         conv.Session.Source,
 				"assigned_agent": assignedAgent,
-			})
+				"sla":            slaByConversation[conv.ID],
+				"tags":           tagNames(tagsByConversation[conv.ID]),
+			}
+			if query != "" {
+				formatted["matches"] = matchesByConversation[conv.ID]
+			}
+			formattedConversations = append(formattedConversations, formatted)
 		}
 
-		// 9. Return conversations plus pagination info.
+		// 6. Return conversations plus pagination info.
+		pagination := gin.H{
+			"limit":       limit,
+			"next_cursor": nextCursor,
+		}
+		if cursor == nil {
+			pagination["page"] = page
+		}
+		if withTotal {
+			pagination["total"] = total
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"conversations": formattedConversations,
-			"pagination": gin.H{
-				"page":  page,
-				"limit": limit,
-				"total": total,
-			},
+			"pagination":    pagination,
 		})
 	}
 }
+
+// tagNames returns names, or an empty list for a conversation without tags.
+func tagNames(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
+
+// conversationFiltersFromQuery reads the conversation list filters from the query string.
+func conversationFiltersFromQuery(c *gin.Context) convHistory.Filters {
+	return convHistory.Filters{
+		StartDate:      c.Query("startdate"),
+		EndDate:        c.Query("enddate"),
+		Mobile:         c.Query("mobile"),
+		Source:         c.Query("source"),
+		ConversationID: c.Query("conversationid"),
+		Tags:           c.Query("tags"),
+		TagsMatch:      c.Query("tags_match"),
+		Query:          c.Query("q"),
+	}
+}
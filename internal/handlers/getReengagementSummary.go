@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"smart-chat/internal/services/reengagement"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxReengagementSummaryDays = 365
+
+// GetReengagementSummaryHandler handles GET /analytics/reengagement.
+// It reports how many nudges were sent in the last `days` days (default 30) and how many recovered the conversation.
+func GetReengagementSummaryHandler(reengagementService *reengagement.ReengagementService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days < 1 || days > maxReengagementSummaryDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return
+		}
+
+		since := time.Now().AddDate(0, 0, -days)
+		summary, err := reengagementService.GetSummary(since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch re-engagement summary"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"days": days, "summary": summary})
+	}
+}
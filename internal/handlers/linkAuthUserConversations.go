@@ -2,9 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
-	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/services/audit"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 
 	"github.com/gin-gonic/gin"
@@ -15,50 +16,33 @@ type LinkAuthUserConversationsRequest struct {
 	ConversationIDs []uint `json:"conversation_ids" binding:"required"`
 }
 
-func LinkAuthUserConversationsHandler(
-	service *authUserConversation.Service,
-	tokenValidator zitadel.TokenValidator,
-) gin.HandlerFunc {
+func LinkAuthUserConversationsHandler(service *authUserConversation.Service, auditLog *audit.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req LinkAuthUserConversationsRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		rawToken := tokenFromAuthorizationHeader(c.GetHeader("Authorization"))
-		if rawToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+		principal, ok := principalFromContext(c)
+		if !ok {
 			return
 		}
 
-		validatedUser, err := tokenValidator.ValidateToken(c.Request.Context(), rawToken)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
-		}
-
-		if validatedUser == nil || validatedUser.ID == nil || strings.TrimSpace(*validatedUser.ID) == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
-		}
-
-		isAdmin, err := service.IsAdminByZitadelUserID(*validatedUser.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify admin role"})
-			return
-		}
-
-		if !isAdmin {
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+		var req LinkAuthUserConversationsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		linkedCount, err := service.LinkConversations(req.UserID, req.ConversationIDs)
+		linkedCount, err := service.LinkConversations(req.UserID, req.ConversationIDs, principal.AuthUserID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationsLink,
+			TargetType: audit.TargetAuthUser,
+			TargetID:   strconv.FormatUint(uint64(req.UserID), 10),
+			Changes: map[string]audit.Change{
+				"conversation_ids": {After: req.ConversationIDs},
+				"linked_count":     {After: linkedCount},
+			},
+		})
 
 		c.JSON(http.StatusOK, gin.H{
 			"status":       "linked",
@@ -1,23 +1,61 @@
 package handlers
 
 import (
-	"smart-chat/internal/store"
+	"encoding/json"
+	"net/http"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/conversation"
 
 	"github.com/gin-gonic/gin"
 )
 
-func ReceiveMessageHandler(c *gin.Context) {
-	accessToken := c.GetHeader("Authorization")
-	conversation, _ := store.GetConversation(accessToken)
-
-	// Format the conversation history for the response
-	formattedHistory := make([]gin.H, 0, len(conversation.Messages))
-	for _, messagePair := range conversation.Messages {
-		formattedHistory = append(formattedHistory, gin.H{
-			"UserMessage": messagePair.UserMessage,
-			"BotMessage":  messagePair.BotMessage,
-		})
+// ReceiveMessageHandler is the legacy /v1/chat/receive endpoint. It returns the session's
+// conversation in the v1 history shape.
+func ReceiveMessageHandler(convService *conversation.ConversationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, exists := c.Get("session")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+			return
+		}
+
+		authSession, ok := session.(models.Session)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+
+		sessionWithConversations, err := convService.GetSessionWithConversations(authSession.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+
+		formattedHistory := []gin.H{}
+		if len(sessionWithConversations.Conversations) > 0 {
+			for _, messagePair := range sessionWithConversations.Conversations[0].MessagePairs {
+				if !messagePair.Visible {
+					continue
+				}
+				formattedHistory = append(formattedHistory, gin.H{
+					"UserMessage": messagePair.User,
+					"BotMessage":  botText(messagePair.Bot),
+				})
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"conversationHistory": formattedHistory})
 	}
+}
 
-	c.JSON(200, gin.H{"conversationHistory": formattedHistory})
+// botText unwraps the {"content": "..."} JSON that v2 stores for bot replies.
+// v1 clients expect the reply as plain text.
+func botText(bot string) string {
+	var parsed struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(bot), &parsed); err != nil || parsed.Content == "" {
+		return bot
+	}
+	return parsed.Content
 }
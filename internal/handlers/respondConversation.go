@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
 	"smart-chat/internal/services/conversation"
 	"smart-chat/internal/services/notifications_job"
+	"smart-chat/internal/services/reengagement"
 	"smart-chat/internal/services/slack"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +20,7 @@ func RespondConversationHandler(
 	convService *conversation.ConversationService,
 	jobService *notifications_job.JobService,
 	slackService *slack.SlackService,
+	reengagementService *reengagement.ReengagementService,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session, exists := c.Get("session")
@@ -30,28 +36,49 @@ func RespondConversationHandler(
 		}
 
 		var reqBody struct {
-			Message string `json:"message" binding:"required"`
+			Message       string `json:"message"`
+			AttachmentIDs []uint `json:"attachment_ids"`
 		}
 		if err := c.ShouldBindJSON(&reqBody); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if strings.TrimSpace(reqBody.Message) == "" && len(reqBody.AttachmentIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "message or attachment_ids is required"})
+			return
+		}
 
 		whatsapp := c.DefaultQuery("whatsapp", "false") == "true"
 		userInput := reqBody.Message
 
+		// WhatsApp users can opt out of (and back into) follow-up nudges with STOP/START.
+		if whatsapp && reengagementService != nil && len(reqBody.AttachmentIDs) == 0 {
+			if reply, handled := reengagementService.HandleKeyword(authSession.UserID, userInput); handled {
+				response := fmt.Sprintf("{\"content\":%q}", reply)
+				go jobService.SendConversationNotification(userInput, response, authSession, slackService)
+				c.JSON(http.StatusOK, gin.H{"response": response})
+				return
+			}
+		}
+
 		// 1. Handle the conversation.
-		response, err := convService.HandleSession(
+		response, err := convService.HandleSessionWithAttachments(
 			authSession.ID,
 			userInput,
+			reqBody.AttachmentIDs,
 			models.MessageTypeUserSent,
 			whatsapp,
 		)
+		if errors.Is(err, attachment.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "attachment not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle session"})
 			return
 		}
-		if whatsapp {
+		// Messages held for an agent in human mode may get no reply.
+		if whatsapp && response != "" {
 			// 2. Run the notification job in the background.
 			go jobService.SendConversationNotification(userInput, response, authSession, slackService)
 		}
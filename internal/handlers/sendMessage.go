@@ -1,120 +1,71 @@
 package handlers
 
 import (
-	"encoding/json"
 	"log"
-	external "smart-chat/external/indian_travellers"
-	"smart-chat/internal/llm_service"
-	"smart-chat/internal/store"
+	"net/http"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/conversation"
 
 	"github.com/gin-gonic/gin"
-	openai "github.com/sashabaranov/go-openai"
 )
 
-func SendMessageHandler(
-	indian_travellers *external.Client,
-) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		accessToken := c.GetHeader("Authorization")
+// v1MessageLimit is the number of messages a v1 conversation accepts.
+const v1MessageLimit = 10
 
-		conversation, _ := store.GetConversation(accessToken)
+// SendMessageHandler is the legacy /v1/chat/send endpoint. It runs the message through the v2
+// conversation pipeline and answers in the v1 response shape, with the bot reply as plain text.
+func SendMessageHandler(convService *conversation.ConversationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, exists := c.Get("session")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+			return
+		}
 
-		// Check if the conversation already has 10 message pairs
-		if len(conversation.Messages) >= 10 {
-			c.JSON(500, gin.H{"error": "Exceeded 10 of conversations"})
+		authSession, ok := session.(models.Session)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing message"})
 			return
 		}
 
 		var jsonData struct {
 			Message string `json:"message" binding:"required"`
 		}
-
 		if err := c.ShouldBindJSON(&jsonData); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
-
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		packages, nil := indian_travellers.GetPackageList()
-		var messages []openai.ChatCompletionMessage
-		systemTemplate := llm_service.SystemMessageTemplate(packages)
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: systemTemplate,
-		})
 
-		for _, pair := range conversation.Messages {
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleUser,
-				Content: pair.UserMessage,
-			}, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleAssistant,
-				Content: pair.BotMessage,
-			})
+		conv, err := convService.GetOrCreateConversation(authSession.ID)
+		if err != nil {
+			log.Printf("Error loading conversation for session %d: %v", authSession.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing message"})
+			return
 		}
 
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: jsonData.Message,
-		})
-
-		typ, response, usedTokens, err := llm_service.GetOpenAIResponse(messages)
+		var sent int64
+		err = convService.DB.Model(&models.MessagePair{}).
+			Where("conversation_id = ? AND type = ?", conv.ID, models.MessageTypeUserSent).
+			Count(&sent).Error
 		if err != nil {
-			log.Printf("Error getting response from OpenAI: %v", err)
-			c.JSON(500, gin.H{"error": "error processing message"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing message"})
+			return
+		}
+		if sent >= v1MessageLimit {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Exceeded 10 of conversations"})
 			return
 		}
-		if typ == "function" {
-			functionDetails := response.(openai.ToolCall)
-			type Package struct {
-				PackageId int `json:"package_id"`
-			}
-			var p Package
-			err := json.Unmarshal([]byte(functionDetails.Function.Arguments), &p)
-			if err != nil {
-				log.Printf("Error getting response from OpenAI: %v", err)
-				c.JSON(500, gin.H{"error": "error processing message"})
-				return
-			}
-			packageDetail, _ := indian_travellers.GetPackageDetails(p.PackageId)
-			packageDetailString, _ := json.Marshal(packageDetail)
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleFunction,
-				Content: string(packageDetailString),
-				Name:    functionDetails.Function.Name,
-			})
-
-			_, response, usedTokens, llm_err := llm_service.GetOpenAIResponse(messages)
-
-			if llm_err != nil {
-				c.JSON(500, gin.H{"error": "error with conversation"})
-				return
-			}
-			messagePair := store.MessagePair{
-				UserMessage: jsonData.Message,
-				BotMessage:  response.(string),
-			}
-			if err := store.AppendToConversation(accessToken, messagePair, usedTokens); err != nil {
-				c.JSON(500, gin.H{"error": "error updating conversation"})
-				return
-			}
-
-			c.JSON(200, gin.H{
-				"status":   "message sent and processed",
-				"response": response,
-			})
-		} else {
-			messagePair := store.MessagePair{
-				UserMessage: jsonData.Message,
-				BotMessage:  response.(string),
-			}
-			if err := store.AppendToConversation(accessToken, messagePair, usedTokens); err != nil {
-				c.JSON(500, gin.H{"error": "error updating conversation"})
-				return
-			}
 
-			c.JSON(200, gin.H{
-				"status":   "message sent and processed",
-				"response": response,
-			})
+		response, err := convService.HandleSession(authSession.ID, jsonData.Message, models.MessageTypeUserSent, false)
+		if err != nil {
+			log.Printf("Error handling v1 message for session %d: %v", authSession.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing message"})
+			return
 		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":   "message sent and processed",
+			"response": botText(response),
+		})
 	}
 }
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"smart-chat/internal/models"
 	"smart-chat/internal/services/conversation"
 	"smart-chat/internal/services/notifications_job"
 	"smart-chat/internal/services/slack"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,6 +35,17 @@ func StartConversationHandler(
 		// Get the whatsapp parameter, default to false
 		whatsapp := c.DefaultQuery("whatsapp", "false") == "true"
 
+		// The optional language code feeds the assignment rules, so record it before the first message.
+		if language := strings.ToLower(strings.TrimSpace(c.Query("language"))); language != "" && len(language) <= 8 {
+			conv, err := conversationService.GetOrCreateConversation(authSession.ID)
+			if err == nil {
+				err = conversationService.SetLanguage(conv.ID, language)
+			}
+			if err != nil {
+				log.Printf("Error recording conversation language: %v", err)
+			}
+		}
+
 		// Here, we're using a hardcoded "Hello" message. In a real application, you'd likely get this from the request.
 		userInput := "Hello!"
 
@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/services/audit"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	"smart-chat/internal/services/slack"
 
@@ -23,8 +24,8 @@ type UpdateAuthUserConversationRequest struct {
 
 func UpdateAuthUserConversationHandler(
 	service *authUserConversation.Service,
-	tokenValidator zitadel.TokenValidator,
 	slackService *slack.SlackService,
+	auditLog *audit.Service,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req UpdateAuthUserConversationRequest
@@ -33,41 +34,16 @@ func UpdateAuthUserConversationHandler(
 			return
 		}
 
-		rawToken := tokenFromAuthorizationHeader(c.GetHeader("Authorization"))
-		if rawToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Required"})
+		principal, ok := principalFromContext(c)
+		if !ok {
 			return
 		}
 
-		validatedUser, err := tokenValidator.ValidateToken(c.Request.Context(), rawToken)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
-		}
-
-		if validatedUser == nil || validatedUser.ID == nil || strings.TrimSpace(*validatedUser.ID) == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
-			return
-		}
-
-		principal, err := service.GetAuthPrincipalByZitadelUserID(*validatedUser.ID)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "auth user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve auth user"})
-			return
-		}
-
-		roleName := strings.ToUpper(strings.TrimSpace(principal.RoleName))
-		if roleName != "ADMIN" && roleName != "AGENT" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "agent or admin role required"})
-			return
-		}
+		// Read the current values first so the audit log keeps what an update overwrites.
+		before, _ := service.GetConversationTracking(req.ConversationID, &principal.AuthUserID)
 
 		updatedLink, err := service.UpdateConversationTracking(authUserConversation.UpdateConversationTrackingInput{
-			AuthUserID:     principal.UserID,
+			AuthUserID:     principal.AuthUserID,
 			ConversationID: req.ConversationID,
 			Started:        req.Started,
 			Resolved:       req.Resolved,
@@ -85,6 +61,13 @@ func UpdateAuthUserConversationHandler(
 			return
 		}
 
+		auditLog.Record(auditActor(c, principal), audit.Entry{
+			Action:     audit.ActionConversationTracking,
+			TargetType: audit.TargetConversation,
+			TargetID:   strconv.FormatUint(uint64(updatedLink.ConversationID), 10),
+			Changes:    audit.Diff(trackingFields(before), trackingFields(updatedLink)),
+		})
+
 		if slackService != nil {
 			slackService.SendSlackNotificationAsync(buildConversationTrackingSlackMessage(updatedLink))
 		}
@@ -105,6 +88,18 @@ func UpdateAuthUserConversationHandler(
 	}
 }
 
+// trackingFields lists the audited tracking fields; nil tracking has none.
+func trackingFields(tracking *authUserConversation.ConversationTracking) map[string]any {
+	if tracking == nil {
+		return map[string]any{}
+	}
+	return map[string]any{
+		"started":  tracking.Started,
+		"resolved": tracking.Resolved,
+		"comments": tracking.Comments,
+	}
+}
+
 func buildConversationTrackingSlackMessage(link *authUserConversation.ConversationTracking) string {
 	agentName := fmt.Sprintf("user_id=%d", link.AuthUserID)
 	if link.AgentName != nil && strings.TrimSpace(*link.AgentName) != "" {
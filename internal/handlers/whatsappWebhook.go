@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	cloudapi "smart-chat/external/whatsapp"
+	"smart-chat/internal/services/whatsapp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxWebhookBodyBytes = 1 << 20 // 1 MiB
+
+// WhatsAppWebhookVerifyHandler answers Meta's GET verification challenge.
+func WhatsAppWebhookVerifyHandler(whatsappService *whatsapp.WhatsAppService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		challenge, ok := whatsappService.VerifySubscription(
+			c.Query("hub.mode"),
+			c.Query("hub.verify_token"),
+			c.Query("hub.challenge"),
+		)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "verification failed"})
+			return
+		}
+
+		c.String(http.StatusOK, challenge)
+	}
+}
+
+// WhatsAppWebhookHandler receives inbound messages and delivery statuses.
+// The signature is checked against the raw body and the messages are stored before Meta gets its 200,
+// so a failure after that is retried from the stored payload; the LLM runs in the background.
+func WhatsAppWebhookHandler(whatsappService *whatsapp.WhatsAppService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodyBytes))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+
+		if !whatsappService.VerifySignature(body, c.GetHeader("X-Hub-Signature-256")) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+
+		var payload cloudapi.WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+
+		senders, err := whatsappService.StoreWebhook(payload)
+		if err != nil {
+			// Meta redelivers webhooks that are not acknowledged with a 200.
+			log.Printf("failed to store whatsapp webhook: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store webhook"})
+			return
+		}
+
+		go func() {
+			if err := whatsappService.ProcessSenders(senders); err != nil {
+				log.Printf("failed to process whatsapp webhook: %v", err)
+			}
+		}()
+
+		c.JSON(http.StatusOK, gin.H{"status": "received"})
+	}
+}
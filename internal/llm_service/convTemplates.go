@@ -32,6 +32,8 @@ func SystemMessageTemplate(packages []external.Package) string {
 		# Function
 		get_package_details : use this function to generate details such as itinerary, inclusion in the package,
 		exclusion in the package, cost for quad sharing, triple sharing and double sharing, for a particular package with id. 
+		request_human_agent : use this function when the user asks to talk to a person, wants to change or cancel a booking,
+		has a complaint, or needs help you cannot give. Pass a short reason and the urgency.
 		 
 		## Pricing
 		Quad sharing means 4 people sharing a room, Triple sharing is 3 people sharing a room, and double sharing is 2 people sharing a room.
@@ -122,6 +124,7 @@ func SystemMessageTemplateForWhatsapp(indian_travellers *external.Client, packag
 		4. After the user selects a trip, ask for their details as per the workflow (name, number of people, date of trip).
 		5. Always follow the state transitions to guide the conversation correctly.
 		6. Use get_package_details function when the user asks for more details about a package.
+		7. Use request_human_agent function when the user asks for a person or needs help you cannot give, with a short reason and the urgency.
 
 		## Example:
 		- First, greet the user and introduce yourself (state: "greeting").
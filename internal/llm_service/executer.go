@@ -16,6 +16,21 @@ import (
 
 var client *openai.Client
 
+// ChatModel is the model that answers conversation messages.
+const ChatModel = openai.GPT4o
+
+// imageInputModels lists the models that accept image_url content parts.
+var imageInputModels = map[string]bool{
+	openai.GPT4o:     true,
+	openai.GPT4oMini: true,
+}
+
+// SupportsImageInput reports whether model can be sent images directly.
+// Other models only receive text descriptions of image attachments.
+func SupportsImageInput(model string) bool {
+	return imageInputModels[model]
+}
+
 func init() {
 	cfg := config.Load()
 	openAIToken := cfg.OpenAIKey
@@ -61,6 +76,7 @@ func GetOpenAIResponsev2(messages []openai.ChatCompletionMessage) (models.Messag
 	ctx := context.Background()
 	var tools = []openai.Tool{
 		{Type: "function", Function: GetPackageDetailsSchema},
+		{Type: "function", Function: RequestHumanAgentSchema},
 	}
 
 	// Define the schema for the response
@@ -72,7 +88,7 @@ func GetOpenAIResponsev2(messages []openai.ChatCompletionMessage) (models.Messag
 	schema, _ := jsonschema.GenerateSchemaForType(ResponseSchema{})
 
 	req := openai.ChatCompletionRequest{
-		Model:    openai.GPT4o,
+		Model:    ChatModel,
 		Messages: messages,
 		Tools:    tools,
 		ResponseFormat: &openai.ChatCompletionResponseFormat{
@@ -113,6 +129,7 @@ func GetOpenAIResponsev2Whatsapp(messages []openai.ChatCompletionMessage) (model
 		{Type: "function", Function: CreateUserInitialQuerySchema},
 		{Type: "function", Function: CreateUserFinalBookingSchema},
 		{Type: "function", Function: FetchUpcomingTripsSchema},
+		{Type: "function", Function: RequestHumanAgentSchema},
 	}
 
 	// Define the schema for the response
@@ -123,7 +140,7 @@ func GetOpenAIResponsev2Whatsapp(messages []openai.ChatCompletionMessage) (model
 	schema, _ := jsonschema.GenerateSchemaForType(ResponseSchema{})
 
 	req := openai.ChatCompletionRequest{
-		Model:    openai.GPT4o,
+		Model:    ChatModel,
 		Messages: messages,
 		Tools:    tools,
 		ResponseFormat: &openai.ChatCompletionResponseFormat{
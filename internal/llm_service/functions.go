@@ -76,3 +76,24 @@ var FetchUpcomingTripsSchema = &openai.FunctionDefinition{
 		Required: []string{"package_id"},
 	},
 }
+
+// Define the schema for handing the conversation over to a human agent
+var RequestHumanAgentSchema = &openai.FunctionDefinition{
+	Name:        "request_human_agent",
+	Description: "Hand the conversation over to a human travel executive when the user asks for one or when you cannot help further",
+	Parameters: jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"reason": {
+				Type:        jsonschema.String,
+				Description: "A short summary of why a human agent is needed, for the agent picking up the conversation",
+			},
+			"urgency": {
+				Type:        jsonschema.String,
+				Enum:        []string{"low", "normal", "high"},
+				Description: "How quickly a human agent should reply",
+			},
+		},
+		Required: []string{"reason", "urgency"},
+	},
+}
@@ -0,0 +1,75 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"smart-chat/internal/models"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const reengagementInstructions = `
+	You are a friendly travel assistant for Indian Travellers Team following up on a WhatsApp conversation.
+	The user stopped replying after your last question. Write one short follow-up message (at most two sentences)
+	that refers to what they were interested in (destination, dates, group size or price) and invites them to continue.
+	Do not repeat the previous message, do not invent prices or offers, do not use markdown, and do not sign off with a name.
+	Reply with the message text only.
+`
+
+// GenerateReengagementNudge writes a personalised follow-up for a conversation the user dropped off from.
+func GenerateReengagementNudge(conversation models.Conversation) (string, error) {
+	messages := []openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: reengagementInstructions,
+	}}
+
+	for _, pair := range conversation.MessagePairs {
+		if !pair.Visible {
+			continue
+		}
+		if pair.User != "" {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: pair.User,
+			})
+		}
+		if pair.Bot != "" {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: botContent(pair.Bot),
+			})
+		}
+	}
+
+	ctx := context.Background()
+	req := openai.ChatCompletionRequest{
+		Model:    openai.GPT4oMini,
+		Messages: messages,
+	}
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		log.Printf("Error creating chat completion: %v", err)
+		return "", err
+	}
+	log.Printf("token usage: %v", resp.Usage.TotalTokens)
+
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no nudge generated")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// botContent unwraps the {"content": "..."} JSON stored for v2 bot replies.
+func botContent(bot string) string {
+	var parsed struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(bot), &parsed); err != nil || parsed.Content == "" {
+		return bot
+	}
+	return parsed.Content
+}
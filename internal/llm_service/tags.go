@@ -0,0 +1,73 @@
+package llm_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"smart-chat/internal/models"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const tagInstructions = `
+	You label conversations between a user and a travel booking assistant for the sales team.
+	Pick the labels from the list below that clearly apply to the conversation, at most five.
+	Only use labels from the list, spelled exactly as given, and pick none when nothing clearly applies.
+	Reply with a JSON object only, in the form {"tags": ["label", ...]}.
+
+	Labels: %s
+`
+
+// SuggestConversationTags picks the tags from vocabulary that describe a conversation.
+func SuggestConversationTags(conversation models.Conversation, vocabulary []string) ([]string, error) {
+	messages := []openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: fmt.Sprintf(tagInstructions, strings.Join(vocabulary, ", ")),
+	}}
+
+	for _, pair := range conversation.MessagePairs {
+		if !pair.Visible {
+			continue
+		}
+		if pair.User != "" {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: pair.User,
+			})
+		}
+		if pair.Bot != "" {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: botContent(pair.Bot),
+			})
+		}
+	}
+
+	ctx := context.Background()
+	req := openai.ChatCompletionRequest{
+		Model:          openai.GPT4oMini,
+		Messages:       messages,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		log.Printf("Error creating chat completion: %v", err)
+		return nil, err
+	}
+	log.Printf("token usage: %v", resp.Usage.TotalTokens)
+
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no tags suggested")
+	}
+	var parsed struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid tag suggestion: %w", err)
+	}
+	return parsed.Tags, nil
+}
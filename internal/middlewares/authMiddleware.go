@@ -1,14 +1,20 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"smart-chat/internal/store"
-	"time"
+	"smart-chat/config"
+	sessionService "smart-chat/internal/services/session"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the legacy /v1/chat routes. v1 access tokens are session tokens,
+// so this is AuthSessionMiddleware with the error responses v1 clients already handle.
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	sessions := sessionService.NewService(db, sessionService.PolicyFromConfig(config.Load()))
 	return func(c *gin.Context) {
 		accessToken := c.GetHeader("Authorization")
 		if accessToken == "" {
@@ -17,21 +23,23 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		conversation, err := store.GetConversation(accessToken)
+		session, err := sessions.Authenticate(accessToken)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			switch {
+			case errors.Is(err, sessionService.ErrSessionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			case errors.Is(err, sessionService.ErrSessionExpired), errors.Is(err, sessionService.ErrSessionRevoked):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "access token expired"})
+			default:
+				log.Println("Database error:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			}
 			c.Abort()
 			return
 		}
 
-		if time.Now().After(conversation.AccessTokenExpireTime) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "access token expired"})
-			c.Abort()
-			return
-		}
-
-		// Store the conversation in the context for use in the handler
-		c.Set("conversation", conversation)
+		c.Set("user", session.User)
+		c.Set("session", session)
 		c.Next()
 	}
 }
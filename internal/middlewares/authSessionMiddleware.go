@@ -1,9 +1,10 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"smart-chat/internal/models"
-	"time"
+	"smart-chat/config"
+	sessionService "smart-chat/internal/services/session"
 
 	"log"
 
@@ -11,7 +12,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// AuthSessionMiddleware authenticates a session access token and slides the session's expiry.
 func AuthSessionMiddleware(db *gorm.DB) gin.HandlerFunc {
+	sessions := sessionService.NewService(db, sessionService.PolicyFromConfig(config.Load()))
 	return func(c *gin.Context) {
 		accessToken := c.GetHeader("Authorization")
 		if accessToken == "" {
@@ -21,27 +24,25 @@ func AuthSessionMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var session models.Session
-		result := db.Preload("User").Where("auth_token = ?", accessToken).First(&session)
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				log.Println("Session not found for token:", accessToken)
+		session, err := sessions.Authenticate(accessToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, sessionService.ErrSessionNotFound):
+				log.Println("Session not found for the presented token")
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "session not found"})
-			} else {
-				log.Println("Database error:", result.Error)
+			case errors.Is(err, sessionService.ErrSessionRevoked):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			case errors.Is(err, sessionService.ErrSessionExpired):
+				log.Println("Session expired for user:", session.UserID)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
+			default:
+				log.Println("Database error:", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 			}
 			c.Abort()
 			return
 		}
 
-		if time.Now().After(session.ExpireAt) {
-			log.Println("Session expired for user:", session.User.ID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
-			c.Abort()
-			return
-		}
-
 		c.Set("user", session.User)
 		c.Set("session", session)
 		c.Next()
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/rbac"
+	authUserService "smart-chat/internal/services/auth_user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authorizer resolves the auth user behind a client bearer token, provisioning it when JIT is
+// enabled, and checks it against the rbac permission matrix.
+type Authorizer struct {
+	authUsers      *authUserService.Service
+	tokenValidator zitadel.TokenValidator
+}
+
+func NewAuthorizer(authUsers *authUserService.Service, tokenValidator zitadel.TokenValidator) *Authorizer {
+	return &Authorizer{authUsers: authUsers, tokenValidator: tokenValidator}
+}
+
+// Require validates the bearer token, stores the caller's *rbac.Principal under rbac.PrincipalKey
+// and aborts unless the caller's role holds the permission.
+func (a *Authorizer) Require(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, status, message := a.resolve(c)
+		if principal == nil {
+			c.JSON(status, gin.H{"error": message})
+			c.Abort()
+			return
+		}
+
+		if !principal.Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": permissionDeniedMessage(permission)})
+			c.Abort()
+			return
+		}
+
+		c.Set(rbac.PrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// Deny refuses every request. It guards client routes that have no declared permission.
+func (a *Authorizer) Deny() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "route has no declared permission"})
+		c.Abort()
+	}
+}
+
+func (a *Authorizer) resolve(c *gin.Context) (*rbac.Principal, int, string) {
+	rawToken := bearerToken(c.GetHeader("Authorization"))
+	if rawToken == "" {
+		return nil, http.StatusUnauthorized, "Authorization Required"
+	}
+
+	validatedUser, err := a.tokenValidator.ValidateToken(c.Request.Context(), rawToken)
+	if err != nil || validatedUser == nil || validatedUser.ID == nil || strings.TrimSpace(*validatedUser.ID) == "" {
+		return nil, http.StatusUnauthorized, "invalid access token"
+	}
+
+	principal, err := a.authUsers.Resolve(validatedUser)
+	switch {
+	case errors.Is(err, authUserService.ErrAuthUserNotFound):
+		return nil, http.StatusForbidden, "auth user not found"
+	case errors.Is(err, authUserService.ErrAuthUserDisabled):
+		return nil, http.StatusForbidden, "auth user disabled"
+	case err != nil:
+		log.Printf("Failed to resolve auth user: %v", err)
+		return nil, http.StatusInternalServerError, "failed to resolve auth user"
+	}
+	return principal, 0, ""
+}
+
+// permissionDeniedMessage names the roles that would have been allowed, e.g. "admin role required".
+func permissionDeniedMessage(permission rbac.Permission) string {
+	roles := rbac.RolesWith(permission)
+	if len(roles) == 0 {
+		return "permission denied"
+	}
+	return strings.ToLower(strings.Join(roles, " or ")) + " role required"
+}
+
+// bearerToken strips an optional "Bearer " prefix; raw tokens are still accepted.
+func bearerToken(authHeader string) string {
+	authHeader = strings.TrimSpace(authHeader)
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+		return strings.TrimSpace(parts[1])
+	}
+	return authHeader
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditEvent records one agent or admin action on a client route. Rows are only ever inserted;
+// the retention job is the only thing that deletes them.
+// Changes holds a JSON object of field -> {"before": ..., "after": ...}.
+type AuditEvent struct {
+	ID                 uint      `gorm:"primaryKey"`
+	CreatedAt          time.Time `gorm:"index;not null"`
+	ActorAuthUserID    *uint     `gorm:"index"`
+	ActorZitadelUserID string    `gorm:"type:varchar(255)"`
+	ActorRole          string    `gorm:"type:varchar(50)"`
+	Action             string    `gorm:"type:varchar(100);not null;index"`
+	TargetType         string    `gorm:"type:varchar(50);not null;index:idx_audit_events_target"`
+	TargetID           string    `gorm:"type:varchar(100);not null;index:idx_audit_events_target"`
+	Changes            []byte    `gorm:"type:json"`
+	IPAddress          string    `gorm:"type:varchar(64)"`
+	UserAgent          string    `gorm:"type:varchar(512)"`
+}
@@ -1,11 +1,31 @@
 package models
 
+import "time"
+
+// Agent availability. The assignment engine only picks available agents.
+const (
+	AgentAvailable = "available"
+	AgentAway      = "away"
+)
+
 type AuthUser struct {
 	UserID        uint    `gorm:"column:user_id;primaryKey;autoIncrement"`
 	ZitadelUserID string  `gorm:"column:zitadel_user_id;type:varchar(255);unique;not null;index"`
 	Name          *string `gorm:"column:name;type:varchar(255)"`
 	Email         *string `gorm:"column:email;type:varchar(255);index"`
 	RoleID        uint    `gorm:"column:role_id;not null"`
+	// PasswordHash is a bcrypt hash for local-credentials login; users without one can only sign in through Zitadel.
+	PasswordHash        *string    `gorm:"column:password_hash;type:varchar(255)"`
+	FailedLoginAttempts int        `gorm:"column:failed_login_attempts;not null;default:0"`
+	LockedUntil         *time.Time `gorm:"column:locked_until"`
+	LastLoginAt         *time.Time `gorm:"column:last_login_at"`
+	// DisabledAt is set when an admin disables the user; disabled users are refused on every client route.
+	DisabledAt *time.Time `gorm:"column:disabled_at"`
+	// Availability is available or away, set by the agent.
+	Availability          string     `gorm:"column:availability;type:varchar(16);not null;default:'available'"`
+	AvailabilityChangedAt *time.Time `gorm:"column:availability_changed_at"`
+	// LastAssignedAt is when the assignment engine last gave the user a conversation.
+	LastAssignedAt *time.Time `gorm:"column:last_assigned_at"`
 }
 
 func (AuthUser) TableName() string {
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type AuthUserConversation struct {
 	gorm.Model
@@ -10,7 +14,11 @@ type AuthUserConversation struct {
 	Conversation   Conversation `gorm:"foreignKey:ConversationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Started        bool         `gorm:"column:started;not null;default:false"`
 	Resolved       bool         `gorm:"column:resolved;not null;default:false"`
-	Comments       string       `gorm:"column:comments;type:text;not null;default:''"`
+	// ResolvedAt is when Resolved was last set, used for resolution SLAs.
+	ResolvedAt *time.Time `gorm:"column:resolved_at"`
+	Comments   string     `gorm:"column:comments;type:text;not null;default:''"`
+	// Primary marks the agent who owns the conversation when several are assigned.
+	Primary bool `gorm:"column:is_primary;not null;default:false"`
 }
 
 func (AuthUserConversation) TableName() string {
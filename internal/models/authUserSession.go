@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthUserSession is a client (agent or admin) session issued by local-credentials login.
+// Token holds the tokenhash form of the bearer token.
+type AuthUserSession struct {
+	gorm.Model
+	AuthUserID uint       `gorm:"column:auth_user_id;not null;index"`
+	AuthUser   AuthUser   `gorm:"foreignKey:AuthUserID;references:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Token      string     `gorm:"column:token;type:varchar(255);uniqueIndex;not null"`
+	IPAddress  string     `gorm:"column:ip_address;type:varchar(64)"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at;not null"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+}
+
+func (AuthUserSession) TableName() string {
+	return "auth_user_sessions"
+}
@@ -1,9 +1,21 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Conversation modes decide who answers inbound user messages.
+const (
+	// ConversationModeBot lets the LLM answer every message.
+	ConversationModeBot = "bot"
+	// ConversationModeHuman stores user messages for the assigned agent without calling the LLM.
+	ConversationModeHuman = "human"
+	// ConversationModePaired keeps the LLM answering while the assigned agent follows along.
+	ConversationModePaired = "paired"
+)
+
 type Conversation struct {
 	gorm.Model
 	SessionID     uint    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
@@ -12,5 +24,14 @@ type Conversation struct {
 	TotalTokens   int
 	MessagePairs  []MessagePair
 	FunctionCalls []FunctionCall
-	Analysed      bool `gorm:"type:bool;not null;default=0"`
+	Analysed      bool   `gorm:"type:bool;not null;default=0"`
+	Mode          string `gorm:"type:varchar(16);not null;default:'bot'"`
+	ModeChangedAt *time.Time
+	ModeChangedBy *uint
+	// ModeExpiresAt is when a human or paired conversation returns to bot mode.
+	ModeExpiresAt *time.Time `gorm:"index"`
+	// EscalatedAt is set while the conversation has an open escalation.
+	EscalatedAt *time.Time `gorm:"index"`
+	// Language is the user's language code when the client sends one, used by assignment rules.
+	Language string `gorm:"type:varchar(8)"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reasons an assignment period ended.
+const (
+	AssignmentEndUnassigned = "unassigned"
+	AssignmentEndReassigned = "reassigned"
+)
+
+// ConversationAssignment is one period during which an auth user was assigned a conversation.
+// The period is open while UnassignedAt is nil; when it ends, the tracking fields of the
+// AuthUserConversation link are archived here and the link is removed.
+type ConversationAssignment struct {
+	gorm.Model
+	ConversationID uint         `gorm:"column:conversation_id;not null;index"`
+	Conversation   Conversation `gorm:"foreignKey:ConversationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	AuthUserID     uint         `gorm:"column:auth_user_id;not null;index"`
+	AuthUser       AuthUser     `gorm:"foreignKey:AuthUserID;references:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Primary        bool         `gorm:"column:is_primary;not null;default:false"`
+	AssignedAt     time.Time    `gorm:"not null"`
+	// AssignedBy and UnassignedBy are nil for automatic assignment.
+	AssignedBy   *uint
+	UnassignedAt *time.Time
+	UnassignedBy *uint
+	EndReason    string `gorm:"type:varchar(16)"`
+	Started      bool   `gorm:"not null;default:false"`
+	Resolved     bool   `gorm:"not null;default:false"`
+	ResolvedAt   *time.Time
+	Comments     string `gorm:"type:text;not null;default:''"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConversationNote is an internal note agents leave on a conversation; users never see it.
+// Replies set ParentID to the top-level note whose thread they belong to. Only top-level notes
+// are pinned.
+type ConversationNote struct {
+	ID               uint      `gorm:"primaryKey"`
+	CreatedAt        time.Time `gorm:"not null"`
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	ConversationID   uint           `gorm:"not null;index"`
+	Conversation     Conversation   `gorm:"foreignKey:ConversationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ParentID         *uint          `gorm:"index"`
+	AuthorAuthUserID uint           `gorm:"column:author_auth_user_id;not null"`
+	Author           AuthUser       `gorm:"foreignKey:AuthorAuthUserID;references:UserID"`
+	Body             string         `gorm:"type:text;not null"`
+	// EditedAt is when the author last changed the body; earlier bodies are ConversationNoteRevision rows.
+	EditedAt *time.Time
+	PinnedAt *time.Time
+	PinnedBy *uint
+}
+
+// ConversationNoteRevision is a note's body as it was before an edit.
+type ConversationNoteRevision struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+	NoteID    uint      `gorm:"not null;index"`
+	Body      string    `gorm:"type:text;not null"`
+	// EditedBy is who replaced this body, at CreatedAt.
+	EditedBy uint `gorm:"not null"`
+}
+
+// ConversationNoteMention is an auth user @mentioned in a note.
+type ConversationNoteMention struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"not null"`
+	NoteID     uint      `gorm:"not null;uniqueIndex:idx_note_mention"`
+	AuthUserID uint      `gorm:"not null;uniqueIndex:idx_note_mention;index"`
+}
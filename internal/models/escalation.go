@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EscalationStatusOpen     = "open"
+	EscalationStatusResolved = "resolved"
+)
+
+const (
+	EscalationUrgencyLow    = "low"
+	EscalationUrgencyNormal = "normal"
+	EscalationUrgencyHigh   = "high"
+)
+
+// Escalation records the bot asking for a human agent through the request_human_agent tool.
+// A conversation has at most one open escalation; later requests update it.
+type Escalation struct {
+	gorm.Model
+	ConversationID     uint         `gorm:"index;not null"`
+	Conversation       Conversation `gorm:"foreignKey:ConversationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Reason             string       `gorm:"type:text;not null"`
+	Urgency            string       `gorm:"type:varchar(16);not null;default:'normal'"`
+	Status             string       `gorm:"type:varchar(16);not null;default:'open';index"`
+	AssignedAuthUserID *uint        `gorm:"index"`
+	ResolvedAt         *time.Time
+	ResolvedBy         *uint
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Export formats.
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatJSONL   = "jsonl"
+	ExportFormatParquet = "parquet"
+)
+
+// Export job statuses.
+const (
+	ExportStatusQueued    = "queued"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+	// ExportStatusExpired is a completed export whose file has been deleted.
+	ExportStatusExpired = "expired"
+)
+
+// ExportJob is a requested bulk export of conversations. Filters holds the list endpoint filters
+// (convHistory.Filters); ScopeAuthUserID limits the export to that agent's conversations when the
+// requester could not read every conversation.
+type ExportJob struct {
+	ID                uint      `gorm:"primaryKey"`
+	CreatedAt         time.Time `gorm:"not null"`
+	UpdatedAt         time.Time
+	RequestedBy       uint   `gorm:"not null;index"`
+	Format            string `gorm:"type:varchar(8);not null"`
+	Filters           []byte `gorm:"type:json"`
+	ScopeAuthUserID   *uint
+	Status            string `gorm:"type:varchar(16);not null;index"`
+	StartedAt         *time.Time
+	CompletedAt       *time.Time
+	ConversationCount int    `gorm:"not null;default:0"`
+	SizeBytes         int64  `gorm:"not null;default:0"`
+	BlobKey           string `gorm:"type:varchar(255)"`
+	Error             string `gorm:"type:text"`
+	// ExpiresAt is when the file is deleted; download links never outlive it.
+	ExpiresAt *time.Time `gorm:"index"`
+}
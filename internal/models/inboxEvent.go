@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// InboxEvent is one change pushed to the client inbox stream. The ID is the stream cursor clients
+// resume from; rows are pruned by the inbox retention job.
+// Audience holds a JSON array of auth user IDs who see the event besides the conversation's
+// current assignees, such as an agent who was just unassigned. Payload holds the event's JSON data.
+type InboxEvent struct {
+	ID             uint      `gorm:"primaryKey"`
+	CreatedAt      time.Time `gorm:"index;not null"`
+	Type           string    `gorm:"type:varchar(32);not null"`
+	ConversationID uint      `gorm:"not null;index"`
+	Audience       []byte    `gorm:"type:json"`
+	Payload        []byte    `gorm:"type:json"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type AttachmentKind string
+
+const (
+	AttachmentKindImage    AttachmentKind = "image"
+	AttachmentKindAudio    AttachmentKind = "audio"
+	AttachmentKindVideo    AttachmentKind = "video"
+	AttachmentKindDocument AttachmentKind = "document"
+	AttachmentKindLocation AttachmentKind = "location"
+)
+
+const (
+	AttachmentUploaderUser  = "user"
+	AttachmentUploaderAgent = "agent"
+)
+
+// MessageAttachment is a file or shared location that belongs to a conversation.
+// It is uploaded first and linked to a MessagePair when the message carrying it is stored.
+// Locations have no blob; their coordinates are stored inline.
+type MessageAttachment struct {
+	gorm.Model
+	ConversationID uint           `gorm:"index;not null"`
+	MessagePairID  *uint          `gorm:"index"`
+	UploadedBy     string         `gorm:"type:varchar(16);not null"`
+	Kind           AttachmentKind `gorm:"type:varchar(16);not null"`
+	FileName       string         `gorm:"type:varchar(255)"`
+	MimeType       string         `gorm:"type:varchar(100)"`
+	SizeBytes      int64
+	StorageKey     string `gorm:"type:varchar(512)"`
+	Caption        string `gorm:"type:text"`
+	Latitude       *float64
+	Longitude      *float64
+	LocationName   string `gorm:"type:varchar(255)"`
+}
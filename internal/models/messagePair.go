@@ -13,17 +13,24 @@ const (
 	MessageTypeOffTopic
 	MessageTypeFunctionCall
 	MessageTypeAgentAssumedAssistant
+	MessageTypeReengagementNudge
+	// MessageTypeUserAwaitingAgent is a user message received in human mode; the LLM did not answer it.
+	MessageTypeUserAwaitingAgent
 )
 
 type MessagePair struct {
 	gorm.Model
-	ConversationID uint           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	Conversation   Conversation   `gorm:"foreignKey:ConversationID;references:ID"`
-	User           string         `gorm:"type:text"`
-	Bot            string         `gorm:"type:text"`
-	BotSummary     string         `gorm:"type:text"`
-	TotalTokens    uint           `gorm:"type:integer;not null"`
-	Visible        bool           `gorm:"type:bool;not null"`
-	Type           MessageType    `gorm:"type:smallint;not null; default:1"`
-	FunctionCalls  []FunctionCall `gorm:"foreignKey:MessageID;references:ID"`
+	ConversationID uint                `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Conversation   Conversation        `gorm:"foreignKey:ConversationID;references:ID"`
+	User           string              `gorm:"type:text"`
+	Bot            string              `gorm:"type:text"`
+	BotSummary     string              `gorm:"type:text"`
+	TotalTokens    uint                `gorm:"type:integer;not null"`
+	Visible        bool                `gorm:"type:bool;not null"`
+	Type           MessageType         `gorm:"type:smallint;not null; default:1"`
+	FunctionCalls  []FunctionCall      `gorm:"foreignKey:MessageID;references:ID"`
+	Attachments    []MessageAttachment `gorm:"foreignKey:MessagePairID;references:ID"`
+	// AuthorAuthUserID is the agent who wrote a MessageTypeAgentAssumedAssistant message.
+	AuthorAuthUserID *uint     `gorm:"column:author_auth_user_id;index"`
+	AuthorAuthUser   *AuthUser `gorm:"foreignKey:AuthorAuthUserID;references:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OTPChallenge is a login code sent by init-login. Only an HMAC of the code is stored.
+// Attempts counts validation tries; when it reaches the limit the challenge is locked and no
+// new code is sent to Mobile until LockedUntil. Mobile is in E.164 form so that every spelling
+// of a number shares the same limits.
+type OTPChallenge struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	Mobile      string    `gorm:"type:varchar(20);index;not null"`
+	IPAddress   string    `gorm:"type:varchar(45);index"`
+	Token       string    `gorm:"type:varchar(255);uniqueIndex;not null"`
+	CodeHash    string    `gorm:"type:varchar(64);not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	LockedUntil *time.Time
+	ConsumedAt  *time.Time
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NudgeStatusPending = "pending"
+	NudgeStatusSent    = "sent"
+	NudgeStatusFailed  = "failed"
+)
+
+const (
+	NudgeOutcomePending    = "pending"
+	NudgeOutcomeRecovered  = "recovered"
+	NudgeOutcomeNoResponse = "no_response"
+	NudgeOutcomeOptedOut   = "opted_out"
+)
+
+// ReengagementNudge records a follow-up sent to a user who stopped replying after the bot asked a question.
+// TriggerMessagePairID is the unanswered bot message; it is unique so a drop-off is nudged at most once.
+// Outcome tracks whether the user came back (recovered), stayed silent (no_response) or opted out.
+type ReengagementNudge struct {
+	gorm.Model
+	ConversationID       uint `gorm:"index;not null"`
+	UserID               uint `gorm:"index;not null"`
+	TriggerMessagePairID uint `gorm:"uniqueIndex;not null"`
+	NudgeMessagePairID   *uint
+	Message              string `gorm:"type:text"`
+	Status               string `gorm:"type:varchar(16);not null;default:'pending'"`
+	Error                string `gorm:"type:text"`
+	SentAt               *time.Time
+	Outcome              string `gorm:"type:varchar(16);not null;default:'pending';index"`
+	RespondedAt          *time.Time
+}
@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// SLA metrics measured from a conversation's first assignment.
+const (
+	SLAMetricFirstResponse = "first_response"
+	SLAMetricResolution    = "resolution"
+)
+
+// SLA alert levels.
+const (
+	SLAAlertWarning = "warning"
+	SLAAlertBreach  = "breach"
+)
+
+// SLAAlert records that the SLA job alerted about a conversation's metric, so each warning and
+// breach is sent once.
+type SLAAlert struct {
+	gorm.Model
+	ConversationID uint         `gorm:"not null;uniqueIndex:idx_sla_alert"`
+	Conversation   Conversation `gorm:"foreignKey:ConversationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Metric         string       `gorm:"type:varchar(16);not null;uniqueIndex:idx_sla_alert"`
+	Level          string       `gorm:"type:varchar(16);not null;uniqueIndex:idx_sla_alert"`
+}
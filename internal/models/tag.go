@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// How a tag got onto a conversation.
+const (
+	TagSourceManual    = "manual"
+	TagSourceSuggested = "suggested"
+)
+
+// Tag labels conversations, such as "honeymoon" or "price objection". Names are stored lower-case.
+// Vocabulary tags are managed by admins and are the only ones the analysis job suggests; agents may
+// also add free tags, which are created on first use.
+type Tag struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"not null"`
+	Name       string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Vocabulary bool      `gorm:"not null;default:false"`
+	CreatedBy  *uint
+}
+
+// ConversationTag attaches a tag to a conversation. AddedBy is empty for suggested tags.
+type ConversationTag struct {
+	ID             uint         `gorm:"primaryKey"`
+	CreatedAt      time.Time    `gorm:"not null"`
+	ConversationID uint         `gorm:"not null;uniqueIndex:idx_conversation_tag"`
+	Conversation   Conversation `gorm:"foreignKey:ConversationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TagID          uint         `gorm:"not null;uniqueIndex:idx_conversation_tag;index"`
+	Tag            Tag          `gorm:"foreignKey:TagID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Source         string       `gorm:"type:varchar(16);not null"`
+	AddedBy        *uint
+}
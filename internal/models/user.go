@@ -13,15 +13,26 @@ type User struct {
 	OTP            string    `gorm:"type:varchar(4); not null"`
 	AccessToken    string    `gorm:"type:varchar(255); not null"`
 	AccessExpireAt time.Time `gorm:"not null"`
-	Sessions       []Session
+	// ReengagementOptedOutAt is set when the user asks not to receive follow-up nudges.
+	ReengagementOptedOutAt *time.Time
+	Sessions               []Session
 }
 
+// Session is a login. AuthToken is the access token and ExpireAt slides forward on activity.
+// RefreshToken (rotated on every use) gets a new access token until RefreshExpireAt;
+// PreviousRefreshToken is the one it replaced, kept to detect replays. Tokens are stored hashed,
+// see internal/tokenhash. A revoked session is rejected whatever its expiry.
 type Session struct {
 	gorm.Model
-	UserID        uint   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	User          User   `gorm:"foreignKey:UserID;references:ID"`
-	AuthToken     string `gorm:"type:varchar(255)"`
-	ExpireAt      time.Time
-	Source        string         `gorm:"type:varchar(15);default:'website'"`
-	Conversations []Conversation `gorm:"foreignKey:SessionID;"`
+	UserID               uint   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	User                 User   `gorm:"foreignKey:UserID;references:ID"`
+	AuthToken            string `gorm:"type:varchar(255);index"`
+	ExpireAt             time.Time
+	RefreshToken         string `gorm:"type:varchar(255);index"`
+	PreviousRefreshToken string `gorm:"type:varchar(255);index"`
+	RefreshExpireAt      *time.Time
+	LastSeenAt           *time.Time
+	RevokedAt            *time.Time
+	Source               string         `gorm:"type:varchar(15);default:'website'"`
+	Conversations        []Conversation `gorm:"foreignKey:SessionID;"`
 }
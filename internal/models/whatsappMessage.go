@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	WhatsAppDirectionInbound  = "inbound"
+	WhatsAppDirectionOutbound = "outbound"
+)
+
+// WhatsAppMessage records every message exchanged through the native WhatsApp webhook.
+// The unique WAMessageID lets us drop the retries Meta sends for already processed messages
+// and attach delivery statuses to the replies we sent. Inbound rows keep the raw message in
+// Payload so a run that failed after Meta got its 200 can be retried.
+type WhatsAppMessage struct {
+	gorm.Model
+	WAMessageID    string `gorm:"column:wa_message_id;type:varchar(255);uniqueIndex;not null"`
+	WaID           string `gorm:"column:wa_id;type:varchar(20);index;not null"`
+	Direction      string `gorm:"column:direction;type:varchar(10);not null"`
+	SessionID      uint   `gorm:"column:session_id;index"`
+	ConversationID uint   `gorm:"column:conversation_id;index"`
+	Status         string `gorm:"column:status;type:varchar(20);not null;default:'received'"`
+	Payload        []byte `gorm:"column:payload;type:json"`
+	Attempts       int    `gorm:"column:attempts;not null;default:0"`
+}
+
+func (WhatsAppMessage) TableName() string {
+	return "whatsapp_messages"
+}
@@ -0,0 +1,80 @@
+package otp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConsoleSender writes codes to a writer instead of delivering them. It is meant for local
+// development, where no SMS gateway is available.
+type ConsoleSender struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewConsoleSender(out io.Writer) *ConsoleSender {
+	return &ConsoleSender{out: out}
+}
+
+func (s *ConsoleSender) Name() string {
+	return ProviderConsole
+}
+
+func (s *ConsoleSender) Send(ctx context.Context, mobile, code string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	recipient, err := ParseMobile(mobile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.out, "[otp] %s code for %s: %s\n", time.Now().Format(time.RFC3339), recipient.E164, code)
+	return err
+}
+
+// FileSender appends codes to a file, so tests and local tooling can read them back.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Name() string {
+	return ProviderFile
+}
+
+func (s *FileSender) Send(ctx context.Context, mobile, code string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	recipient, err := ParseMobile(mobile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create OTP file directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open OTP file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), recipient.E164, code)
+	return err
+}
@@ -0,0 +1,49 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Failover tries each sender in order until one delivers the code.
+type Failover struct {
+	senders []OTPSender
+}
+
+func NewFailover(senders ...OTPSender) *Failover {
+	return &Failover{senders: senders}
+}
+
+func (f *Failover) Name() string {
+	names := make([]string, 0, len(f.senders))
+	for _, sender := range f.senders {
+		names = append(names, sender.Name())
+	}
+	return "failover(" + strings.Join(names, ",") + ")"
+}
+
+func (f *Failover) Send(ctx context.Context, mobile, code string) error {
+	if _, err := ParseMobile(mobile); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sender := range f.senders {
+		err := sender.Send(ctx, mobile, code)
+		if err == nil {
+			if len(errs) > 0 {
+				log.Printf("OTP for %s delivered by %s after %d failed provider(s)", MaskMobile(mobile), sender.Name(), len(errs))
+			}
+			return nil
+		}
+		log.Printf("OTP provider %s failed for %s: %v", sender.Name(), MaskMobile(mobile), err)
+		errs = append(errs, fmt.Errorf("%s: %w", sender.Name(), err))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"smart-chat/config"
+)
+
+// Provider names accepted in Config.OTPProviders.
+const (
+	ProviderFast2SMS     = "fast2sms"
+	ProviderHTTPTemplate = "http"
+	ProviderWhatsApp     = "whatsapp"
+	ProviderConsole      = "console"
+	ProviderFile         = "file"
+)
+
+// DefaultCountryCode is assumed for mobiles given without one.
+const DefaultCountryCode = "91"
+
+var (
+	ErrInvalidMobile     = errors.New("invalid mobile number")
+	ErrUnsupportedMobile = errors.New("mobile number is not supported by this provider")
+)
+
+// OTPSender delivers a one-time code to a mobile number.
+// Implementations must not include the code in returned errors or logs.
+type OTPSender interface {
+	Name() string
+	Send(ctx context.Context, mobile, code string) error
+}
+
+// Recipient is a mobile number in the formats different gateways expect.
+type Recipient struct {
+	// E164 is the number with a leading plus, e.g. +919876543210.
+	E164 string
+	// Digits is E164 without the plus, as used by the WhatsApp Cloud API.
+	Digits string
+	// CountryCode and National are set when the number is in DefaultCountryCode.
+	CountryCode string
+	National    string
+}
+
+// ParseMobile normalizes a mobile number. Ten digit numbers without a country code are
+// taken to be in DefaultCountryCode.
+func ParseMobile(mobile string) (Recipient, error) {
+	cleaned := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(mobile))
+	hasPlus := strings.HasPrefix(cleaned, "+")
+	digits := strings.TrimPrefix(cleaned, "+")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Recipient{}, ErrInvalidMobile
+	}
+	if !hasPlus && len(digits) == 10 {
+		digits = DefaultCountryCode + digits
+	}
+	if len(digits) < 8 || len(digits) > 15 {
+		return Recipient{}, ErrInvalidMobile
+	}
+
+	recipient := Recipient{E164: "+" + digits, Digits: digits}
+	if strings.HasPrefix(digits, DefaultCountryCode) && len(digits) == len(DefaultCountryCode)+10 {
+		recipient.CountryCode = DefaultCountryCode
+		recipient.National = digits[len(DefaultCountryCode):]
+	}
+	return recipient, nil
+}
+
+// MaskMobile hides all but the last four digits of a mobile number for logging.
+func MaskMobile(mobile string) string {
+	if len(mobile) <= 4 {
+		return "****"
+	}
+	return strings.Repeat("*", len(mobile)-4) + mobile[len(mobile)-4:]
+}
+
+// New builds the sender configured in cfg.OTPProviders, a comma-separated list tried in order.
+// The console and file sinks write codes in plain text and are refused in production.
+func New(cfg *config.Config) (OTPSender, error) {
+	var senders []OTPSender
+	for _, name := range strings.Split(cfg.OTPProviders, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		sender, err := newProvider(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, sender)
+	}
+
+	switch len(senders) {
+	case 0:
+		return nil, errors.New("no OTP provider configured")
+	case 1:
+		return senders[0], nil
+	default:
+		return NewFailover(senders...), nil
+	}
+}
+
+func newProvider(cfg *config.Config, name string) (OTPSender, error) {
+	switch name {
+	case ProviderFast2SMS:
+		if cfg.FAST2SMS_API_KEY == "" {
+			return nil, errors.New("fast2sms OTP provider requires FAST2SMS_API_KEY")
+		}
+		return NewFast2SMSSender(cfg.OTPFast2SMSURL, cfg.FAST2SMS_API_KEY), nil
+	case ProviderHTTPTemplate:
+		return NewHTTPTemplateSender(cfg.OTPHTTPMethod, cfg.OTPHTTPURL, cfg.OTPHTTPHeaders, cfg.OTPHTTPBodyTemplate)
+	case ProviderWhatsApp:
+		if cfg.OTPWhatsAppTemplate == "" {
+			return nil, errors.New("whatsapp OTP provider requires OTPWhatsAppTemplate")
+		}
+		return NewWhatsAppSender(cfg.WhatsAppGraphBaseURL, cfg.WhatsAppPhoneNumberID, cfg.WhatsAppAccessToken, cfg.OTPWhatsAppTemplate, cfg.OTPWhatsAppLanguage), nil
+	case ProviderConsole, ProviderFile:
+		if os.Getenv("SMART_CHAT_ENV") == "prod" {
+			return nil, fmt.Errorf("%s OTP provider is not allowed in production", name)
+		}
+		if name == ProviderFile {
+			return NewFileSender(cfg.OTPFilePath), nil
+		}
+		return NewConsoleSender(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown OTP provider %q", name)
+	}
+}
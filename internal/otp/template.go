@@ -0,0 +1,126 @@
+package otp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is available to the URL and body templates of an HTTPTemplateSender.
+type TemplateData struct {
+	Recipient
+	Code string
+}
+
+var templateFuncs = template.FuncMap{
+	// json renders a value as a JSON literal, for building JSON bodies safely.
+	"json": func(v any) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// HTTPTemplateSender calls any SMS gateway with a templated request, e.g.
+//
+//	URL:  https://sms.example.com/send?to={{urlquery .Digits}}
+//	Body: {"to": {{json .E164}}, "otp": {{json .Code}}}
+//
+// Any 2xx response counts as delivered.
+type HTTPTemplateSender struct {
+	method  string
+	url     *template.Template
+	headers map[string]string
+	body    *template.Template
+	client  *http.Client
+}
+
+// NewHTTPTemplateSender parses the templates. headers is a JSON object of header names to values.
+func NewHTTPTemplateSender(method, urlTemplate, headers, bodyTemplate string) (*HTTPTemplateSender, error) {
+	if strings.TrimSpace(urlTemplate) == "" {
+		return nil, errors.New("http OTP provider requires OTPHTTPURL")
+	}
+	if method = strings.ToUpper(strings.TrimSpace(method)); method == "" {
+		method = http.MethodPost
+	}
+
+	urlTmpl, err := template.New("url").Funcs(templateFuncs).Option("missingkey=error").Parse(urlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTP HTTP URL template: %w", err)
+	}
+	var bodyTmpl *template.Template
+	if strings.TrimSpace(bodyTemplate) != "" {
+		bodyTmpl, err = template.New("body").Funcs(templateFuncs).Option("missingkey=error").Parse(bodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTP HTTP body template: %w", err)
+		}
+	}
+	headerMap := map[string]string{}
+	if strings.TrimSpace(headers) != "" {
+		if err := json.Unmarshal([]byte(headers), &headerMap); err != nil {
+			return nil, fmt.Errorf("invalid OTP HTTP headers, expected a JSON object: %w", err)
+		}
+	}
+
+	return &HTTPTemplateSender{
+		method:  method,
+		url:     urlTmpl,
+		headers: headerMap,
+		body:    bodyTmpl,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *HTTPTemplateSender) Name() string {
+	return ProviderHTTPTemplate
+}
+
+func (s *HTTPTemplateSender) Send(ctx context.Context, mobile, code string) error {
+	recipient, err := ParseMobile(mobile)
+	if err != nil {
+		return err
+	}
+	data := TemplateData{Recipient: recipient, Code: code}
+
+	var target bytes.Buffer
+	if err := s.url.Execute(&target, data); err != nil {
+		return fmt.Errorf("failed to render OTP HTTP URL: %w", err)
+	}
+	var body io.Reader
+	if s.body != nil {
+		var rendered bytes.Buffer
+		if err := s.body.Execute(&rendered, data); err != nil {
+			return fmt.Errorf("failed to render OTP HTTP body: %w", err)
+		}
+		body = &rendered
+	}
+
+	req, err := http.NewRequestWithContext(ctx, s.method, target.String(), body)
+	if err != nil {
+		return errors.New("failed to create OTP HTTP request")
+	}
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call OTP HTTP gateway: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodyBytes))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("OTP HTTP gateway returned status %s", resp.Status)
+	}
+	return nil
+}
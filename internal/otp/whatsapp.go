@@ -0,0 +1,50 @@
+package otp
+
+import (
+	"context"
+	"strings"
+
+	"smart-chat/external/whatsapp"
+)
+
+// WhatsAppSender sends codes as a WhatsApp authentication template. The template needs a body
+// variable for the code and a copy-code button, which is how Meta defines authentication templates.
+type WhatsAppSender struct {
+	client   *whatsapp.Client
+	template string
+	language string
+}
+
+func NewWhatsAppSender(baseURL, phoneNumberID, accessToken, template, language string) *WhatsAppSender {
+	if strings.TrimSpace(language) == "" {
+		language = "en"
+	}
+	return &WhatsAppSender{
+		client:   whatsapp.NewClient(baseURL, phoneNumberID, accessToken),
+		template: template,
+		language: language,
+	}
+}
+
+func (s *WhatsAppSender) Name() string {
+	return ProviderWhatsApp
+}
+
+func (s *WhatsAppSender) Send(ctx context.Context, mobile, code string) error {
+	recipient, err := ParseMobile(mobile)
+	if err != nil {
+		return err
+	}
+
+	codeParameter := []whatsapp.TemplateParameter{{Type: "text", Text: code}}
+	// The code only travels in the request body, so client errors are safe to return as they are.
+	_, err = s.client.SendTemplateMessage(ctx, recipient.Digits, whatsapp.SendTemplate{
+		Name:     s.template,
+		Language: whatsapp.TemplateLanguage{Code: s.language},
+		Components: []whatsapp.TemplateComponent{
+			{Type: "body", Parameters: codeParameter},
+			{Type: "button", SubType: "url", Index: "0", Parameters: codeParameter},
+		},
+	})
+	return err
+}
@@ -0,0 +1,106 @@
+// Package rbac maps auth roles to the permissions that /v2/client routes require.
+//
+// Routes declare a permission rather than a role, and RolePermissions is the only place that
+// says which role holds which permission. Scoped permissions come in pairs: a route declares the
+// narrower ":assigned" permission and the handler widens its query when the caller also holds
+// the matching ":all" one.
+package rbac
+
+import "strings"
+
+// Permission names an action on a resource, optionally with a scope: "resource:action[:scope]".
+type Permission string
+
+const (
+	// Public marks a route that needs no client token, such as the login itself.
+	Public Permission = "public"
+
+	ConversationsReadAssigned  Permission = "conversations:read:assigned"
+	ConversationsReadAll       Permission = "conversations:read:all"
+	ConversationsWriteAssigned Permission = "conversations:write:assigned"
+	ConversationsWriteAll      Permission = "conversations:write:all"
+	ConversationsAssign        Permission = "conversations:assign"
+	ConversationsExport        Permission = "conversations:export"
+	AgentsRead                 Permission = "agents:read"
+	AnalyticsRead              Permission = "analytics:read"
+	SessionsManage             Permission = "sessions:manage"
+	AuthUsersManage            Permission = "auth_users:manage"
+	AuditRead                  Permission = "audit:read"
+	TagsManage                 Permission = "tags:manage"
+)
+
+const (
+	RoleAdmin = "ADMIN"
+	RoleAgent = "AGENT"
+)
+
+// Roles lists the known roles, least privileged first.
+var Roles = []string{RoleAgent, RoleAdmin}
+
+// RolePermissions is the permission matrix.
+var RolePermissions = map[string][]Permission{
+	RoleAgent: {
+		ConversationsReadAssigned,
+		ConversationsWriteAssigned,
+		ConversationsExport,
+	},
+	RoleAdmin: {
+		ConversationsReadAssigned,
+		ConversationsReadAll,
+		ConversationsWriteAssigned,
+		ConversationsWriteAll,
+		ConversationsAssign,
+		ConversationsExport,
+		AgentsRead,
+		AnalyticsRead,
+		SessionsManage,
+		AuthUsersManage,
+		AuditRead,
+		TagsManage,
+	},
+}
+
+// PrincipalKey is the gin context key holding the *Principal of an authorized client request.
+const PrincipalKey = "principal"
+
+// Principal is the auth user behind a client request.
+type Principal struct {
+	AuthUserID    uint
+	ZitadelUserID string
+	// Role is upper-cased.
+	Role string
+}
+
+// Can reports whether the principal's role holds the permission.
+func (p *Principal) Can(permission Permission) bool {
+	return p != nil && Allows(p.Role, permission)
+}
+
+// Allows reports whether role holds the permission. Role names are case-insensitive.
+func Allows(role string, permission Permission) bool {
+	if permission == Public {
+		return true
+	}
+	for _, granted := range RolePermissions[NormalizeRole(role)] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolesWith returns the roles holding the permission, in the order of Roles.
+func RolesWith(permission Permission) []string {
+	var roles []string
+	for _, role := range Roles {
+		if Allows(role, permission) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// NormalizeRole upper-cases and trims a role name as stored in auth_roles.
+func NormalizeRole(role string) string {
+	return strings.ToUpper(strings.TrimSpace(role))
+}
@@ -1,25 +1,43 @@
 package routes
 
 import (
+	"log"
+	"net/http"
+
+	"smart-chat/internal/authservice/local"
 	"smart-chat/internal/authservice/zitadel"
-	"smart-chat/external/indian_travellers"
 	"smart-chat/internal/handlers"
+	middleware "smart-chat/internal/middlewares"
+	"smart-chat/internal/rbac"
 	"smart-chat/internal/services/analytics"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/audit"
+	authUserService "smart-chat/internal/services/auth_user"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	"smart-chat/internal/services/conversation"
 	convHistory "smart-chat/internal/services/conversation_history"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/internal/services/escalation"
+	"smart-chat/internal/services/export"
 	"smart-chat/internal/services/human"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/note"
 	"smart-chat/internal/services/notifications_job"
+	"smart-chat/internal/services/reengagement"
+	sessionService "smart-chat/internal/services/session"
+	"smart-chat/internal/services/sla"
 	"smart-chat/internal/services/slack"
+	"smart-chat/internal/services/tag"
 	userService "smart-chat/internal/services/user"
+	"smart-chat/internal/services/whatsapp"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(group *gin.RouterGroup, indian_travellers *indian_travellers.Client) {
+func RegisterRoutes(group *gin.RouterGroup, convService *conversation.ConversationService) {
 	group.GET("/ping", handlers.PingHandler)
-	group.POST("/send", handlers.SendMessageHandler(indian_travellers))
-	group.GET("/receive", handlers.ReceiveMessageHandler)
+	group.POST("/send", handlers.SendMessageHandler(convService))
+	group.GET("/receive", handlers.ReceiveMessageHandler(convService))
 }
 
 func RegisterV2Routes(
@@ -27,13 +45,22 @@ func RegisterV2Routes(
 	convService *conversation.ConversationService,
 	jobService *notifications_job.JobService,
 	slackService *slack.SlackService,
+	attachmentService *attachment.Service,
+	reengagementService *reengagement.ReengagementService,
 ) {
 
 	group.POST("/start", handlers.StartConversationHandler(convService, jobService, slackService))
 	group.GET("/messages", handlers.GetConversationHandler(convService))
 
 	group.POST("/message",
-		handlers.RespondConversationHandler(convService, jobService, slackService))
+		handlers.RespondConversationHandler(convService, jobService, slackService, reengagementService))
+	group.POST("/attachments", handlers.UploadChatAttachmentHandler(convService, attachmentService))
+	group.GET("/attachments/:id", handlers.GetChatAttachmentHandler(attachmentService))
+}
+
+func RegisterWhatsAppRoutes(group *gin.RouterGroup, whatsappService *whatsapp.WhatsAppService) {
+	group.GET("/webhook", handlers.WhatsAppWebhookVerifyHandler(whatsappService))
+	group.POST("/webhook", handlers.WhatsAppWebhookHandler(whatsappService))
 }
 
 func ClientRoutes(
@@ -45,16 +72,159 @@ func ClientRoutes(
 	jobService *notifications_job.JobService,
 	slackService *slack.SlackService,
 	authUserConversationService *authUserConversation.Service,
+	attachmentService *attachment.Service,
+	reengagementService *reengagement.ReengagementService,
+	sessions *sessionService.Service,
+	localAuth *local.Service,
+	authUsers *authUserService.Service,
+	auditLog *audit.Service,
+	modes *conversationMode.Service,
+	escalations *escalation.Service,
+	assignments *authUserConversation.Engine,
+	slaService *sla.Service,
+	inboxHub *inbox.Hub,
+	tagService *tag.Service,
+	exports *export.Service,
+	notes *note.Service,
 	tokenValidator zitadel.TokenValidator,
 ) {
-	group.POST("/login", handlers.ClientAdminLoginHandler())
-	group.GET("/conversation/:id", handlers.GetConversationByIDHandler(convHistoryService, authUserConversationService, tokenValidator))
-	group.GET("/conversations", handlers.GetConversationsWithFiltersHandler(convHistoryService, authUserConversationService, tokenValidator))
-	group.GET("/analytics/dashboard/conversations-summary", handlers.GetDashboardConversationSummaryHandler(analyticsService))
-	group.GET("/analytics/conversations/last-30-days", handlers.GetConversationsCountLast30DaysHandler(analyticsService))
-	group.GET("/agents", handlers.GetAgentsHandler(authUserConversationService, tokenValidator))
-	group.GET("/userdetails", handlers.ClientUserDetailsHandler(us))
-	group.POST("/add-message", handlers.AddMessageHandler(humanService, jobService, slackService))
-	group.POST("/conversations/link", handlers.LinkAuthUserConversationsHandler(authUserConversationService, tokenValidator))
-	group.PATCH("/conversations/tracking", handlers.UpdateAuthUserConversationHandler(authUserConversationService, tokenValidator, slackService))
+	client := clientRouter{group: group, authorizer: middleware.NewAuthorizer(authUsers, tokenValidator)}
+
+	client.handle(http.MethodPost, "/login", handlers.ClientAdminLoginHandler(localAuth))
+	client.handle(http.MethodPost, "/logout", handlers.ClientAdminLogoutHandler(localAuth))
+	client.handle(http.MethodGet, "/conversation/:id", handlers.GetConversationByIDHandler(convHistoryService, authUserConversationService, slaService, notes))
+	client.handle(http.MethodPost, "/conversation/:id/attachments", handlers.UploadConversationAttachmentHandler(convHistoryService, attachmentService, auditLog))
+	client.handle(http.MethodPatch, "/conversation/:id/mode", handlers.UpdateConversationModeHandler(convHistoryService, modes, auditLog))
+	client.handle(http.MethodGet, "/conversation/:id/assignments", handlers.GetConversationAssignmentsHandler(convHistoryService, authUserConversationService))
+	client.handle(http.MethodPost, "/conversation/:id/reassign", handlers.ReassignConversationHandler(convHistoryService, authUserConversationService, auditLog))
+	client.handle(http.MethodPost, "/conversation/:id/unassign", handlers.UnassignConversationHandler(convHistoryService, authUserConversationService, auditLog))
+	client.handle(http.MethodPut, "/conversation/:id/primary", handlers.SetConversationPrimaryHandler(convHistoryService, authUserConversationService, auditLog))
+	client.handle(http.MethodGet, "/conversations/:id/notes", handlers.ListConversationNotesHandler(convHistoryService, notes))
+	client.handle(http.MethodPost, "/conversations/:id/notes", handlers.CreateConversationNoteHandler(convHistoryService, notes))
+	client.handle(http.MethodPatch, "/conversations/:id/notes/:noteId", handlers.UpdateConversationNoteHandler(convHistoryService, notes))
+	client.handle(http.MethodDelete, "/conversations/:id/notes/:noteId", handlers.DeleteConversationNoteHandler(convHistoryService, notes, auditLog))
+	client.handle(http.MethodGet, "/conversations/:id/notes/:noteId/history", handlers.GetConversationNoteHistoryHandler(convHistoryService, notes))
+	client.handle(http.MethodPut, "/conversations/:id/notes/:noteId/pin", handlers.PinConversationNoteHandler(convHistoryService, notes, auditLog, true))
+	client.handle(http.MethodDelete, "/conversations/:id/notes/:noteId/pin", handlers.PinConversationNoteHandler(convHistoryService, notes, auditLog, false))
+	client.handle(http.MethodGet, "/conversation/:id/tags", handlers.GetConversationTagsHandler(convHistoryService, tagService))
+	client.handle(http.MethodPost, "/conversation/:id/tags", handlers.AddConversationTagsHandler(convHistoryService, tagService, auditLog))
+	client.handle(http.MethodDelete, "/conversation/:id/tags/:tagId", handlers.RemoveConversationTagHandler(convHistoryService, tagService, auditLog))
+	client.handle(http.MethodGet, "/attachments/:id", handlers.GetClientAttachmentHandler(convHistoryService, attachmentService))
+	client.handle(http.MethodGet, "/conversations", handlers.GetConversationsWithFiltersHandler(convHistoryService, authUserConversationService, slaService, tagService))
+	client.handle(http.MethodGet, "/analytics/dashboard/conversations-summary", handlers.GetDashboardConversationSummaryHandler(analyticsService))
+	client.handle(http.MethodGet, "/analytics/conversations/last-30-days", handlers.GetConversationsCountLast30DaysHandler(analyticsService))
+	client.handle(http.MethodGet, "/analytics/reengagement", handlers.GetReengagementSummaryHandler(reengagementService))
+	client.handle(http.MethodGet, "/agents", handlers.GetAgentsHandler(authUserConversationService))
+	client.handle(http.MethodGet, "/agents/me/availability", handlers.GetAgentAvailabilityHandler(assignments))
+	client.handle(http.MethodPatch, "/agents/me/availability", handlers.UpdateAgentAvailabilityHandler(assignments, auditLog))
+	client.handle(http.MethodGet, "/userdetails", handlers.ClientUserDetailsHandler(us, convHistoryService))
+	client.handle(http.MethodPost, "/add-message", handlers.AddMessageHandler(humanService, convHistoryService, jobService, slackService, auditLog, modes))
+	client.handle(http.MethodGet, "/inbox/events", handlers.GetInboxEventsHandler(inboxHub))
+	client.handle(http.MethodGet, "/escalations", handlers.GetEscalationsHandler(escalations))
+	client.handle(http.MethodPost, "/escalations/:id/resolve", handlers.ResolveEscalationHandler(convHistoryService, escalations, auditLog))
+	client.handle(http.MethodPost, "/conversations/link", handlers.LinkAuthUserConversationsHandler(authUserConversationService, auditLog))
+	client.handle(http.MethodPatch, "/conversations/tracking", handlers.UpdateAuthUserConversationHandler(authUserConversationService, slackService, auditLog))
+	client.handle(http.MethodGet, "/sessions", handlers.GetUserSessionsHandler(sessions))
+	client.handle(http.MethodPost, "/sessions/revoke", handlers.RevokeUserSessionsHandler(sessions, auditLog))
+	client.handle(http.MethodGet, "/auth-users", handlers.ListAuthUsersHandler(authUsers))
+	client.handle(http.MethodPost, "/auth-users", handlers.CreateAuthUserHandler(authUsers, auditLog))
+	client.handle(http.MethodPatch, "/auth-users/:id/role", handlers.UpdateAuthUserRoleHandler(authUsers, auditLog))
+	client.handle(http.MethodPost, "/auth-users/:id/disable", handlers.DisableAuthUserHandler(authUsers, auditLog))
+	client.handle(http.MethodPost, "/auth-users/:id/enable", handlers.EnableAuthUserHandler(authUsers, auditLog))
+	client.handle(http.MethodGet, "/auth-roles", handlers.ListAuthRolesHandler(authUsers))
+	client.handle(http.MethodPost, "/auth-roles", handlers.CreateAuthRoleHandler(authUsers, auditLog))
+	client.handle(http.MethodDelete, "/auth-roles/:id", handlers.DeleteAuthRoleHandler(authUsers, auditLog))
+	client.handle(http.MethodGet, "/tags", handlers.ListTagsHandler(tagService))
+	client.handle(http.MethodPost, "/tags", handlers.CreateTagHandler(tagService, auditLog))
+	client.handle(http.MethodDelete, "/tags/:id", handlers.DeleteTagHandler(tagService, auditLog))
+	client.handle(http.MethodGet, "/exports", handlers.ListExportsHandler(exports))
+	client.handle(http.MethodPost, "/exports", handlers.CreateExportHandler(exports, auditLog))
+	client.handle(http.MethodGet, "/exports/:id", handlers.GetExportHandler(exports))
+	client.handle(http.MethodGet, "/exports/:id/download", handlers.DownloadExportHandler(exports))
+	client.handle(http.MethodGet, "/audit", handlers.GetAuditEventsHandler(auditLog))
+}
+
+// ClientRoutePermissions declares the permission each /v2/client route requires, keyed by
+// "METHOD /path" relative to the group. Which roles hold a permission is decided in rbac.
+var ClientRoutePermissions = map[string]rbac.Permission{
+	"POST /login":  rbac.Public,
+	"POST /logout": rbac.Public,
+	// Download links are signed; the signature stands in for the token.
+	"GET /exports/:id/download": rbac.Public,
+
+	"GET /conversation/:id":                        rbac.ConversationsReadAssigned,
+	"GET /conversations":                           rbac.ConversationsReadAssigned,
+	"GET /attachments/:id":                         rbac.ConversationsReadAssigned,
+	"GET /userdetails":                             rbac.ConversationsReadAssigned,
+	"POST /conversation/:id/attachments":           rbac.ConversationsWriteAssigned,
+	"PATCH /conversation/:id/mode":                 rbac.ConversationsWriteAssigned,
+	"POST /add-message":                            rbac.ConversationsWriteAssigned,
+	"PATCH /conversations/tracking":                rbac.ConversationsWriteAssigned,
+	"POST /conversations/link":                     rbac.ConversationsAssign,
+	"GET /conversation/:id/assignments":            rbac.ConversationsReadAssigned,
+	"POST /conversation/:id/reassign":              rbac.ConversationsAssign,
+	"POST /conversation/:id/unassign":              rbac.ConversationsAssign,
+	"PUT /conversation/:id/primary":                rbac.ConversationsAssign,
+	"GET /conversation/:id/tags":                   rbac.ConversationsReadAssigned,
+	"POST /conversation/:id/tags":                  rbac.ConversationsWriteAssigned,
+	"DELETE /conversation/:id/tags/:tagId":         rbac.ConversationsWriteAssigned,
+	"GET /conversations/:id/notes":                 rbac.ConversationsReadAssigned,
+	"POST /conversations/:id/notes":                rbac.ConversationsWriteAssigned,
+	"PATCH /conversations/:id/notes/:noteId":       rbac.ConversationsWriteAssigned,
+	"DELETE /conversations/:id/notes/:noteId":      rbac.ConversationsWriteAssigned,
+	"GET /conversations/:id/notes/:noteId/history": rbac.ConversationsReadAssigned,
+	"PUT /conversations/:id/notes/:noteId/pin":     rbac.ConversationsWriteAssigned,
+	"DELETE /conversations/:id/notes/:noteId/pin":  rbac.ConversationsWriteAssigned,
+	"GET /tags":                     rbac.ConversationsReadAssigned,
+	"GET /inbox/events":             rbac.ConversationsReadAssigned,
+	"GET /escalations":              rbac.ConversationsReadAssigned,
+	"POST /escalations/:id/resolve": rbac.ConversationsWriteAssigned,
+
+	"GET /agents":                   rbac.AgentsRead,
+	"GET /agents/me/availability":   rbac.ConversationsReadAssigned,
+	"PATCH /agents/me/availability": rbac.ConversationsWriteAssigned,
+
+	"GET /analytics/dashboard/conversations-summary": rbac.AnalyticsRead,
+	"GET /analytics/conversations/last-30-days":      rbac.AnalyticsRead,
+	"GET /analytics/reengagement":                    rbac.AnalyticsRead,
+
+	"GET /sessions":         rbac.SessionsManage,
+	"POST /sessions/revoke": rbac.SessionsManage,
+
+	"GET /auth-users":              rbac.AuthUsersManage,
+	"POST /auth-users":             rbac.AuthUsersManage,
+	"PATCH /auth-users/:id/role":   rbac.AuthUsersManage,
+	"POST /auth-users/:id/disable": rbac.AuthUsersManage,
+	"POST /auth-users/:id/enable":  rbac.AuthUsersManage,
+	"GET /auth-roles":              rbac.AuthUsersManage,
+	"POST /auth-roles":             rbac.AuthUsersManage,
+	"DELETE /auth-roles/:id":       rbac.AuthUsersManage,
+
+	"POST /tags":       rbac.TagsManage,
+	"DELETE /tags/:id": rbac.TagsManage,
+
+	"GET /exports":     rbac.ConversationsExport,
+	"POST /exports":    rbac.ConversationsExport,
+	"GET /exports/:id": rbac.ConversationsExport,
+
+	"GET /audit": rbac.AuditRead,
+}
+
+// clientRouter registers client routes behind the permission declared in ClientRoutePermissions.
+type clientRouter struct {
+	group      *gin.RouterGroup
+	authorizer *middleware.Authorizer
+}
+
+func (r clientRouter) handle(method, path string, handler gin.HandlerFunc) {
+	permission, declared := ClientRoutePermissions[method+" "+path]
+	switch {
+	case !declared:
+		log.Printf("Client route %s %s has no declared permission and will refuse every request", method, path)
+		r.group.Handle(method, path, r.authorizer.Deny(), handler)
+	case permission == rbac.Public:
+		r.group.Handle(method, path, handler)
+	default:
+		r.group.Handle(method, path, r.authorizer.Require(permission), handler)
+	}
 }
@@ -0,0 +1,365 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmpty           = errors.New("attachment is empty")
+	ErrTooLarge        = errors.New("attachment exceeds the maximum allowed size")
+	ErrUnsupportedType = errors.New("unsupported attachment type")
+	ErrInvalidLocation = errors.New("invalid location coordinates")
+	ErrNotFound        = errors.New("attachment not found")
+	ErrNoContent       = errors.New("attachment has no stored content")
+)
+
+// allowedMimeTypes is the upload allowlist and the kind each type is stored as.
+var allowedMimeTypes = map[string]models.AttachmentKind{
+	"image/jpeg":      models.AttachmentKindImage,
+	"image/png":       models.AttachmentKindImage,
+	"image/webp":      models.AttachmentKindImage,
+	"audio/ogg":       models.AttachmentKindAudio,
+	"audio/mpeg":      models.AttachmentKindAudio,
+	"audio/mp4":       models.AttachmentKindAudio,
+	"audio/aac":       models.AttachmentKindAudio,
+	"audio/amr":       models.AttachmentKindAudio,
+	"video/mp4":       models.AttachmentKindVideo,
+	"video/3gpp":      models.AttachmentKindVideo,
+	"application/pdf": models.AttachmentKindDocument,
+}
+
+// opaqueMimeTypes cannot be recognised from their first bytes, so the declared type is trusted
+// when sniffing only yields application/octet-stream.
+var opaqueMimeTypes = map[string]bool{
+	"audio/aac":  true,
+	"audio/amr":  true,
+	"audio/mp4":  true,
+	"video/3gpp": true,
+}
+
+var fileExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"audio/ogg":       ".ogg",
+	"audio/mpeg":      ".mp3",
+	"audio/mp4":       ".m4a",
+	"audio/aac":       ".aac",
+	"audio/amr":       ".amr",
+	"video/mp4":       ".mp4",
+	"video/3gpp":      ".3gp",
+	"application/pdf": ".pdf",
+}
+
+// UploadInput describes a file to store for a conversation.
+type UploadInput struct {
+	ConversationID   uint
+	UploadedBy       string
+	FileName         string
+	DeclaredMimeType string
+	Caption          string
+	Body             io.Reader
+}
+
+// LocationInput describes a location shared in a conversation.
+type LocationInput struct {
+	ConversationID uint
+	UploadedBy     string
+	Latitude       float64
+	Longitude      float64
+	Name           string
+}
+
+// Service validates attachments, stores their content in a blob store and keeps their metadata.
+type Service struct {
+	db       *gorm.DB
+	store    blobstore.Store
+	maxBytes int64
+}
+
+func NewService(db *gorm.DB, store blobstore.Store, maxBytes int64) *Service {
+	return &Service{db: db, store: store, maxBytes: maxBytes}
+}
+
+// MaxBytes is the largest upload the service accepts.
+func (s *Service) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// Upload validates the size and content type of a file, writes it to the blob store and records it.
+// The content type is sniffed from the file itself; the declared type is only trusted for formats
+// that cannot be sniffed.
+func (s *Service) Upload(ctx context.Context, input UploadInput) (*models.MessageAttachment, error) {
+	content, err := io.ReadAll(io.LimitReader(input.Body, s.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if len(content) == 0 {
+		return nil, ErrEmpty
+	}
+	if int64(len(content)) > s.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	mimeType, err := DetectMimeType(content, input.DeclaredMimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := storageKey(input.ConversationID, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(ctx, key, bytes.NewReader(content), mimeType); err != nil {
+		return nil, err
+	}
+
+	attachment := models.MessageAttachment{
+		ConversationID: input.ConversationID,
+		UploadedBy:     input.UploadedBy,
+		Kind:           allowedMimeTypes[mimeType],
+		FileName:       cleanFileName(input.FileName, mimeType),
+		MimeType:       mimeType,
+		SizeBytes:      int64(len(content)),
+		StorageKey:     key,
+		Caption:        strings.TrimSpace(input.Caption),
+	}
+	if err := s.db.Create(&attachment).Error; err != nil {
+		if delErr := s.store.Delete(ctx, key); delErr != nil {
+			return nil, fmt.Errorf("failed to save attachment: %w (cleanup failed: %v)", err, delErr)
+		}
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	return &attachment, nil
+}
+
+// CreateLocation records a shared location. Locations have no blob content.
+func (s *Service) CreateLocation(input LocationInput) (*models.MessageAttachment, error) {
+	if input.Latitude < -90 || input.Latitude > 90 || input.Longitude < -180 || input.Longitude > 180 {
+		return nil, ErrInvalidLocation
+	}
+
+	latitude, longitude := input.Latitude, input.Longitude
+	attachment := models.MessageAttachment{
+		ConversationID: input.ConversationID,
+		UploadedBy:     input.UploadedBy,
+		Kind:           models.AttachmentKindLocation,
+		Latitude:       &latitude,
+		Longitude:      &longitude,
+		LocationName:   strings.TrimSpace(input.Name),
+	}
+	if err := s.db.Create(&attachment).Error; err != nil {
+		return nil, fmt.Errorf("failed to save location: %w", err)
+	}
+	return &attachment, nil
+}
+
+// GetByID returns the attachment with the given ID.
+func (s *Service) GetByID(id uint) (*models.MessageAttachment, error) {
+	var attachment models.MessageAttachment
+	if err := s.db.First(&attachment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetForUser returns the attachment only if it belongs to one of the chat user's conversations.
+func (s *Service) GetForUser(id, userID uint) (*models.MessageAttachment, error) {
+	var attachment models.MessageAttachment
+	err := s.db.
+		Joins("JOIN conversations ON conversations.id = message_attachments.conversation_id").
+		Joins("JOIN sessions ON sessions.id = conversations.session_id").
+		Where("message_attachments.id = ? AND sessions.user_id = ?", id, userID).
+		First(&attachment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// LoadUnlinked returns the given attachments if they all belong to the conversation and are not
+// yet part of a message.
+func (s *Service) LoadUnlinked(conversationID uint, ids []uint) ([]models.MessageAttachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var attachments []models.MessageAttachment
+	err := s.db.
+		Where("id IN ? AND conversation_id = ? AND message_pair_id IS NULL", uniqueIDs(ids), conversationID).
+		Order("id asc").
+		Find(&attachments).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) != len(uniqueIDs(ids)) {
+		return nil, ErrNotFound
+	}
+	return attachments, nil
+}
+
+// Open returns a reader for the stored content of an attachment.
+func (s *Service) Open(ctx context.Context, attachment *models.MessageAttachment) (io.ReadCloser, error) {
+	if attachment.StorageKey == "" {
+		return nil, ErrNoContent
+	}
+	return s.store.Get(ctx, attachment.StorageKey)
+}
+
+// ImageDataURL returns an image attachment as a base64 data URL for LLM image inputs.
+func (s *Service) ImageDataURL(ctx context.Context, attachment *models.MessageAttachment) (string, error) {
+	if attachment.Kind != models.AttachmentKindImage {
+		return "", ErrUnsupportedType
+	}
+
+	reader, err := s.Open(ctx, attachment)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment %d: %w", attachment.ID, err)
+	}
+	return "data:" + attachment.MimeType + ";base64," + base64.StdEncoding.EncodeToString(content), nil
+}
+
+// LinkToMessage attaches previously uploaded attachments to a message pair.
+// Pass a transaction to link atomically with the message insert.
+func LinkToMessage(db *gorm.DB, conversationID, messagePairID uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ids = uniqueIDs(ids)
+	result := db.Model(&models.MessageAttachment{}).
+		Where("id IN ? AND conversation_id = ? AND message_pair_id IS NULL", ids, conversationID).
+		Update("message_pair_id", messagePairID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to link attachments: %w", result.Error)
+	}
+	if result.RowsAffected != int64(len(ids)) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Describe renders an attachment as text for the LLM history.
+func Describe(attachment models.MessageAttachment) string {
+	who := "User"
+	if attachment.UploadedBy == models.AttachmentUploaderAgent {
+		who = "Agent"
+	}
+
+	var what string
+	switch attachment.Kind {
+	case models.AttachmentKindImage:
+		what = fmt.Sprintf("an image %q", attachment.FileName)
+	case models.AttachmentKindAudio:
+		what = "a voice note"
+	case models.AttachmentKindVideo:
+		what = fmt.Sprintf("a video %q", attachment.FileName)
+	case models.AttachmentKindDocument:
+		what = fmt.Sprintf("a document %q", attachment.FileName)
+	case models.AttachmentKindLocation:
+		what = "a location"
+		if attachment.LocationName != "" {
+			what += ": " + attachment.LocationName
+		}
+		if attachment.Latitude != nil && attachment.Longitude != nil {
+			what += fmt.Sprintf(" (%.6f, %.6f)", *attachment.Latitude, *attachment.Longitude)
+		}
+	default:
+		what = "a file"
+	}
+
+	description := fmt.Sprintf("[%s shared %s", who, what)
+	if attachment.Caption != "" {
+		description += fmt.Sprintf(" with caption %q", attachment.Caption)
+	}
+	return description + "]"
+}
+
+// DetectMimeType sniffs the content type and checks it against the allowlist.
+func DetectMimeType(content []byte, declared string) (string, error) {
+	sniffed := normalizeMimeType(http.DetectContentType(content))
+	declared = normalizeMimeType(declared)
+
+	switch sniffed {
+	case "application/ogg":
+		sniffed = "audio/ogg"
+	case "video/mp4":
+		// MP4 audio and video share a container.
+		if declared == "audio/mp4" {
+			sniffed = declared
+		}
+	case "application/octet-stream":
+		if opaqueMimeTypes[declared] {
+			sniffed = declared
+		}
+	}
+
+	if _, ok := allowedMimeTypes[sniffed]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return sniffed, nil
+}
+
+func normalizeMimeType(mimeType string) string {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+func storageKey(conversationID uint, mimeType string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate storage key: %w", err)
+	}
+	return fmt.Sprintf("attachments/%d/%s%s", conversationID, hex.EncodeToString(random), fileExtensions[mimeType]), nil
+}
+
+func cleanFileName(name, mimeType string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "attachment" + fileExtensions[mimeType]
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,280 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded by client handlers.
+const (
+	ActionConversationsLink      = "conversations.link"
+	ActionConversationTracking   = "conversations.tracking.update"
+	ActionConversationAddMessage = "conversations.add_message"
+	ActionConversationAttachment = "conversations.attachment.upload"
+	ActionConversationMode       = "conversations.mode.update"
+	ActionConversationReassign   = "conversations.reassign"
+	ActionConversationUnassign   = "conversations.unassign"
+	ActionConversationPrimary    = "conversations.primary.update"
+	ActionConversationTagsAdd    = "conversations.tags.add"
+	ActionConversationTagRemove  = "conversations.tags.remove"
+	ActionConversationNotePin    = "conversations.notes.pin"
+	ActionConversationNoteDelete = "conversations.notes.delete"
+	ActionEscalationResolve      = "escalations.resolve"
+	ActionSessionsRevoke         = "sessions.revoke"
+	ActionAuthUserCreate         = "auth_users.create"
+	ActionAuthUserRoleChange     = "auth_users.role.update"
+	ActionAuthUserDisable        = "auth_users.disable"
+	ActionAuthUserEnable         = "auth_users.enable"
+	ActionAuthUserAvailability   = "auth_users.availability.update"
+	ActionAuthRoleCreate         = "auth_roles.create"
+	ActionAuthRoleDelete         = "auth_roles.delete"
+	ActionTagCreate              = "tags.create"
+	ActionTagDelete              = "tags.delete"
+	ActionExportCreate           = "exports.create"
+)
+
+// Target types.
+const (
+	TargetConversation = "conversation"
+	TargetAuthUser     = "auth_user"
+	TargetAuthRole     = "auth_role"
+	TargetEscalation   = "escalation"
+	TargetTag          = "tag"
+	TargetExport       = "export"
+	TargetUser         = "user"
+)
+
+// pruneBatchSize bounds each DELETE of the retention job.
+const pruneBatchSize = 1000
+
+// DefaultRetention is used when the configured retention is not positive.
+const DefaultRetention = 365 * 24 * time.Hour
+
+// RetentionFromConfig returns how long audit events are kept.
+func RetentionFromConfig(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.AuditRetentionDays) * 24 * time.Hour
+}
+
+// Actor is who performed an action, and from where.
+type Actor struct {
+	AuthUserID    uint
+	ZitadelUserID string
+	Role          string
+	IPAddress     string
+	UserAgent     string
+}
+
+// Change is one field's value before and after an action. A nil Before means the value was created.
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Entry is an action to record.
+type Entry struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Changes    map[string]Change
+}
+
+// Event is an audit event as returned by the API.
+type Event struct {
+	ID              uint            `json:"id"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ActorAuthUserID *uint           `json:"actor_auth_user_id"`
+	ActorZitadelID  string          `json:"actor_zitadel_user_id"`
+	ActorRole       string          `json:"actor_role"`
+	Action          string          `json:"action"`
+	TargetType      string          `json:"target_type"`
+	TargetID        string          `json:"target_id"`
+	Changes         json.RawMessage `json:"changes"`
+	IPAddress       string          `json:"ip_address"`
+	UserAgent       string          `json:"user_agent"`
+}
+
+// Filter narrows List. Zero fields do not filter.
+type Filter struct {
+	ActorAuthUserID uint
+	Action          string
+	TargetType      string
+	TargetID        string
+	From            time.Time
+	To              time.Time
+}
+
+// Service appends and queries audit events.
+type Service struct {
+	db        *gorm.DB
+	retention time.Duration
+	slack     *slack.SlackService
+}
+
+// NewService returns a Service. slackService may be nil, in which case failed writes are only logged.
+func NewService(db *gorm.DB, retention time.Duration, slackService *slack.SlackService) *Service {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Service{db: db, retention: retention, slack: slackService}
+}
+
+// Record appends an event. It runs after the audited change has been made, so a failed write is
+// logged and alerted on rather than undoing the change.
+func (s *Service) Record(actor Actor, entry Entry) {
+	if s == nil {
+		return
+	}
+	var changes []byte
+	if len(entry.Changes) > 0 {
+		encoded, err := json.Marshal(entry.Changes)
+		if err != nil {
+			log.Printf("Failed to encode audit changes for %s: %v", entry.Action, err)
+		} else {
+			changes = encoded
+		}
+	}
+
+	event := models.AuditEvent{
+		ActorZitadelUserID: actor.ZitadelUserID,
+		ActorRole:          actor.Role,
+		Action:             entry.Action,
+		TargetType:         entry.TargetType,
+		TargetID:           entry.TargetID,
+		Changes:            changes,
+		IPAddress:          truncate(actor.IPAddress, 64),
+		UserAgent:          truncate(actor.UserAgent, 512),
+	}
+	if actor.AuthUserID != 0 {
+		actorID := actor.AuthUserID
+		event.ActorAuthUserID = &actorID
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		message := fmt.Sprintf("Failed to write audit event %s on %s %s by auth user %d: %v",
+			entry.Action, entry.TargetType, entry.TargetID, actor.AuthUserID, err)
+		log.Print(message)
+		if s.slack != nil {
+			s.slack.SendSlackAlertAsync(message)
+		}
+	}
+}
+
+// List returns matching events, newest first, and the total number of matches.
+func (s *Service) List(filter Filter, offset, limit int) ([]Event, int64, error) {
+	query := s.db.Model(&models.AuditEvent{})
+	if filter.ActorAuthUserID != 0 {
+		query = query.Where("actor_auth_user_id = ?", filter.ActorAuthUserID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []models.AuditEvent
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	events := make([]Event, 0, len(rows))
+	for _, row := range rows {
+		changes := json.RawMessage(row.Changes)
+		if len(changes) == 0 {
+			changes = json.RawMessage("{}")
+		}
+		events = append(events, Event{
+			ID:              row.ID,
+			CreatedAt:       row.CreatedAt,
+			ActorAuthUserID: row.ActorAuthUserID,
+			ActorZitadelID:  row.ActorZitadelUserID,
+			ActorRole:       row.ActorRole,
+			Action:          row.Action,
+			TargetType:      row.TargetType,
+			TargetID:        row.TargetID,
+			Changes:         changes,
+			IPAddress:       row.IPAddress,
+			UserAgent:       row.UserAgent,
+		})
+	}
+	return events, total, nil
+}
+
+// Prune deletes events older than the retention period, in batches, and returns how many were deleted.
+func (s *Service) Prune(now time.Time) (int64, error) {
+	cutoff := now.Add(-s.retention)
+	var deleted int64
+	for {
+		batch := s.db.Where("id IN (?)",
+			s.db.Model(&models.AuditEvent{}).Select("id").Where("created_at < ?", cutoff).Limit(pruneBatchSize),
+		).Delete(&models.AuditEvent{})
+		if batch.Error != nil {
+			return deleted, batch.Error
+		}
+		deleted += batch.RowsAffected
+		if batch.RowsAffected < pruneBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// RunRetention is the cron entry point for Prune.
+func (s *Service) RunRetention() {
+	deleted, err := s.Prune(time.Now())
+	if err != nil {
+		log.Printf("Audit retention run failed: %v", err)
+		if s.slack != nil {
+			s.slack.SendSlackAlertAsync(fmt.Sprintf("Audit retention run failed: *%v*", err))
+		}
+		return
+	}
+	log.Printf("Audit retention run: deleted=%d", deleted)
+}
+
+// Diff returns the fields whose values differ between before and after. Fields missing from
+// before are reported with a nil Before.
+func Diff(before, after map[string]any) map[string]Change {
+	changes := map[string]Change{}
+	for field, newValue := range after {
+		oldValue, existed := before[field]
+		if existed && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes[field] = Change{Before: oldValue, After: newValue}
+	}
+	for field, oldValue := range before {
+		if _, ok := after[field]; !ok {
+			changes[field] = Change{Before: oldValue, After: nil}
+		}
+	}
+	return changes
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
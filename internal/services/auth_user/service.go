@@ -0,0 +1,521 @@
+package auth_user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAuthUserNotFound = errors.New("auth user not found")
+	ErrAuthUserDisabled = errors.New("auth user disabled")
+	ErrAuthUserExists   = errors.New("auth user already exists")
+	ErrRoleNotFound     = errors.New("role not found")
+	ErrRoleExists       = errors.New("role already exists")
+	ErrRoleInUse        = errors.New("role is assigned to auth users")
+	ErrBuiltInRole      = errors.New("built-in roles cannot be deleted")
+	ErrInvalidRoleName  = errors.New("role name must be 1-50 letters, digits or underscores")
+	// ErrLastAdmin refuses a change that would leave nobody able to manage auth users.
+	ErrLastAdmin  = errors.New("at least one active admin is required")
+	ErrSelfChange = errors.New("admins cannot disable or demote themselves")
+)
+
+// Settings controls just-in-time provisioning of auth users.
+type Settings struct {
+	// JITEnabled creates an auth user on the first request of a validated identity that has none.
+	JITEnabled bool
+	// DefaultRole is given to provisioned users whose token carries no known role.
+	DefaultRole string
+}
+
+// SettingsFromConfig builds Settings from the application config.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	return Settings{JITEnabled: cfg.AuthJITEnabled, DefaultRole: cfg.AuthDefaultRole}
+}
+
+// AuthUser is the admin view of an auth user.
+type AuthUser struct {
+	UserID        uint       `json:"user_id"`
+	ZitadelUserID string     `json:"zitadel_user_id"`
+	Name          *string    `json:"name"`
+	Email         *string    `json:"email"`
+	Role          string     `json:"role"`
+	Disabled      bool       `json:"disabled"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	HasPassword   bool       `json:"has_password"`
+}
+
+// Role is the admin view of an auth role, with the permissions rbac grants it.
+type Role struct {
+	RoleID      uint              `json:"role_id"`
+	Name        string            `json:"name"`
+	Permissions []rbac.Permission `json:"permissions"`
+	UserCount   int64             `json:"user_count"`
+}
+
+// CreateInput pre-provisions an auth user. ZitadelUserID may be empty for users who only sign in
+// with local credentials; it then defaults to "local:<email>".
+type CreateInput struct {
+	ZitadelUserID string
+	Name          *string
+	Email         *string
+	Role          string
+}
+
+// Service resolves validated identities to auth users and lets admins manage users and roles.
+type Service struct {
+	db       *gorm.DB
+	settings Settings
+	slack    *slack.SlackService
+}
+
+// NewService returns a Service. slackService may be nil, in which case provisioning is only logged.
+func NewService(db *gorm.DB, settings Settings, slackService *slack.SlackService) *Service {
+	settings.DefaultRole = rbac.NormalizeRole(settings.DefaultRole)
+	if settings.DefaultRole == "" {
+		settings.DefaultRole = rbac.RoleAgent
+	}
+	return &Service{db: db, settings: settings, slack: slackService}
+}
+
+// Resolve returns the principal for a validated identity. Name and email are synced from the
+// token on every call; the role is only taken from the token when the user is provisioned, after
+// which the admin API owns it. Unknown identities get ErrAuthUserNotFound unless JIT is enabled.
+func (s *Service) Resolve(identity *zitadel.ValidateTokenUser) (*rbac.Principal, error) {
+	if identity == nil || identity.ID == nil || strings.TrimSpace(*identity.ID) == "" {
+		return nil, ErrAuthUserNotFound
+	}
+	zitadelUserID := strings.TrimSpace(*identity.ID)
+
+	var user models.AuthUser
+	err := s.db.Where("zitadel_user_id = ?", zitadelUserID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !s.settings.JITEnabled {
+			return nil, ErrAuthUserNotFound
+		}
+		if err := s.provision(zitadelUserID, identity); err != nil {
+			return nil, err
+		}
+		err = s.db.Where("zitadel_user_id = ?", zitadelUserID).First(&user).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAuthUserDisabled
+	}
+
+	if updates := profileUpdates(user, identity); len(updates) > 0 {
+		if err := s.db.Model(&models.AuthUser{}).Where("user_id = ?", user.UserID).UpdateColumns(updates).Error; err != nil {
+			log.Printf("Failed to sync auth user %d profile: %v", user.UserID, err)
+		}
+	}
+
+	var role models.AuthRole
+	if err := s.db.First(&role, user.RoleID).Error; err != nil {
+		return nil, err
+	}
+	return &rbac.Principal{
+		AuthUserID:    user.UserID,
+		ZitadelUserID: zitadelUserID,
+		Role:          rbac.NormalizeRole(role.Name),
+	}, nil
+}
+
+// provision creates the auth user. A concurrent request provisioning the same identity is not an error.
+func (s *Service) provision(zitadelUserID string, identity *zitadel.ValidateTokenUser) error {
+	roleName := s.settings.DefaultRole
+	if identity.Role != nil {
+		if claimed := rbac.NormalizeRole(*identity.Role); claimed != "" && s.db.Where("UPPER(name) = ?", claimed).First(&models.AuthRole{}).Error == nil {
+			roleName = claimed
+		}
+	}
+	role, err := s.ensureRole(roleName)
+	if err != nil {
+		return err
+	}
+
+	user := models.AuthUser{
+		ZitadelUserID: zitadelUserID,
+		Name:          trimmed(identity.Name),
+		Email:         trimmed(identity.Email),
+		RoleID:        role.RoleID,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&user)
+	if result.Error != nil {
+		return fmt.Errorf("failed to provision auth user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Auth user provisioned: %s (%s) as %s", zitadelUserID, valueOr(user.Email, "no email"), role.Name)
+	log.Print(message)
+	if s.slack != nil {
+		s.slack.SendSlackAlertAsync(message)
+	}
+	return nil
+}
+
+// ensureRole returns the role by name, creating it only for the roles rbac knows about.
+func (s *Service) ensureRole(name string) (models.AuthRole, error) {
+	var role models.AuthRole
+	err := s.db.Where("UPPER(name) = ?", name).First(&role).Error
+	if err == nil {
+		return role, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return role, err
+	}
+	if _, known := rbac.RolePermissions[name]; !known {
+		return role, ErrRoleNotFound
+	}
+	role = models.AuthRole{Name: name}
+	if err := s.db.Where("name = ?", name).FirstOrCreate(&role).Error; err != nil {
+		return role, err
+	}
+	return role, nil
+}
+
+func profileUpdates(user models.AuthUser, identity *zitadel.ValidateTokenUser) map[string]any {
+	updates := map[string]any{}
+	if name := trimmed(identity.Name); name != nil && (user.Name == nil || *user.Name != *name) {
+		updates["name"] = *name
+	}
+	if email := trimmed(identity.Email); email != nil && (user.Email == nil || *user.Email != *email) {
+		updates["email"] = *email
+	}
+	return updates
+}
+
+type authUserRow struct {
+	UserID        uint       `gorm:"column:user_id"`
+	ZitadelUserID string     `gorm:"column:zitadel_user_id"`
+	Name          *string    `gorm:"column:name"`
+	Email         *string    `gorm:"column:email"`
+	RoleName      string     `gorm:"column:role_name"`
+	DisabledAt    *time.Time `gorm:"column:disabled_at"`
+	LastLoginAt   *time.Time `gorm:"column:last_login_at"`
+	PasswordHash  *string    `gorm:"column:password_hash"`
+}
+
+func (s *Service) authUsers() *gorm.DB {
+	return s.db.
+		Table("auth_users").
+		Select("auth_users.user_id, auth_users.zitadel_user_id, auth_users.name, auth_users.email, auth_roles.name AS role_name, " +
+			"auth_users.disabled_at, auth_users.last_login_at, auth_users.password_hash").
+		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id")
+}
+
+func (row authUserRow) view() AuthUser {
+	return AuthUser{
+		UserID:        row.UserID,
+		ZitadelUserID: row.ZitadelUserID,
+		Name:          row.Name,
+		Email:         row.Email,
+		Role:          rbac.NormalizeRole(row.RoleName),
+		Disabled:      row.DisabledAt != nil,
+		DisabledAt:    row.DisabledAt,
+		LastLoginAt:   row.LastLoginAt,
+		HasPassword:   row.PasswordHash != nil,
+	}
+}
+
+// List returns every auth user, disabled ones included.
+func (s *Service) List() ([]AuthUser, error) {
+	var rows []authUserRow
+	if err := s.authUsers().Order("auth_users.user_id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	users := make([]AuthUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, row.view())
+	}
+	return users, nil
+}
+
+// Get returns one auth user.
+func (s *Service) Get(userID uint) (*AuthUser, error) {
+	var row authUserRow
+	err := s.authUsers().Where("auth_users.user_id = ?", userID).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAuthUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := row.view()
+	return &user, nil
+}
+
+// Create pre-provisions an auth user with the given role.
+func (s *Service) Create(input CreateInput) (*AuthUser, error) {
+	email := trimmed(input.Email)
+	zitadelUserID := strings.TrimSpace(input.ZitadelUserID)
+	if zitadelUserID == "" && email != nil {
+		zitadelUserID = "local:" + strings.ToLower(*email)
+	}
+	if zitadelUserID == "" {
+		return nil, errors.New("zitadel_user_id or email is required")
+	}
+
+	var role models.AuthRole
+	err := s.db.Where("UPPER(name) = ?", rbac.NormalizeRole(input.Role)).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var existing int64
+	query := s.db.Model(&models.AuthUser{}).Where("zitadel_user_id = ?", zitadelUserID)
+	if email != nil {
+		query = query.Or("LOWER(email) = ?", strings.ToLower(*email))
+	}
+	if err := query.Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAuthUserExists
+	}
+
+	user := models.AuthUser{ZitadelUserID: zitadelUserID, Name: trimmed(input.Name), Email: email, RoleID: role.RoleID}
+	if err := s.db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return s.Get(user.UserID)
+}
+
+// SetRole changes an auth user's role. actorID is the admin making the change.
+func (s *Service) SetRole(userID uint, roleName string, actorID uint) (*AuthUser, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		var role models.AuthRole
+		err = tx.Where("UPPER(name) = ?", rbac.NormalizeRole(roleName)).First(&role).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if role.RoleID == user.RoleID {
+			return nil
+		}
+		if !rbac.Allows(role.Name, rbac.AuthUsersManage) {
+			if userID == actorID {
+				return ErrSelfChange
+			}
+			if err := ensureOtherAdmin(tx, user); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.AuthUser{}).Where("user_id = ?", userID).Update("role_id", role.RoleID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(userID)
+}
+
+// Disable refuses the user on every client route and revokes their local-credentials sessions.
+func (s *Service) Disable(userID uint, actorID uint) (*AuthUser, error) {
+	if userID == actorID {
+		return nil, ErrSelfChange
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt != nil {
+			return nil
+		}
+		if err := ensureOtherAdmin(tx, user); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.AuthUser{}).Where("user_id = ?", userID).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.AuthUserSession{}).
+			Where("auth_user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(userID)
+}
+
+// Enable lifts Disable.
+func (s *Service) Enable(userID uint) (*AuthUser, error) {
+	if _, err := findUser(s.db, userID); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.AuthUser{}).Where("user_id = ?", userID).Update("disabled_at", nil).Error; err != nil {
+		return nil, err
+	}
+	return s.Get(userID)
+}
+
+// ListRoles returns every role with the permissions rbac grants it. Roles rbac does not know
+// about hold no permissions.
+func (s *Service) ListRoles() ([]Role, error) {
+	type roleRow struct {
+		RoleID    uint   `gorm:"column:role_id"`
+		Name      string `gorm:"column:name"`
+		UserCount int64  `gorm:"column:user_count"`
+	}
+	var rows []roleRow
+	err := s.db.
+		Table("auth_roles").
+		Select("auth_roles.role_id, auth_roles.name, COUNT(auth_users.user_id) AS user_count").
+		Joins("LEFT JOIN auth_users ON auth_users.role_id = auth_roles.role_id").
+		Group("auth_roles.role_id, auth_roles.name").
+		Order("auth_roles.role_id ASC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]Role, 0, len(rows))
+	for _, row := range rows {
+		roles = append(roles, Role{
+			RoleID:      row.RoleID,
+			Name:        row.Name,
+			Permissions: permissionsOf(row.Name),
+			UserCount:   row.UserCount,
+		})
+	}
+	return roles, nil
+}
+
+// CreateRole adds a role. Names are stored upper-cased.
+func (s *Service) CreateRole(name string) (*Role, error) {
+	name = rbac.NormalizeRole(name)
+	if !validRoleName(name) {
+		return nil, ErrInvalidRoleName
+	}
+	var existing int64
+	if err := s.db.Model(&models.AuthRole{}).Where("UPPER(name) = ?", name).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrRoleExists
+	}
+	role := models.AuthRole{Name: name}
+	if err := s.db.Create(&role).Error; err != nil {
+		return nil, err
+	}
+	return &Role{RoleID: role.RoleID, Name: role.Name, Permissions: permissionsOf(role.Name)}, nil
+}
+
+// DeleteRole removes a role that no auth user holds. The roles in rbac.Roles cannot be deleted.
+func (s *Service) DeleteRole(roleID uint) error {
+	var role models.AuthRole
+	err := s.db.First(&role, roleID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, builtIn := rbac.RolePermissions[rbac.NormalizeRole(role.Name)]; builtIn {
+		return ErrBuiltInRole
+	}
+	var holders int64
+	if err := s.db.Model(&models.AuthUser{}).Where("role_id = ?", roleID).Count(&holders).Error; err != nil {
+		return err
+	}
+	if holders > 0 {
+		return ErrRoleInUse
+	}
+	return s.db.Delete(&models.AuthRole{}, roleID).Error
+}
+
+func findUser(db *gorm.DB, userID uint) (models.AuthUser, error) {
+	var user models.AuthUser
+	err := db.First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrAuthUserNotFound
+	}
+	return user, err
+}
+
+// ensureOtherAdmin returns ErrLastAdmin when user is the only active user able to manage auth users.
+func ensureOtherAdmin(db *gorm.DB, user models.AuthUser) error {
+	var role models.AuthRole
+	if err := db.First(&role, user.RoleID).Error; err != nil {
+		return err
+	}
+	if !rbac.Allows(role.Name, rbac.AuthUsersManage) {
+		return nil
+	}
+	var others int64
+	err := db.Table("auth_users").
+		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
+		Where("UPPER(auth_roles.name) IN ?", rbac.RolesWith(rbac.AuthUsersManage)).
+		Where("auth_users.disabled_at IS NULL AND auth_users.user_id <> ?", user.UserID).
+		Count(&others).Error
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func permissionsOf(roleName string) []rbac.Permission {
+	permissions := rbac.RolePermissions[rbac.NormalizeRole(roleName)]
+	if permissions == nil {
+		return []rbac.Permission{}
+	}
+	return permissions
+}
+
+func validRoleName(name string) bool {
+	if name == "" || len(name) > 50 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func trimmed(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	v := strings.TrimSpace(*value)
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func valueOr(value *string, fallback string) string {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,319 @@
+package auth_user_conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+
+	"gorm.io/gorm"
+)
+
+// Assignment strategies.
+const (
+	// StrategyRoundRobin picks the eligible agent who was assigned a conversation longest ago.
+	StrategyRoundRobin = "round_robin"
+	// StrategyLeastOpen picks the eligible agent with the fewest unresolved conversations.
+	StrategyLeastOpen = "least_open"
+	// StrategyRules picks among the agents of the first matching rule, least open first, and falls
+	// back to StrategyLeastOpen when no rule matches or none of its agents can take the conversation.
+	StrategyRules = "rules"
+)
+
+// Trigger is an event that assigns a conversation automatically when enabled.
+type Trigger string
+
+const (
+	TriggerStart      Trigger = "start"
+	TriggerEscalation Trigger = "escalation"
+	TriggerLead       Trigger = "lead"
+)
+
+var ErrInvalidAvailability = errors.New("availability must be available or away")
+
+// packageFunctions are the tool calls whose package_id shows which packages the user looked at.
+var packageFunctions = []string{"get_package_details", "fetch_upcoming_trips"}
+
+const (
+	leastOpenOrder  = "open_conversations ASC, auth_users.user_id ASC"
+	roundRobinOrder = "CASE WHEN auth_users.last_assigned_at IS NULL THEN 0 ELSE 1 END, auth_users.last_assigned_at ASC, auth_users.user_id ASC"
+)
+
+// Rule sends matching conversations to a pool of agents. Empty criteria match anything; a rule
+// with several criteria needs all of them to match.
+type Rule struct {
+	// Source is the session source, website or whatsapp.
+	Source string `json:"source"`
+	// PackageIDs matches when the user looked at any of these packages.
+	PackageIDs []int `json:"package_ids"`
+	// Language is the conversation's language code.
+	Language string `json:"language"`
+	AgentIDs []uint `json:"agent_ids"`
+}
+
+// EngineSettings controls automatic assignment.
+type EngineSettings struct {
+	Strategy string
+	Triggers map[Trigger]bool
+	Rules    []Rule
+	// MaxOpenPerAgent is how many unresolved conversations an agent can hold before being skipped.
+	// Zero means no limit.
+	MaxOpenPerAgent int
+}
+
+// EngineSettingsFromConfig builds EngineSettings from the application config. Rules are a JSON
+// array of Rule; invalid rules are logged and ignored.
+func EngineSettingsFromConfig(cfg *config.Config) EngineSettings {
+	settings := EngineSettings{
+		Strategy:        strings.ToLower(strings.TrimSpace(cfg.AssignmentStrategy)),
+		Triggers:        make(map[Trigger]bool),
+		MaxOpenPerAgent: cfg.AssignmentMaxOpenPerAgent,
+	}
+	for _, trigger := range strings.Split(cfg.AssignmentTriggers, ",") {
+		if trigger = strings.ToLower(strings.TrimSpace(trigger)); trigger != "" {
+			settings.Triggers[Trigger(trigger)] = true
+		}
+	}
+	if rules := strings.TrimSpace(cfg.AssignmentRules); rules != "" {
+		if err := json.Unmarshal([]byte(rules), &settings.Rules); err != nil {
+			log.Printf("Ignoring invalid assignment rules: %v", err)
+			settings.Rules = nil
+		}
+	}
+	return settings
+}
+
+// AgentStatus is an agent's availability and load as returned by the client API.
+type AgentStatus struct {
+	UserID               uint   `json:"user_id"`
+	Availability         string `json:"availability"`
+	OpenConversations    int64  `json:"open_conversations"`
+	MaxOpenConversations int    `json:"max_open_conversations"`
+}
+
+// Engine assigns conversations to agents and admins automatically. Disabled, away and
+// at-capacity users are never picked.
+type Engine struct {
+	db       *gorm.DB
+	service  *Service
+	settings EngineSettings
+	now      func() time.Time
+}
+
+func NewEngine(db *gorm.DB, settings EngineSettings) *Engine {
+	return &Engine{db: db, service: NewService(db), settings: settings, now: time.Now}
+}
+
+// Enabled reports whether the trigger assigns conversations.
+func (e *Engine) Enabled(trigger Trigger) bool {
+	return e.settings.Triggers[trigger]
+}
+
+// AssignOn assigns the conversation when the trigger is enabled. It returns nil when the trigger is
+// disabled or nobody can take the conversation.
+func (e *Engine) AssignOn(trigger Trigger, conversationID uint) (*AgentUser, error) {
+	if !e.Enabled(trigger) {
+		return nil, nil
+	}
+	return e.Assign(conversationID)
+}
+
+// Assign assigns the conversation with the configured strategy and returns the agent. A
+// conversation that already has an agent keeps it. It returns nil when nobody can take it.
+// The check, the pick and the link run in one transaction holding the conversation's row lock,
+// so concurrent triggers cannot assign two primaries.
+func (e *Engine) Assign(conversationID uint) (*AgentUser, error) {
+	var agent *AgentUser
+	var linked bool
+	err := e.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockConversations(tx, []uint{conversationID}); err != nil {
+			return err
+		}
+		assigned, err := NewService(tx).GetAssignedAgentsByConversationIDs([]uint{conversationID})
+		if err != nil {
+			return err
+		}
+		if existing, ok := assigned[conversationID]; ok {
+			agent = existing
+			return nil
+		}
+
+		agent, err = e.pick(tx, conversationID)
+		if err != nil || agent == nil {
+			return err
+		}
+		if _, err := linkConversations(tx, agent.UserID, []uint{conversationID}, 0); err != nil {
+			return err
+		}
+		linked = true
+		if err := tx.Model(&models.AuthUser{}).Where("user_id = ?", agent.UserID).Update("last_assigned_at", e.now()).Error; err != nil {
+			return fmt.Errorf("failed to record assignment time for auth user %d: %w", agent.UserID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if linked {
+		e.service.publishAssignment(conversationID, AssignmentActionAssigned, agent.UserID)
+	}
+	return agent, nil
+}
+
+// SetAvailability marks the auth user available or away and returns their status.
+func (e *Engine) SetAvailability(authUserID uint, availability string) (*AgentStatus, error) {
+	availability = strings.ToLower(strings.TrimSpace(availability))
+	if availability != models.AgentAvailable && availability != models.AgentAway {
+		return nil, ErrInvalidAvailability
+	}
+	result := e.db.Model(&models.AuthUser{}).Where("user_id = ?", authUserID).Updates(map[string]any{
+		"availability":            availability,
+		"availability_changed_at": e.now(),
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update availability: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return e.Status(authUserID)
+}
+
+// Status returns the auth user's availability and number of unresolved conversations.
+func (e *Engine) Status(authUserID uint) (*AgentStatus, error) {
+	var user models.AuthUser
+	if err := e.db.Select("user_id", "availability").Where("user_id = ?", authUserID).Take(&user).Error; err != nil {
+		return nil, err
+	}
+	var open int64
+	err := e.db.Model(&models.AuthUserConversation{}).
+		Where("auth_user_id = ? AND resolved = ?", authUserID, false).
+		Count(&open).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count open conversations: %w", err)
+	}
+	availability := user.Availability
+	if availability == "" {
+		availability = models.AgentAvailable
+	}
+	return &AgentStatus{
+		UserID:               user.UserID,
+		Availability:         availability,
+		OpenConversations:    open,
+		MaxOpenConversations: e.settings.MaxOpenPerAgent,
+	}, nil
+}
+
+func (e *Engine) pick(tx *gorm.DB, conversationID uint) (*AgentUser, error) {
+	switch e.settings.Strategy {
+	case StrategyRoundRobin:
+		return e.candidate(tx, nil, roundRobinOrder)
+	case StrategyRules:
+		agentIDs, err := e.matchRule(tx, conversationID)
+		if err != nil {
+			return nil, err
+		}
+		if len(agentIDs) > 0 {
+			agent, err := e.candidate(tx, agentIDs, leastOpenOrder)
+			if err != nil || agent != nil {
+				return agent, err
+			}
+		}
+		return e.candidate(tx, nil, leastOpenOrder)
+	default:
+		return e.candidate(tx, nil, leastOpenOrder)
+	}
+}
+
+// candidate returns the first eligible agent in order, limited to agentIDs when given.
+func (e *Engine) candidate(tx *gorm.DB, agentIDs []uint, order string) (*AgentUser, error) {
+	query := tx.
+		Table("auth_users").
+		Select("auth_users.user_id, auth_users.name, COUNT(auth_user_conversation.id) AS open_conversations").
+		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
+		Joins("LEFT JOIN auth_user_conversation ON auth_user_conversation.auth_user_id = auth_users.user_id AND auth_user_conversation.resolved = ? AND auth_user_conversation.deleted_at IS NULL", false).
+		Where("UPPER(auth_roles.name) IN ?", rbac.RolesWith(rbac.ConversationsWriteAssigned)).
+		Where("auth_users.disabled_at IS NULL AND auth_users.availability = ?", models.AgentAvailable).
+		Group("auth_users.user_id, auth_users.name, auth_users.last_assigned_at")
+	if len(agentIDs) > 0 {
+		query = query.Where("auth_users.user_id IN ?", agentIDs)
+	}
+	if e.settings.MaxOpenPerAgent > 0 {
+		query = query.Having("COUNT(auth_user_conversation.id) < ?", e.settings.MaxOpenPerAgent)
+	}
+
+	var agents []AgentUser
+	if err := query.Order(order).Limit(1).Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to pick an agent: %w", err)
+	}
+	if len(agents) == 0 {
+		return nil, nil
+	}
+	return &agents[0], nil
+}
+
+// matchRule returns the agents of the first rule matching the conversation.
+func (e *Engine) matchRule(tx *gorm.DB, conversationID uint) ([]uint, error) {
+	if len(e.settings.Rules) == 0 {
+		return nil, nil
+	}
+
+	var conv struct {
+		Source   string
+		Language string
+	}
+	err := tx.Table("conversations").
+		Select("sessions.source, conversations.language").
+		Joins("JOIN sessions ON sessions.id = conversations.session_id").
+		Where("conversations.id = ?", conversationID).
+		Take(&conv).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation for assignment rules: %w", err)
+	}
+
+	var calls [][]byte
+	err = tx.Model(&models.FunctionCall{}).
+		Where("conversation_id = ? AND name IN ?", conversationID, packageFunctions).
+		Pluck("args", &calls).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load package interest: %w", err)
+	}
+	packages := make(map[int]bool)
+	for _, call := range calls {
+		var args struct {
+			PackageID int `json:"package_id"`
+		}
+		if json.Unmarshal(call, &args) == nil && args.PackageID != 0 {
+			packages[args.PackageID] = true
+		}
+	}
+
+	for _, rule := range e.settings.Rules {
+		if rule.Source != "" && !strings.EqualFold(rule.Source, conv.Source) {
+			continue
+		}
+		if rule.Language != "" && !strings.EqualFold(rule.Language, conv.Language) {
+			continue
+		}
+		if len(rule.PackageIDs) > 0 && !anyPackage(rule.PackageIDs, packages) {
+			continue
+		}
+		return rule.AgentIDs, nil
+	}
+	return nil, nil
+}
+
+func anyPackage(packageIDs []int, seen map[int]bool) bool {
+	for _, id := range packageIDs {
+		if seen[id] {
+			return true
+		}
+	}
+	return false
+}
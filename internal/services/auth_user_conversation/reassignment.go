@@ -0,0 +1,339 @@
+package auth_user_conversation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/inbox"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotAssigned       = errors.New("auth user is not assigned to the conversation")
+	ErrSameAssignee      = errors.New("conversation is already assigned to that auth user")
+	ErrInvalidAssignee   = errors.New("auth user cannot be assigned conversations")
+	ErrNoPrimaryAssignee = errors.New("conversation has no assignee")
+)
+
+// Assignment changes reported in assignment.changed inbox events.
+const (
+	AssignmentActionAssigned   = "assigned"
+	AssignmentActionReassigned = "reassigned"
+	AssignmentActionUnassigned = "unassigned"
+	AssignmentActionPrimary    = "primary"
+)
+
+// Assignee is an auth user currently assigned to a conversation, with their tracking state.
+type Assignee struct {
+	UserID     uint      `json:"user_id" gorm:"column:user_id"`
+	Name       *string   `json:"name" gorm:"column:name"`
+	Primary    bool      `json:"primary" gorm:"column:is_primary"`
+	Started    bool      `json:"started" gorm:"column:started"`
+	Resolved   bool      `json:"resolved" gorm:"column:resolved"`
+	Comments   string    `json:"comments" gorm:"column:comments"`
+	AssignedAt time.Time `json:"assigned_at" gorm:"column:created_at"`
+}
+
+// AssignmentRecord is one assignment period in a conversation's history. Tracking fields are live
+// for open periods and archived for closed ones.
+type AssignmentRecord struct {
+	UserID       uint       `json:"user_id" gorm:"column:auth_user_id"`
+	Name         *string    `json:"name" gorm:"column:name"`
+	Primary      bool       `json:"primary" gorm:"column:is_primary"`
+	AssignedAt   time.Time  `json:"assigned_at" gorm:"column:assigned_at"`
+	AssignedBy   *uint      `json:"assigned_by" gorm:"column:assigned_by"`
+	UnassignedAt *time.Time `json:"unassigned_at" gorm:"column:unassigned_at"`
+	UnassignedBy *uint      `json:"unassigned_by" gorm:"column:unassigned_by"`
+	EndReason    string     `json:"end_reason" gorm:"column:end_reason"`
+	Started      bool       `json:"started" gorm:"column:started"`
+	Resolved     bool       `json:"resolved" gorm:"column:resolved"`
+	Comments     string     `json:"comments" gorm:"column:comments"`
+}
+
+// ReassignInput moves a conversation from one auth user to another.
+type ReassignInput struct {
+	ConversationID uint
+	// FromUserID is the assignee to replace. Zero replaces the primary assignee.
+	FromUserID uint
+	ToUserID   uint
+	ActorID    uint
+	// CarryTracking copies started, resolved and comments to the new assignee. The previous
+	// assignee's values are archived in the history either way.
+	CarryTracking bool
+}
+
+// Assignees lists the conversation's current assignees, primary first.
+func (s *Service) Assignees(conversationID uint) ([]Assignee, error) {
+	assignees := make([]Assignee, 0)
+	err := s.db.
+		Table("auth_user_conversation").
+		Select("auth_users.user_id, auth_users.name, auth_user_conversation.is_primary, auth_user_conversation.started, auth_user_conversation.resolved, auth_user_conversation.comments, auth_user_conversation.created_at").
+		Joins("JOIN auth_users ON auth_users.user_id = auth_user_conversation.auth_user_id").
+		Where("auth_user_conversation.conversation_id = ? AND auth_user_conversation.deleted_at IS NULL", conversationID).
+		Order("auth_user_conversation.is_primary DESC, auth_user_conversation.created_at ASC").
+		Scan(&assignees).Error
+	if err != nil {
+		return nil, err
+	}
+	return assignees, nil
+}
+
+// History lists every assignment period of the conversation, oldest first.
+func (s *Service) History(conversationID uint) ([]AssignmentRecord, error) {
+	records := make([]AssignmentRecord, 0)
+	err := s.db.
+		Table("conversation_assignments").
+		Select("conversation_assignments.auth_user_id, auth_users.name, conversation_assignments.is_primary, conversation_assignments.assigned_at, "+
+			"conversation_assignments.assigned_by, conversation_assignments.unassigned_at, conversation_assignments.unassigned_by, conversation_assignments.end_reason, "+
+			"COALESCE(auth_user_conversation.started, conversation_assignments.started) AS started, "+
+			"COALESCE(auth_user_conversation.resolved, conversation_assignments.resolved) AS resolved, "+
+			"COALESCE(auth_user_conversation.comments, conversation_assignments.comments) AS comments").
+		Joins("LEFT JOIN auth_users ON auth_users.user_id = conversation_assignments.auth_user_id").
+		Joins("LEFT JOIN auth_user_conversation ON conversation_assignments.unassigned_at IS NULL AND auth_user_conversation.conversation_id = conversation_assignments.conversation_id AND auth_user_conversation.auth_user_id = conversation_assignments.auth_user_id").
+		Where("conversation_assignments.conversation_id = ? AND conversation_assignments.deleted_at IS NULL", conversationID).
+		Order("conversation_assignments.assigned_at ASC, conversation_assignments.id ASC").
+		Scan(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Reassign moves the conversation to input.ToUserID. The new assignee takes over the primary role
+// when the replaced one held it. Reassigning to someone already assigned just drops the old link.
+func (s *Service) Reassign(input ReassignInput) error {
+	if input.ToUserID == 0 {
+		return errors.New("to_user_id is required")
+	}
+	if err := s.checkAssignable(input.ToUserID); err != nil {
+		return err
+	}
+
+	var fromUserID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		from, err := findLink(tx, input.ConversationID, input.FromUserID)
+		if err != nil {
+			return err
+		}
+		fromUserID = from.AuthUserID
+		if from.AuthUserID == input.ToUserID {
+			return ErrSameAssignee
+		}
+		now := time.Now()
+		if err := endAssignment(tx, from, input.ActorID, models.AssignmentEndReassigned, now); err != nil {
+			return err
+		}
+
+		var to models.AuthUserConversation
+		err = tx.Where("conversation_id = ? AND auth_user_id = ?", input.ConversationID, input.ToUserID).First(&to).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			to = models.AuthUserConversation{
+				AuthUserID:     input.ToUserID,
+				ConversationID: input.ConversationID,
+				Primary:        from.Primary,
+			}
+			if input.CarryTracking {
+				to.Started, to.Resolved, to.ResolvedAt, to.Comments = from.Started, from.Resolved, from.ResolvedAt, from.Comments
+			}
+			if err := tx.Create(&to).Error; err != nil {
+				return fmt.Errorf("failed to assign conversation: %w", err)
+			}
+			if err := tx.Create(&models.ConversationAssignment{
+				ConversationID: input.ConversationID,
+				AuthUserID:     input.ToUserID,
+				Primary:        to.Primary,
+				AssignedAt:     now,
+				AssignedBy:     actorOrNil(input.ActorID),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to record assignment: %w", err)
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+		if from.Primary {
+			return setPrimary(tx, input.ConversationID, input.ToUserID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.publishAssignment(input.ConversationID, AssignmentActionReassigned, input.ToUserID, fromUserID)
+	return nil
+}
+
+// Unassign removes the auth user from the conversation and archives their tracking state. When the
+// primary assignee leaves, the longest-assigned remaining agent becomes primary.
+func (s *Service) Unassign(conversationID, authUserID, actorID uint) error {
+	if authUserID == 0 {
+		return errors.New("user_id is required")
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		link, err := findLink(tx, conversationID, authUserID)
+		if err != nil {
+			return err
+		}
+		if err := endAssignment(tx, link, actorID, models.AssignmentEndUnassigned, time.Now()); err != nil {
+			return err
+		}
+		if !link.Primary {
+			return nil
+		}
+		var next models.AuthUserConversation
+		err = tx.Where("conversation_id = ?", conversationID).Order("created_at ASC, id ASC").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return setPrimary(tx, conversationID, next.AuthUserID)
+	})
+	if err != nil {
+		return err
+	}
+	s.publishAssignment(conversationID, AssignmentActionUnassigned, authUserID, authUserID)
+	return nil
+}
+
+// SetPrimary makes an assigned auth user the conversation's primary assignee.
+func (s *Service) SetPrimary(conversationID, authUserID uint) error {
+	if authUserID == 0 {
+		return errors.New("user_id is required")
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := findLink(tx, conversationID, authUserID); err != nil {
+			return err
+		}
+		return setPrimary(tx, conversationID, authUserID)
+	})
+	if err != nil {
+		return err
+	}
+	s.publishAssignment(conversationID, AssignmentActionPrimary, authUserID)
+	return nil
+}
+
+// checkAssignable reports whether the auth user is enabled and their role works assigned conversations.
+func (s *Service) checkAssignable(authUserID uint) error {
+	var count int64
+	err := s.db.
+		Table("auth_users").
+		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
+		Where("auth_users.user_id = ? AND auth_users.disabled_at IS NULL", authUserID).
+		Where("UPPER(auth_roles.name) IN ?", rbac.RolesWith(rbac.ConversationsWriteAssigned)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidAssignee
+	}
+	return nil
+}
+
+// findLink returns the auth user's link to the conversation, or the primary assignee's when
+// authUserID is zero. It takes the conversation's row lock first, so assignment changes to one
+// conversation run one at a time.
+func findLink(tx *gorm.DB, conversationID, authUserID uint) (*models.AuthUserConversation, error) {
+	if _, err := lockConversations(tx, []uint{conversationID}); err != nil {
+		return nil, err
+	}
+	query := tx.Where("conversation_id = ?", conversationID)
+	if authUserID != 0 {
+		query = query.Where("auth_user_id = ?", authUserID)
+	}
+	var link models.AuthUserConversation
+	err := query.Order("is_primary DESC, created_at ASC, id ASC").First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if authUserID == 0 {
+			return nil, ErrNoPrimaryAssignee
+		}
+		return nil, ErrNotAssigned
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// endAssignment archives the link's tracking state in its open history period and removes the
+// link. Links made before the history existed get a period starting when they were created.
+func endAssignment(tx *gorm.DB, link *models.AuthUserConversation, actorID uint, reason string, now time.Time) error {
+	var period models.ConversationAssignment
+	err := tx.Where("conversation_id = ? AND auth_user_id = ? AND unassigned_at IS NULL", link.ConversationID, link.AuthUserID).
+		Order("assigned_at DESC").
+		First(&period).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		period = models.ConversationAssignment{
+			ConversationID: link.ConversationID,
+			AuthUserID:     link.AuthUserID,
+			Primary:        link.Primary,
+			AssignedAt:     link.CreatedAt,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	period.UnassignedAt = &now
+	period.UnassignedBy = actorOrNil(actorID)
+	period.EndReason = reason
+	period.Primary = link.Primary
+	period.Started = link.Started
+	period.Resolved = link.Resolved
+	period.ResolvedAt = link.ResolvedAt
+	period.Comments = link.Comments
+	if err := tx.Save(&period).Error; err != nil {
+		return fmt.Errorf("failed to archive assignment: %w", err)
+	}
+	if err := tx.Unscoped().Delete(link).Error; err != nil {
+		return fmt.Errorf("failed to remove assignment: %w", err)
+	}
+	return nil
+}
+
+// setPrimary makes the auth user the only primary assignee of the conversation, in the links and
+// in the open history periods.
+func setPrimary(tx *gorm.DB, conversationID, authUserID uint) error {
+	// Clear the old primary before setting the new one: idx_auth_user_conversation_primary allows
+	// one primary per conversation at every step.
+	if err := tx.Model(&models.AuthUserConversation{}).
+		Where("conversation_id = ? AND auth_user_id <> ? AND is_primary = ?", conversationID, authUserID, true).
+		Update("is_primary", false).Error; err != nil {
+		return fmt.Errorf("failed to update primary assignee: %w", err)
+	}
+	if err := tx.Model(&models.AuthUserConversation{}).
+		Where("conversation_id = ? AND auth_user_id = ?", conversationID, authUserID).
+		Update("is_primary", true).Error; err != nil {
+		return fmt.Errorf("failed to update primary assignee: %w", err)
+	}
+	isPrimary := gorm.Expr("auth_user_id = ?", authUserID)
+	if err := tx.Model(&models.ConversationAssignment{}).
+		Where("conversation_id = ? AND unassigned_at IS NULL", conversationID).
+		Update("is_primary", isPrimary).Error; err != nil {
+		return fmt.Errorf("failed to update primary assignee history: %w", err)
+	}
+	return nil
+}
+
+// publishAssignment pushes an assignment change to the inbox. Auth users who lost the conversation
+// are added to the audience so their inbox can drop it.
+func (s *Service) publishAssignment(conversationID uint, action string, authUserID uint, removed ...uint) {
+	s.inbox.Publish(inbox.EventAssignmentChanged, conversationID, map[string]any{
+		"action":       action,
+		"auth_user_id": authUserID,
+	}, removed...)
+}
+
+func actorOrNil(actorID uint) *uint {
+	if actorID == 0 {
+		return nil
+	}
+	return &actorID
+}
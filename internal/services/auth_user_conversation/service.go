@@ -7,13 +7,16 @@ import (
 	"time"
 
 	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/inbox"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 type Service struct {
-	db *gorm.DB
+	db    *gorm.DB
+	inbox *inbox.Publisher
 }
 
 type AgentUser struct {
@@ -21,11 +24,6 @@ type AgentUser struct {
 	Name   *string `json:"name" gorm:"column:name"`
 }
 
-type AuthPrincipal struct {
-	UserID   uint
-	RoleName string
-}
-
 type UpdateConversationTrackingInput struct {
 	AuthUserID     uint
 	ConversationID uint
@@ -53,60 +51,118 @@ type conversationTrackingRow struct {
 }
 
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, inbox: inbox.NewPublisher(db)}
+}
+
+// LinkConversations assigns the conversations to the auth user on behalf of assignedBy, or of the
+// system when assignedBy is zero, and returns how many links were added. The first agent of a
+// conversation becomes its primary assignee.
+func (s *Service) LinkConversations(authUserID uint, conversationIDs []uint, assignedBy uint) (int, error) {
+	var linkedIDs []uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		linkedIDs, err = linkConversations(tx, authUserID, conversationIDs, assignedBy)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, conversationID := range linkedIDs {
+		s.publishAssignment(conversationID, AssignmentActionAssigned, authUserID)
+	}
+	return len(linkedIDs), nil
 }
 
-func (s *Service) LinkConversations(authUserID uint, conversationIDs []uint) (int, error) {
+// linkConversations does the work of LinkConversations in tx, holding the conversations' row locks
+// so two callers cannot both make themselves primary, and returns the conversations it linked.
+func linkConversations(tx *gorm.DB, authUserID uint, conversationIDs []uint, assignedBy uint) ([]uint, error) {
 	if authUserID == 0 {
-		return 0, errors.New("user_id is required")
+		return nil, errors.New("user_id is required")
 	}
 
 	if len(conversationIDs) == 0 {
-		return 0, errors.New("conversation_ids cannot be empty")
+		return nil, errors.New("conversation_ids cannot be empty")
 	}
 
 	var userCount int64
-	if err := s.db.Table("auth_users").Where("user_id = ?", authUserID).Count(&userCount).Error; err != nil {
-		return 0, err
+	if err := tx.Table("auth_users").Where("user_id = ?", authUserID).Count(&userCount).Error; err != nil {
+		return nil, err
 	}
 	if userCount == 0 {
-		return 0, errors.New("auth user not found")
+		return nil, errors.New("auth user not found")
 	}
 
 	uniqueConversationIDs := dedupeUintIDs(conversationIDs)
 	if len(uniqueConversationIDs) == 0 {
-		return 0, errors.New("conversation_ids cannot be empty")
+		return nil, errors.New("conversation_ids cannot be empty")
 	}
 
-	var foundIDs []uint
-	if err := s.db.Model(&models.Conversation{}).Where("id IN ?", uniqueConversationIDs).Pluck("id", &foundIDs).Error; err != nil {
-		return 0, err
+	foundIDs, err := lockConversations(tx, uniqueConversationIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(foundIDs) != len(uniqueConversationIDs) {
-		return 0, fmt.Errorf("one or more conversation_ids are invalid")
+		return nil, fmt.Errorf("one or more conversation_ids are invalid")
 	}
 
-	links := make([]models.AuthUserConversation, 0, len(uniqueConversationIDs))
+	var withPrimary []uint
+	if err := tx.Model(&models.AuthUserConversation{}).
+		Where("conversation_id IN ? AND is_primary = ?", uniqueConversationIDs, true).
+		Pluck("conversation_id", &withPrimary).Error; err != nil {
+		return nil, err
+	}
+	hasPrimary := make(map[uint]bool, len(withPrimary))
+	for _, id := range withPrimary {
+		hasPrimary[id] = true
+	}
+
+	var linkedIDs []uint
+	now := time.Now()
 	for _, conversationID := range uniqueConversationIDs {
-		links = append(links, models.AuthUserConversation{
+		link := models.AuthUserConversation{
 			AuthUserID:     authUserID,
 			ConversationID: conversationID,
-		})
-	}
-
-	result := s.db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{
-			{Name: "auth_user_id"},
-			{Name: "conversation_id"},
-		},
-		DoNothing: true,
-	}).Create(&links)
-	if result.Error != nil {
-		return 0, result.Error
+			Primary:        !hasPrimary[conversationID],
+		}
+		result := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{
+				{Name: "auth_user_id"},
+				{Name: "conversation_id"},
+			},
+			DoNothing: true,
+		}).Create(&link)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		linkedIDs = append(linkedIDs, conversationID)
+		if err := tx.Create(&models.ConversationAssignment{
+			ConversationID: conversationID,
+			AuthUserID:     authUserID,
+			Primary:        link.Primary,
+			AssignedAt:     now,
+			AssignedBy:     actorOrNil(assignedBy),
+		}).Error; err != nil {
+			return nil, err
+		}
 	}
+	return linkedIDs, nil
+}
 
-	return int(result.RowsAffected), nil
+// lockConversations takes the row locks of the conversations until tx ends, in ID order so
+// concurrent callers cannot deadlock, and returns the IDs that exist.
+func lockConversations(tx *gorm.DB, conversationIDs []uint) ([]uint, error) {
+	var foundIDs []uint
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Model(&models.Conversation{}).
+		Where("id IN ?", conversationIDs).
+		Order("id").
+		Pluck("id", &foundIDs).Error
+	return foundIDs, err
 }
 
 func (s *Service) UpdateConversationTracking(input UpdateConversationTrackingInput) (*ConversationTracking, error) {
@@ -123,6 +179,10 @@ func (s *Service) UpdateConversationTracking(input UpdateConversationTrackingInp
 	}
 	if input.Resolved != nil {
 		updates["resolved"] = *input.Resolved
+		updates["resolved_at"] = nil
+		if *input.Resolved {
+			updates["resolved_at"] = gorm.Expr("COALESCE(resolved_at, ?)", time.Now())
+		}
 	}
 	if input.Comments != nil {
 		updates["comments"] = strings.TrimSpace(*input.Comments)
@@ -146,6 +206,12 @@ func (s *Service) UpdateConversationTracking(input UpdateConversationTrackingInp
 		return nil, err
 	}
 
+	s.inbox.Publish(inbox.EventTrackingUpdated, row.ConversationID, map[string]any{
+		"auth_user_id": row.AuthUserID,
+		"started":      row.Started,
+		"resolved":     row.Resolved,
+		"comments":     row.Comments,
+	})
 	return &ConversationTracking{
 		AuthUserID:     row.AuthUserID,
 		ConversationID: row.ConversationID,
@@ -179,43 +245,7 @@ func (s *Service) GetConversationTracking(conversationID uint, authUserID *uint)
 	}, nil
 }
 
-func (s *Service) IsAdminByZitadelUserID(zitadelUserID string) (bool, error) {
-	principal, err := s.GetAuthPrincipalByZitadelUserID(zitadelUserID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return false, nil
-		}
-		return false, err
-	}
-
-	return strings.EqualFold(strings.TrimSpace(principal.RoleName), "ADMIN"), nil
-}
-
-func (s *Service) GetAuthPrincipalByZitadelUserID(zitadelUserID string) (*AuthPrincipal, error) {
-	zitadelUserID = strings.TrimSpace(zitadelUserID)
-	if zitadelUserID == "" {
-		return nil, errors.New("zitadel user id is required")
-	}
-
-	type principalLookup struct {
-		UserID   uint   `gorm:"column:user_id"`
-		RoleName string `gorm:"column:name"`
-	}
-
-	var row principalLookup
-	err := s.db.
-		Table("auth_users").
-		Select("auth_users.user_id, auth_roles.name").
-		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
-		Where("auth_users.zitadel_user_id = ?", zitadelUserID).
-		Take(&row).Error
-	if err != nil {
-		return nil, err
-	}
-
-	return &AuthPrincipal{UserID: row.UserID, RoleName: row.RoleName}, nil
-}
-
+// ListAgentsAndAdmins lists the auth users whose role can work assigned conversations.
 func (s *Service) ListAgentsAndAdmins() ([]AgentUser, error) {
 	agents := make([]AgentUser, 0)
 
@@ -223,7 +253,7 @@ func (s *Service) ListAgentsAndAdmins() ([]AgentUser, error) {
 		Table("auth_users").
 		Select("auth_users.user_id, auth_users.name").
 		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
-		Where("UPPER(auth_roles.name) IN ?", []string{"ADMIN", "AGENT"}).
+		Where("UPPER(auth_roles.name) IN ?", rbac.RolesWith(rbac.ConversationsWriteAssigned)).
 		Order("auth_users.name ASC, auth_users.user_id ASC").
 		Find(&agents).Error
 	if err != nil {
@@ -252,7 +282,7 @@ func (s *Service) GetAssignedAgentsByConversationIDs(conversationIDs []uint) (ma
 		Select("auth_user_conversation.conversation_id, auth_users.user_id, auth_users.name, auth_user_conversation.created_at").
 		Joins("JOIN auth_users ON auth_users.user_id = auth_user_conversation.auth_user_id").
 		Where("auth_user_conversation.conversation_id IN ?", conversationIDs).
-		Order("auth_user_conversation.conversation_id ASC, auth_user_conversation.created_at ASC").
+		Order("auth_user_conversation.conversation_id ASC, auth_user_conversation.is_primary DESC, auth_user_conversation.created_at ASC").
 		Find(&rows).Error
 	if err != nil {
 		return nil, err
@@ -281,7 +311,7 @@ func (s *Service) getConversationTrackingRow(conversationID uint, authUserID *ui
 
 	var row conversationTrackingRow
 	err := query.
-		Order("auth_user_conversation.created_at ASC").
+		Order("auth_user_conversation.is_primary DESC, auth_user_conversation.created_at ASC").
 		Take(&row).Error
 	if err != nil {
 		return nil, err
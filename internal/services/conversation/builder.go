@@ -2,24 +2,30 @@ package conversation
 
 import (
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/inbox"
 
 	"gorm.io/gorm"
 )
 
 type ConversationBuilder struct {
-	db *gorm.DB
+	db    *gorm.DB
+	inbox *inbox.Publisher
 }
 
 func NewConversationBuilder(db *gorm.DB) *ConversationBuilder {
-	return &ConversationBuilder{db: db}
+	return &ConversationBuilder{db: db, inbox: inbox.NewPublisher(db)}
 }
 
 func (cb *ConversationBuilder) Build(sessionID uint) (*models.Conversation, error) {
 	conversation := &models.Conversation{
 		SessionID: sessionID,
 	}
-	if result := cb.db.FirstOrCreate(conversation, models.Conversation{SessionID: sessionID}); result.Error != nil {
+	result := cb.db.FirstOrCreate(conversation, models.Conversation{SessionID: sessionID})
+	if result.Error != nil {
 		return nil, result.Error
 	}
+	if result.RowsAffected == 1 {
+		cb.inbox.Publish(inbox.EventConversationCreated, conversation.ID, map[string]any{"session_id": sessionID})
+	}
 	return conversation, nil
 }
@@ -1,7 +1,9 @@
 package conversation
 
 import (
+	"smart-chat/config"
 	"smart-chat/internal/models"
+	conversationMode "smart-chat/internal/services/conversation_mode"
 
 	"gorm.io/gorm"
 )
@@ -16,7 +18,8 @@ func NewConversationService(db *gorm.DB) *ConversationService {
 	executor := NewConversationExecutor(db)
 	state := NewConversationState(db)
 	historyLoader := NewConversationHistory(db)
-	receiver := NewConversationReceiver(db, builder, executor, state, historyLoader)
+	modes := conversationMode.NewService(db, conversationMode.SettingsFromConfig(config.Load()), executor.slackService)
+	receiver := NewConversationReceiver(db, builder, executor, state, historyLoader, modes, executor.assignments)
 	return &ConversationService{
 		DB:       db,
 		Receiver: receiver,
@@ -24,11 +27,27 @@ func NewConversationService(db *gorm.DB) *ConversationService {
 }
 
 func (cs *ConversationService) HandleSession(sessionID uint, userInput string, messageType models.MessageType, whatsapp bool) (string, error) {
-	return cs.Receiver.ReceiveMessage(sessionID, userInput, messageType, whatsapp)
+	return cs.HandleSessionWithAttachments(sessionID, userInput, nil, messageType, whatsapp)
+}
+
+// HandleSessionWithAttachments is HandleSession for a message that carries previously uploaded attachments.
+// The attachments must belong to the session's conversation and not be linked to a message yet.
+func (cs *ConversationService) HandleSessionWithAttachments(sessionID uint, userInput string, attachmentIDs []uint, messageType models.MessageType, whatsapp bool) (string, error) {
+	return cs.Receiver.ReceiveMessage(sessionID, userInput, attachmentIDs, messageType, whatsapp)
+}
+
+// SetLanguage records the user's language code on the conversation for assignment rules.
+func (cs *ConversationService) SetLanguage(conversationID uint, language string) error {
+	return cs.DB.Model(&models.Conversation{}).Where("id = ?", conversationID).Update("language", language).Error
+}
+
+// GetOrCreateConversation returns the session's conversation, creating it if needed.
+func (cs *ConversationService) GetOrCreateConversation(sessionID uint) (*models.Conversation, error) {
+	return cs.Receiver.Builder.Build(sessionID)
 }
 
 func (cs *ConversationService) GetSessionWithConversations(sessionID uint) (*models.Session, error) {
 	var session models.Session
-	err := cs.DB.Preload("Conversations.MessagePairs").Where("id = ?", sessionID).First(&session).Error
+	err := cs.DB.Preload("Conversations.MessagePairs.Attachments").Where("id = ?", sessionID).First(&session).Error
 	return &session, err
 }
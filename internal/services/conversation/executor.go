@@ -1,6 +1,7 @@
 package conversation
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,8 +9,14 @@ import (
 	"smart-chat/cache"
 	"smart-chat/config"
 	"smart-chat/external/indian_travellers"
+	"smart-chat/internal/blobstore"
 	"smart-chat/internal/llm_service"
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/internal/services/escalation"
+	"smart-chat/internal/services/inbox"
 	"smart-chat/internal/services/slack"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -20,32 +27,47 @@ type ConversationExecutor struct {
 	db                *gorm.DB
 	indian_travellers *indian_travellers.Client
 	slackService      *slack.SlackService
+	attachments       *attachment.Service
+	escalations       *escalation.Service
+	assignments       *authUserConversation.Engine
+	inbox             *inbox.Publisher
 }
 
 func NewConversationExecutor(db *gorm.DB) *ConversationExecutor {
-
+	cfg := config.Load()
+	slackService := slack.NewSlackService(cfg, db)
+	modes := conversationMode.NewService(db, conversationMode.SettingsFromConfig(cfg), slackService)
+	assignments := authUserConversation.NewEngine(db, authUserConversation.EngineSettingsFromConfig(cfg))
 	return &ConversationExecutor{
 		db:                db,
-		indian_travellers: indian_travellers.NewClient(config.Load()),
-		slackService:      slack.NewSlackService(config.Load(), db),
+		indian_travellers: indian_travellers.NewClient(cfg),
+		slackService:      slackService,
+		attachments:       attachment.NewService(db, blobstore.New(cfg), cfg.AttachmentMaxBytes),
+		escalations:       escalation.NewService(db, escalation.SettingsFromConfig(cfg), assignments, modes, slackService),
+		assignments:       assignments,
+		inbox:             inbox.NewPublisher(db),
 	}
 }
 
-func (ce *ConversationExecutor) Execute(conversationID uint, userInput string, messageType models.MessageType, conversationState *ConversationState, whatsapp bool) (string, error) {
+func (ce *ConversationExecutor) Execute(conversationID uint, userInput string, attachmentIDs []uint, messageType models.MessageType, conversationState *ConversationState, whatsapp bool) (string, error) {
+	attachments, err := ce.attachments.LoadUnlinked(conversationID, attachmentIDs)
+	if err != nil {
+		return "", err
+	}
 	packages, err := ce.getPackageListFromCache()
 	if err != nil {
 		log.Printf("Error getting package list: %v", err)
 		ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error getting package list: *%v* for conversation ID: *%d*", err, conversationID))
 		return "", err
 	}
-	messages := ce.prepareMessages(conversationState.ConversationHistory, packages, userInput, whatsapp)
+	messages := ce.prepareMessages(conversationState.ConversationHistory, packages, ce.userMessage(userInput, attachments), whatsapp)
 	conversationState.ConversationHistory = messages
 	var botResponse string
 	for {
 		if conversationState.State == ConversationStateEnd {
 			break
 		}
-		botResponse, err = ce.processInput(conversationID, userInput, conversationState, whatsapp)
+		botResponse, err = ce.processInput(conversationID, userInput, attachmentIDs, conversationState, whatsapp)
 		if err != nil {
 			return "", err
 		}
@@ -54,7 +76,7 @@ func (ce *ConversationExecutor) Execute(conversationID uint, userInput string, m
 	return botResponse, nil
 }
 
-func (ce *ConversationExecutor) processInput(conversationID uint, userInput string, conversationState *ConversationState, whatsapp bool) (string, error) {
+func (ce *ConversationExecutor) processInput(conversationID uint, userInput string, attachmentIDs []uint, conversationState *ConversationState, whatsapp bool) (string, error) {
 	var botResponse string
 	var totalTokens uint
 	var responseType models.MessageType
@@ -83,11 +105,15 @@ func (ce *ConversationExecutor) processInput(conversationID uint, userInput stri
 			ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error asserting tool call from response content: *%v* for conversation ID: *%d*", err, conversationID))
 			return "", errors.New("error asserting tool call from response content")
 		}
-		messageId, err := ce.updateConversation(conversationID, "", "", totalTokens, responseType)
+		messageId, err := ce.updateConversation(conversationID, "", "", totalTokens, responseType, nil)
 		if err != nil {
 			ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error updating conversation: *%v* for conversation ID: *%d*", err, conversationID))
 			return "", err
 		}
+		if toolCall.Function.Name == llm_service.RequestHumanAgentSchema.Name {
+			conversationState.EndState()
+			return ce.requestHumanAgent(toolCall, conversationID, messageId, userInput, attachmentIDs)
+		}
 		functionResponse, err := processFunctionResponse(ce.indian_travellers, toolCall, ce.db, conversationID, messageId)
 		if err != nil {
 			log.Printf("Error processing function response: %v", err)
@@ -95,6 +121,9 @@ func (ce *ConversationExecutor) processInput(conversationID uint, userInput stri
 			conversationState.EndState()
 			return "we encountered an error while processing your request. Please try again later.", nil
 		}
+		if isLeadFunction(toolCall.Function.Name) {
+			ce.assignOnLead(conversationID)
+		}
 		functionResponseString, _ := json.Marshal(functionResponse)
 		functionMessage := openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleFunction,
@@ -104,7 +133,7 @@ func (ce *ConversationExecutor) processInput(conversationID uint, userInput stri
 		conversationState.AddToHistory(functionMessage)
 	default:
 		botResponse, _ = responseContent.(string)
-		if _, err := ce.updateConversation(conversationID, userInput, botResponse, totalTokens, responseType); err != nil {
+		if _, err := ce.updateConversation(conversationID, userInput, botResponse, totalTokens, responseType, attachmentIDs); err != nil {
 			ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error updating conversation: *%v* for conversation ID: *%d*", err, conversationID))
 			return "", err
 		}
@@ -113,7 +142,31 @@ func (ce *ConversationExecutor) processInput(conversationID uint, userInput stri
 	return botResponse, nil
 }
 
-func (ce *ConversationExecutor) prepareMessages(history []openai.ChatCompletionMessage, packages []indian_travellers.Package, userInput string, whatsapp bool) []openai.ChatCompletionMessage {
+// requestHumanAgent escalates the conversation for the request_human_agent tool and answers the
+// user with the handoff message instead of asking the LLM again.
+func (ce *ConversationExecutor) requestHumanAgent(toolCall openai.ToolCall, conversationID, messageId uint, userInput string, attachmentIDs []uint) (string, error) {
+	handoff, err := handleRequestHumanAgent(ce.escalations, toolCall, ce.db, conversationID, messageId, userInput)
+	if err != nil {
+		log.Printf("Error escalating conversation %d: %v", conversationID, err)
+		ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error escalating to a human agent: *%v* for conversation ID: *%d*", err, conversationID))
+		return "we encountered an error while processing your request. Please try again later.", nil
+	}
+	if _, err := ce.updateConversation(conversationID, userInput, handoff, 0, models.MessageTypeUserSent, attachmentIDs); err != nil {
+		ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error updating conversation: *%v* for conversation ID: *%d*", err, conversationID))
+		return "", err
+	}
+	return handoff, nil
+}
+
+// assignOnLead assigns the conversation to an agent once the user has shared trip details.
+func (ce *ConversationExecutor) assignOnLead(conversationID uint) {
+	if _, err := ce.assignments.AssignOn(authUserConversation.TriggerLead, conversationID); err != nil {
+		log.Printf("Error assigning conversation %d on lead: %v", conversationID, err)
+		ce.slackService.SendSlackAlertAsync(fmt.Sprintf("Error assigning conversation on lead: *%v* for conversation ID: *%d*", err, conversationID))
+	}
+}
+
+func (ce *ConversationExecutor) prepareMessages(history []openai.ChatCompletionMessage, packages []indian_travellers.Package, userMessage openai.ChatCompletionMessage, whatsapp bool) []openai.ChatCompletionMessage {
 	var systemTemplate string
 	if whatsapp {
 		systemTemplate = llm_service.SystemMessageTemplateForWhatsapp(ce.indian_travellers, packages, 1)
@@ -121,10 +174,39 @@ func (ce *ConversationExecutor) prepareMessages(history []openai.ChatCompletionM
 		systemTemplate = llm_service.SystemMessageTemplate(packages)
 	}
 	messages := append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: systemTemplate}}, history...)
-	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: userInput})
+	messages = append(messages, userMessage)
 	return messages
 }
 
+// userMessage builds the user turn. Attachments are described in text, and images are also sent
+// as image inputs when the chat model supports them.
+func (ce *ConversationExecutor) userMessage(userInput string, attachments []models.MessageAttachment) openai.ChatCompletionMessage {
+	text := withAttachmentDescriptions(userInput, attachments)
+	if !llm_service.SupportsImageInput(llm_service.ChatModel) {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text}
+	}
+
+	parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: text}}
+	for i := range attachments {
+		if attachments[i].Kind != models.AttachmentKindImage {
+			continue
+		}
+		dataURL, err := ce.attachments.ImageDataURL(context.Background(), &attachments[i])
+		if err != nil {
+			log.Printf("Error loading image attachment %d: %v", attachments[i].ID, err)
+			continue
+		}
+		parts = append(parts, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: dataURL, Detail: openai.ImageURLDetailAuto},
+		})
+	}
+	if len(parts) == 1 {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text}
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts}
+}
+
 func (ce *ConversationExecutor) getPackageListFromCache() ([]indian_travellers.Package, error) {
 	cacheKey := fmt.Sprintf(cache.CacheKeys.GetPackageList.Key)
 	var packages []indian_travellers.Package
@@ -147,7 +229,7 @@ func (ce *ConversationExecutor) getPackageListFromCache() ([]indian_travellers.P
 	return packages, nil
 }
 
-func (ce *ConversationExecutor) updateConversation(conversationID uint, userInput, botResponse string, totalTokens uint, messageType models.MessageType) (uint, error) {
+func (ce *ConversationExecutor) updateConversation(conversationID uint, userInput, botResponse string, totalTokens uint, messageType models.MessageType, attachmentIDs []uint) (uint, error) {
 	var visible bool
 	switch messageType {
 	case models.MessageTypeUserFix, models.MessageTypeOffTopic, models.MessageTypeFunctionCall:
@@ -165,15 +247,29 @@ func (ce *ConversationExecutor) updateConversation(conversationID uint, userInpu
 		Type:           messageType,
 	}
 
-	// Save the message pair to the database.
-	if err := ce.db.Create(&messagePair).Error; err != nil {
+	// Save the message pair to the database, with the user's attachments linked in the same transaction.
+	err := ce.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&messagePair).Error; err != nil {
+			return err
+		}
+		return attachment.LinkToMessage(tx, conversationID, messagePair.ID, attachmentIDs)
+	})
+	if err != nil {
 		log.Printf("Error saving message pair: %v", err)
 		return 0, err // Return 0 as the ID in case of error
 	}
+	if visible {
+		ce.inbox.Publish(inbox.EventMessageCreated, conversationID, inbox.MessageData(&messagePair))
+	}
 
 	return messagePair.ID, nil // Return the ID of the newly created message pair
 }
 
+// isLeadFunction reports whether the tool call creates a lead with the travel backend.
+func isLeadFunction(name string) bool {
+	return name == "create_user_initial_query" || name == "create_user_final_booking"
+}
+
 func processFunctionResponse(indian_travellers_client *indian_travellers.Client, toolCall openai.ToolCall, db *gorm.DB, conversationID uint, messageId uint) (interface{}, error) {
 	// Generalize the handling of function calls based on the function's name
 	switch toolCall.Function.Name {
@@ -7,6 +7,7 @@ import (
 	"smart-chat/cache"
 	external "smart-chat/external/indian_travellers"
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/escalation"
 
 	openai "github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
@@ -194,3 +195,38 @@ func fetchUpcomingTrips(indian_travellers_client *external.Client, toolCall open
 	// Return the upcoming trips response
 	return upcomingTrips, nil
 }
+
+// handleRequestHumanAgent escalates the conversation to a human agent and returns the handoff
+// message for the user.
+func handleRequestHumanAgent(escalations *escalation.Service, toolCall openai.ToolCall, db *gorm.DB, conversationID uint, messageId uint, userInput string) (string, error) {
+	var args struct {
+		Reason  string `json:"reason"`
+		Urgency string `json:"urgency"`
+	}
+	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+		return "", err
+	}
+
+	escalated, err := escalations.Escalate(escalation.Request{
+		ConversationID:  conversationID,
+		Reason:          args.Reason,
+		Urgency:         args.Urgency,
+		LastUserMessage: userInput,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	functionCall := models.FunctionCall{
+		ConversationID:   conversationID,
+		MessageID:        messageId,
+		Name:             toolCall.Function.Name,
+		Args:             []byte(toolCall.Function.Arguments),
+		FunctionResponse: fmt.Sprintf("{\"escalation_id\":%d}", escalated.ID),
+	}
+	if err := db.Create(&functionCall).Error; err != nil {
+		return "", err
+	}
+
+	return escalations.HandoffMessage(), nil
+}
@@ -3,11 +3,16 @@ package conversation
 import (
 	"log"
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
+// HumanAgentName is the name given to assistant turns written by a human agent.
+const HumanAgentName = "human_agent"
+
 type ConversationHistory struct {
 	db *gorm.DB
 }
@@ -18,7 +23,7 @@ func NewConversationHistory(db *gorm.DB) *ConversationHistory {
 
 func (ch *ConversationHistory) FetchHistory(conversationID uint) ([]openai.ChatCompletionMessage, error) {
 	var conversationHistory []models.MessagePair
-	err := ch.db.Where("conversation_id = ?", conversationID).Preload("FunctionCalls").Find(&conversationHistory).Error
+	err := ch.db.Where("conversation_id = ?", conversationID).Preload("FunctionCalls").Preload("Attachments").Order("id").Find(&conversationHistory).Error
 	if err != nil {
 		log.Printf("Error fetching conversation history: %v", err)
 		return nil, err
@@ -38,16 +43,51 @@ func (ch *ConversationHistory) FetchHistory(conversationID uint) ([]openai.ChatC
 				messages = append(messages, functionMessage)
 			}
 		} else {
-			// Add user message and bot message to the conversation history
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleUser,
-				Content: pair.User,
-			}, openai.ChatCompletionMessage{
+			// Add user message and bot message to the conversation history.
+			// Attachments from earlier turns are only described; images are not re-sent.
+			var userAttachments, agentAttachments []models.MessageAttachment
+			for _, a := range pair.Attachments {
+				if a.UploadedBy == models.AttachmentUploaderAgent {
+					agentAttachments = append(agentAttachments, a)
+				} else {
+					userAttachments = append(userAttachments, a)
+				}
+			}
+			// Agent messages and nudges have no user turn, and messages held for an agent may have no
+			// reply; an empty message would read as saying nothing.
+			if userContent := withAttachmentDescriptions(pair.User, userAttachments); userContent != "" {
+				messages = append(messages, openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleUser,
+					Content: userContent,
+				})
+			}
+			assistantContent := withAttachmentDescriptions(pair.Bot, agentAttachments)
+			if assistantContent == "" {
+				continue
+			}
+			assistantMessage := openai.ChatCompletionMessage{
 				Role:    openai.ChatMessageRoleAssistant,
-				Content: pair.Bot,
-			})
+				Content: assistantContent,
+			}
+			if pair.Type == models.MessageTypeAgentAssumedAssistant {
+				// Tell the model a human agent wrote this turn so later bot turns follow on from it.
+				assistantMessage.Name = HumanAgentName
+			}
+			messages = append(messages, assistantMessage)
 		}
 	}
 
 	return messages, nil
 }
+
+// withAttachmentDescriptions appends a text description of each attachment to a message.
+func withAttachmentDescriptions(text string, attachments []models.MessageAttachment) string {
+	lines := make([]string, 0, len(attachments)+1)
+	if strings.TrimSpace(text) != "" {
+		lines = append(lines, text)
+	}
+	for _, a := range attachments {
+		lines = append(lines, attachment.Describe(a))
+	}
+	return strings.Join(lines, "\n")
+}
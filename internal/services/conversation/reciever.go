@@ -5,6 +5,8 @@ import (
 	"log"
 	"smart-chat/cache"
 	"smart-chat/internal/models"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	conversationMode "smart-chat/internal/services/conversation_mode"
 
 	"gorm.io/gorm"
 )
@@ -15,20 +17,21 @@ type ConversationReceiver struct {
 	Executor      *ConversationExecutor
 	ConvState     *ConversationState
 	HistoryLoader *ConversationHistory
+	Modes         *conversationMode.Service
+	Assignments   *authUserConversation.Engine
 }
 
-func NewConversationReceiver(db *gorm.DB, builder *ConversationBuilder, executor *ConversationExecutor, state *ConversationState, historyLoader *ConversationHistory) *ConversationReceiver {
-	return &ConversationReceiver{db: db, Builder: builder, Executor: executor, ConvState: state, HistoryLoader: historyLoader}
+func NewConversationReceiver(db *gorm.DB, builder *ConversationBuilder, executor *ConversationExecutor, state *ConversationState, historyLoader *ConversationHistory, modes *conversationMode.Service, assignments *authUserConversation.Engine) *ConversationReceiver {
+	return &ConversationReceiver{db: db, Builder: builder, Executor: executor, ConvState: state, HistoryLoader: historyLoader, Modes: modes, Assignments: assignments}
 }
 
-func (cr *ConversationReceiver) ReceiveMessage(sessionID uint, message string, messageType models.MessageType, whatsapp bool) (string, error) {
+func (cr *ConversationReceiver) ReceiveMessage(sessionID uint, message string, attachmentIDs []uint, messageType models.MessageType, whatsapp bool) (string, error) {
 	conversation, err := cr.Builder.Build(sessionID)
 	if err != nil {
 		return "", err
 	}
-	convHistory, _ := cr.HistoryLoader.FetchHistory(conversation.ID)
-	cr.ConvState.InitState(conversation.ID, convHistory)
-	response, err := cr.Executor.Execute(conversation.ID, message, messageType, cr.ConvState, whatsapp)
+	cr.assignOnStart(conversation.ID)
+	response, err := cr.respond(conversation.ID, message, attachmentIDs, messageType, whatsapp)
 	if err != nil {
 		return "", err
 	}
@@ -40,3 +43,42 @@ func (cr *ConversationReceiver) ReceiveMessage(sessionID uint, message string, m
 	}
 	return response, nil
 }
+
+// assignOnStart assigns a conversation to an agent when its first message arrives.
+func (cr *ConversationReceiver) assignOnStart(conversationID uint) {
+	if cr.Assignments == nil || !cr.Assignments.Enabled(authUserConversation.TriggerStart) {
+		return
+	}
+	var messages int64
+	if err := cr.db.Model(&models.MessagePair{}).Where("conversation_id = ?", conversationID).Count(&messages).Error; err != nil {
+		log.Printf("Error counting messages of conversation %d: %v", conversationID, err)
+		return
+	}
+	if messages > 0 {
+		return
+	}
+	if _, err := cr.Assignments.AssignOn(authUserConversation.TriggerStart, conversationID); err != nil {
+		log.Printf("Error assigning conversation %d on start: %v", conversationID, err)
+	}
+}
+
+// respond answers the message with the LLM unless the conversation is in human mode, where the
+// message is held for the assigned agent instead.
+func (cr *ConversationReceiver) respond(conversationID uint, message string, attachmentIDs []uint, messageType models.MessageType, whatsapp bool) (string, error) {
+	if cr.Modes != nil {
+		state, err := cr.Modes.Get(conversationID)
+		if err != nil {
+			return "", err
+		}
+		switch state.Mode {
+		case models.ConversationModeHuman:
+			return cr.Modes.HoldForAgent(conversationID, message, attachmentIDs, messageType)
+		case models.ConversationModePaired:
+			cr.Modes.NotifyAgents(conversationID, message, len(attachmentIDs))
+		}
+	}
+
+	convHistory, _ := cr.HistoryLoader.FetchHistory(conversationID)
+	cr.ConvState.InitState(conversationID, convHistory)
+	return cr.Executor.Execute(conversationID, message, attachmentIDs, messageType, cr.ConvState, whatsapp)
+}
@@ -0,0 +1,49 @@
+package convHistory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"smart-chat/internal/constants"
+	"smart-chat/internal/models"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not produced by Cursor.Encode.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a conversation list ordered by (created_at, id) in Sort order. Clients
+// see it only as the opaque string from Encode.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"i"`
+	Sort      string    `json:"s"`
+}
+
+// CursorAfter returns the cursor for the page that follows conversation.
+func CursorAfter(conversation models.Conversation, sortOrder string) Cursor {
+	return Cursor{CreatedAt: conversation.CreatedAt.UTC(), ID: conversation.ID, Sort: sortOrder}
+}
+
+// Encode returns the cursor as an opaque URL-safe string.
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a cursor from Encode.
+func DecodeCursor(encoded string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == 0 || cursor.CreatedAt.IsZero() {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if cursor.Sort != constants.SortAsc && cursor.Sort != constants.SortDesc {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
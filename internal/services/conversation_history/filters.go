@@ -0,0 +1,94 @@
+package convHistory
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smart-chat/internal/constants"
+	spec "smart-chat/internal/services/conversation_history/specification"
+	"smart-chat/internal/services/tag"
+)
+
+// Filters are the optional conversation list filters, named after the list endpoint's query
+// parameters. Exports store them to build the same specifications when they run.
+type Filters struct {
+	StartDate      string `json:"startdate,omitempty"`
+	EndDate        string `json:"enddate,omitempty"`
+	Mobile         string `json:"mobile,omitempty"`
+	Source         string `json:"source,omitempty"`
+	ConversationID string `json:"conversationid,omitempty"`
+	Tags           string `json:"tags,omitempty"`
+	TagsMatch      string `json:"tags_match,omitempty"`
+	Query          string `json:"q,omitempty"`
+}
+
+// FilterError is an invalid filter value. Its message is meant for the client.
+type FilterError struct {
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	return e.Message
+}
+
+// Specifications returns the specifications selecting the filtered conversations. Every error is
+// a *FilterError.
+func (f Filters) Specifications() ([]spec.Specification, error) {
+	var specs []spec.Specification
+
+	// A date range needs both ends; either one alone is ignored.
+	if f.StartDate != "" && f.EndDate != "" {
+		startDate, err := time.Parse(constants.DateFormat, f.StartDate)
+		if err != nil {
+			return nil, &FilterError{constants.ErrInvalidStartDate}
+		}
+		endDate, err := time.Parse(constants.DateFormat, f.EndDate)
+		if err != nil {
+			return nil, &FilterError{constants.ErrInvalidEndDate}
+		}
+		specs = append(specs, spec.ByDateRange{StartDate: startDate, EndDate: endDate})
+	}
+
+	if f.Mobile != "" {
+		specs = append(specs, spec.ByMobile{Mobile: f.Mobile})
+	}
+
+	if source := strings.TrimSpace(f.Source); source != "" {
+		specs = append(specs, spec.BySource{Source: source})
+	}
+
+	if conversationIDStr := strings.TrimSpace(f.ConversationID); conversationIDStr != "" {
+		conversationID, err := strconv.ParseUint(conversationIDStr, 10, 64)
+		if err != nil || conversationID == 0 {
+			return nil, &FilterError{constants.ErrInvalidConversationID}
+		}
+		specs = append(specs, spec.ByID{ID: uint(conversationID)})
+	}
+
+	// Tags are comma-separated names, matching any (default) or all of them.
+	if tagsStr := strings.TrimSpace(f.Tags); tagsStr != "" {
+		names, err := tag.NormalizeNames(strings.Split(tagsStr, ","))
+		if err != nil {
+			return nil, &FilterError{err.Error()}
+		}
+		match := strings.ToLower(f.TagsMatch)
+		if match == "" {
+			match = spec.TagMatchAny
+		}
+		if match != spec.TagMatchAny && match != spec.TagMatchAll {
+			return nil, &FilterError{"tags_match must be any or all"}
+		}
+		specs = append(specs, spec.ByTags{Names: names, Match: match})
+	}
+
+	if query := strings.TrimSpace(f.Query); query != "" {
+		if utf8.RuneCountInString(query) > MaxSearchQueryLength || len(spec.SearchTerms(query)) == 0 {
+			return nil, &FilterError{"q must contain a word and be at most 200 characters"}
+		}
+		specs = append(specs, spec.ByText{Query: query})
+	}
+
+	return specs, nil
+}
@@ -0,0 +1,183 @@
+package convHistory
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"smart-chat/internal/models"
+	spec "smart-chat/internal/services/conversation_history/specification"
+)
+
+const (
+	// MaxSearchQueryLength caps the ?q= search query, in characters.
+	MaxSearchQueryLength = 200
+	// maxSnippets is how many matching messages per conversation get a snippet.
+	maxSnippets = 3
+	// snippetContext is how many characters of text a fallback snippet shows before the first match.
+	snippetContext = 60
+	// snippetLength is the length of a fallback snippet, in characters.
+	snippetLength = 200
+
+	// Highlight sentinels: snippets are HTML-escaped before these become <mark> tags.
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+// MessageMatch is a message that matched a text search, with the matching words in <mark> tags.
+// The rest of the snippet is HTML-escaped.
+type MessageMatch struct {
+	MessagePairID uint   `json:"message_pair_id"`
+	Snippet       string `json:"snippet"`
+}
+
+// TextMatches lists the messages of one conversation that matched a text search, oldest first.
+// Only the first few have a snippet.
+type TextMatches struct {
+	MessageIDs []uint         `json:"message_ids"`
+	Snippets   []MessageMatch `json:"snippets"`
+}
+
+// SearchMatches returns, for each of the conversations, the visible messages matching query and
+// highlighted snippets for the first of them. Conversations without a match are left out.
+func (chs *ConvHistoryService) SearchMatches(conversationIDs []uint, query string) (map[uint]*TextMatches, error) {
+	matches := make(map[uint]*TextMatches, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return matches, nil
+	}
+
+	var rows []struct {
+		ID             uint
+		ConversationID uint
+	}
+	err := spec.MatchingMessages(chs.db, query).
+		Select("message_pairs.id, message_pairs.conversation_id").
+		Where("message_pairs.conversation_id IN ?", conversationIDs).
+		Order("message_pairs.conversation_id, message_pairs.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var snippetIDs []uint
+	for _, row := range rows {
+		match, ok := matches[row.ConversationID]
+		if !ok {
+			match = &TextMatches{MessageIDs: []uint{}, Snippets: []MessageMatch{}}
+			matches[row.ConversationID] = match
+		}
+		match.MessageIDs = append(match.MessageIDs, row.ID)
+		if len(match.MessageIDs) <= maxSnippets {
+			snippetIDs = append(snippetIDs, row.ID)
+		}
+	}
+	if len(snippetIDs) == 0 {
+		return matches, nil
+	}
+
+	snippets, err := chs.snippets(snippetIDs, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if snippet, ok := snippets[row.ID]; ok {
+			match := matches[row.ConversationID]
+			match.Snippets = append(match.Snippets, MessageMatch{MessagePairID: row.ID, Snippet: snippet})
+		}
+	}
+	return matches, nil
+}
+
+// snippets returns a highlighted snippet of each message. Postgres builds them with ts_headline;
+// elsewhere they are cut around the first search term.
+func (chs *ConvHistoryService) snippets(messagePairIDs []uint, query string) (map[uint]string, error) {
+	snippets := make(map[uint]string, len(messagePairIDs))
+	if chs.db.Dialector.Name() == "postgres" {
+		var rows []struct {
+			ID      uint
+			Snippet string
+		}
+		err := chs.db.Model(&models.MessagePair{}).
+			Select(`id, ts_headline('`+spec.SearchConfig+`', coalesce("user", '') || ' ' || coalesce(bot, ''),
+				websearch_to_tsquery('`+spec.SearchConfig+`', ?), ?) AS snippet`,
+				query, "StartSel="+markStart+", StopSel="+markStop+", MinWords=10, MaxWords=30, MaxFragments=2").
+			Where("id IN ?", messagePairIDs).
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			snippets[row.ID] = highlight(row.Snippet)
+		}
+		return snippets, nil
+	}
+
+	var pairs []models.MessagePair
+	if err := chs.db.Select("id", "user", "bot").Where("id IN ?", messagePairIDs).Find(&pairs).Error; err != nil {
+		return nil, err
+	}
+	terms := spec.SearchTerms(query)
+	for _, pair := range pairs {
+		snippets[pair.ID] = highlight(markTerms(strings.TrimSpace(pair.User+" "+pair.Bot), terms))
+	}
+	return snippets, nil
+}
+
+// markTerms cuts text to a window around the first search term and wraps every term in it with
+// the highlight sentinels.
+func markTerms(text string, terms []string) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	termRunes := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		termRunes = append(termRunes, []rune(term))
+	}
+	matchAt := func(i int) int {
+		for _, term := range termRunes {
+			if i+len(term) <= len(lower) && string(lower[i:i+len(term)]) == string(term) {
+				return len(term)
+			}
+		}
+		return 0
+	}
+
+	first := 0
+	for i := range lower {
+		if matchAt(i) > 0 {
+			first = i
+			break
+		}
+	}
+	start := max(first-snippetContext, 0)
+	for start > 0 && start < first && !unicode.IsSpace(runes[start-1]) {
+		start++
+	}
+	end := min(start+snippetLength, len(runes))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		if n := matchAt(i); n > 0 {
+			b.WriteString(markStart + string(runes[i:i+n]) + markStop)
+			i += n
+			continue
+		}
+		b.WriteRune(runes[i])
+		i++
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// highlight HTML-escapes a snippet and turns the highlight sentinels into <mark> tags.
+func highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(escaped)
+}
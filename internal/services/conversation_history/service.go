@@ -23,7 +23,8 @@ func (chs *ConvHistoryService) GetConversations(offset, limit int, specs ...spec
 	return chs.GetConversationsWithSort(offset, limit, constants.DefaultSortStr, specs...)
 }
 
-// GetConversationsWithSort fetches conversations with full associations (MessagePairs, FunctionCalls, Session.User).
+// GetConversationsWithSort fetches conversations with full associations (MessagePairs with their
+// attachments and agent authors, FunctionCalls, Session.User).
 func (chs *ConvHistoryService) GetConversationsWithSort(offset, limit int, sortOrder string, specs ...spec.Specification) ([]models.Conversation, error) {
 	sortOrder = strings.ToLower(sortOrder)
 	if sortOrder != constants.SortAsc && sortOrder != constants.SortDesc {
@@ -39,7 +40,8 @@ func (chs *ConvHistoryService) GetConversationsWithSort(offset, limit int, sortO
 
 	var conversations []models.Conversation
 	err := dbQuery.
-		Preload("MessagePairs").
+		Preload("MessagePairs.Attachments").
+		Preload("MessagePairs.AuthorAuthUser").
 		Preload("FunctionCalls").
 		Preload("Session.User").
 		Order("conversations.created_at " + sortOrder).
@@ -69,6 +71,30 @@ func (chs *ConvHistoryService) ListConversations(offset, limit int, sortOrder st
 		dbQuery = s.Apply(dbQuery)
 	}
 
+	return chs.listConversations(dbQuery.Offset(offset), limit, sortOrder)
+}
+
+// ListConversationsAfter fetches the conversations for list views that follow cursor, in the
+// cursor's sort order. Seeking on (created_at, id) keeps deep pages as cheap as the first one and
+// stops pages from shifting when new conversations arrive.
+func (chs *ConvHistoryService) ListConversationsAfter(cursor Cursor, limit int, specs ...spec.Specification) ([]models.Conversation, error) {
+	dbQuery := chs.db.Model(&models.Conversation{})
+
+	for _, s := range specs {
+		dbQuery = s.Apply(dbQuery)
+	}
+
+	operator := ">"
+	if cursor.Sort == constants.SortDesc {
+		operator = "<"
+	}
+	dbQuery = dbQuery.Where("(conversations.created_at, conversations.id) "+operator+" (?, ?)", cursor.CreatedAt, cursor.ID)
+
+	return chs.listConversations(dbQuery, limit, cursor.Sort)
+}
+
+// listConversations runs a list query ordered by (created_at, id), the order cursors follow.
+func (chs *ConvHistoryService) listConversations(dbQuery *gorm.DB, limit int, sortOrder string) ([]models.Conversation, error) {
 	var conversations []models.Conversation
 	err := dbQuery.
 		Distinct("conversations.id", "conversations.created_at", "conversations.session_id").
@@ -80,7 +106,7 @@ func (chs *ConvHistoryService) ListConversations(offset, limit int, sortOrder st
 			return db.Select("id", "name", "mobile")
 		}).
 		Order("conversations.created_at " + sortOrder).
-		Offset(offset).
+		Order("conversations.id " + sortOrder).
 		Limit(limit).
 		Find(&conversations).Error
 
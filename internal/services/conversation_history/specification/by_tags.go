@@ -0,0 +1,30 @@
+package specification
+
+import "gorm.io/gorm"
+
+// Tag match modes for ByTags.
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// ByTags filters conversations carrying any, or with Match set to TagMatchAll every, one of the
+// tag names. Names must already be normalized and de-duplicated.
+type ByTags struct {
+	Names []string
+	Match string
+}
+
+func (spec ByTags) Apply(db *gorm.DB) *gorm.DB {
+	tagged := db.Session(&gorm.Session{NewDB: true}).
+		Table("conversation_tags").
+		Select("conversation_tags.conversation_id").
+		Joins("JOIN tags ON tags.id = conversation_tags.tag_id").
+		Where("tags.name IN ?", spec.Names)
+	if spec.Match == TagMatchAll {
+		tagged = tagged.
+			Group("conversation_tags.conversation_id").
+			Having("COUNT(DISTINCT conversation_tags.tag_id) = ?", len(spec.Names))
+	}
+	return db.Where("conversations.id IN (?)", tagged)
+}
@@ -0,0 +1,57 @@
+package specification
+
+import (
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// SearchConfig is the Postgres text search configuration message_pairs.search_vector is built with.
+const SearchConfig = "english"
+
+// ByText filters conversations with a visible message matching the search query.
+type ByText struct {
+	Query string
+}
+
+func (spec ByText) Apply(db *gorm.DB) *gorm.DB {
+	matching := MatchingMessages(db.Session(&gorm.Session{NewDB: true}), spec.Query).
+		Select("message_pairs.conversation_id")
+	return db.Where("conversations.id IN (?)", matching)
+}
+
+// MatchingMessages scopes db to the visible message pairs matching query. On Postgres it searches
+// the message_pairs.search_vector GIN index with web search syntax ("quoted phrases", or, -word).
+// Other databases, such as the SQLite test database, fall back to requiring every search term in
+// the user or bot text of the same message.
+func MatchingMessages(db *gorm.DB, query string) *gorm.DB {
+	db = db.Table("message_pairs").
+		Where("message_pairs.deleted_at IS NULL AND message_pairs.visible = ?", true)
+	if db.Dialector.Name() == "postgres" {
+		return db.Where("message_pairs.search_vector @@ websearch_to_tsquery('"+SearchConfig+"', ?)", query)
+	}
+	for _, term := range SearchTerms(query) {
+		pattern := "%" + term + "%"
+		db = db.Where(`(LOWER(message_pairs."user") LIKE ? OR LOWER(message_pairs.bot) LIKE ?)`, pattern, pattern)
+	}
+	return db
+}
+
+// SearchTerms returns the distinct lower-case words of a search query, ignoring punctuation and
+// search operators.
+func SearchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if word == "or" || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
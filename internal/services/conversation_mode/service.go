@@ -0,0 +1,264 @@
+package conversation_mode
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidMode          = errors.New("mode must be bot, human or paired")
+	ErrConversationNotFound = errors.New("conversation not found")
+)
+
+// Settings controls human takeover.
+type Settings struct {
+	// Timeout is how long a human or paired conversation stays in that mode after the last agent
+	// activity before it returns to bot mode. Zero keeps the mode until an agent changes it.
+	Timeout time.Duration
+	// AckMessage is sent once per takeover to a user who writes in human mode. Empty sends nothing.
+	AckMessage string
+}
+
+// SettingsFromConfig builds Settings from the application config.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	return Settings{
+		Timeout:    time.Duration(cfg.HumanModeTimeoutMinutes) * time.Minute,
+		AckMessage: strings.TrimSpace(cfg.HumanModeAckMessage),
+	}
+}
+
+// State is a conversation's mode as returned by the client API.
+type State struct {
+	ConversationID uint       `json:"conversation_id"`
+	Mode           string     `json:"mode"`
+	ChangedAt      *time.Time `json:"mode_changed_at"`
+	ChangedBy      *uint      `json:"mode_changed_by"`
+	ExpiresAt      *time.Time `json:"mode_expires_at"`
+}
+
+// Service reads and changes conversation modes and holds user messages for agents in human mode.
+type Service struct {
+	db       *gorm.DB
+	settings Settings
+	slack    *slack.SlackService
+	inbox    *inbox.Publisher
+	now      func() time.Time
+}
+
+func NewService(db *gorm.DB, settings Settings, slackService *slack.SlackService) *Service {
+	return &Service{db: db, settings: settings, slack: slackService, inbox: inbox.NewPublisher(db), now: time.Now}
+}
+
+// ValidMode reports whether mode is one of the conversation modes.
+func ValidMode(mode string) bool {
+	switch mode {
+	case models.ConversationModeBot, models.ConversationModeHuman, models.ConversationModePaired:
+		return true
+	}
+	return false
+}
+
+// Get returns the conversation's mode. A mode past its expiry is returned to bot first.
+func (s *Service) Get(conversationID uint) (*State, error) {
+	var conv models.Conversation
+	if err := s.db.Select("id", "mode", "mode_changed_at", "mode_changed_by", "mode_expires_at").First(&conv, conversationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, fmt.Errorf("failed to load conversation mode: %w", err)
+	}
+	if conv.Mode != models.ConversationModeBot && conv.ModeExpiresAt != nil && !conv.ModeExpiresAt.After(s.now()) {
+		if _, err := s.returnToBot(s.db.Where("id = ?", conversationID)); err != nil {
+			return nil, err
+		}
+		return s.Get(conversationID)
+	}
+	return stateOf(conv), nil
+}
+
+// Set changes the conversation's mode on behalf of the auth user actorID, or of the system when
+// actorID is zero. Human and paired modes expire after Settings.Timeout.
+func (s *Service) Set(conversationID uint, mode string, actorID uint) (*State, error) {
+	if !ValidMode(mode) {
+		return nil, ErrInvalidMode
+	}
+	now := s.now()
+	var changedBy *uint
+	if actorID != 0 {
+		changedBy = &actorID
+	}
+	updates := map[string]any{
+		"mode":            mode,
+		"mode_changed_at": now,
+		"mode_changed_by": changedBy,
+		"mode_expires_at": s.expiry(mode, now),
+	}
+	result := s.db.Model(&models.Conversation{}).Where("id = ?", conversationID).Updates(updates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update conversation mode: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrConversationNotFound
+	}
+	return s.Get(conversationID)
+}
+
+// Extend restarts the auto-return timer of a human or paired conversation after agent activity.
+func (s *Service) Extend(conversationID uint) error {
+	if s.settings.Timeout <= 0 {
+		return nil
+	}
+	now := s.now()
+	return s.db.Model(&models.Conversation{}).
+		Where("id = ? AND mode <> ?", conversationID, models.ConversationModeBot).
+		Update("mode_expires_at", now.Add(s.settings.Timeout)).Error
+}
+
+// ReturnExpired puts every conversation whose mode expired by now back in bot mode.
+func (s *Service) ReturnExpired(now time.Time) (int64, error) {
+	return s.returnToBot(s.db.Where("mode <> ? AND mode_expires_at <= ?", models.ConversationModeBot, now))
+}
+
+// RunAutoReturn is the cron entry point for ReturnExpired.
+func (s *Service) RunAutoReturn() {
+	returned, err := s.ReturnExpired(s.now())
+	if err != nil {
+		log.Printf("Conversation mode auto-return failed: %v", err)
+		if s.slack != nil {
+			s.slack.SendSlackAlertAsync(fmt.Sprintf("Conversation mode auto-return failed: *%v*", err))
+		}
+		return
+	}
+	if returned > 0 {
+		log.Printf("Conversation mode auto-return: returned=%d", returned)
+	}
+}
+
+// HoldForAgent stores a user message received in human mode without asking the LLM, pings Slack
+// and returns the acknowledgement to send the user, if any, in the bot response format.
+func (s *Service) HoldForAgent(conversationID uint, userInput string, attachmentIDs []uint, messageType models.MessageType) (string, error) {
+	state, err := s.Get(conversationID)
+	if err != nil {
+		return "", err
+	}
+
+	reply := ""
+	if s.settings.AckMessage != "" {
+		acked, err := s.ackedSince(conversationID, state.ChangedAt)
+		if err != nil {
+			return "", err
+		}
+		if !acked {
+			reply = fmt.Sprintf("{\"content\":%q}", s.settings.AckMessage)
+		}
+	}
+
+	pair := models.MessagePair{
+		ConversationID: conversationID,
+		User:           userInput,
+		Bot:            reply,
+		Visible:        messageType != models.MessageTypeUserFix,
+		Type:           models.MessageTypeUserAwaitingAgent,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&pair).Error; err != nil {
+			return fmt.Errorf("failed to store message for agent: %w", err)
+		}
+		return attachment.LinkToMessage(tx, conversationID, pair.ID, attachmentIDs)
+	})
+	if err != nil {
+		return "", err
+	}
+	if pair.Visible {
+		s.inbox.Publish(inbox.EventMessageCreated, conversationID, inbox.MessageData(&pair))
+	}
+
+	s.NotifyAgents(conversationID, userInput, len(attachmentIDs))
+	return reply, nil
+}
+
+// NotifyAgents pings Slack about a new user message in a human or paired conversation, naming the
+// agents assigned to it.
+func (s *Service) NotifyAgents(conversationID uint, userInput string, attachments int) {
+	if s.slack == nil {
+		return
+	}
+	var agents []string
+	err := s.db.Table("auth_user_conversation").
+		Select("COALESCE(auth_users.name, auth_users.zitadel_user_id)").
+		Joins("JOIN auth_users ON auth_users.user_id = auth_user_conversation.auth_user_id").
+		Where("auth_user_conversation.conversation_id = ? AND auth_user_conversation.deleted_at IS NULL", conversationID).
+		Scan(&agents).Error
+	if err != nil {
+		log.Printf("Failed to load assigned agents for conversation %d: %v", conversationID, err)
+	}
+	assigned := "nobody"
+	if len(agents) > 0 {
+		assigned = strings.Join(agents, ", ")
+	}
+	message := fmt.Sprintf("New message in human-handled conversation ID: *%d* (assigned: *%s*) | %q", conversationID, assigned, userInput)
+	if attachments > 0 {
+		message += fmt.Sprintf(" | attachments=%d", attachments)
+	}
+	s.slack.SendSlackNotificationAsync(message)
+}
+
+// ackedSince reports whether the user has been sent the acknowledgement since the mode last changed.
+func (s *Service) ackedSince(conversationID uint, since *time.Time) (bool, error) {
+	query := s.db.Model(&models.MessagePair{}).
+		Where("conversation_id = ? AND type = ? AND bot <> ''", conversationID, models.MessageTypeUserAwaitingAgent)
+	if since != nil {
+		query = query.Where("created_at >= ?", *since)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check human mode acknowledgement: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *Service) expiry(mode string, now time.Time) *time.Time {
+	if mode == models.ConversationModeBot || s.settings.Timeout <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(s.settings.Timeout)
+	return &expiresAt
+}
+
+func (s *Service) returnToBot(scope *gorm.DB) (int64, error) {
+	result := scope.Model(&models.Conversation{}).Updates(map[string]any{
+		"mode":            models.ConversationModeBot,
+		"mode_changed_at": s.now(),
+		"mode_changed_by": nil,
+		"mode_expires_at": nil,
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to return conversations to bot mode: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func stateOf(conv models.Conversation) *State {
+	mode := conv.Mode
+	if mode == "" {
+		mode = models.ConversationModeBot
+	}
+	return &State{
+		ConversationID: conv.ID,
+		Mode:           mode,
+		ChangedAt:      conv.ModeChangedAt,
+		ChangedBy:      conv.ModeChangedBy,
+		ExpiresAt:      conv.ModeExpiresAt,
+	}
+}
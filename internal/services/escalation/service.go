@@ -0,0 +1,323 @@
+package escalation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReasonRequired       = errors.New("reason is required")
+	ErrInvalidStatus        = errors.New("status must be open, resolved or all")
+	ErrEscalationNotFound   = errors.New("escalation not found")
+	ErrConversationNotFound = errors.New("conversation not found")
+)
+
+// StatusAll lists escalations in every status.
+const StatusAll = "all"
+
+// urgencyRank orders urgencies from most to least pressing.
+var urgencyRank = map[string]int{
+	models.EscalationUrgencyHigh:   0,
+	models.EscalationUrgencyNormal: 1,
+	models.EscalationUrgencyLow:    2,
+}
+
+// Assigner picks the agent who takes an escalated conversation.
+// *authUserConversation.Engine satisfies it.
+type Assigner interface {
+	AssignOn(trigger authUserConversation.Trigger, conversationID uint) (*authUserConversation.AgentUser, error)
+}
+
+// Settings controls escalations.
+type Settings struct {
+	// HandoffMessage is sent to the user when the bot hands the conversation over.
+	HandoffMessage string
+	// ClientAppBaseURL is where agents open conversations; Slack notifications link to it.
+	ClientAppBaseURL string
+}
+
+// SettingsFromConfig builds Settings from the application config.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	return Settings{
+		HandoffMessage:   strings.TrimSpace(cfg.EscalationHandoffMessage),
+		ClientAppBaseURL: strings.TrimRight(strings.TrimSpace(cfg.ClientAppBaseURL), "/"),
+	}
+}
+
+// Request is the bot asking for a human agent.
+type Request struct {
+	ConversationID  uint
+	Reason          string
+	Urgency         string
+	LastUserMessage string
+}
+
+// ListFilter narrows the escalation queue.
+type ListFilter struct {
+	// Status is open, resolved or all. Empty lists open escalations.
+	Status string
+	// AssignedTo limits the queue to conversations assigned to this auth user.
+	AssignedTo *uint
+}
+
+// QueueItem is an escalation as listed by the client API.
+type QueueItem struct {
+	ID             uint       `json:"id" gorm:"column:id"`
+	ConversationID uint       `json:"conversation_id" gorm:"column:conversation_id"`
+	Reason         string     `json:"reason" gorm:"column:reason"`
+	Urgency        string     `json:"urgency" gorm:"column:urgency"`
+	Status         string     `json:"status" gorm:"column:status"`
+	AssignedTo     *uint      `json:"assigned_to" gorm:"column:assigned_auth_user_id"`
+	AssigneeName   *string    `json:"assignee_name" gorm:"column:assignee_name"`
+	UserName       string     `json:"user_name" gorm:"column:user_name"`
+	UserMobile     string     `json:"user_mobile" gorm:"column:user_mobile"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"column:created_at"`
+	ResolvedAt     *time.Time `json:"resolved_at" gorm:"column:resolved_at"`
+	ResolvedBy     *uint      `json:"resolved_by" gorm:"column:resolved_by"`
+}
+
+// Service records escalations raised by the bot, hands the conversation to an agent and serves the
+// escalation queue.
+type Service struct {
+	db       *gorm.DB
+	settings Settings
+	assigner Assigner
+	modes    *conversationMode.Service
+	slack    *slack.SlackService
+	inbox    *inbox.Publisher
+	now      func() time.Time
+}
+
+func NewService(db *gorm.DB, settings Settings, assigner Assigner, modes *conversationMode.Service, slackService *slack.SlackService) *Service {
+	return &Service{db: db, settings: settings, assigner: assigner, modes: modes, slack: slackService, inbox: inbox.NewPublisher(db), now: time.Now}
+}
+
+// NormalizeUrgency returns urgency in lower case, or normal when it is not a known urgency.
+func NormalizeUrgency(urgency string) string {
+	urgency = strings.ToLower(strings.TrimSpace(urgency))
+	if _, ok := urgencyRank[urgency]; !ok {
+		return models.EscalationUrgencyNormal
+	}
+	return urgency
+}
+
+// HandoffMessage returns the message for the user in the bot response format.
+func (s *Service) HandoffMessage() string {
+	return fmt.Sprintf("{\"content\":%q}", s.settings.HandoffMessage)
+}
+
+// Escalate marks the conversation as escalated, assigns it to an agent, puts it in human mode and
+// notifies Slack. A conversation with an open escalation keeps it, raising its urgency if needed.
+func (s *Service) Escalate(req Request) (*models.Escalation, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	urgency := NormalizeUrgency(req.Urgency)
+
+	var conv models.Conversation
+	if err := s.db.Preload("Session.User").First(&conv, req.ConversationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+
+	var escalation models.Escalation
+	opened := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("conversation_id = ? AND status = ?", conv.ID, models.EscalationStatusOpen).First(&escalation).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			opened = true
+			escalation = models.Escalation{
+				ConversationID: conv.ID,
+				Reason:         reason,
+				Urgency:        urgency,
+				Status:         models.EscalationStatusOpen,
+			}
+			if err := tx.Create(&escalation).Error; err != nil {
+				return fmt.Errorf("failed to create escalation: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to load open escalation: %w", err)
+		default:
+			updates := map[string]any{"reason": reason}
+			if urgencyRank[urgency] < urgencyRank[escalation.Urgency] {
+				updates["urgency"] = urgency
+			}
+			if err := tx.Model(&escalation).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update escalation: %w", err)
+			}
+		}
+		if conv.EscalatedAt == nil {
+			if err := tx.Model(&models.Conversation{}).Where("id = ?", conv.ID).Update("escalated_at", s.now()).Error; err != nil {
+				return fmt.Errorf("failed to mark conversation as escalated: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agent, err := s.assign(&escalation)
+	if err != nil {
+		log.Printf("Failed to assign escalated conversation %d: %v", conv.ID, err)
+	}
+	if s.modes != nil {
+		if _, err := s.modes.Set(conv.ID, models.ConversationModeHuman, 0); err != nil {
+			log.Printf("Failed to switch escalated conversation %d to human mode: %v", conv.ID, err)
+		}
+	}
+
+	if opened {
+		s.inbox.Publish(inbox.EventEscalationOpened, conv.ID, map[string]any{
+			"escalation_id": escalation.ID,
+			"reason":        escalation.Reason,
+			"urgency":       escalation.Urgency,
+		})
+	}
+	s.notify(&conv, &escalation, agent, req.LastUserMessage)
+	return &escalation, nil
+}
+
+// List returns a page of the escalation queue, most urgent and oldest first, and the total count.
+func (s *Service) List(filter ListFilter, offset, limit int) ([]QueueItem, int64, error) {
+	status := strings.ToLower(strings.TrimSpace(filter.Status))
+	if status == "" {
+		status = models.EscalationStatusOpen
+	}
+	if status != models.EscalationStatusOpen && status != models.EscalationStatusResolved && status != StatusAll {
+		return nil, 0, ErrInvalidStatus
+	}
+
+	query := s.db.Table("escalations").Where("escalations.deleted_at IS NULL")
+	if status != StatusAll {
+		query = query.Where("escalations.status = ?", status)
+	}
+	if filter.AssignedTo != nil {
+		query = query.Where("escalations.conversation_id IN (?)", s.db.Table("auth_user_conversation").
+			Select("conversation_id").
+			Where("auth_user_id = ? AND deleted_at IS NULL", *filter.AssignedTo))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count escalations: %w", err)
+	}
+
+	items := make([]QueueItem, 0)
+	err := query.
+		Select("escalations.id, escalations.conversation_id, escalations.reason, escalations.urgency, escalations.status, " +
+			"escalations.assigned_auth_user_id, auth_users.name AS assignee_name, users.name AS user_name, users.mobile AS user_mobile, " +
+			"escalations.created_at, escalations.resolved_at, escalations.resolved_by").
+		Joins("JOIN conversations ON conversations.id = escalations.conversation_id").
+		Joins("JOIN sessions ON sessions.id = conversations.session_id").
+		Joins("JOIN users ON users.id = sessions.user_id").
+		Joins("LEFT JOIN auth_users ON auth_users.user_id = escalations.assigned_auth_user_id").
+		Order(fmt.Sprintf("CASE escalations.urgency WHEN '%s' THEN 0 WHEN '%s' THEN 1 ELSE 2 END",
+			models.EscalationUrgencyHigh, models.EscalationUrgencyNormal)).
+		Order("escalations.created_at ASC, escalations.id ASC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&items).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list escalations: %w", err)
+	}
+	return items, total, nil
+}
+
+// Get returns the escalation with the given ID.
+func (s *Service) Get(id uint) (*models.Escalation, error) {
+	var escalation models.Escalation
+	if err := s.db.First(&escalation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEscalationNotFound
+		}
+		return nil, fmt.Errorf("failed to load escalation: %w", err)
+	}
+	return &escalation, nil
+}
+
+// Resolve closes the escalation on behalf of the auth user actorID and clears the conversation's
+// escalated flag. Resolving a resolved escalation changes nothing.
+func (s *Service) Resolve(id uint, actorID uint) (*models.Escalation, error) {
+	escalation, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if escalation.Status == models.EscalationStatusResolved {
+		return escalation, nil
+	}
+
+	now := s.now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(escalation).Updates(map[string]any{
+			"status":      models.EscalationStatusResolved,
+			"resolved_at": now,
+			"resolved_by": actorID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to resolve escalation: %w", err)
+		}
+		return tx.Model(&models.Conversation{}).Where("id = ?", escalation.ConversationID).Update("escalated_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.inbox.Publish(inbox.EventEscalationResolved, escalation.ConversationID, map[string]any{
+		"escalation_id": escalation.ID,
+		"resolved_by":   actorID,
+	})
+	return s.Get(id)
+}
+
+func (s *Service) assign(escalation *models.Escalation) (*authUserConversation.AgentUser, error) {
+	if s.assigner == nil {
+		return nil, nil
+	}
+	agent, err := s.assigner.AssignOn(authUserConversation.TriggerEscalation, escalation.ConversationID)
+	if err != nil || agent == nil {
+		return nil, err
+	}
+	if escalation.AssignedAuthUserID == nil || *escalation.AssignedAuthUserID != agent.UserID {
+		if err := s.db.Model(escalation).Update("assigned_auth_user_id", agent.UserID).Error; err != nil {
+			return agent, fmt.Errorf("failed to record escalation assignee: %w", err)
+		}
+	}
+	return agent, nil
+}
+
+func (s *Service) notify(conv *models.Conversation, escalation *models.Escalation, agent *authUserConversation.AgentUser, lastUserMessage string) {
+	if s.slack == nil {
+		return
+	}
+	assignee := "nobody"
+	if agent != nil {
+		assignee = fmt.Sprintf("user %d", agent.UserID)
+		if agent.Name != nil && *agent.Name != "" {
+			assignee = *agent.Name
+		}
+	}
+	message := fmt.Sprintf("Human agent requested for conversation ID: *%d* | urgency: *%s* | assigned: *%s* | user: *%s* (%s) | reason: %q",
+		conv.ID, escalation.Urgency, assignee, conv.Session.User.Name, conv.Session.User.Mobile, escalation.Reason)
+	if lastUserMessage != "" {
+		message += fmt.Sprintf(" | last message: %q", lastUserMessage)
+	}
+	if s.settings.ClientAppBaseURL != "" {
+		message += fmt.Sprintf(" | %s/conversations/%d", s.settings.ClientAppBaseURL, conv.ID)
+	}
+	s.slack.SendSlackNotificationAsync(message)
+}
@@ -0,0 +1,291 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"smart-chat/internal/models"
+	spec "smart-chat/internal/services/conversation_history/specification"
+	"smart-chat/internal/services/tag"
+
+	"gorm.io/gorm"
+)
+
+// Record is one exported conversation. JSONL exports write it as is; CSV and Parquet exports write
+// its flat form.
+type Record struct {
+	ConversationID uint               `json:"conversation_id"`
+	CreatedAt      time.Time          `json:"created_at"`
+	Source         string             `json:"source"`
+	Mode           string             `json:"mode"`
+	Language       string             `json:"language"`
+	Feedback       bool               `json:"feedback"`
+	TotalTokens    int                `json:"total_tokens"`
+	User           RecordUser         `json:"user"`
+	Messages       []RecordMessage    `json:"messages"`
+	FunctionCalls  []RecordFunction   `json:"function_calls"`
+	Summary        string             `json:"summary"`
+	Tags           []string           `json:"tags"`
+	Tracking       []RecordAssignment `json:"tracking"`
+}
+
+type RecordUser struct {
+	ID     uint   `json:"id"`
+	Name   string `json:"name"`
+	Mobile string `json:"mobile"`
+}
+
+type RecordMessage struct {
+	ID               uint      `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Type             int8      `json:"type"`
+	Visible          bool      `json:"visible"`
+	User             string    `json:"user"`
+	Bot              string    `json:"bot"`
+	AuthorAuthUserID *uint     `json:"author_auth_user_id"`
+}
+
+type RecordFunction struct {
+	ID            uint            `json:"id"`
+	MessagePairID uint            `json:"message_pair_id"`
+	Name          string          `json:"name"`
+	Args          json.RawMessage `json:"args"`
+	Response      string          `json:"response"`
+}
+
+// RecordAssignment is an assigned agent and their tracking fields.
+type RecordAssignment struct {
+	AuthUserID uint       `json:"auth_user_id"`
+	Name       string     `json:"name"`
+	Primary    bool       `json:"primary"`
+	Started    bool       `json:"started"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Comments   string     `json:"comments"`
+}
+
+// flatRecord is a Record as one CSV or Parquet row.
+type flatRecord struct {
+	ConversationID  int64     `parquet:"conversation_id"`
+	CreatedAt       time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Source          string    `parquet:"source"`
+	Mode            string    `parquet:"mode"`
+	Language        string    `parquet:"language"`
+	UserName        string    `parquet:"user_name"`
+	UserMobile      string    `parquet:"user_mobile"`
+	MessageCount    int64     `parquet:"message_count"`
+	Transcript      string    `parquet:"transcript"`
+	FunctionCalls   string    `parquet:"function_calls"`
+	Summary         string    `parquet:"summary"`
+	Tags            string    `parquet:"tags"`
+	Assignees       string    `parquet:"assignees"`
+	PrimaryAssignee string    `parquet:"primary_assignee"`
+	Started         bool      `parquet:"started"`
+	Resolved        bool      `parquet:"resolved"`
+	Comments        string    `parquet:"comments"`
+}
+
+var flatColumns = []string{
+	"conversation_id", "created_at", "source", "mode", "language", "user_name", "user_mobile",
+	"message_count", "transcript", "function_calls", "summary", "tags", "assignees",
+	"primary_assignee", "started", "resolved", "comments",
+}
+
+func (f flatRecord) values() []string {
+	return []string{
+		fmt.Sprint(f.ConversationID), f.CreatedAt.Format(time.RFC3339), f.Source, f.Mode, f.Language,
+		f.UserName, f.UserMobile, fmt.Sprint(f.MessageCount), f.Transcript, f.FunctionCalls, f.Summary,
+		f.Tags, f.Assignees, f.PrimaryAssignee, fmt.Sprint(f.Started), fmt.Sprint(f.Resolved), f.Comments,
+	}
+}
+
+// flat returns the record as a row. The transcript keeps visible messages only, function calls
+// are listed by name, and the tracking fields are the primary assignee's.
+func (r Record) flat() flatRecord {
+	var transcript strings.Builder
+	visible := 0
+	for _, message := range r.Messages {
+		if !message.Visible {
+			continue
+		}
+		visible++
+		if message.User != "" {
+			transcript.WriteString("User: " + message.User + "\n")
+		}
+		if message.Bot != "" {
+			transcript.WriteString("Bot: " + botText(message.Bot) + "\n")
+		}
+	}
+	functions := make([]string, 0, len(r.FunctionCalls))
+	for _, call := range r.FunctionCalls {
+		functions = append(functions, call.Name)
+	}
+	assignees := make([]string, 0, len(r.Tracking))
+	for _, assignment := range r.Tracking {
+		assignees = append(assignees, assignment.Name)
+	}
+
+	row := flatRecord{
+		ConversationID: int64(r.ConversationID),
+		CreatedAt:      r.CreatedAt.UTC(),
+		Source:         r.Source,
+		Mode:           r.Mode,
+		Language:       r.Language,
+		UserName:       r.User.Name,
+		UserMobile:     r.User.Mobile,
+		MessageCount:   int64(visible),
+		Transcript:     strings.TrimSuffix(transcript.String(), "\n"),
+		FunctionCalls:  strings.Join(functions, ","),
+		Summary:        r.Summary,
+		Tags:           strings.Join(r.Tags, ","),
+		Assignees:      strings.Join(assignees, ","),
+	}
+	// Tracking is ordered primary first.
+	if len(r.Tracking) > 0 && r.Tracking[0].Primary {
+		row.PrimaryAssignee = r.Tracking[0].Name
+		row.Started = r.Tracking[0].Started
+		row.Resolved = r.Tracking[0].Resolved
+		row.Comments = r.Tracking[0].Comments
+	}
+	return row
+}
+
+// botText returns the reply text of a stored bot message, which may be the raw JSON response.
+func botText(bot string) string {
+	var parsed struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(bot), &parsed); err != nil || parsed.Content == "" {
+		return bot
+	}
+	return parsed.Content
+}
+
+// nextConversationIDs returns up to limit IDs of the selected conversations after afterID, in
+// ID order.
+func nextConversationIDs(db *gorm.DB, specs []spec.Specification, afterID uint, limit int) ([]uint, error) {
+	query := db.Model(&models.Conversation{})
+	for _, s := range specs {
+		query = s.Apply(query)
+	}
+	var ids []uint
+	err := query.
+		Distinct("conversations.id").
+		Where("conversations.id > ?", afterID).
+		Order("conversations.id ASC").
+		Limit(limit).
+		Pluck("conversations.id", &ids).Error
+	return ids, err
+}
+
+// loadRecords builds the records of the conversations, in ID order.
+func loadRecords(db *gorm.DB, tags *tag.Service, conversationIDs []uint) ([]Record, error) {
+	var conversations []models.Conversation
+	err := db.
+		Preload("Session.User").
+		Preload("MessagePairs", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("FunctionCalls", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Where("id IN ?", conversationIDs).
+		Order("id ASC").
+		Find(&conversations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %w", err)
+	}
+
+	var analyses []models.ConvAnalysis
+	if err := db.Where("conversation_id IN ?", conversationIDs).Order("id ASC").Find(&analyses).Error; err != nil {
+		return nil, fmt.Errorf("failed to load conversation analyses: %w", err)
+	}
+	summaries := make(map[uint]string, len(analyses))
+	for _, analysis := range analyses {
+		// The latest analysis wins.
+		summaries[analysis.ConversationID] = analysis.Summary
+	}
+
+	var links []models.AuthUserConversation
+	err = db.Preload("AuthUser").
+		Where("conversation_id IN ?", conversationIDs).
+		Order("is_primary DESC, created_at ASC, id ASC").
+		Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load assignments: %w", err)
+	}
+	tracking := make(map[uint][]RecordAssignment, len(links))
+	for _, link := range links {
+		name := ""
+		if link.AuthUser.Name != nil {
+			name = *link.AuthUser.Name
+		}
+		tracking[link.ConversationID] = append(tracking[link.ConversationID], RecordAssignment{
+			AuthUserID: link.AuthUserID,
+			Name:       name,
+			Primary:    link.Primary,
+			Started:    link.Started,
+			Resolved:   link.Resolved,
+			ResolvedAt: link.ResolvedAt,
+			Comments:   link.Comments,
+		})
+	}
+
+	tagNames, err := tags.NamesForConversations(conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(conversations))
+	for _, conv := range conversations {
+		record := Record{
+			ConversationID: conv.ID,
+			CreatedAt:      conv.CreatedAt,
+			Source:         conv.Session.Source,
+			Mode:           conv.Mode,
+			Language:       conv.Language,
+			Feedback:       conv.Feedback,
+			TotalTokens:    conv.TotalTokens,
+			User: RecordUser{
+				ID:     conv.Session.User.ID,
+				Name:   conv.Session.User.Name,
+				Mobile: conv.Session.User.Mobile,
+			},
+			Messages:      make([]RecordMessage, 0, len(conv.MessagePairs)),
+			FunctionCalls: make([]RecordFunction, 0, len(conv.FunctionCalls)),
+			Summary:       summaries[conv.ID],
+			Tags:          tagNames[conv.ID],
+			Tracking:      tracking[conv.ID],
+		}
+		if record.Tags == nil {
+			record.Tags = []string{}
+		}
+		if record.Tracking == nil {
+			record.Tracking = []RecordAssignment{}
+		}
+		for _, pair := range conv.MessagePairs {
+			record.Messages = append(record.Messages, RecordMessage{
+				ID:               pair.ID,
+				CreatedAt:        pair.CreatedAt,
+				Type:             int8(pair.Type),
+				Visible:          pair.Visible,
+				User:             pair.User,
+				Bot:              pair.Bot,
+				AuthorAuthUserID: pair.AuthorAuthUserID,
+			})
+		}
+		for _, call := range conv.FunctionCalls {
+			args := json.RawMessage(call.Args)
+			if !json.Valid(args) {
+				args = json.RawMessage("null")
+			}
+			record.FunctionCalls = append(record.FunctionCalls, RecordFunction{
+				ID:            call.ID,
+				MessagePairID: call.MessageID,
+				Name:          call.Name,
+				Args:          args,
+				Response:      call.FunctionResponse,
+			})
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
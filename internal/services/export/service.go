@@ -0,0 +1,481 @@
+// Package export runs bulk exports of conversations to CSV, JSONL or Parquet files in the blob
+// store, and hands out download links that expire.
+package export
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/models"
+	convHistory "smart-chat/internal/services/conversation_history"
+	spec "smart-chat/internal/services/conversation_history/specification"
+	"smart-chat/internal/services/tag"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// batchSize is how many conversations are loaded and written at a time.
+	batchSize = 500
+	// maxPendingPerUser bounds the queued and running exports of one auth user.
+	maxPendingPerUser = 3
+	// staleAfter is how long an export may run before the retention job fails it, as when the
+	// instance running it stopped.
+	staleAfter = 2 * time.Hour
+)
+
+var (
+	ErrInvalidFormat        = errors.New("format must be csv, jsonl or parquet")
+	ErrTooManyConversations = errors.New("too many conversations to export")
+	ErrTooManyPending       = errors.New("too many exports in progress")
+	ErrNotFound             = errors.New("export not found")
+	ErrNotReady             = errors.New("export is not ready for download")
+	ErrInvalidLink          = errors.New("invalid download link")
+	ErrLinkExpired          = errors.New("download link has expired")
+)
+
+// Settings controls exports.
+type Settings struct {
+	// LinkKey signs download links.
+	LinkKey []byte
+	// LinkTTL is how long a download link works.
+	LinkTTL time.Duration
+	// Retention is how long export files are kept.
+	Retention time.Duration
+	// MaxConversations caps the conversations in one export.
+	MaxConversations int64
+	// PollInterval is how often the worker looks for queued exports from other instances.
+	PollInterval time.Duration
+}
+
+// SettingsFromConfig builds Settings from the application config.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	return Settings{
+		LinkKey:          []byte(cfg.ExportLinkKey),
+		LinkTTL:          time.Duration(cfg.ExportLinkMinutes) * time.Minute,
+		Retention:        time.Duration(cfg.ExportRetentionHours) * time.Hour,
+		MaxConversations: cfg.ExportMaxConversations,
+		PollInterval:     time.Duration(cfg.ExportPollSeconds) * time.Second,
+	}
+}
+
+// Job is an export as returned to clients. DownloadURL is a path on this API, set once the export
+// has completed.
+type Job struct {
+	ID                uint            `json:"id"`
+	Format            string          `json:"format"`
+	Status            string          `json:"status"`
+	Filters           json.RawMessage `json:"filters"`
+	ConversationCount int             `json:"conversation_count"`
+	SizeBytes         int64           `json:"size_bytes"`
+	Error             string          `json:"error,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+	CompletedAt       *time.Time      `json:"completed_at"`
+	ExpiresAt         *time.Time      `json:"expires_at"`
+	DownloadURL       string          `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time      `json:"download_expires_at,omitempty"`
+}
+
+// Download is an export file opened for a download link. The caller closes Body.
+type Download struct {
+	Body        io.ReadCloser
+	FileName    string
+	ContentType string
+	SizeBytes   int64
+}
+
+type Service struct {
+	db       *gorm.DB
+	store    blobstore.Store
+	settings Settings
+	tags     *tag.Service
+	wake     chan struct{}
+	running  sync.Mutex
+}
+
+func NewService(db *gorm.DB, store blobstore.Store, settings Settings) *Service {
+	if settings.LinkTTL <= 0 {
+		settings.LinkTTL = time.Hour
+	}
+	if settings.Retention <= 0 {
+		settings.Retention = 72 * time.Hour
+	}
+	if settings.MaxConversations <= 0 {
+		settings.MaxConversations = 50000
+	}
+	if settings.PollInterval <= 0 {
+		settings.PollInterval = 30 * time.Second
+	}
+	return &Service{
+		db:       db,
+		store:    store,
+		settings: settings,
+		tags:     tag.NewService(db, nil),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Create queues an export of the conversations matching filters for the auth user requestedBy.
+// scopeAuthUserID limits it to that agent's conversations; it is nil for callers who may read
+// every conversation. Invalid filters return a *convHistory.FilterError.
+func (s *Service) Create(requestedBy uint, scopeAuthUserID *uint, format string, filters convHistory.Filters) (*Job, error) {
+	if _, ok := extensions[format]; !ok {
+		return nil, ErrInvalidFormat
+	}
+	specs, err := exportSpecs(filters, scopeAuthUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending int64
+	if err := s.db.Model(&models.ExportJob{}).
+		Where("requested_by = ? AND status IN ?", requestedBy, []string{models.ExportStatusQueued, models.ExportStatusRunning}).
+		Count(&pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to count pending exports: %w", err)
+	}
+	if pending >= maxPendingPerUser {
+		return nil, ErrTooManyPending
+	}
+
+	total, err := convHistory.NewConvHistoryService(s.db).CountConversations(specs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count conversations: %w", err)
+	}
+	if total > s.settings.MaxConversations {
+		return nil, fmt.Errorf("%w: %d match, the limit is %d", ErrTooManyConversations, total, s.settings.MaxConversations)
+	}
+
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode export filters: %w", err)
+	}
+	job := models.ExportJob{
+		RequestedBy:     requestedBy,
+		Format:          format,
+		Filters:         encoded,
+		ScopeAuthUserID: scopeAuthUserID,
+		Status:          models.ExportStatusQueued,
+	}
+	if err := s.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.view(job), nil
+}
+
+// Get returns an export of the auth user requestedBy.
+func (s *Service) Get(id, requestedBy uint) (*Job, error) {
+	var job models.ExportJob
+	err := s.db.Where("id = ? AND requested_by = ?", id, requestedBy).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load export: %w", err)
+	}
+	return s.view(job), nil
+}
+
+// List returns the exports of the auth user requestedBy, newest first.
+func (s *Service) List(requestedBy uint, limit int) ([]Job, error) {
+	var jobs []models.ExportJob
+	if err := s.db.Where("requested_by = ?", requestedBy).Order("id DESC").Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+	views := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		views = append(views, *s.view(job))
+	}
+	return views, nil
+}
+
+// Open checks a download link and opens the export file it points to.
+func (s *Service) Open(ctx context.Context, id uint, expires, signature string) (*Download, error) {
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(s.sign(id, expiresUnix))) {
+		return nil, ErrInvalidLink
+	}
+	if time.Now().Unix() > expiresUnix {
+		return nil, ErrLinkExpired
+	}
+
+	var job models.ExportJob
+	err = s.db.First(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load export: %w", err)
+	}
+	if job.Status == models.ExportStatusExpired {
+		return nil, ErrLinkExpired
+	}
+	if job.Status != models.ExportStatusCompleted {
+		return nil, ErrNotReady
+	}
+
+	body, err := s.store.Get(ctx, job.BlobKey)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, ErrLinkExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export file: %w", err)
+	}
+	return &Download{
+		Body:        body,
+		FileName:    fmt.Sprintf("conversations-export-%d.%s", job.ID, extensions[job.Format]),
+		ContentType: contentTypes[job.Format],
+		SizeBytes:   job.SizeBytes,
+	}, nil
+}
+
+// Start runs queued exports until ctx is done: right away when this instance queues one, and
+// every PollInterval for exports queued elsewhere.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.settings.PollInterval)
+		defer ticker.Stop()
+		for {
+			s.RunPending(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunPending runs queued exports one at a time until none are left. Each export is claimed with a
+// conditional update, so instances sharing the database never run the same one.
+func (s *Service) RunPending(ctx context.Context) {
+	if !s.running.TryLock() {
+		return
+	}
+	defer s.running.Unlock()
+
+	for ctx.Err() == nil {
+		job, err := s.claim()
+		if err != nil {
+			log.Printf("Error claiming export job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		s.run(ctx, job)
+	}
+}
+
+// RunRetention deletes expired export files and fails exports left running by a stopped instance.
+func (s *Service) RunRetention() {
+	now := time.Now()
+	var expired []models.ExportJob
+	if err := s.db.Where("status = ? AND expires_at < ?", models.ExportStatusCompleted, now).Find(&expired).Error; err != nil {
+		log.Printf("Error loading expired exports: %v", err)
+		return
+	}
+	for _, job := range expired {
+		if err := s.store.Delete(context.Background(), job.BlobKey); err != nil {
+			log.Printf("Error deleting export file %s: %v", job.BlobKey, err)
+			continue
+		}
+		if err := s.db.Model(&job).Update("status", models.ExportStatusExpired).Error; err != nil {
+			log.Printf("Error expiring export %d: %v", job.ID, err)
+		}
+	}
+
+	result := s.db.Model(&models.ExportJob{}).
+		Where("status = ? AND started_at < ?", models.ExportStatusRunning, now.Add(-staleAfter)).
+		Updates(map[string]any{"status": models.ExportStatusFailed, "error": "export was interrupted", "completed_at": now})
+	if result.Error != nil {
+		log.Printf("Error failing stale exports: %v", result.Error)
+	}
+	log.Printf("Export retention: expired %d exports, failed %d stale exports", len(expired), result.RowsAffected)
+}
+
+// claim marks the oldest queued export as running and returns it, or nil when none is queued.
+func (s *Service) claim() (*models.ExportJob, error) {
+	for {
+		var job models.ExportJob
+		err := s.db.Where("status = ?", models.ExportStatusQueued).Order("id ASC").First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		result := s.db.Model(&models.ExportJob{}).
+			Where("id = ? AND status = ?", job.ID, models.ExportStatusQueued).
+			Updates(map[string]any{"status": models.ExportStatusRunning, "started_at": now})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			job.Status = models.ExportStatusRunning
+			job.StartedAt = &now
+			return &job, nil
+		}
+		// Another instance claimed it first.
+	}
+}
+
+// run writes the export file and records the outcome on the job.
+func (s *Service) run(ctx context.Context, job *models.ExportJob) {
+	count, size, key, err := s.write(ctx, job)
+	now := time.Now()
+	if err != nil {
+		log.Printf("Export %d failed: %v", job.ID, err)
+		if updateErr := s.db.Model(job).Updates(map[string]any{
+			"status":       models.ExportStatusFailed,
+			"error":        err.Error(),
+			"completed_at": now,
+		}).Error; updateErr != nil {
+			log.Printf("Error recording failure of export %d: %v", job.ID, updateErr)
+		}
+		return
+	}
+
+	expiresAt := now.Add(s.settings.Retention)
+	if err := s.db.Model(job).Updates(map[string]any{
+		"status":             models.ExportStatusCompleted,
+		"conversation_count": count,
+		"size_bytes":         size,
+		"blob_key":           key,
+		"completed_at":       now,
+		"expires_at":         expiresAt,
+	}).Error; err != nil {
+		log.Printf("Error recording completion of export %d: %v", job.ID, err)
+	}
+}
+
+// write streams the selected conversations to a temporary file in batches, then stores it.
+func (s *Service) write(ctx context.Context, job *models.ExportJob) (int, int64, string, error) {
+	var filters convHistory.Filters
+	if err := json.Unmarshal(job.Filters, &filters); err != nil {
+		return 0, 0, "", fmt.Errorf("invalid export filters: %w", err)
+	}
+	specs, err := exportSpecs(filters, job.ScopeAuthUserID)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	file, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := newRecordWriter(job.Format, file)
+	count := 0
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, "", err
+		}
+		ids, err := nextConversationIDs(s.db, specs, lastID, batchSize)
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("failed to select conversations: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+		records, err := loadRecords(s.db, s.tags, ids)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		if err := writer.Write(records); err != nil {
+			return 0, 0, "", fmt.Errorf("failed to write export: %w", err)
+		}
+		count += len(records)
+		lastID = ids[len(ids)-1]
+		if int64(count) > s.settings.MaxConversations {
+			return 0, 0, "", fmt.Errorf("%w: the limit is %d", ErrTooManyConversations, s.settings.MaxConversations)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return 0, 0, "", fmt.Errorf("failed to write export: %w", err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to measure export file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, "", fmt.Errorf("failed to rewind export file: %w", err)
+	}
+	key := fmt.Sprintf("exports/%d.%s", job.ID, extensions[job.Format])
+	if err := s.store.Put(ctx, key, file, contentTypes[job.Format]); err != nil {
+		return 0, 0, "", err
+	}
+	return count, size, key, nil
+}
+
+// view returns the job as shown to clients, with a fresh download link when it has completed.
+func (s *Service) view(job models.ExportJob) *Job {
+	filters := json.RawMessage(job.Filters)
+	if len(filters) == 0 {
+		filters = json.RawMessage("{}")
+	}
+	view := &Job{
+		ID:                job.ID,
+		Format:            job.Format,
+		Status:            job.Status,
+		Filters:           filters,
+		ConversationCount: job.ConversationCount,
+		SizeBytes:         job.SizeBytes,
+		Error:             job.Error,
+		CreatedAt:         job.CreatedAt,
+		CompletedAt:       job.CompletedAt,
+		ExpiresAt:         job.ExpiresAt,
+	}
+	if job.Status == models.ExportStatusCompleted && job.ExpiresAt != nil {
+		expiresAt := time.Now().Add(s.settings.LinkTTL).Truncate(time.Second)
+		if job.ExpiresAt.Before(expiresAt) {
+			expiresAt = job.ExpiresAt.Truncate(time.Second)
+		}
+		view.DownloadURL = fmt.Sprintf("/v2/client/exports/%d/download?expires=%d&signature=%s",
+			job.ID, expiresAt.Unix(), s.sign(job.ID, expiresAt.Unix()))
+		view.DownloadExpiresAt = &expiresAt
+	}
+	return view
+}
+
+// sign returns the download link signature of an export for an expiry time.
+func (s *Service) sign(id uint, expiresUnix int64) string {
+	mac := hmac.New(sha256.New, s.settings.LinkKey)
+	fmt.Fprintf(mac, "export:%d:%d", id, expiresUnix)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// exportSpecs returns the specifications selecting an export's conversations.
+func exportSpecs(filters convHistory.Filters, scopeAuthUserID *uint) ([]spec.Specification, error) {
+	specs, err := filters.Specifications()
+	if err != nil {
+		return nil, err
+	}
+	if scopeAuthUserID != nil {
+		specs = append(specs, spec.ByAssignedAuthUser{AuthUserID: *scopeAuthUserID})
+	}
+	return specs, nil
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"smart-chat/internal/models"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// contentTypes and extensions are keyed by export format.
+var (
+	contentTypes = map[string]string{
+		models.ExportFormatCSV:     "text/csv",
+		models.ExportFormatJSONL:   "application/x-ndjson",
+		models.ExportFormatParquet: "application/vnd.apache.parquet",
+	}
+	extensions = map[string]string{
+		models.ExportFormatCSV:     "csv",
+		models.ExportFormatJSONL:   "jsonl",
+		models.ExportFormatParquet: "parquet",
+	}
+)
+
+// recordWriter writes records in one export format. Close flushes what is buffered but does not
+// close the underlying writer.
+type recordWriter interface {
+	Write(records []Record) error
+	Close() error
+}
+
+func newRecordWriter(format string, w io.Writer) recordWriter {
+	switch format {
+	case models.ExportFormatJSONL:
+		return jsonlWriter{json.NewEncoder(w)}
+	case models.ExportFormatParquet:
+		return parquetWriter{parquet.NewGenericWriter[flatRecord](w, parquet.Compression(&parquet.Zstd))}
+	default:
+		return &csvWriter{w: csv.NewWriter(w)}
+	}
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvWriter) Write(records []Record) error {
+	if !c.headerWritten {
+		if err := c.w.Write(flatColumns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+	for _, record := range records {
+		if err := c.w.Write(csvSafe(record.flat().values())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	if !c.headerWritten {
+		if err := c.w.Write(flatColumns); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvSafe prefixes cells a spreadsheet would run as a formula with a quote, so user-supplied
+// names and messages open as text.
+func csvSafe(values []string) []string {
+	for i, value := range values {
+		if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+			values[i] = "'" + value
+		}
+	}
+	return values
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j jsonlWriter) Write(records []Record) error {
+	for _, record := range records {
+		if err := j.encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (jsonlWriter) Close() error {
+	return nil
+}
+
+// parquetWriter writes one row group per batch of records.
+type parquetWriter struct {
+	w *parquet.GenericWriter[flatRecord]
+}
+
+func (p parquetWriter) Write(records []Record) error {
+	rows := make([]flatRecord, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, record.flat())
+	}
+	if _, err := p.w.Write(rows); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (p parquetWriter) Close() error {
+	return p.w.Close()
+}
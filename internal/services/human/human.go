@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/inbox"
 
 	"gorm.io/gorm"
 )
@@ -11,18 +13,25 @@ import (
 // HumanService is responsible for adding agent messages (as if by a human)
 // to a conversation. It works directly with the database.
 type HumanService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	inbox *inbox.Publisher
 }
 
 // NewHumanService returns a new instance of HumanService.
 func NewHumanService(db *gorm.DB) *HumanService {
-	return &HumanService{db: db}
+	return &HumanService{db: db, inbox: inbox.NewPublisher(db)}
 }
 
-// AddMessage finds the conversation by ID and adds a new MessagePair
-// with Type set to MessageTypeAgentAssumedAssistant and User left empty.
+// AddMessage finds the conversation by ID and adds a new MessagePair written by the agent
+// authorAuthUserID, with Type set to MessageTypeAgentAssumedAssistant and User left empty.
 // It stores the message in JSON format: {"content": "your message"}
-func (hs *HumanService) AddMessage(conversationID uint, message string) error {
+func (hs *HumanService) AddMessage(conversationID, authorAuthUserID uint, message string) error {
+	return hs.AddMessageWithAttachments(conversationID, authorAuthUserID, message, nil)
+}
+
+// AddMessageWithAttachments is AddMessage for a message that carries attachments the agent
+// uploaded to the conversation beforehand. The message and links are stored atomically.
+func (hs *HumanService) AddMessageWithAttachments(conversationID, authorAuthUserID uint, message string, attachmentIDs []uint) error {
 	// 1. Ensure the conversation exists.
 	var conv models.Conversation
 	if err := hs.db.First(&conv, conversationID).Error; err != nil {
@@ -42,11 +51,22 @@ func (hs *HumanService) AddMessage(conversationID uint, message string) error {
 		Type:           models.MessageTypeAgentAssumedAssistant,
 		TotalTokens:    0, // Adjust if necessary.
 	}
+	if authorAuthUserID != 0 {
+		msgPair.AuthorAuthUserID = &authorAuthUserID
+	}
 
-	// 4. Insert the message pair record.
-	if err := hs.db.Create(&msgPair).Error; err != nil {
-		return fmt.Errorf("failed to add message: %w", err)
+	// 4. Insert the message pair record and link its attachments.
+	err := hs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msgPair).Error; err != nil {
+			return fmt.Errorf("failed to add message: %w", err)
+		}
+		return attachment.LinkToMessage(tx, conversationID, msgPair.ID, attachmentIDs)
+	})
+	if err != nil {
+		return err
 	}
 
+	// 5. Push the message to the other agents watching the inbox.
+	hs.inbox.Publish(inbox.EventMessageCreated, conversationID, inbox.MessageData(&msgPair))
 	return nil
 }
@@ -0,0 +1,328 @@
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// batchSize bounds each read of new events and each DELETE of the retention job.
+	batchSize = 500
+	// bufferSize is how many events a subscriber may fall behind before it is dropped.
+	bufferSize = 256
+	// gapWait is how long dispatch waits for a missing event ID to commit before skipping it.
+	// IDs are allocated before commit, so a later ID can become visible first.
+	gapWait = 5 * time.Second
+)
+
+// HubSettings controls event dispatch.
+type HubSettings struct {
+	// PollInterval is how often the hub checks for new events when it is not notified.
+	PollInterval time.Duration
+	// Retention is how long events are kept for clients resuming from a cursor.
+	Retention time.Duration
+}
+
+// HubSettingsFromConfig builds HubSettings from the application config.
+func HubSettingsFromConfig(cfg *config.Config) HubSettings {
+	return HubSettings{
+		PollInterval: time.Duration(cfg.InboxPollSeconds) * time.Second,
+		Retention:    time.Duration(cfg.InboxRetentionHours) * time.Hour,
+	}
+}
+
+// Event is an inbox event as pushed to clients.
+type Event struct {
+	ID             uint            `json:"id"`
+	Type           string          `json:"type"`
+	ConversationID uint            `json:"conversation_id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// Viewer is who an event stream is for. All viewers see every event; others only see events of
+// conversations assigned to them and events naming them in the audience.
+type Viewer struct {
+	AuthUserID uint
+	All        bool
+}
+
+// Subscription receives live events for a viewer. Events is closed when the subscriber falls too
+// far behind or the hub stops; the client should reconnect from the last event it received.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	viewer Viewer
+}
+
+// Hub pushes inbox events recorded by any server instance to the subscribers on this one.
+type Hub struct {
+	db       *gorm.DB
+	settings HubSettings
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+
+	// lastID and gapSince are only used by the dispatch loop.
+	lastID   uint
+	gapSince time.Time
+}
+
+func NewHub(db *gorm.DB, settings HubSettings) *Hub {
+	if settings.PollInterval <= 0 {
+		settings.PollInterval = 2 * time.Second
+	}
+	if settings.Retention <= 0 {
+		settings.Retention = 24 * time.Hour
+	}
+	return &Hub{db: db, settings: settings, subscribers: make(map[*Subscription]struct{})}
+}
+
+// Start dispatches events recorded from now on until ctx is done. On Postgres the hub listens for
+// announced events and polls as a fallback; elsewhere it only polls.
+func (h *Hub) Start(ctx context.Context) error {
+	if err := h.db.Model(&models.InboxEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&h.lastID).Error; err != nil {
+		return fmt.Errorf("failed to load the latest inbox event: %w", err)
+	}
+	wake := make(chan struct{}, 1)
+	if h.db.Dialector.Name() == "postgres" {
+		go h.listen(ctx, wake)
+	}
+	go h.run(ctx, wake)
+	return nil
+}
+
+// Subscribe returns a subscription to live events the viewer may see.
+func (h *Hub) Subscribe(viewer Viewer) *Subscription {
+	events := make(chan Event, bufferSize)
+	sub := &Subscription{Events: events, events: events, viewer: viewer}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe stops the subscription. It is safe to call more than once.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(sub)
+}
+
+// Replay returns up to limit events after the cursor that the viewer may see, oldest first.
+// truncated reports that the client cannot catch up from the cursor, because more events are
+// waiting or the cursor's events have been pruned, and should reload its conversations instead.
+func (h *Hub) Replay(viewer Viewer, after uint, limit int) ([]Event, bool, error) {
+	var oldest uint
+	if err := h.db.Model(&models.InboxEvent{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to load the oldest inbox event: %w", err)
+	}
+	if after > 0 && oldest > after+1 {
+		return nil, true, nil
+	}
+
+	var assigned map[uint]bool
+	if !viewer.All {
+		var conversationIDs []uint
+		if err := h.db.Model(&models.AuthUserConversation{}).
+			Where("auth_user_id = ?", viewer.AuthUserID).
+			Pluck("conversation_id", &conversationIDs).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to load assigned conversations: %w", err)
+		}
+		assigned = make(map[uint]bool, len(conversationIDs))
+		for _, id := range conversationIDs {
+			assigned[id] = true
+		}
+	}
+
+	events := make([]Event, 0)
+	for {
+		var rows []models.InboxEvent
+		if err := h.db.Where("id > ?", after).Order("id ASC").Limit(batchSize).Find(&rows).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to load inbox events: %w", err)
+		}
+		for _, row := range rows {
+			after = row.ID
+			if !viewer.All && !assigned[row.ConversationID] && !inAudience(row, viewer.AuthUserID) {
+				continue
+			}
+			if len(events) == limit {
+				return events, true, nil
+			}
+			events = append(events, toEvent(row))
+		}
+		if len(rows) < batchSize {
+			return events, false, nil
+		}
+	}
+}
+
+// Prune deletes events older than the retention period, in batches, and returns how many were deleted.
+func (h *Hub) Prune(now time.Time) (int64, error) {
+	cutoff := now.Add(-h.settings.Retention)
+	var deleted int64
+	for {
+		batch := h.db.Where("id IN (?)",
+			h.db.Model(&models.InboxEvent{}).Select("id").Where("created_at < ?", cutoff).Limit(batchSize),
+		).Delete(&models.InboxEvent{})
+		if batch.Error != nil {
+			return deleted, batch.Error
+		}
+		deleted += batch.RowsAffected
+		if batch.RowsAffected < batchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// RunRetention is the cron entry point for Prune.
+func (h *Hub) RunRetention() {
+	deleted, err := h.Prune(time.Now())
+	if err != nil {
+		log.Printf("Inbox retention run failed: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Inbox retention run: deleted=%d", deleted)
+	}
+}
+
+func (h *Hub) run(ctx context.Context, wake <-chan struct{}) {
+	ticker := time.NewTicker(h.settings.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.mu.Lock()
+			for sub := range h.subscribers {
+				h.drop(sub)
+			}
+			h.mu.Unlock()
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+		if err := h.dispatch(time.Now()); err != nil {
+			log.Printf("Failed to dispatch inbox events: %v", err)
+		}
+	}
+}
+
+// dispatch pushes events recorded since the last run to the subscribers that may see them.
+func (h *Hub) dispatch(now time.Time) error {
+	for {
+		var rows []models.InboxEvent
+		if err := h.db.Where("id > ?", h.lastID).Order("id ASC").Limit(batchSize).Find(&rows).Error; err != nil {
+			return err
+		}
+		assignees := make(map[uint]map[uint]bool)
+		for _, row := range rows {
+			if row.ID != h.lastID+1 {
+				if h.gapSince.IsZero() {
+					h.gapSince = now
+				}
+				if now.Sub(h.gapSince) < gapWait {
+					return nil
+				}
+			}
+			h.gapSince = time.Time{}
+			h.lastID = row.ID
+
+			assigned, ok := assignees[row.ConversationID]
+			if !ok {
+				var err error
+				if assigned, err = h.assigned(row.ConversationID); err != nil {
+					return err
+				}
+				assignees[row.ConversationID] = assigned
+			}
+			h.deliver(row, assigned)
+		}
+		if len(rows) < batchSize {
+			return nil
+		}
+	}
+}
+
+func (h *Hub) assigned(conversationID uint) (map[uint]bool, error) {
+	var authUserIDs []uint
+	if err := h.db.Model(&models.AuthUserConversation{}).
+		Where("conversation_id = ?", conversationID).
+		Pluck("auth_user_id", &authUserIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load conversation assignees: %w", err)
+	}
+	assigned := make(map[uint]bool, len(authUserIDs))
+	for _, id := range authUserIDs {
+		assigned[id] = true
+	}
+	return assigned, nil
+}
+
+func (h *Hub) deliver(row models.InboxEvent, assigned map[uint]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subscribers) == 0 {
+		return
+	}
+	event := toEvent(row)
+	for sub := range h.subscribers {
+		viewer := sub.viewer
+		if !viewer.All && !assigned[viewer.AuthUserID] && !inAudience(row, viewer.AuthUserID) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.drop(sub)
+		}
+	}
+}
+
+// drop removes the subscription and closes its channel. h.mu must be held.
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.events)
+}
+
+func inAudience(row models.InboxEvent, authUserID uint) bool {
+	if len(row.Audience) == 0 {
+		return false
+	}
+	var audience []uint
+	if err := json.Unmarshal(row.Audience, &audience); err != nil {
+		log.Printf("Invalid audience on inbox event %d: %v", row.ID, err)
+		return false
+	}
+	for _, id := range audience {
+		if id == authUserID {
+			return true
+		}
+	}
+	return false
+}
+
+func toEvent(row models.InboxEvent) Event {
+	data := json.RawMessage(row.Payload)
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	return Event{
+		ID:             row.ID,
+		Type:           row.Type,
+		ConversationID: row.ConversationID,
+		CreatedAt:      row.CreatedAt,
+		Data:           data,
+	}
+}
@@ -0,0 +1,79 @@
+package inbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const maxListenBackoff = 30 * time.Second
+
+// listen wakes the dispatch loop whenever an event is announced on Postgres, reconnecting with
+// backoff when the listening connection fails. Events announced while reconnecting are picked up
+// by the poll.
+func (h *Hub) listen(ctx context.Context, wake chan<- struct{}) {
+	backoff := time.Second
+	for {
+		listening, err := h.listenOnce(ctx, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		if listening {
+			backoff = time.Second
+		}
+		log.Printf("Inbox listener stopped, reconnecting in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxListenBackoff)
+	}
+}
+
+// listenOnce holds a pooled connection for LISTEN until it fails or ctx is done, and reports
+// whether it got as far as listening.
+func (h *Hub) listenOnce(ctx context.Context, wake chan<- struct{}) (bool, error) {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	listening := false
+	err = conn.Raw(func(driverConn any) error {
+		pgxConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		if _, err := pgxConn.Conn().Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return fmt.Errorf("%w: %v", driver.ErrBadConn, err)
+		}
+		listening = true
+		// Catch up on events recorded while no connection was listening.
+		signal(wake)
+		for {
+			if _, err := pgxConn.Conn().WaitForNotification(ctx); err != nil {
+				// The connection is still subscribed; discard it rather than return it to the pool.
+				return fmt.Errorf("%w: %v", driver.ErrBadConn, err)
+			}
+			signal(wake)
+		}
+	})
+	return listening, err
+}
+
+func signal(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,84 @@
+package inbox
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"smart-chat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Event types pushed to the client inbox.
+const (
+	EventConversationCreated = "conversation.created"
+	EventMessageCreated      = "message.created"
+	EventAssignmentChanged   = "assignment.changed"
+	EventTrackingUpdated     = "tracking.updated"
+	EventEscalationOpened    = "escalation.opened"
+	EventEscalationResolved  = "escalation.resolved"
+	EventNoteCreated         = "note.created"
+	EventNoteUpdated         = "note.updated"
+	EventNoteDeleted         = "note.deleted"
+)
+
+// notifyChannel is the Postgres channel new event IDs are announced on, so every server instance
+// dispatches them without waiting for its next poll.
+const notifyChannel = "inbox_events"
+
+// Publisher records inbox events for the hubs of all server instances to push.
+type Publisher struct {
+	db *gorm.DB
+}
+
+func NewPublisher(db *gorm.DB) *Publisher {
+	return &Publisher{db: db}
+}
+
+// Publish records an event about the conversation. data is encoded as the event's JSON payload.
+// The event is shown to everyone who may see all conversations, the conversation's assignees and
+// the auth users in audience. It runs after the change it reports has been made, so a failure is
+// logged rather than returned.
+func (p *Publisher) Publish(eventType string, conversationID uint, data any, audience ...uint) {
+	if p == nil {
+		return
+	}
+	event := models.InboxEvent{Type: eventType, ConversationID: conversationID}
+	if data != nil {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("Failed to encode inbox event %s for conversation %d: %v", eventType, conversationID, err)
+			return
+		}
+		event.Payload = payload
+	}
+	if len(audience) > 0 {
+		encoded, err := json.Marshal(audience)
+		if err != nil {
+			log.Printf("Failed to encode inbox event audience for conversation %d: %v", conversationID, err)
+			return
+		}
+		event.Audience = encoded
+	}
+
+	if err := p.db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record inbox event %s for conversation %d: %v", eventType, conversationID, err)
+		return
+	}
+	if p.db.Dialector.Name() != "postgres" {
+		return
+	}
+	if err := p.db.Exec("SELECT pg_notify(?, ?)", notifyChannel, strconv.FormatUint(uint64(event.ID), 10)).Error; err != nil {
+		log.Printf("Failed to announce inbox event %d: %v", event.ID, err)
+	}
+}
+
+// MessageData is the payload of a message.created event.
+func MessageData(pair *models.MessagePair) map[string]any {
+	return map[string]any{
+		"message_pair_id":     pair.ID,
+		"type":                pair.Type,
+		"author_auth_user_id": pair.AuthorAuthUserID,
+	}
+}
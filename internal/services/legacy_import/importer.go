@@ -0,0 +1,178 @@
+package legacy_import
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"smart-chat/internal/constants"
+	"smart-chat/internal/models"
+	"smart-chat/internal/otp"
+	"smart-chat/internal/store"
+	"smart-chat/internal/tokenhash"
+
+	"gorm.io/gorm"
+)
+
+// Source is where legacy v1 conversations are read from. store.Memcache reads them from memcache.
+type Source interface {
+	FetchAllConversations() ([]store.Conversation, error)
+	DeleteConversation(accessToken string) error
+}
+
+// Result summarises an import run.
+type Result struct {
+	Imported int
+	Skipped  int
+	Messages int
+	Failed   int
+	Deleted  int
+}
+
+// Importer copies v1 conversations into the users, sessions, conversations and message_pairs tables.
+// Each v1 access token becomes the session's auth token (stored hashed), so an imported conversation
+// can still be continued with the token the client holds. Running it again skips conversations already imported.
+type Importer struct {
+	db     *gorm.DB
+	source Source
+	tokens *tokenhash.Hasher
+}
+
+func NewImporter(db *gorm.DB, source Source) *Importer {
+	return &Importer{db: db, source: source, tokens: tokenhash.Default()}
+}
+
+// Import copies every conversation in the source. With deleteImported, conversations are removed from
+// the source once they are in the database.
+func (i *Importer) Import(deleteImported bool) (Result, error) {
+	var result Result
+
+	conversations, err := i.source.FetchAllConversations()
+	if err != nil {
+		return result, fmt.Errorf("failed to fetch v1 conversations: %w", err)
+	}
+
+	for _, legacy := range conversations {
+		if legacy.AccessToken == "" {
+			result.Failed++
+			continue
+		}
+
+		imported, err := i.importConversation(legacy)
+		if err != nil {
+			log.Printf("Failed to import v1 conversation for %s: %v", legacy.UserMobile, err)
+			result.Failed++
+			continue
+		}
+		if imported {
+			result.Imported++
+			result.Messages += len(legacy.Messages)
+		} else {
+			result.Skipped++
+		}
+
+		if deleteImported {
+			if err := i.source.DeleteConversation(legacy.AccessToken); err != nil {
+				log.Printf("Imported v1 conversation for %s but failed to delete it: %v", legacy.UserMobile, err)
+				continue
+			}
+			result.Deleted++
+		}
+	}
+
+	return result, nil
+}
+
+// importConversation returns false when a session with the conversation's access token already exists.
+func (i *Importer) importConversation(legacy store.Conversation) (bool, error) {
+	imported := false
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := i.tokens.Where(tx, "auth_token", legacy.AccessToken).Model(&models.Session{}).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return nil
+		}
+
+		user, err := findOrCreateUser(tx, legacy)
+		if err != nil {
+			return err
+		}
+
+		session := models.Session{
+			UserID:    user.ID,
+			AuthToken: i.tokens.Hash(legacy.AccessToken),
+			ExpireAt:  legacy.AccessTokenExpireTime,
+			Source:    constants.WebsiteSource,
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		conversation := models.Conversation{
+			SessionID:   session.ID,
+			TotalTokens: legacy.TotalTokens,
+		}
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+
+		for _, message := range legacy.Messages {
+			pair := models.MessagePair{
+				ConversationID: conversation.ID,
+				User:           message.UserMessage,
+				Bot:            fmt.Sprintf("{\"content\":%q}", message.BotMessage),
+				Visible:        true,
+				Type:           models.MessageTypeUserSent,
+			}
+			if err := tx.Create(&pair).Error; err != nil {
+				return err
+			}
+		}
+
+		imported = true
+		return nil
+	})
+	return imported, err
+}
+
+// findOrCreateUser keys users by the E.164 mobile, as OTP and WhatsApp logins do, so imported
+// history belongs to the user those logins return. A user saved under another spelling of the
+// number is moved to the E.164 form rather than duplicated. A mobile that does not parse is
+// looked up and stored as it is.
+func findOrCreateUser(tx *gorm.DB, legacy store.Conversation) (models.User, error) {
+	recipient, err := otp.ParseMobile(legacy.UserMobile)
+	if err != nil {
+		log.Printf("Importing v1 conversation for %s under its unparsed mobile: %v", otp.MaskMobile(legacy.UserMobile), err)
+		recipient = otp.Recipient{E164: legacy.UserMobile}
+	}
+
+	var user models.User
+	err = tx.Where("mobile = ?", recipient.E164).First(&user).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	if recipient.Digits != "" {
+		forms := []string{legacy.UserMobile, recipient.Digits}
+		if recipient.National != "" {
+			forms = append(forms, recipient.National)
+		}
+		err = tx.Where("mobile IN ?", forms).Order("id").First(&user).Error
+		if err == nil {
+			return user, tx.Model(&user).Update("mobile", recipient.E164).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, err
+		}
+	}
+
+	user = models.User{
+		Name:           legacy.UserName,
+		Mobile:         recipient.E164,
+		AccessExpireAt: time.Now(),
+	}
+	return user, tx.Create(&user).Error
+}
@@ -0,0 +1,495 @@
+package note
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/services/inbox"
+
+	"gorm.io/gorm"
+)
+
+// MaxBodyLength is the longest note body, in characters.
+const MaxBodyLength = 4000
+
+var (
+	ErrInvalidBody    = errors.New("body must be 1 to 4000 characters")
+	ErrNoteNotFound   = errors.New("note not found")
+	ErrInvalidParent  = errors.New("replies must be to a top-level note of the same conversation")
+	ErrNotAuthor      = errors.New("only the author can edit a note")
+	ErrCannotDelete   = errors.New("only the author or an admin can delete a note")
+	ErrPinReply       = errors.New("only top-level notes can be pinned")
+	ErrInvalidMention = errors.New("mentioned users must be active auth users who can see the conversation")
+)
+
+// mentionPattern matches an @ followed by an auth user's email, as in "@priya@example.com".
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+
+// Author is an auth user as shown on notes.
+type Author struct {
+	ID   uint    `json:"id"`
+	Name *string `json:"name"`
+}
+
+// Note is a note as returned by the client API. Top-level notes list their replies, oldest first.
+type Note struct {
+	ID             uint       `json:"id"`
+	ConversationID uint       `json:"conversation_id"`
+	ParentID       *uint      `json:"parent_id"`
+	Author         Author     `json:"author"`
+	Body           string     `json:"body"`
+	Mentions       []Author   `json:"mentions"`
+	Pinned         bool       `json:"pinned"`
+	PinnedAt       *time.Time `json:"pinned_at"`
+	PinnedBy       *uint      `json:"pinned_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at"`
+	Replies        []Note     `json:"replies,omitempty"`
+}
+
+// Revision is an earlier body of a note and who replaced it.
+type Revision struct {
+	Body     string    `json:"body"`
+	EditedBy Author    `json:"edited_by"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// Service manages the internal notes on conversations.
+type Service struct {
+	db    *gorm.DB
+	inbox *inbox.Publisher
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, inbox: inbox.NewPublisher(db)}
+}
+
+// Mentions returns the lower-cased emails @mentioned in body, in order and without repeats.
+func Mentions(body string) []string {
+	seen := make(map[string]bool)
+	emails := make([]string, 0)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(match[1])
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+// ForConversation returns the conversation's note threads: pinned notes first, most recently
+// pinned first, then the others oldest first.
+func (s *Service) ForConversation(conversationID uint) ([]Note, error) {
+	var rows []models.ConversationNote
+	err := s.db.Preload("Author").
+		Where("conversation_id = ?", conversationID).
+		Order("created_at ASC, id ASC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notes: %w", err)
+	}
+	notes, err := s.threads(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Pinned != notes[j].Pinned {
+			return notes[i].Pinned
+		}
+		if notes[i].Pinned {
+			return notes[i].PinnedAt.After(*notes[j].PinnedAt)
+		}
+		return false
+	})
+	return notes, nil
+}
+
+// Get returns one note of the conversation with its replies.
+func (s *Service) Get(conversationID, noteID uint) (*Note, error) {
+	row, err := s.load(conversationID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	rows := []models.ConversationNote{*row}
+	if row.ParentID == nil {
+		var replies []models.ConversationNote
+		if err := s.db.Preload("Author").Where("parent_id = ?", row.ID).Order("created_at ASC, id ASC").Find(&replies).Error; err != nil {
+			return nil, fmt.Errorf("failed to load replies: %w", err)
+		}
+		rows = append(rows, replies...)
+	}
+	// The note comes first, with any replies nested under it.
+	notes, err := s.threads(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &notes[0], nil
+}
+
+// Create adds a note by the auth user authorID, as a reply when parentID is set. Mentioned users
+// are notified through the inbox.
+func (s *Service) Create(conversationID, authorID uint, parentID *uint, body string) (*Note, error) {
+	body, err := normalizeBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		parent, err := s.load(conversationID, *parentID)
+		if errors.Is(err, ErrNoteNotFound) || (err == nil && parent.ParentID != nil) {
+			return nil, ErrInvalidParent
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	mentioned, err := s.resolveMentions(conversationID, authorID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	row := models.ConversationNote{
+		ConversationID:   conversationID,
+		ParentID:         parentID,
+		AuthorAuthUserID: authorID,
+		Body:             body,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&row).Error; err != nil {
+			return fmt.Errorf("failed to create note: %w", err)
+		}
+		return addMentions(tx, row.ID, mentioned)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(inbox.EventNoteCreated, &row, mentioned)
+	return s.Get(conversationID, row.ID)
+}
+
+// Update replaces the body of a note by its author, keeping the old body as a revision. Users
+// mentioned for the first time are notified. It also returns the old body.
+func (s *Service) Update(conversationID, noteID, editorID uint, body string) (*Note, string, error) {
+	row, err := s.load(conversationID, noteID)
+	if err != nil {
+		return nil, "", err
+	}
+	if row.AuthorAuthUserID != editorID {
+		return nil, "", ErrNotAuthor
+	}
+	body, err = normalizeBody(body)
+	if err != nil {
+		return nil, "", err
+	}
+	previous := row.Body
+	if body == previous {
+		note, err := s.Get(conversationID, noteID)
+		return note, previous, err
+	}
+	mentioned, err := s.resolveMentions(conversationID, editorID, body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var existing []uint
+	if err := s.db.Model(&models.ConversationNoteMention{}).Where("note_id = ?", row.ID).Pluck("auth_user_id", &existing).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to load mentions: %w", err)
+	}
+	already := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		already[id] = true
+	}
+	added := make([]uint, 0, len(mentioned))
+	for _, id := range mentioned {
+		if !already[id] {
+			added = append(added, id)
+		}
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		revision := models.ConversationNoteRevision{NoteID: row.ID, Body: previous, EditedBy: editorID}
+		if err := tx.Create(&revision).Error; err != nil {
+			return fmt.Errorf("failed to save note revision: %w", err)
+		}
+		if err := tx.Model(row).Updates(map[string]any{"body": body, "edited_at": now}).Error; err != nil {
+			return fmt.Errorf("failed to update note: %w", err)
+		}
+		removed := tx.Where("note_id = ?", row.ID)
+		if len(mentioned) > 0 {
+			removed = removed.Where("auth_user_id NOT IN ?", mentioned)
+		}
+		if err := removed.Delete(&models.ConversationNoteMention{}).Error; err != nil {
+			return fmt.Errorf("failed to update mentions: %w", err)
+		}
+		return addMentions(tx, row.ID, added)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.publish(inbox.EventNoteUpdated, row, added)
+	note, err := s.Get(conversationID, noteID)
+	return note, previous, err
+}
+
+// SetPinned pins or unpins a top-level note on behalf of the auth user actorID.
+func (s *Service) SetPinned(conversationID, noteID, actorID uint, pinned bool) (*Note, error) {
+	row, err := s.load(conversationID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if row.ParentID != nil {
+		return nil, ErrPinReply
+	}
+	if (row.PinnedAt != nil) != pinned {
+		updates := map[string]any{"pinned_at": nil, "pinned_by": nil}
+		if pinned {
+			updates = map[string]any{"pinned_at": time.Now(), "pinned_by": actorID}
+		}
+		if err := s.db.Model(row).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to pin note: %w", err)
+		}
+		s.publish(inbox.EventNoteUpdated, row, nil)
+	}
+	return s.Get(conversationID, noteID)
+}
+
+// Delete deletes a note and, for a top-level note, its replies. Only the author may delete a note
+// unless deleteAny is set. It returns the deleted note.
+func (s *Service) Delete(conversationID, noteID, actorID uint, deleteAny bool) (*models.ConversationNote, error) {
+	row, err := s.load(conversationID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if row.AuthorAuthUserID != actorID && !deleteAny {
+		return nil, ErrCannotDelete
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parent_id = ?", row.ID).Delete(&models.ConversationNote{}).Error; err != nil {
+			return fmt.Errorf("failed to delete replies: %w", err)
+		}
+		if err := tx.Delete(row).Error; err != nil {
+			return fmt.Errorf("failed to delete note: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(inbox.EventNoteDeleted, row, nil)
+	return row, nil
+}
+
+// History returns the earlier bodies of a note, oldest first.
+func (s *Service) History(conversationID, noteID uint) ([]Revision, error) {
+	if _, err := s.load(conversationID, noteID); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Body      string
+		EditedBy  uint
+		Name      *string
+		CreatedAt time.Time
+	}
+	err := s.db.Table("conversation_note_revisions").
+		Select("conversation_note_revisions.body, conversation_note_revisions.edited_by, auth_users.name, conversation_note_revisions.created_at").
+		Joins("LEFT JOIN auth_users ON auth_users.user_id = conversation_note_revisions.edited_by").
+		Where("conversation_note_revisions.note_id = ?", noteID).
+		Order("conversation_note_revisions.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load note history: %w", err)
+	}
+	revisions := make([]Revision, 0, len(rows))
+	for _, row := range rows {
+		revisions = append(revisions, Revision{
+			Body:     row.Body,
+			EditedBy: Author{ID: row.EditedBy, Name: row.Name},
+			EditedAt: row.CreatedAt,
+		})
+	}
+	return revisions, nil
+}
+
+func (s *Service) load(conversationID, noteID uint) (*models.ConversationNote, error) {
+	var row models.ConversationNote
+	err := s.db.Preload("Author").Where("id = ? AND conversation_id = ?", noteID, conversationID).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load note: %w", err)
+	}
+	return &row, nil
+}
+
+// threads turns notes, oldest first, into views with their mentions. Replies are nested under
+// their parent when it is among rows.
+func (s *Service) threads(rows []models.ConversationNote) ([]Note, error) {
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	mentions, err := s.mentionsOf(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[uint]bool, len(rows))
+	for _, row := range rows {
+		present[row.ID] = true
+	}
+	replies := make(map[uint][]Note)
+	for _, row := range rows {
+		if row.ParentID != nil && present[*row.ParentID] {
+			replies[*row.ParentID] = append(replies[*row.ParentID], view(row, mentions[row.ID]))
+		}
+	}
+	notes := make([]Note, 0, len(rows))
+	for _, row := range rows {
+		if row.ParentID != nil && present[*row.ParentID] {
+			continue
+		}
+		note := view(row, mentions[row.ID])
+		note.Replies = replies[row.ID]
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+// mentionsOf returns the users mentioned in each note, by user ID.
+func (s *Service) mentionsOf(noteIDs []uint) (map[uint][]Author, error) {
+	mentions := make(map[uint][]Author, len(noteIDs))
+	if len(noteIDs) == 0 {
+		return mentions, nil
+	}
+	var rows []struct {
+		NoteID     uint
+		AuthUserID uint
+		Name       *string
+	}
+	err := s.db.Table("conversation_note_mentions").
+		Select("conversation_note_mentions.note_id, conversation_note_mentions.auth_user_id, auth_users.name").
+		Joins("JOIN auth_users ON auth_users.user_id = conversation_note_mentions.auth_user_id").
+		Where("conversation_note_mentions.note_id IN ?", noteIDs).
+		Order("conversation_note_mentions.auth_user_id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mentions: %w", err)
+	}
+	for _, row := range rows {
+		mentions[row.NoteID] = append(mentions[row.NoteID], Author{ID: row.AuthUserID, Name: row.Name})
+	}
+	return mentions, nil
+}
+
+// resolveMentions returns the IDs of the users mentioned in body, leaving out the author. Every
+// mention must name an enabled auth user assigned to the conversation or able to read all
+// conversations; otherwise ErrInvalidMention lists the emails that do not.
+func (s *Service) resolveMentions(conversationID, authorID uint, body string) ([]uint, error) {
+	emails := Mentions(body)
+	if len(emails) == 0 {
+		return nil, nil
+	}
+	var rows []struct {
+		UserID uint
+		Email  string
+	}
+	assigned := s.db.Table("auth_user_conversation").
+		Select("auth_user_id").
+		Where("conversation_id = ? AND deleted_at IS NULL", conversationID)
+	err := s.db.Table("auth_users").
+		Select("auth_users.user_id, LOWER(auth_users.email) AS email").
+		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
+		Where("LOWER(auth_users.email) IN ? AND auth_users.disabled_at IS NULL", emails).
+		Where("UPPER(auth_roles.name) IN ? OR auth_users.user_id IN (?)", rbac.RolesWith(rbac.ConversationsReadAll), assigned).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+
+	found := make(map[string]uint, len(rows))
+	for _, row := range rows {
+		found[row.Email] = row.UserID
+	}
+	var missing []string
+	ids := make([]uint, 0, len(emails))
+	for _, email := range emails {
+		id, ok := found[email]
+		switch {
+		case !ok:
+			missing = append(missing, email)
+		case id != authorID:
+			ids = append(ids, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMention, strings.Join(missing, ", "))
+	}
+	return ids, nil
+}
+
+// publish tells the conversation's viewers about a note change. Newly mentioned users are in the
+// audience, so they are told even when the conversation is not assigned to them.
+func (s *Service) publish(eventType string, row *models.ConversationNote, mentioned []uint) {
+	if mentioned == nil {
+		mentioned = []uint{}
+	}
+	s.inbox.Publish(eventType, row.ConversationID, map[string]any{
+		"note_id":             row.ID,
+		"parent_id":           row.ParentID,
+		"author_auth_user_id": row.AuthorAuthUserID,
+		"mentioned":           mentioned,
+	}, mentioned...)
+}
+
+func addMentions(tx *gorm.DB, noteID uint, authUserIDs []uint) error {
+	if len(authUserIDs) == 0 {
+		return nil
+	}
+	mentions := make([]models.ConversationNoteMention, 0, len(authUserIDs))
+	for _, id := range authUserIDs {
+		mentions = append(mentions, models.ConversationNoteMention{NoteID: noteID, AuthUserID: id})
+	}
+	if err := tx.Create(&mentions).Error; err != nil {
+		return fmt.Errorf("failed to save mentions: %w", err)
+	}
+	return nil
+}
+
+func normalizeBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > MaxBodyLength {
+		return "", ErrInvalidBody
+	}
+	return body, nil
+}
+
+func view(row models.ConversationNote, mentions []Author) Note {
+	if mentions == nil {
+		mentions = []Author{}
+	}
+	return Note{
+		ID:             row.ID,
+		ConversationID: row.ConversationID,
+		ParentID:       row.ParentID,
+		Author:         Author{ID: row.AuthorAuthUserID, Name: row.Author.Name},
+		Body:           row.Body,
+		Mentions:       mentions,
+		Pinned:         row.PinnedAt != nil,
+		PinnedAt:       row.PinnedAt,
+		PinnedBy:       row.PinnedBy,
+		CreatedAt:      row.CreatedAt,
+		EditedAt:       row.EditedAt,
+	}
+}
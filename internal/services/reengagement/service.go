@@ -0,0 +1,515 @@
+package reengagement
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/external/notification"
+	"smart-chat/internal/constants"
+	"smart-chat/internal/llm_service"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ResponseWindow is how long after a nudge a user reply still counts as a recovery.
+const ResponseWindow = 48 * time.Hour
+
+const (
+	optOutReply = "You won't receive any more follow-up messages from us. Reply START to turn them back on."
+	optInReply  = "Follow-up messages are back on. Ask me anything about your next trip!"
+)
+
+var optOutKeywords = map[string]bool{
+	"STOP":        true,
+	"UNSUBSCRIBE": true,
+	"STOP ALL":    true,
+}
+
+// NudgeGenerator writes the follow-up text for a conversation.
+type NudgeGenerator interface {
+	GenerateNudge(conversation models.Conversation) (string, error)
+}
+
+// MessageSender delivers a nudge to the user. *notification.Client satisfies it.
+type MessageSender interface {
+	SendMessageEvent(payload notification.Payload) error
+}
+
+// LLMNudgeGenerator generates nudges with the LLM from the conversation history.
+type LLMNudgeGenerator struct{}
+
+func (LLMNudgeGenerator) GenerateNudge(conversation models.Conversation) (string, error) {
+	return llm_service.GenerateReengagementNudge(conversation)
+}
+
+// Settings controls when and how often users are nudged.
+type Settings struct {
+	Enabled bool
+	// IdleAfter and MaxIdle bound how long ago the unanswered bot question was sent.
+	// MaxIdle keeps nudges inside WhatsApp's 24 hour customer service window.
+	IdleAfter time.Duration
+	MaxIdle   time.Duration
+	// No nudges are sent from QuietStartHour until QuietEndHour in Location.
+	QuietStartHour int
+	QuietEndHour   int
+	Location       *time.Location
+	// At most MaxPerUser nudges are sent to a user within CapWindow.
+	MaxPerUser int
+	CapWindow  time.Duration
+}
+
+// SettingsFromConfig builds Settings from the application config. Quiet hours are in Asia/Kolkata.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	return Settings{
+		Enabled:        cfg.ReengagementEnabled,
+		IdleAfter:      time.Duration(cfg.ReengagementIdleHours) * time.Hour,
+		MaxIdle:        time.Duration(cfg.ReengagementMaxIdleHours) * time.Hour,
+		QuietStartHour: cfg.ReengagementQuietStartHour,
+		QuietEndHour:   cfg.ReengagementQuietEndHour,
+		Location:       kolkata(),
+		MaxPerUser:     cfg.ReengagementMaxPerUser,
+		CapWindow:      time.Duration(cfg.ReengagementCapWindowHours) * time.Hour,
+	}
+}
+
+// RunResult summarises one scheduler run.
+type RunResult struct {
+	Sent       int
+	Failed     int
+	Capped     int
+	Recovered  int
+	NoResponse int
+	QuietHours bool
+}
+
+// Summary is the nudge funnel over a period.
+type Summary struct {
+	Sent         int64   `json:"sent"`
+	Failed       int64   `json:"failed"`
+	Recovered    int64   `json:"recovered"`
+	NoResponse   int64   `json:"noResponse"`
+	OptedOut     int64   `json:"optedOut"`
+	Pending      int64   `json:"pending"`
+	RecoveryRate float64 `json:"recoveryRate"`
+}
+
+// ReengagementService follows up with WhatsApp users who stopped replying after the bot asked a question.
+type ReengagementService struct {
+	db           *gorm.DB
+	settings     Settings
+	generator    NudgeGenerator
+	sender       MessageSender
+	slackService *slack.SlackService
+	inbox        *inbox.Publisher
+}
+
+// NewReengagementService returns a new ReengagementService.
+func NewReengagementService(db *gorm.DB, settings Settings, generator NudgeGenerator, sender MessageSender, slackService *slack.SlackService) *ReengagementService {
+	if settings.Location == nil {
+		settings.Location = kolkata()
+	}
+	return &ReengagementService{
+		db:           db,
+		settings:     settings,
+		generator:    generator,
+		sender:       sender,
+		slackService: slackService,
+		inbox:        inbox.NewPublisher(db),
+	}
+}
+
+type candidate struct {
+	MessagePairID  uint
+	ConversationID uint
+	Bot            string
+	UserID         uint
+	Mobile         string
+}
+
+// Run is the cron entry point.
+func (s *ReengagementService) Run() {
+	if !s.settings.Enabled {
+		return
+	}
+	result, err := s.RunAt(time.Now())
+	if err != nil {
+		log.Printf("Re-engagement run failed: %v", err)
+		s.alert(fmt.Sprintf("Re-engagement run failed: *%v*", err))
+		return
+	}
+	log.Printf("Re-engagement run: sent=%d failed=%d capped=%d recovered=%d no_response=%d quiet_hours=%t",
+		result.Sent, result.Failed, result.Capped, result.Recovered, result.NoResponse, result.QuietHours)
+}
+
+// RunAt records outcomes of earlier nudges and, outside quiet hours, sends new ones as of now.
+func (s *ReengagementService) RunAt(now time.Time) (RunResult, error) {
+	var result RunResult
+
+	recovered, noResponse, err := s.recordOutcomes(now)
+	if err != nil {
+		return result, err
+	}
+	result.Recovered, result.NoResponse = recovered, noResponse
+
+	if s.InQuietHours(now) {
+		result.QuietHours = true
+		return result, nil
+	}
+
+	candidates, err := s.findCandidates(now)
+	if err != nil {
+		return result, err
+	}
+
+	for _, c := range candidates {
+		if !botAskedQuestion(c.Bot) {
+			continue
+		}
+
+		capped, err := s.reachedCap(c.UserID, now)
+		if err != nil {
+			return result, err
+		}
+		if capped {
+			result.Capped++
+			continue
+		}
+
+		sent, err := s.nudge(c, now)
+		if err != nil {
+			log.Printf("Failed to nudge conversation %d: %v", c.ConversationID, err)
+			s.alert(fmt.Sprintf("Failed to send re-engagement nudge for conversation ID: *%d*: %v", c.ConversationID, err))
+			result.Failed++
+			continue
+		}
+		if sent {
+			result.Sent++
+		}
+	}
+
+	return result, nil
+}
+
+// InQuietHours reports whether t falls in the configured quiet hours.
+func (s *ReengagementService) InQuietHours(t time.Time) bool {
+	start, end := s.settings.QuietStartHour, s.settings.QuietEndHour
+	if start == end {
+		return false
+	}
+	hour := t.In(s.settings.Location).Hour()
+	if start < end {
+		return hour >= start && hour < end
+	}
+	// The window wraps around midnight, e.g. 21:00 to 09:00.
+	return hour >= start || hour < end
+}
+
+// findCandidates returns WhatsApp conversations in bot mode whose latest message is a bot reply
+// sent within the idle window to a user who has not opted out.
+func (s *ReengagementService) findCandidates(now time.Time) ([]candidate, error) {
+	latest := s.db.Model(&models.MessagePair{}).
+		Select("conversation_id, MAX(id) AS last_id").
+		Group("conversation_id")
+
+	var candidates []candidate
+	err := s.db.Table("message_pairs").
+		Select("message_pairs.id AS message_pair_id, message_pairs.conversation_id, message_pairs.bot, users.id AS user_id, users.mobile").
+		Joins("JOIN (?) latest ON latest.last_id = message_pairs.id", latest).
+		Joins("JOIN conversations ON conversations.id = message_pairs.conversation_id AND conversations.deleted_at IS NULL").
+		Joins("JOIN sessions ON sessions.id = conversations.session_id").
+		Joins("JOIN users ON users.id = sessions.user_id").
+		Where("message_pairs.deleted_at IS NULL").
+		Where("message_pairs.type IN ?", []models.MessageType{models.MessageTypeUserSent, models.MessageTypeUserFix}).
+		Where("message_pairs.visible = ?", true).
+		Where("message_pairs.created_at > ? AND message_pairs.created_at <= ?", now.Add(-s.settings.MaxIdle), now.Add(-s.settings.IdleAfter)).
+		Where("sessions.source = ?", constants.WhatsAppSource).
+		Where("conversations.mode = ?", models.ConversationModeBot).
+		Where("users.reengagement_opted_out_at IS NULL").
+		Order("message_pairs.id asc").
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find re-engagement candidates: %w", err)
+	}
+	return candidates, nil
+}
+
+func (s *ReengagementService) reachedCap(userID uint, now time.Time) (bool, error) {
+	if s.settings.MaxPerUser <= 0 {
+		return false, nil
+	}
+	var count int64
+	err := s.db.Model(&models.ReengagementNudge{}).
+		Where("user_id = ? AND status = ? AND sent_at > ?", userID, models.NudgeStatusSent, now.Add(-s.settings.CapWindow)).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to count nudges for user %d: %w", userID, err)
+	}
+	return count >= int64(s.settings.MaxPerUser), nil
+}
+
+// nudge claims the drop-off, generates the follow-up, sends it and records it in the conversation.
+// It returns false when another run already claimed the drop-off.
+func (s *ReengagementService) nudge(c candidate, now time.Time) (bool, error) {
+	record := models.ReengagementNudge{
+		ConversationID:       c.ConversationID,
+		UserID:               c.UserID,
+		TriggerMessagePairID: c.MessagePairID,
+		Status:               models.NudgeStatusPending,
+		Outcome:              models.NudgeOutcomePending,
+	}
+	claim := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "trigger_message_pair_id"}},
+		DoNothing: true,
+	}).Create(&record)
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return false, nil
+	}
+
+	var conversation models.Conversation
+	err := s.db.
+		Preload("MessagePairs", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }).
+		First(&conversation, c.ConversationID).Error
+	if err != nil {
+		return false, s.fail(&record, fmt.Errorf("failed to load conversation: %w", err))
+	}
+
+	text, err := s.generator.GenerateNudge(conversation)
+	if err == nil && strings.TrimSpace(text) == "" {
+		err = errors.New("empty nudge generated")
+	}
+	if err != nil {
+		return false, s.fail(&record, err)
+	}
+	text = strings.TrimSpace(text)
+
+	payload := notification.Payload{
+		ConversationID: c.ConversationID,
+		Mobile:         c.Mobile,
+		MessagePair:    notification.MessagePair{Bot: text},
+	}
+	if err := s.sender.SendMessageEvent(payload); err != nil {
+		record.Message = text
+		return false, s.fail(&record, err)
+	}
+
+	pair := models.MessagePair{
+		ConversationID: c.ConversationID,
+		Bot:            fmt.Sprintf("{\"content\":%q}", text),
+		Visible:        true,
+		Type:           models.MessageTypeReengagementNudge,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&pair).Error; err != nil {
+			return err
+		}
+		return tx.Model(&record).Updates(map[string]any{
+			"status":                models.NudgeStatusSent,
+			"message":               text,
+			"sent_at":               now,
+			"nudge_message_pair_id": pair.ID,
+		}).Error
+	})
+	if err != nil {
+		return true, fmt.Errorf("nudge sent but not recorded: %w", err)
+	}
+	s.inbox.Publish(inbox.EventMessageCreated, c.ConversationID, inbox.MessageData(&pair))
+	return true, nil
+}
+
+func (s *ReengagementService) fail(record *models.ReengagementNudge, cause error) error {
+	err := s.db.Model(record).Updates(map[string]any{
+		"status":  models.NudgeStatusFailed,
+		"outcome": models.NudgeOutcomeNoResponse,
+		"message": record.Message,
+		"error":   cause.Error(),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to record failed nudge %d: %v", record.ID, err)
+	}
+	return cause
+}
+
+// recordOutcomes marks sent nudges as recovered when the user replied afterwards,
+// or as no_response once ResponseWindow has passed.
+func (s *ReengagementService) recordOutcomes(now time.Time) (int, int, error) {
+	var pending []models.ReengagementNudge
+	err := s.db.
+		Where("status = ? AND outcome = ?", models.NudgeStatusSent, models.NudgeOutcomePending).
+		Find(&pending).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load pending nudges: %w", err)
+	}
+
+	recovered, noResponse := 0, 0
+	for _, nudge := range pending {
+		if nudge.SentAt == nil {
+			continue
+		}
+
+		var reply models.MessagePair
+		err := s.db.
+			Where("conversation_id = ? AND type = ? AND created_at > ?", nudge.ConversationID, models.MessageTypeUserSent, *nudge.SentAt).
+			Order("created_at asc").
+			First(&reply).Error
+		switch {
+		case err == nil:
+			respondedAt := reply.CreatedAt
+			if err := s.setOutcome(nudge.ID, models.NudgeOutcomeRecovered, &respondedAt); err != nil {
+				return recovered, noResponse, err
+			}
+			recovered++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if now.Sub(*nudge.SentAt) < ResponseWindow {
+				continue
+			}
+			if err := s.setOutcome(nudge.ID, models.NudgeOutcomeNoResponse, nil); err != nil {
+				return recovered, noResponse, err
+			}
+			noResponse++
+		default:
+			return recovered, noResponse, err
+		}
+	}
+	return recovered, noResponse, nil
+}
+
+func (s *ReengagementService) setOutcome(nudgeID uint, outcome string, respondedAt *time.Time) error {
+	return s.db.Model(&models.ReengagementNudge{}).
+		Where("id = ?", nudgeID).
+		Updates(map[string]any{"outcome": outcome, "responded_at": respondedAt}).Error
+}
+
+// OptOut stops all future nudges for the user and closes any open ones.
+func (s *ReengagementService) OptOut(userID uint) error {
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).
+			Where("id = ? AND reengagement_opted_out_at IS NULL", userID).
+			Update("reengagement_opted_out_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.ReengagementNudge{}).
+			Where("user_id = ? AND outcome = ?", userID, models.NudgeOutcomePending).
+			Update("outcome", models.NudgeOutcomeOptedOut).Error
+	})
+}
+
+// OptIn re-enables nudges for the user.
+func (s *ReengagementService) OptIn(userID uint) error {
+	return s.db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("reengagement_opted_out_at", nil).Error
+}
+
+// HandleKeyword handles the STOP/START keywords in an inbound message.
+// It returns the reply to send and true when the message was a keyword.
+func (s *ReengagementService) HandleKeyword(userID uint, text string) (string, bool) {
+	keyword := strings.ToUpper(strings.Join(strings.Fields(text), " "))
+	switch {
+	case optOutKeywords[keyword]:
+		if err := s.OptOut(userID); err != nil {
+			log.Printf("Failed to opt out user %d: %v", userID, err)
+			return "", false
+		}
+		return optOutReply, true
+	case keyword == "START":
+		var user models.User
+		if err := s.db.Select("id", "reengagement_opted_out_at").First(&user, userID).Error; err != nil {
+			return "", false
+		}
+		// START is an ordinary message unless the user previously opted out.
+		if user.ReengagementOptedOutAt == nil {
+			return "", false
+		}
+		if err := s.OptIn(userID); err != nil {
+			log.Printf("Failed to opt in user %d: %v", userID, err)
+			return "", false
+		}
+		return optInReply, true
+	}
+	return "", false
+}
+
+// GetSummary returns the nudge funnel for nudges created since the given time.
+func (s *ReengagementService) GetSummary(since time.Time) (Summary, error) {
+	type row struct {
+		Status  string
+		Outcome string
+		Count   int64
+	}
+	var rows []row
+	err := s.db.Model(&models.ReengagementNudge{}).
+		Select("status, outcome, COUNT(*) AS count").
+		Where("created_at >= ?", since).
+		Group("status, outcome").
+		Scan(&rows).Error
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var summary Summary
+	for _, r := range rows {
+		if r.Status == models.NudgeStatusFailed {
+			summary.Failed += r.Count
+			continue
+		}
+		if r.Status != models.NudgeStatusSent {
+			continue
+		}
+		summary.Sent += r.Count
+		switch r.Outcome {
+		case models.NudgeOutcomeRecovered:
+			summary.Recovered += r.Count
+		case models.NudgeOutcomeNoResponse:
+			summary.NoResponse += r.Count
+		case models.NudgeOutcomeOptedOut:
+			summary.OptedOut += r.Count
+		default:
+			summary.Pending += r.Count
+		}
+	}
+	if summary.Sent > 0 {
+		summary.RecoveryRate = float64(summary.Recovered) / float64(summary.Sent)
+	}
+	return summary, nil
+}
+
+func (s *ReengagementService) alert(message string) {
+	if s.slackService != nil {
+		s.slackService.SendSlackAlertAsync(message)
+	}
+}
+
+// botAskedQuestion reports whether a stored bot reply ends the turn with a question.
+func botAskedQuestion(bot string) bool {
+	var parsed struct {
+		Content string `json:"content"`
+	}
+	content := bot
+	if err := json.Unmarshal([]byte(bot), &parsed); err == nil && parsed.Content != "" {
+		content = parsed.Content
+	}
+	return strings.Contains(content, "?")
+}
+
+func kolkata() *time.Location {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		// India has no DST, so a fixed offset is equivalent when tzdata is unavailable.
+		return time.FixedZone("IST", 5*60*60+30*60)
+	}
+	return loc
+}
@@ -0,0 +1,343 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/otp"
+	"smart-chat/internal/tokenhash"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrSessionRevoked  = errors.New("session revoked")
+	// ErrRefreshTokenReused means a refresh token that was already rotated away came back. Someone
+	// else holds a copy, so the session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// touchInterval limits how often last_seen_at and expire_at are written for a busy session.
+const touchInterval = time.Minute
+
+// Policy controls how long sessions live.
+type Policy struct {
+	// IdleTimeout is how long an access token stays valid after the session was last used.
+	IdleTimeout time.Duration
+	// RefreshTTL is how long a refresh token stays valid after it was issued.
+	RefreshTTL time.Duration
+}
+
+// DefaultPolicy is used for any zero field of a Policy.
+var DefaultPolicy = Policy{
+	IdleTimeout: time.Hour,
+	RefreshTTL:  30 * 24 * time.Hour,
+}
+
+// PolicyFromConfig builds a Policy from the application config.
+func PolicyFromConfig(cfg *config.Config) Policy {
+	return Policy{
+		IdleTimeout: time.Duration(cfg.SessionIdleMinutes) * time.Minute,
+		RefreshTTL:  time.Duration(cfg.SessionRefreshDays) * 24 * time.Hour,
+	}
+}
+
+// Tokens are returned to the client once; only their hashes are stored.
+type Tokens struct {
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// ActiveSession is a session that can still be used, directly or through its refresh token.
+type ActiveSession struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"userId"`
+	Mobile     string     `json:"mobile"`
+	Source     string     `json:"source"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt *time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+// Service issues, refreshes, slides and revokes sessions.
+type Service struct {
+	db     *gorm.DB
+	policy Policy
+	tokens *tokenhash.Hasher
+}
+
+// NewService returns a Service hashing tokens with tokenhash.Default().
+func NewService(db *gorm.DB, policy Policy) *Service {
+	if policy.IdleTimeout <= 0 {
+		policy.IdleTimeout = DefaultPolicy.IdleTimeout
+	}
+	if policy.RefreshTTL <= 0 {
+		policy.RefreshTTL = DefaultPolicy.RefreshTTL
+	}
+	return &Service{db: db, policy: policy, tokens: tokenhash.Default()}
+}
+
+// Issue creates a session for the user and returns its tokens.
+func (s *Service) Issue(userID uint, source string) (Tokens, error) {
+	now := time.Now()
+	tokens, err := s.newTokens(now)
+	if err != nil {
+		return Tokens{}, err
+	}
+	session := models.Session{
+		UserID:          userID,
+		AuthToken:       s.tokens.Hash(tokens.AccessToken),
+		ExpireAt:        tokens.ExpiresAt,
+		RefreshToken:    s.tokens.Hash(tokens.RefreshToken),
+		RefreshExpireAt: &tokens.RefreshExpiresAt,
+		LastSeenAt:      &now,
+		Source:          source,
+	}
+	if err := s.db.Create(&session).Error; err != nil {
+		return Tokens{}, err
+	}
+	return tokens, nil
+}
+
+// Find returns the session for an access token, whether or not it is still valid. Sessions stored
+// under an older pepper or in plaintext are rehashed with the current pepper on the way through.
+func (s *Service) Find(accessToken string) (models.Session, error) {
+	var session models.Session
+	if accessToken == "" {
+		return session, ErrSessionNotFound
+	}
+	err := s.tokens.Where(s.db, "auth_token", accessToken).Preload("User").First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, ErrSessionNotFound
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := s.tokens.Upgrade(s.db, &session, "auth_token", session.AuthToken, accessToken); err != nil {
+		log.Printf("Failed to rehash token of session %d: %v", session.ID, err)
+	}
+	return session, nil
+}
+
+// Authenticate returns the session for an access token if it is neither revoked nor expired, and
+// slides its expiry forward.
+func (s *Service) Authenticate(accessToken string) (models.Session, error) {
+	session, err := s.Find(accessToken)
+	if err != nil {
+		return session, err
+	}
+	if session.RevokedAt != nil {
+		return session, ErrSessionRevoked
+	}
+	now := time.Now()
+	if now.After(session.ExpireAt) {
+		return session, ErrSessionExpired
+	}
+	s.touch(&session, now)
+	return session, nil
+}
+
+// touch records activity and moves the expiry to IdleTimeout from now. It never shortens a
+// session that was issued with a longer expiry, and writes at most once per touchInterval.
+func (s *Service) touch(session *models.Session, now time.Time) {
+	updates := map[string]any{}
+	if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) >= touchInterval {
+		updates["last_seen_at"] = now
+	}
+	if expiry := now.Add(s.policy.IdleTimeout); expiry.Sub(session.ExpireAt) >= touchInterval {
+		updates["expire_at"] = expiry
+	}
+	if len(updates) == 0 {
+		return
+	}
+	if err := s.db.Model(&models.Session{}).Where("id = ?", session.ID).UpdateColumns(updates).Error; err != nil {
+		log.Printf("Failed to extend session %d: %v", session.ID, err)
+		return
+	}
+	if _, ok := updates["last_seen_at"]; ok {
+		session.LastSeenAt = &now
+	}
+	if expiry, ok := updates["expire_at"].(time.Time); ok {
+		session.ExpireAt = expiry
+	}
+}
+
+// Refresh exchanges a refresh token for new access and refresh tokens. The old refresh token stops
+// working; presenting it again revokes the session.
+func (s *Service) Refresh(refreshToken string) (Tokens, error) {
+	if refreshToken == "" {
+		return Tokens{}, ErrSessionNotFound
+	}
+	var session models.Session
+	err := s.tokens.Where(s.db, "refresh_token", refreshToken).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var replayed models.Session
+		if s.tokens.Where(s.db, "previous_refresh_token", refreshToken).First(&replayed).Error == nil {
+			log.Printf("Refresh token of session %d was reused, revoking the session", replayed.ID)
+			if err := s.revoke(s.db.Where("id = ?", replayed.ID)); err != nil {
+				return Tokens{}, err
+			}
+			return Tokens{}, ErrRefreshTokenReused
+		}
+		return Tokens{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	if session.RevokedAt != nil {
+		return Tokens{}, ErrSessionRevoked
+	}
+	if session.RefreshExpireAt == nil || time.Now().After(*session.RefreshExpireAt) {
+		return Tokens{}, ErrSessionExpired
+	}
+	return s.Rotate(session)
+}
+
+// Rotate gives a session new access and refresh tokens.
+func (s *Service) Rotate(session models.Session) (Tokens, error) {
+	if session.RevokedAt != nil {
+		return Tokens{}, ErrSessionRevoked
+	}
+	now := time.Now()
+	tokens, err := s.newTokens(now)
+	if err != nil {
+		return Tokens{}, err
+	}
+	// Matching on the current refresh token makes concurrent rotations of one session fail
+	// instead of both succeeding.
+	result := tokenhash.Quiet(s.db).Model(&models.Session{}).
+		Where("id = ? AND refresh_token = ? AND revoked_at IS NULL", session.ID, session.RefreshToken).
+		UpdateColumns(map[string]any{
+			"auth_token":             s.tokens.Hash(tokens.AccessToken),
+			"expire_at":              tokens.ExpiresAt,
+			"refresh_token":          s.tokens.Hash(tokens.RefreshToken),
+			"previous_refresh_token": session.RefreshToken,
+			"refresh_expire_at":      tokens.RefreshExpiresAt,
+			"last_seen_at":           now,
+		})
+	if result.Error != nil {
+		return Tokens{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Tokens{}, ErrSessionNotFound
+	}
+	return tokens, nil
+}
+
+// Revoke ends the session an access token belongs to, even if it has already expired.
+func (s *Service) Revoke(accessToken string) error {
+	session, err := s.Find(accessToken)
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+	return s.revoke(s.db.Where("id = ?", session.ID))
+}
+
+// RevokeAllForMobile revokes every session of the users with this mobile number and returns how many were revoked.
+func (s *Service) RevokeAllForMobile(mobile string) (int64, error) {
+	userIDs, err := s.userIDsForMobile(mobile)
+	if err != nil || len(userIDs) == 0 {
+		return 0, err
+	}
+	result := s.db.Model(&models.Session{}).
+		Where("user_id IN ? AND revoked_at IS NULL", userIDs).
+		UpdateColumn("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// ListActiveForUser lists the user's usable sessions, most recently used first. current marks the
+// caller's own session.
+func (s *Service) ListActiveForUser(userID uint, current uint) ([]ActiveSession, error) {
+	return s.listActive([]uint{userID}, current)
+}
+
+// ListActiveForMobile lists the usable sessions of the users with this mobile number.
+func (s *Service) ListActiveForMobile(mobile string) ([]ActiveSession, error) {
+	userIDs, err := s.userIDsForMobile(mobile)
+	if err != nil || len(userIDs) == 0 {
+		return []ActiveSession{}, err
+	}
+	return s.listActive(userIDs, 0)
+}
+
+func (s *Service) listActive(userIDs []uint, current uint) ([]ActiveSession, error) {
+	now := time.Now()
+	var sessions []models.Session
+	err := s.db.Preload("User").
+		Where("user_id IN ? AND revoked_at IS NULL", userIDs).
+		Where("expire_at > ? OR refresh_expire_at > ?", now, now).
+		Order("COALESCE(last_seen_at, created_at) DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]ActiveSession, 0, len(sessions))
+	for _, session := range sessions {
+		active = append(active, ActiveSession{
+			ID:         session.ID,
+			UserID:     session.UserID,
+			Mobile:     session.User.Mobile,
+			Source:     session.Source,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpireAt,
+			Current:    session.ID == current,
+		})
+	}
+	return active, nil
+}
+
+// userIDsForMobile matches the number as typed and in its E.164, digits-only and national forms,
+// since users.mobile holds whatever the client sent at login.
+func (s *Service) userIDsForMobile(mobile string) ([]uint, error) {
+	forms := []string{mobile}
+	if recipient, err := otp.ParseMobile(mobile); err == nil {
+		forms = append(forms, recipient.E164, recipient.Digits, recipient.National)
+	}
+	var userIDs []uint
+	err := s.db.Model(&models.User{}).Where("mobile IN ?", forms).Pluck("id", &userIDs).Error
+	return userIDs, err
+}
+
+func (s *Service) revoke(scope *gorm.DB) error {
+	return scope.Model(&models.Session{}).UpdateColumn("revoked_at", time.Now()).Error
+}
+
+func (s *Service) newTokens(now time.Time) (Tokens, error) {
+	accessToken, err := generateToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	refreshToken, err := generateToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        now.Add(s.policy.IdleTimeout),
+		RefreshExpiresAt: now.Add(s.policy.RefreshTTL),
+	}, nil
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,406 @@
+package sla
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statuses of an SLA metric.
+const (
+	// StatusNone means the conversation's source has no target for the metric.
+	StatusNone = "none"
+	// StatusPending is running and not yet close to its due time.
+	StatusPending = "pending"
+	// StatusAtRisk is running and past Settings.WarnPercent of its target.
+	StatusAtRisk = "at_risk"
+	// StatusBreached is past its due time, met late or not at all.
+	StatusBreached = "breached"
+	// StatusMet was met on time.
+	StatusMet = "met"
+)
+
+// staleAfter keeps the job from alerting about breaches older than this, so enabling SLAs or
+// restarting after downtime does not page for the whole backlog.
+const staleAfter = 24 * time.Hour
+
+// batchSize is how many conversations the job evaluates per query.
+const batchSize = 500
+
+// Policy sets SLA targets for conversations from a session source. An empty Source is the
+// default for sources without a policy of their own. Zero minutes means no target.
+type Policy struct {
+	Source               string `json:"source"`
+	FirstResponseMinutes int    `json:"first_response_minutes"`
+	ResolutionMinutes    int    `json:"resolution_minutes"`
+}
+
+// Settings controls SLA tracking and alerts.
+type Settings struct {
+	Policies []Policy
+	// WarnPercent is how much of a target may elapse before the job warns. Zero disables warnings.
+	WarnPercent int
+	// ClientAppBaseURL is where agents open conversations; Slack alerts link to it.
+	ClientAppBaseURL string
+}
+
+// SettingsFromConfig builds Settings from the application config. Policies are a JSON array of
+// Policy; invalid policies are logged and ignored.
+func SettingsFromConfig(cfg *config.Config) Settings {
+	settings := Settings{
+		WarnPercent:      cfg.SLAWarnPercent,
+		ClientAppBaseURL: strings.TrimRight(strings.TrimSpace(cfg.ClientAppBaseURL), "/"),
+	}
+	if policies := strings.TrimSpace(cfg.SLAPolicies); policies != "" {
+		if err := json.Unmarshal([]byte(policies), &settings.Policies); err != nil {
+			log.Printf("Ignoring invalid SLA policies: %v", err)
+			settings.Policies = nil
+		}
+	}
+	return settings
+}
+
+// Status is a conversation's SLA state as returned by the client API. Both clocks start at the
+// conversation's first assignment. Seconds are set once the metric is reached.
+type Status struct {
+	Source               string     `json:"source"`
+	AssignedAt           time.Time  `json:"assigned_at"`
+	FirstResponseAt      *time.Time `json:"first_response_at"`
+	FirstResponseDueAt   *time.Time `json:"first_response_due_at"`
+	FirstResponseSeconds *int64     `json:"first_response_seconds"`
+	FirstResponseStatus  string     `json:"first_response_status"`
+	ResolvedAt           *time.Time `json:"resolved_at"`
+	ResolutionDueAt      *time.Time `json:"resolution_due_at"`
+	ResolutionSeconds    *int64     `json:"resolution_seconds"`
+	ResolutionStatus     string     `json:"resolution_status"`
+}
+
+// Service computes SLA state from assignments, agent messages and the resolved tracking flag, and
+// alerts Slack when conversations approach or breach their targets.
+type Service struct {
+	db        *gorm.DB
+	settings  Settings
+	assignees *authUserConversation.Service
+	slack     *slack.SlackService
+	now       func() time.Time
+}
+
+func NewService(db *gorm.DB, settings Settings, slackService *slack.SlackService) *Service {
+	return &Service{
+		db:        db,
+		settings:  settings,
+		assignees: authUserConversation.NewService(db),
+		slack:     slackService,
+		now:       time.Now,
+	}
+}
+
+// PolicyFor returns the policy for the session source, falling back to the default policy.
+func (s *Service) PolicyFor(source string) Policy {
+	var fallback *Policy
+	for i, policy := range s.settings.Policies {
+		if policy.Source == "" {
+			if fallback == nil {
+				fallback = &s.settings.Policies[i]
+			}
+			continue
+		}
+		if strings.EqualFold(policy.Source, source) {
+			return policy
+		}
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return Policy{}
+}
+
+// ForConversation returns the conversation's SLA state, or nil if it was never assigned.
+func (s *Service) ForConversation(conversationID uint) (*Status, error) {
+	statuses, err := s.ForConversations([]uint{conversationID})
+	if err != nil {
+		return nil, err
+	}
+	return statuses[conversationID], nil
+}
+
+// ForConversations returns the SLA state of each conversation that was ever assigned.
+func (s *Service) ForConversations(conversationIDs []uint) (map[uint]*Status, error) {
+	return s.statusesAt(conversationIDs, s.now())
+}
+
+func (s *Service) statusesAt(conversationIDs []uint, now time.Time) (map[uint]*Status, error) {
+	result := make(map[uint]*Status)
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+
+	var conversations []struct {
+		ID     uint
+		Source string
+	}
+	err := s.db.Table("conversations").
+		Select("conversations.id, sessions.source").
+		Joins("JOIN sessions ON sessions.id = conversations.session_id").
+		Where("conversations.id IN ?", conversationIDs).
+		Scan(&conversations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversations for SLA: %w", err)
+	}
+
+	assignedAt := make(map[uint]time.Time)
+	firstAssignment := func(conversationID uint, at time.Time) {
+		if current, ok := assignedAt[conversationID]; !ok || at.Before(current) {
+			assignedAt[conversationID] = at
+		}
+	}
+	var periods []models.ConversationAssignment
+	if err := s.db.Select("conversation_id", "assigned_at").Where("conversation_id IN ?", conversationIDs).Find(&periods).Error; err != nil {
+		return nil, fmt.Errorf("failed to load assignment history for SLA: %w", err)
+	}
+	for _, period := range periods {
+		firstAssignment(period.ConversationID, period.AssignedAt)
+	}
+
+	// Links made before assignment history existed count from their creation.
+	var links []models.AuthUserConversation
+	err = s.db.Select("conversation_id", "created_at", "updated_at", "resolved", "resolved_at").
+		Where("conversation_id IN ?", conversationIDs).
+		Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load assignments for SLA: %w", err)
+	}
+	resolvedAt := make(map[uint]time.Time)
+	for _, link := range links {
+		firstAssignment(link.ConversationID, link.CreatedAt)
+		if !link.Resolved {
+			continue
+		}
+		at := link.UpdatedAt
+		if link.ResolvedAt != nil {
+			at = *link.ResolvedAt
+		}
+		if current, ok := resolvedAt[link.ConversationID]; !ok || at.Before(current) {
+			resolvedAt[link.ConversationID] = at
+		}
+	}
+
+	var replies []models.MessagePair
+	err = s.db.Select("conversation_id", "created_at").
+		Where("conversation_id IN ? AND type = ?", conversationIDs, models.MessageTypeAgentAssumedAssistant).
+		Order("created_at ASC").
+		Find(&replies).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent messages for SLA: %w", err)
+	}
+	firstResponse := make(map[uint]time.Time)
+	for _, reply := range replies {
+		start, ok := assignedAt[reply.ConversationID]
+		if _, seen := firstResponse[reply.ConversationID]; seen || !ok || reply.CreatedAt.Before(start) {
+			continue
+		}
+		firstResponse[reply.ConversationID] = reply.CreatedAt
+	}
+
+	for _, conv := range conversations {
+		start, ok := assignedAt[conv.ID]
+		if !ok {
+			continue
+		}
+		policy := s.PolicyFor(conv.Source)
+		status := &Status{Source: conv.Source, AssignedAt: start}
+		if at, ok := firstResponse[conv.ID]; ok {
+			status.FirstResponseAt = &at
+		}
+		if at, ok := resolvedAt[conv.ID]; ok {
+			status.ResolvedAt = &at
+		}
+		status.FirstResponseDueAt, status.FirstResponseSeconds, status.FirstResponseStatus =
+			s.measure(start, status.FirstResponseAt, policy.FirstResponseMinutes, now)
+		status.ResolutionDueAt, status.ResolutionSeconds, status.ResolutionStatus =
+			s.measure(start, status.ResolvedAt, policy.ResolutionMinutes, now)
+		result[conv.ID] = status
+	}
+	return result, nil
+}
+
+// CheckDeadlines sends a Slack warning for each open conversation approaching an SLA target and
+// an alert naming the admins for each breach. Every warning and breach is sent once.
+func (s *Service) CheckDeadlines(now time.Time) (warned, breached int, err error) {
+	var conversationIDs []uint
+	err = s.db.Model(&models.AuthUserConversation{}).
+		Where("resolved = ?", false).
+		Distinct("conversation_id").
+		Pluck("conversation_id", &conversationIDs).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load open conversations for SLA: %w", err)
+	}
+
+	for start := 0; start < len(conversationIDs); start += batchSize {
+		batch := conversationIDs[start:min(start+batchSize, len(conversationIDs))]
+		statuses, err := s.statusesAt(batch, now)
+		if err != nil {
+			return warned, breached, err
+		}
+		agents, err := s.assignees.GetAssignedAgentsByConversationIDs(batch)
+		if err != nil {
+			return warned, breached, err
+		}
+		for _, conversationID := range batch {
+			status := statuses[conversationID]
+			if status == nil || status.ResolvedAt != nil {
+				continue
+			}
+			checks := []struct {
+				metric string
+				status string
+				done   *time.Time
+				due    *time.Time
+			}{
+				{models.SLAMetricFirstResponse, status.FirstResponseStatus, status.FirstResponseAt, status.FirstResponseDueAt},
+				{models.SLAMetricResolution, status.ResolutionStatus, status.ResolvedAt, status.ResolutionDueAt},
+			}
+			for _, check := range checks {
+				if check.done != nil || check.due == nil {
+					continue
+				}
+				level := ""
+				switch {
+				case check.status == StatusAtRisk:
+					level = models.SLAAlertWarning
+				case check.status == StatusBreached && now.Sub(*check.due) < staleAfter:
+					level = models.SLAAlertBreach
+				default:
+					continue
+				}
+				sent, err := s.alertOnce(conversationID, check.metric, level)
+				if err != nil {
+					return warned, breached, err
+				}
+				if !sent {
+					continue
+				}
+				s.notify(conversationID, check.metric, level, *check.due, agents[conversationID], now)
+				if level == models.SLAAlertWarning {
+					warned++
+				} else {
+					breached++
+				}
+			}
+		}
+	}
+	return warned, breached, nil
+}
+
+// RunAlerts is the cron entry point for CheckDeadlines.
+func (s *Service) RunAlerts() {
+	warned, breached, err := s.CheckDeadlines(s.now())
+	if err != nil {
+		log.Printf("SLA alert job failed: %v", err)
+		if s.slack != nil {
+			s.slack.SendSlackAlertAsync(fmt.Sprintf("SLA alert job failed: *%v*", err))
+		}
+		return
+	}
+	if warned > 0 || breached > 0 {
+		log.Printf("SLA alert job: warned=%d breached=%d", warned, breached)
+	}
+}
+
+// measure returns a metric's due time, how long it took once reached, and its status.
+func (s *Service) measure(start time.Time, done *time.Time, targetMinutes int, now time.Time) (*time.Time, *int64, string) {
+	var seconds *int64
+	if done != nil {
+		elapsed := int64(done.Sub(start).Seconds())
+		seconds = &elapsed
+	}
+	if targetMinutes <= 0 {
+		return nil, seconds, StatusNone
+	}
+
+	target := time.Duration(targetMinutes) * time.Minute
+	due := start.Add(target)
+	switch {
+	case done != nil && !done.After(due):
+		return &due, seconds, StatusMet
+	case done != nil || !now.Before(due):
+		return &due, seconds, StatusBreached
+	case s.settings.WarnPercent > 0 && now.Sub(start) >= target*time.Duration(s.settings.WarnPercent)/100:
+		return &due, seconds, StatusAtRisk
+	default:
+		return &due, seconds, StatusPending
+	}
+}
+
+// alertOnce records the alert and reports whether it was new.
+func (s *Service) alertOnce(conversationID uint, metric, level string) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SLAAlert{
+		ConversationID: conversationID,
+		Metric:         metric,
+		Level:          level,
+	})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record SLA alert: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (s *Service) notify(conversationID uint, metric, level string, due time.Time, agent *authUserConversation.AgentUser, now time.Time) {
+	if s.slack == nil {
+		return
+	}
+	assignee := "nobody"
+	if agent != nil {
+		assignee = fmt.Sprintf("user %d", agent.UserID)
+		if agent.Name != nil && *agent.Name != "" {
+			assignee = *agent.Name
+		}
+	}
+	metricName := strings.ReplaceAll(metric, "_", " ")
+
+	var message string
+	if level == models.SLAAlertWarning {
+		message = fmt.Sprintf("SLA warning: %s for conversation ID: *%d* is due in %s | assigned: *%s*",
+			metricName, conversationID, due.Sub(now).Round(time.Minute), assignee)
+	} else {
+		message = fmt.Sprintf("SLA breached: %s for conversation ID: *%d* was due %s ago | assigned: *%s* | admins: *%s*",
+			metricName, conversationID, now.Sub(due).Round(time.Minute), assignee, s.adminNames())
+	}
+	if s.settings.ClientAppBaseURL != "" {
+		message += fmt.Sprintf(" | %s/conversations/%d", s.settings.ClientAppBaseURL, conversationID)
+	}
+	if level == models.SLAAlertWarning {
+		s.slack.SendSlackNotificationAsync(message)
+	} else {
+		s.slack.SendSlackAlertAsync(message)
+	}
+}
+
+// adminNames lists the enabled auth users who can reassign conversations.
+func (s *Service) adminNames() string {
+	var names []string
+	err := s.db.Table("auth_users").
+		Select("COALESCE(auth_users.name, auth_users.zitadel_user_id)").
+		Joins("JOIN auth_roles ON auth_roles.role_id = auth_users.role_id").
+		Where("UPPER(auth_roles.name) IN ? AND auth_users.disabled_at IS NULL", rbac.RolesWith(rbac.ConversationsAssign)).
+		Order("auth_users.user_id ASC").
+		Scan(&names).Error
+	if err != nil {
+		log.Printf("Failed to load admins for SLA alert: %v", err)
+	}
+	if len(names) == 0 {
+		return "nobody"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,348 @@
+package tag
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smart-chat/internal/llm_service"
+	"smart-chat/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxNameLength is the longest tag name, in characters.
+	MaxNameLength = 64
+	// MaxPerRequest caps how many tags are added to a conversation at once.
+	MaxPerRequest = 20
+	// maxSuggestions caps how many tags the analysis job adds to a conversation.
+	maxSuggestions = 5
+)
+
+var (
+	ErrInvalidName          = errors.New("tag names must be 1 to 64 characters without commas")
+	ErrTooManyTags          = errors.New("at most 20 tags can be added at once")
+	ErrTagExists            = errors.New("tag is already in the vocabulary")
+	ErrTagNotFound          = errors.New("tag not found")
+	ErrNotTagged            = errors.New("conversation does not have that tag")
+	ErrConversationNotFound = errors.New("conversation not found")
+)
+
+// Suggester proposes tags for a conversation, chosen from the vocabulary.
+type Suggester interface {
+	SuggestTags(conversation models.Conversation, vocabulary []string) ([]string, error)
+}
+
+// LLMSuggester suggests tags with the LLM from the conversation history.
+type LLMSuggester struct{}
+
+func (LLMSuggester) SuggestTags(conversation models.Conversation, vocabulary []string) ([]string, error) {
+	return llm_service.SuggestConversationTags(conversation, vocabulary)
+}
+
+// Tag is a tag as returned by the client API.
+type Tag struct {
+	ID                uint      `json:"id" gorm:"column:id"`
+	Name              string    `json:"name" gorm:"column:name"`
+	Vocabulary        bool      `json:"vocabulary" gorm:"column:vocabulary"`
+	ConversationCount int64     `json:"conversation_count" gorm:"column:conversation_count"`
+	CreatedAt         time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+// ConversationTag is a tag on a conversation as returned by the client API.
+type ConversationTag struct {
+	ID         uint      `json:"id" gorm:"column:id"`
+	Name       string    `json:"name" gorm:"column:name"`
+	Vocabulary bool      `json:"vocabulary" gorm:"column:vocabulary"`
+	Source     string    `json:"source" gorm:"column:source"`
+	AddedBy    *uint     `json:"added_by" gorm:"column:added_by"`
+	AddedAt    time.Time `json:"added_at" gorm:"column:added_at"`
+}
+
+// Service manages the tag vocabulary and the tags on conversations.
+type Service struct {
+	db        *gorm.DB
+	suggester Suggester
+}
+
+func NewService(db *gorm.DB, suggester Suggester) *Service {
+	return &Service{db: db, suggester: suggester}
+}
+
+// NormalizeName lower-cases a tag name and collapses its whitespace. It returns ErrInvalidName
+// when the result is empty, too long or contains a comma, which separates tags in list filters.
+func NormalizeName(name string) (string, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if normalized == "" || utf8.RuneCountInString(normalized) > MaxNameLength || strings.Contains(normalized, ",") {
+		return "", ErrInvalidName
+	}
+	return normalized, nil
+}
+
+// NormalizeNames normalizes and de-duplicates tag names, keeping their order.
+func NormalizeNames(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name, err := NormalizeName(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized, nil
+}
+
+// List returns tags by name with the number of conversations carrying each. vocabularyOnly leaves
+// out free tags.
+func (s *Service) List(vocabularyOnly bool) ([]Tag, error) {
+	query := s.db.Table("tags").
+		Select("tags.id, tags.name, tags.vocabulary, tags.created_at, COUNT(conversation_tags.id) AS conversation_count").
+		Joins("LEFT JOIN conversation_tags ON conversation_tags.tag_id = tags.id").
+		Group("tags.id, tags.name, tags.vocabulary, tags.created_at").
+		Order("tags.name ASC")
+	if vocabularyOnly {
+		query = query.Where("tags.vocabulary = ?", true)
+	}
+	tags := make([]Tag, 0)
+	if err := query.Scan(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// Create adds a tag to the vocabulary on behalf of the auth user actorID. A free tag of the same
+// name joins the vocabulary, keeping its conversations.
+func (s *Service) Create(name string, actorID uint) (*models.Tag, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var tag models.Tag
+	err = s.db.Where("name = ?", name).First(&tag).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		tag = models.Tag{Name: name, Vocabulary: true, CreatedBy: actorOrNil(actorID)}
+		if err := s.db.Create(&tag).Error; err != nil {
+			return nil, fmt.Errorf("failed to create tag: %w", err)
+		}
+		return &tag, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to load tag: %w", err)
+	case tag.Vocabulary:
+		return nil, ErrTagExists
+	}
+	if err := s.db.Model(&tag).Update("vocabulary", true).Error; err != nil {
+		return nil, fmt.Errorf("failed to add tag to the vocabulary: %w", err)
+	}
+	return &tag, nil
+}
+
+// Delete removes the tag and takes it off every conversation. It returns the deleted tag.
+func (s *Service) Delete(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&tag, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTagNotFound
+			}
+			return fmt.Errorf("failed to load tag: %w", err)
+		}
+		if err := tx.Where("tag_id = ?", id).Delete(&models.ConversationTag{}).Error; err != nil {
+			return fmt.Errorf("failed to untag conversations: %w", err)
+		}
+		if err := tx.Delete(&tag).Error; err != nil {
+			return fmt.Errorf("failed to delete tag: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// ForConversation returns the conversation's tags by name.
+func (s *Service) ForConversation(conversationID uint) ([]ConversationTag, error) {
+	tags := make([]ConversationTag, 0)
+	err := s.db.Table("conversation_tags").
+		Select("tags.id, tags.name, tags.vocabulary, conversation_tags.source, conversation_tags.added_by, conversation_tags.created_at AS added_at").
+		Joins("JOIN tags ON tags.id = conversation_tags.tag_id").
+		Where("conversation_tags.conversation_id = ?", conversationID).
+		Order("tags.name ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation tags: %w", err)
+	}
+	return tags, nil
+}
+
+// NamesForConversations returns the tag names of each conversation, sorted.
+func (s *Service) NamesForConversations(conversationIDs []uint) (map[uint][]string, error) {
+	names := make(map[uint][]string, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return names, nil
+	}
+	var rows []struct {
+		ConversationID uint
+		Name           string
+	}
+	err := s.db.Table("conversation_tags").
+		Select("conversation_tags.conversation_id, tags.name").
+		Joins("JOIN tags ON tags.id = conversation_tags.tag_id").
+		Where("conversation_tags.conversation_id IN ?", conversationIDs).
+		Order("tags.name ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation tags: %w", err)
+	}
+	for _, row := range rows {
+		names[row.ConversationID] = append(names[row.ConversationID], row.Name)
+	}
+	return names, nil
+}
+
+// Add tags the conversation on behalf of the auth user actorID, creating free tags for unknown
+// names. Adding a suggested tag confirms it as a manual one.
+func (s *Service) Add(conversationID uint, names []string, actorID uint) error {
+	if len(names) > MaxPerRequest {
+		return ErrTooManyTags
+	}
+	normalized, err := NormalizeNames(names)
+	if err != nil {
+		return err
+	}
+	if len(normalized) == 0 {
+		return ErrInvalidName
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Conversation{}).Where("id = ?", conversationID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to load conversation: %w", err)
+	}
+	if count == 0 {
+		return ErrConversationNotFound
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range normalized {
+			tag := models.Tag{CreatedBy: actorOrNil(actorID)}
+			if err := tx.Where(models.Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+				return fmt.Errorf("failed to create tag %q: %w", name, err)
+			}
+			created, err := attach(tx, models.ConversationTag{
+				ConversationID: conversationID,
+				TagID:          tag.ID,
+				Source:         models.TagSourceManual,
+				AddedBy:        actorOrNil(actorID),
+			})
+			if err != nil {
+				return err
+			}
+			if created {
+				continue
+			}
+			if err := tx.Model(&models.ConversationTag{}).
+				Where("conversation_id = ? AND tag_id = ? AND source = ?", conversationID, tag.ID, models.TagSourceSuggested).
+				Updates(map[string]any{"source": models.TagSourceManual, "added_by": actorOrNil(actorID)}).Error; err != nil {
+				return fmt.Errorf("failed to confirm tag %q: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Remove takes the tag off the conversation.
+func (s *Service) Remove(conversationID, tagID uint) error {
+	result := s.db.Where("conversation_id = ? AND tag_id = ?", conversationID, tagID).Delete(&models.ConversationTag{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove tag: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotTagged
+	}
+	return nil
+}
+
+// Suggest asks the suggester for vocabulary tags that fit the conversation and adds the ones it
+// does not have yet as suggested tags. It returns the names added.
+func (s *Service) Suggest(conversation models.Conversation) ([]string, error) {
+	var vocabulary []models.Tag
+	if err := s.db.Where("vocabulary = ?", true).Order("name ASC").Find(&vocabulary).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tag vocabulary: %w", err)
+	}
+	if len(vocabulary) == 0 || s.suggester == nil {
+		return nil, nil
+	}
+	byName := make(map[string]uint, len(vocabulary))
+	names := make([]string, 0, len(vocabulary))
+	for _, tag := range vocabulary {
+		byName[tag.Name] = tag.ID
+		names = append(names, tag.Name)
+	}
+
+	suggested, err := s.suggester.SuggestTags(conversation, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest tags: %w", err)
+	}
+
+	added := make([]string, 0)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range suggested {
+			name, err := NormalizeName(name)
+			if err != nil {
+				continue
+			}
+			tagID, ok := byName[name]
+			if !ok {
+				continue
+			}
+			delete(byName, name)
+			created, err := attach(tx, models.ConversationTag{ConversationID: conversation.ID, TagID: tagID, Source: models.TagSourceSuggested})
+			if err != nil {
+				return err
+			}
+			if created {
+				added = append(added, name)
+			}
+			if len(added) == maxSuggestions {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(added)
+	return added, nil
+}
+
+// attach adds the link unless the conversation already has the tag, and reports whether it did.
+func attach(tx *gorm.DB, link models.ConversationTag) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "conversation_id"}, {Name: "tag_id"}},
+		DoNothing: true,
+	}).Create(&link)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to tag conversation: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func actorOrNil(actorID uint) *uint {
+	if actorID == 0 {
+		return nil
+	}
+	return &actorID
+}
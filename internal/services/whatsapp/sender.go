@@ -0,0 +1,73 @@
+package whatsapp
+
+import (
+	"strings"
+
+	"smart-chat/config"
+	"smart-chat/external/notification"
+	cloudapi "smart-chat/external/whatsapp"
+)
+
+const (
+	SenderGraph        = "graph"
+	SenderNotification = "notification"
+)
+
+// OutboundMessage is a bot reply addressed to a WhatsApp user.
+type OutboundMessage struct {
+	ConversationID uint
+	WaID           string
+	Mobile         string
+	UserInput      string
+	Text           string
+}
+
+// OutboundSender delivers replies to WhatsApp users. Send returns the provider message ID
+// when the provider exposes one, so delivery statuses can be matched later.
+type OutboundSender interface {
+	Send(message OutboundMessage) (string, error)
+}
+
+// GraphSender replies directly through the WhatsApp Cloud API.
+type GraphSender struct {
+	client *cloudapi.Client
+}
+
+func NewGraphSender(client *cloudapi.Client) *GraphSender {
+	return &GraphSender{client: client}
+}
+
+func (s *GraphSender) Send(message OutboundMessage) (string, error) {
+	return s.client.SendTextMessage(message.WaID, message.Text)
+}
+
+// NotificationSender hands replies to the notification service, which owns the
+// WhatsApp Business integration in deployments that do not talk to Meta directly.
+type NotificationSender struct {
+	client *notification.Client
+}
+
+func NewNotificationSender(client *notification.Client) *NotificationSender {
+	return &NotificationSender{client: client}
+}
+
+func (s *NotificationSender) Send(message OutboundMessage) (string, error) {
+	payload := notification.Payload{
+		ConversationID: message.ConversationID,
+		Mobile:         message.Mobile,
+		MessagePair: notification.MessagePair{
+			User: message.UserInput,
+			Bot:  message.Text,
+		},
+	}
+	return "", s.client.SendMessageEvent(payload)
+}
+
+// NewOutboundSender picks the sender configured by WhatsAppOutboundSender.
+// Anything other than "graph" falls back to the notification service.
+func NewOutboundSender(cfg *config.Config, notifClient *notification.Client) OutboundSender {
+	if strings.EqualFold(strings.TrimSpace(cfg.WhatsAppOutboundSender), SenderGraph) {
+		return NewGraphSender(cloudapi.NewClient(cfg.WhatsAppGraphBaseURL, cfg.WhatsAppPhoneNumberID, cfg.WhatsAppAccessToken))
+	}
+	return NewNotificationSender(notifClient)
+}
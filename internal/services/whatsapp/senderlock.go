@@ -0,0 +1,84 @@
+package whatsapp
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"sync"
+)
+
+// senderLocks hands out one mutex per wa_id, dropping it once nobody holds or waits for it.
+type senderLocks struct {
+	mu    sync.Mutex
+	locks map[string]*senderLock
+}
+
+type senderLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newSenderLocks() *senderLocks {
+	return &senderLocks{locks: make(map[string]*senderLock)}
+}
+
+func (l *senderLocks) lock(waID string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[waID]
+	if !ok {
+		lock = &senderLock{}
+		l.locks[waID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, waID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// lockSender serialises processing for one sender: within this instance with a mutex and, on
+// Postgres, across instances with an advisory lock on the sender's mobile. The advisory lock is
+// held on a dedicated connection until the returned function releases it.
+func (s *WhatsAppService) lockSender(waID string) (func(), error) {
+	release := s.senders.lock(waID)
+	if s.db.Dialector.Name() != "postgres" {
+		return release, nil
+	}
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// The two-key form keeps these locks apart from other advisory locks taken on a mobile.
+	mobile := MobileFromWaID(waID)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext('whatsapp_sender'), hashtext($1))", mobile); err != nil {
+		conn.Close()
+		release()
+		return nil, err
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext('whatsapp_sender'), hashtext($1))", mobile); err != nil {
+			log.Printf("failed to release whatsapp sender lock for %s: %v", waID, err)
+			// Drop the connection so the lock ends with its session instead of returning to the pool.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+		release()
+	}, nil
+}
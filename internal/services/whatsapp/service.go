@@ -0,0 +1,621 @@
+package whatsapp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"smart-chat/config"
+	cloudapi "smart-chat/external/whatsapp"
+	"smart-chat/internal/constants"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/slack"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionWindow mirrors WhatsApp's customer service window: messages within it continue
+// the same session (and therefore the same conversation).
+const SessionWindow = 24 * time.Hour
+
+// Statuses of inbound messages: received when stored, processing while a run holds them, then
+// processed or failed.
+const (
+	inboundReceived   = "received"
+	inboundProcessing = "processing"
+	inboundProcessed  = "processed"
+	inboundFailed     = "failed"
+)
+
+const (
+	// maxInboundAttempts is how many runs an inbound message gets before it is left as failed.
+	maxInboundAttempts = 3
+	// staleInboundAfter is how long a stored message may wait, or a run may hold it, before
+	// RetryPending takes it over.
+	staleInboundAfter = 10 * time.Minute
+)
+
+const unsupportedMessageReply = "Sorry, I couldn't read that message. Please type your question, or send a photo, voice note, document or location."
+
+// ConversationHandler runs a user message through the conversation pipeline.
+// *conversation.ConversationService satisfies it.
+type ConversationHandler interface {
+	HandleSessionWithAttachments(sessionID uint, userInput string, attachmentIDs []uint, messageType models.MessageType, whatsapp bool) (string, error)
+}
+
+// KeywordHandler answers opt-out style keywords (STOP/START) before they reach the LLM.
+// *reengagement.ReengagementService satisfies it.
+type KeywordHandler interface {
+	HandleKeyword(userID uint, text string) (string, bool)
+}
+
+// MediaDownloader fetches the content of inbound media. *cloudapi.Client satisfies it.
+type MediaDownloader interface {
+	DownloadMedia(mediaID string) (io.ReadCloser, string, error)
+}
+
+// inboundPayload is what is kept of an inbound message to process it later.
+type inboundPayload struct {
+	Name    string           `json:"name"`
+	Message cloudapi.Message `json:"message"`
+}
+
+// WhatsAppService handles the native WhatsApp Cloud API webhook: subscription verification,
+// signature validation, mapping senders to users and sessions, and replying through an OutboundSender.
+type WhatsAppService struct {
+	db            *gorm.DB
+	verifyToken   string
+	appSecret     string
+	conversations ConversationHandler
+	sender        OutboundSender
+	media         MediaDownloader
+	attachments   *attachment.Service
+	keywords      KeywordHandler
+	slackService  *slack.SlackService
+	inbox         *inbox.Publisher
+	senders       *senderLocks
+}
+
+// NewWhatsAppService returns a new WhatsAppService. Inbound media is downloaded from the Graph API
+// configured in cfg and stored through attachments.
+func NewWhatsAppService(cfg *config.Config, db *gorm.DB, conversations ConversationHandler, sender OutboundSender, attachments *attachment.Service, keywords KeywordHandler, slackService *slack.SlackService) *WhatsAppService {
+	return &WhatsAppService{
+		db:            db,
+		verifyToken:   cfg.WhatsAppVerifyToken,
+		appSecret:     cfg.WhatsAppAppSecret,
+		conversations: conversations,
+		sender:        sender,
+		media:         cloudapi.NewClient(cfg.WhatsAppGraphBaseURL, cfg.WhatsAppPhoneNumberID, cfg.WhatsAppAccessToken),
+		attachments:   attachments,
+		keywords:      keywords,
+		slackService:  slackService,
+		inbox:         inbox.NewPublisher(db),
+		senders:       newSenderLocks(),
+	}
+}
+
+// VerifySubscription answers Meta's webhook verification challenge.
+// It returns the challenge to echo back and whether the request is valid.
+func (s *WhatsAppService) VerifySubscription(mode, token, challenge string) (string, bool) {
+	if mode != "subscribe" || s.verifyToken == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(token), []byte(s.verifyToken)) {
+		return "", false
+	}
+	return challenge, true
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header against the raw request body.
+func (s *WhatsAppService) VerifySignature(body []byte, signatureHeader string) bool {
+	if s.appSecret == "" {
+		return false
+	}
+
+	signature, found := strings.CutPrefix(strings.TrimSpace(signatureHeader), "sha256=")
+	if !found {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.appSecret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// StoreWebhook records the delivery statuses and inbound messages of a webhook payload and returns
+// the senders that have new messages to process. It runs before Meta is acknowledged: an error means
+// nothing was lost yet and the delivery should be retried.
+func (s *WhatsAppService) StoreWebhook(payload cloudapi.WebhookPayload) ([]string, error) {
+	var senders []string
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			if change.Field != "messages" {
+				continue
+			}
+
+			for _, status := range change.Value.Statuses {
+				s.updateOutboundStatus(status)
+			}
+
+			for _, message := range change.Value.Messages {
+				stored, err := s.storeInbound(contactName(change.Value.Contacts, message.From), message)
+				if err != nil {
+					return nil, err
+				}
+				if stored && !slices.Contains(senders, message.From) {
+					senders = append(senders, message.From)
+				}
+			}
+		}
+	}
+	return senders, nil
+}
+
+// ProcessSenders runs the pending inbound messages of each sender, oldest first.
+// Errors for individual messages are logged and alerted; the first one is returned.
+func (s *WhatsAppService) ProcessSenders(waIDs []string) error {
+	var firstErr error
+	for _, waID := range waIDs {
+		if err := s.processSender(waID, false); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ProcessWebhook stores a webhook payload and processes it before returning.
+func (s *WhatsAppService) ProcessWebhook(payload cloudapi.WebhookPayload) error {
+	senders, err := s.StoreWebhook(payload)
+	if err != nil {
+		return err
+	}
+	return s.ProcessSenders(senders)
+}
+
+// RetryPending picks up inbound messages that failed, or that were stored but never finished because
+// an instance stopped, and processes them again. A message is tried at most maxInboundAttempts times.
+// It runs from cron.
+func (s *WhatsAppService) RetryPending() {
+	stale := time.Now().Add(-staleInboundAfter)
+	var waIDs []string
+	err := s.db.Model(&models.WhatsAppMessage{}).
+		Where("direction = ?", models.WhatsAppDirectionInbound).
+		Where("(status = ? AND attempts < ?) OR (status IN ? AND updated_at < ?)",
+			inboundFailed, maxInboundAttempts, []string{inboundReceived, inboundProcessing}, stale).
+		Distinct().
+		Pluck("wa_id", &waIDs).Error
+	if err != nil {
+		log.Printf("failed to find pending whatsapp messages: %v", err)
+		return
+	}
+
+	for _, waID := range waIDs {
+		if err := s.processSender(waID, true); err != nil {
+			log.Printf("failed to retry whatsapp messages from %s: %v", waID, err)
+		}
+	}
+}
+
+// storeInbound records an inbound message with its payload. It reports false for a message that was
+// already stored, since Meta redelivers messages it did not see acknowledged in time.
+func (s *WhatsAppService) storeInbound(name string, message cloudapi.Message) (bool, error) {
+	if strings.TrimSpace(message.ID) == "" || strings.TrimSpace(message.From) == "" {
+		// Retrying the delivery would not fix it, so drop the message rather than fail the webhook.
+		log.Printf("skipping whatsapp message without id or sender: %+v", message)
+		return false, nil
+	}
+
+	payload, err := json.Marshal(inboundPayload{Name: name, Message: message})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode whatsapp message %s: %w", message.ID, err)
+	}
+	inbound := models.WhatsAppMessage{
+		WAMessageID: message.ID,
+		WaID:        message.From,
+		Direction:   models.WhatsAppDirectionInbound,
+		Status:      inboundReceived,
+		Payload:     payload,
+	}
+	result := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "wa_message_id"}},
+		DoNothing: true,
+	}).Create(&inbound)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to store whatsapp message %s: %w", message.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("skipping duplicate whatsapp message %s", message.ID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// processSender runs a sender's received messages one at a time, oldest first, holding the sender
+// lock so concurrent deliveries for one wa_id neither create duplicate users or sessions nor run
+// overlapping LLM turns. With retry set, failed messages that have attempts left are run again.
+func (s *WhatsAppService) processSender(waID string, retry bool) error {
+	unlock, err := s.lockSender(waID)
+	if err != nil {
+		return fmt.Errorf("failed to lock whatsapp sender %s: %w", waID, err)
+	}
+	defer unlock()
+
+	// Holding the lock, nothing else is running this sender's messages: one still marked processing
+	// was interrupted and counts as a failed attempt.
+	err = s.db.Model(&models.WhatsAppMessage{}).
+		Where("wa_id = ? AND direction = ? AND status = ?", waID, models.WhatsAppDirectionInbound, inboundProcessing).
+		Updates(map[string]any{"status": inboundFailed, "attempts": gorm.Expr("attempts + 1")}).Error
+	if err != nil {
+		return fmt.Errorf("failed to reset interrupted whatsapp messages: %w", err)
+	}
+	if retry {
+		err = s.db.Model(&models.WhatsAppMessage{}).
+			Where("wa_id = ? AND direction = ? AND status = ? AND attempts < ?", waID, models.WhatsAppDirectionInbound, inboundFailed, maxInboundAttempts).
+			Update("status", inboundReceived).Error
+		if err != nil {
+			return fmt.Errorf("failed to requeue whatsapp messages: %w", err)
+		}
+	}
+
+	var firstErr error
+	for {
+		var inbound models.WhatsAppMessage
+		err := s.db.
+			Where("wa_id = ? AND direction = ? AND status = ?", waID, models.WhatsAppDirectionInbound, inboundReceived).
+			Order("id").
+			First(&inbound).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return firstErr
+		}
+		if err != nil {
+			return err
+		}
+
+		claimed := s.db.Model(&models.WhatsAppMessage{}).
+			Where("id = ? AND status = ?", inbound.ID, inboundReceived).
+			Update("status", inboundProcessing)
+		if claimed.Error != nil {
+			return fmt.Errorf("failed to claim whatsapp message %s: %w", inbound.WAMessageID, claimed.Error)
+		}
+		if claimed.RowsAffected == 0 {
+			continue
+		}
+
+		if err := s.handleMessage(inbound); err != nil {
+			log.Printf("failed to handle whatsapp message %s: %v", inbound.WAMessageID, err)
+			s.alert(fmt.Sprintf("Failed to handle WhatsApp message *%s*: %v", inbound.WAMessageID, err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+}
+
+func (s *WhatsAppService) handleMessage(inbound models.WhatsAppMessage) error {
+	var payload inboundPayload
+	if err := json.Unmarshal(inbound.Payload, &payload); err != nil {
+		s.markInbound(inbound.ID, inboundFailed, 0, 0)
+		return fmt.Errorf("failed to decode stored message: %w", err)
+	}
+	message := payload.Message
+
+	session, isNew, err := s.resolveSession(message.From, payload.Name)
+	if err != nil {
+		s.markInbound(inbound.ID, inboundFailed, 0, 0)
+		return err
+	}
+	if isNew && s.slackService != nil {
+		s.slackService.NotifyNewConversation(*session, true)
+	}
+
+	conversation := models.Conversation{SessionID: session.ID}
+	created := s.db.FirstOrCreate(&conversation, models.Conversation{SessionID: session.ID})
+	if created.Error != nil {
+		s.markInbound(inbound.ID, inboundFailed, session.ID, 0)
+		return fmt.Errorf("failed to load conversation for session %d: %w", session.ID, created.Error)
+	}
+	if created.RowsAffected == 1 {
+		s.inbox.Publish(inbox.EventConversationCreated, conversation.ID, map[string]any{"session_id": session.ID})
+	}
+	conversationID := conversation.ID
+
+	userInput := messageText(message)
+	attachmentIDs, err := s.saveAttachments(conversationID, message)
+	if err != nil {
+		log.Printf("failed to store media for whatsapp message %s: %v", message.ID, err)
+		s.alert(fmt.Sprintf("Failed to store media for WhatsApp message *%s*: %v", message.ID, err))
+	}
+
+	reply := unsupportedMessageReply
+	if keywordReply, handled := s.handleKeyword(session.UserID, message, userInput); handled {
+		reply = keywordReply
+	} else if userInput != "" || len(attachmentIDs) > 0 {
+		response, err := s.conversations.HandleSessionWithAttachments(session.ID, userInput, attachmentIDs, models.MessageTypeUserSent, true)
+		if err != nil {
+			s.markInbound(inbound.ID, inboundFailed, session.ID, conversationID)
+			return fmt.Errorf("failed to handle session %d: %w", session.ID, err)
+		}
+		reply = responseContent(response)
+	}
+
+	// The turn is recorded from here on, so a failed send is not retried: that would run the LLM again.
+	s.markInbound(inbound.ID, inboundProcessed, session.ID, conversationID)
+
+	if strings.TrimSpace(reply) == "" {
+		return nil
+	}
+
+	messageID, err := s.sender.Send(OutboundMessage{
+		ConversationID: conversationID,
+		WaID:           message.From,
+		Mobile:         session.User.Mobile,
+		UserInput:      userInput,
+		Text:           reply,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send reply for conversation %d: %w", conversationID, err)
+	}
+
+	if messageID != "" {
+		outbound := models.WhatsAppMessage{
+			WAMessageID:    messageID,
+			WaID:           message.From,
+			Direction:      models.WhatsAppDirectionOutbound,
+			SessionID:      session.ID,
+			ConversationID: conversationID,
+			Status:         "sent",
+		}
+		if err := s.db.Create(&outbound).Error; err != nil {
+			log.Printf("failed to record outbound whatsapp message %s: %v", messageID, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveSession maps a wa_id to a User and an active WhatsApp Session, creating either when missing.
+// The returned flag is true when a new session (and therefore a new conversation) was started.
+func (s *WhatsAppService) resolveSession(waID, name string) (*models.Session, bool, error) {
+	mobile := MobileFromWaID(waID)
+	now := time.Now()
+
+	user, err := s.findOrCreateUser(mobile, name, now)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var session models.Session
+	err = s.db.
+		Where("user_id = ? AND source = ? AND expire_at > ? AND revoked_at IS NULL", user.ID, constants.WhatsAppSource, now).
+		Order("created_at desc").
+		First(&session).Error
+	isNew := false
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		session = models.Session{
+			UserID:   user.ID,
+			Source:   constants.WhatsAppSource,
+			ExpireAt: now.Add(SessionWindow),
+		}
+		if err := s.db.Create(&session).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to create session: %w", err)
+		}
+		isNew = true
+	case err != nil:
+		return nil, false, err
+	default:
+		if err := s.db.Model(&session).Update("expire_at", now.Add(SessionWindow)).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to extend session: %w", err)
+		}
+	}
+
+	session.User = user
+	return &session, isNew, nil
+}
+
+// findOrCreateUser returns the live user with mobile, creating it when missing.
+// idx_users_mobile_unique refuses a second row for the same mobile, so a failed create
+// is retried as a lookup.
+func (s *WhatsAppService) findOrCreateUser(mobile, name string, now time.Time) (models.User, error) {
+	var user models.User
+	err := s.db.Where("mobile = ?", mobile).First(&user).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name = mobile
+	}
+	user = models.User{
+		Name:           name,
+		Mobile:         mobile,
+		AccessExpireAt: now,
+	}
+	if err := s.db.Create(&user).Error; err != nil {
+		var existing models.User
+		if s.db.Where("mobile = ?", mobile).First(&existing).Error == nil {
+			return existing, nil
+		}
+		return user, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// saveAttachments stores the media or location carried by an inbound message and returns the attachment IDs.
+func (s *WhatsAppService) saveAttachments(conversationID uint, message cloudapi.Message) ([]uint, error) {
+	if s.attachments == nil {
+		return nil, nil
+	}
+
+	if message.Type == "location" && message.Location != nil {
+		name := message.Location.Name
+		if name == "" {
+			name = message.Location.Address
+		}
+		location, err := s.attachments.CreateLocation(attachment.LocationInput{
+			ConversationID: conversationID,
+			UploadedBy:     models.AttachmentUploaderUser,
+			Latitude:       message.Location.Latitude,
+			Longitude:      message.Location.Longitude,
+			Name:           name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []uint{location.ID}, nil
+	}
+
+	media := messageMedia(message)
+	if media == nil {
+		return nil, nil
+	}
+
+	body, mimeType, err := s.media.DownloadMedia(media.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if mimeType == "" {
+		mimeType = media.MimeType
+	}
+	stored, err := s.attachments.Upload(context.Background(), attachment.UploadInput{
+		ConversationID:   conversationID,
+		UploadedBy:       models.AttachmentUploaderUser,
+		FileName:         media.Filename,
+		DeclaredMimeType: mimeType,
+		Body:             body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []uint{stored.ID}, nil
+}
+
+func (s *WhatsAppService) markInbound(id uint, status string, sessionID, conversationID uint) {
+	updates := map[string]any{"status": status}
+	if status == inboundFailed {
+		updates["attempts"] = gorm.Expr("attempts + 1")
+	}
+	if sessionID != 0 {
+		updates["session_id"] = sessionID
+	}
+	if conversationID != 0 {
+		updates["conversation_id"] = conversationID
+	}
+	if err := s.db.Model(&models.WhatsAppMessage{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		log.Printf("failed to update whatsapp message %d: %v", id, err)
+	}
+}
+
+func (s *WhatsAppService) updateOutboundStatus(status cloudapi.Status) {
+	if status.ID == "" || status.Status == "" {
+		return
+	}
+	err := s.db.Model(&models.WhatsAppMessage{}).
+		Where("wa_message_id = ? AND direction = ?", status.ID, models.WhatsAppDirectionOutbound).
+		Update("status", status.Status).Error
+	if err != nil {
+		log.Printf("failed to update status for whatsapp message %s: %v", status.ID, err)
+	}
+}
+
+func (s *WhatsAppService) handleKeyword(userID uint, message cloudapi.Message, userInput string) (string, bool) {
+	if s.keywords == nil || message.Type != "text" {
+		return "", false
+	}
+	return s.keywords.HandleKeyword(userID, userInput)
+}
+
+func (s *WhatsAppService) alert(message string) {
+	if s.slackService != nil {
+		s.slackService.SendSlackAlertAsync(message)
+	}
+}
+
+// MobileFromWaID converts a wa_id (country code and number, no plus sign) to the
+// E.164 format stored in users.mobile.
+func MobileFromWaID(waID string) string {
+	return "+" + strings.TrimPrefix(strings.TrimSpace(waID), "+")
+}
+
+func contactName(contacts []cloudapi.Contact, waID string) string {
+	for _, contact := range contacts {
+		if contact.WaID == waID {
+			return strings.TrimSpace(contact.Profile.Name)
+		}
+	}
+	return ""
+}
+
+// messageText returns the text of a message, or the caption of a media message.
+func messageText(message cloudapi.Message) string {
+	if media := messageMedia(message); media != nil {
+		return strings.TrimSpace(media.Caption)
+	}
+
+	switch message.Type {
+	case "text":
+		if message.Text != nil {
+			return strings.TrimSpace(message.Text.Body)
+		}
+	case "button":
+		if message.Button != nil {
+			return strings.TrimSpace(message.Button.Text)
+		}
+	case "interactive":
+		if message.Interactive == nil {
+			return ""
+		}
+		if message.Interactive.ButtonReply != nil {
+			return strings.TrimSpace(message.Interactive.ButtonReply.Title)
+		}
+		if message.Interactive.ListReply != nil {
+			return strings.TrimSpace(message.Interactive.ListReply.Title)
+		}
+	}
+	return ""
+}
+
+func messageMedia(message cloudapi.Message) *cloudapi.Media {
+	switch message.Type {
+	case "image":
+		return message.Image
+	case "audio":
+		return message.Audio
+	case "video":
+		return message.Video
+	case "document":
+		return message.Document
+	case "sticker":
+		return message.Sticker
+	}
+	return nil
+}
+
+// responseContent extracts the text from the {"content": "..."} JSON the WhatsApp prompt returns.
+func responseContent(response string) string {
+	var parsed struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
+		return response
+	}
+	return parsed.Content
+}
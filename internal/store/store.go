@@ -241,3 +241,20 @@ func removeKeyFromList(key string) error {
 
 	return mc.Set(&memcache.Item{Key: conversationKeysList, Value: data})
 }
+
+// Memcache exposes the conversation functions of this package as a value, for callers that
+// take an interface.
+type Memcache struct{}
+
+// FetchAllConversations returns no conversations, rather than an error, when the keys list is gone.
+func (Memcache) FetchAllConversations() ([]Conversation, error) {
+	conversations, err := FetchAllConversations()
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, nil
+	}
+	return conversations, err
+}
+
+func (Memcache) DeleteConversation(accessToken string) error {
+	return DeleteConversation(accessToken)
+}
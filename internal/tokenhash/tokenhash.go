@@ -0,0 +1,159 @@
+// Package tokenhash stores bearer tokens (session tokens, access tokens, OTP challenge tokens) as
+// keyed hashes, so a database snapshot cannot be replayed as live credentials.
+//
+// A stored hash looks like "<pepper id>$<hex HMAC-SHA256>". Peppers come from config as an ordered
+// list: the first one hashes new tokens and the rest are only accepted for lookups. To rotate,
+// prepend a new pepper and keep the old ones until the sessions hashed with them have expired;
+// every hit on an old pepper, or on a token still stored in plaintext, is rewritten with the
+// current pepper by Upgrade.
+package tokenhash
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"smart-chat/config"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const separator = "$"
+
+// Pepper is one HMAC key. Its ID is stored with each hash so the key can be retired later.
+type Pepper struct {
+	ID  string
+	Key []byte
+}
+
+// Hasher hashes tokens with the current pepper and looks them up under every configured pepper.
+type Hasher struct {
+	peppers []Pepper
+}
+
+// New parses a comma-separated list of id:secret peppers, current pepper first.
+func New(spec string) (*Hasher, error) {
+	var peppers []Pepper
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || key == "" {
+			return nil, errors.New("token pepper must be in id:secret form")
+		}
+		if strings.Contains(id, separator) {
+			return nil, fmt.Errorf("token pepper id %q must not contain %q", id, separator)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate token pepper id %q", id)
+		}
+		seen[id] = true
+		peppers = append(peppers, Pepper{ID: id, Key: []byte(key)})
+	}
+	if len(peppers) == 0 {
+		return nil, errors.New("at least one token pepper is required")
+	}
+	return &Hasher{peppers: peppers}, nil
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultHasher *Hasher
+)
+
+// Default returns the Hasher for cfg.TokenPeppers. Invalid peppers are fatal, as starting
+// without them would lock every user out.
+func Default() *Hasher {
+	defaultOnce.Do(func() {
+		hasher, err := New(config.Load().TokenPeppers)
+		if err != nil {
+			log.Fatalf("Failed to configure token hashing: %v", err)
+		}
+		defaultHasher = hasher
+	})
+	return defaultHasher
+}
+
+// Hash returns the stored form of token under the current pepper.
+func (h *Hasher) Hash(token string) string {
+	return hashWith(h.peppers[0], token)
+}
+
+// Candidates returns every stored form token may have: its hash under each pepper and, for
+// tokens issued before hashing, the token itself. A value already in hashed form is never
+// matched verbatim, so a leaked hash cannot be presented as a token.
+func (h *Hasher) Candidates(token string) []string {
+	candidates := make([]string, 0, len(h.peppers)+1)
+	for _, pepper := range h.peppers {
+		candidates = append(candidates, hashWith(pepper, token))
+	}
+	if !IsHash(token) {
+		candidates = append(candidates, token)
+	}
+	return candidates
+}
+
+// NeedsUpgrade reports whether a stored value is plaintext or hashed with a pepper other than the current one.
+func (h *Hasher) NeedsUpgrade(stored string) bool {
+	return !strings.HasPrefix(stored, h.peppers[0].ID+separator)
+}
+
+// Where scopes db to rows whose column holds token in any stored form. The query is logged
+// without its parameters.
+func (h *Hasher) Where(db *gorm.DB, column, token string) *gorm.DB {
+	return Quiet(db).Where(column+" IN ?", h.Candidates(token))
+}
+
+// Upgrade rewrites column of model, which was found through Where, to the current hash.
+// model must carry its primary key.
+func (h *Hasher) Upgrade(db *gorm.DB, model any, column, stored, token string) error {
+	if !h.NeedsUpgrade(stored) {
+		return nil
+	}
+	return Quiet(db).Model(model).Where(column+" = ?", stored).UpdateColumn(column, h.Hash(token)).Error
+}
+
+// Quiet returns db with a logger that leaves query parameters out of SQL logs, for queries
+// that carry tokens.
+func Quiet(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{Logger: quietLogger{db.Logger}})
+}
+
+type quietLogger struct {
+	logger.Interface
+}
+
+func (l quietLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return quietLogger{l.Interface.LogMode(level)}
+}
+
+func (quietLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// IsHash reports whether value has the stored hash shape.
+func IsHash(value string) bool {
+	_, sum, ok := strings.Cut(value, separator)
+	if !ok || len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+func hashWith(pepper Pepper, token string) string {
+	mac := hmac.New(sha256.New, pepper.Key)
+	mac.Write([]byte(token))
+	return pepper.ID + separator + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,9 @@
+-- Keyset pagination for the conversations list (?cursor=) seeks on (created_at, id) in either
+-- direction; this index serves the seek and the ORDER BY together with the soft-delete filter.
+DO $$
+BEGIN
+    IF to_regclass('public.conversations') IS NOT NULL THEN
+        CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at_created_at_id
+            ON public.conversations (deleted_at, created_at, id);
+    END IF;
+END $$;
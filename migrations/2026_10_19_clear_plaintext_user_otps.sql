@@ -0,0 +1,7 @@
+-- Login codes now live hashed in otp_challenges; drop the plaintext codes left on users.
+DO $$
+BEGIN
+    IF to_regclass('public.users') IS NOT NULL THEN
+        UPDATE users SET otp = '' WHERE otp <> '';
+    END IF;
+END $$;
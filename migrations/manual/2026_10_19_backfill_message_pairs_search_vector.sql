@@ -0,0 +1,28 @@
+-- Out-of-band step for message_pairs.search_vector. Startup does not run this directory.
+-- Run it with psql once the service has started with migrations/post/2026_10_19_add_message_pairs_search_vector.sql,
+-- so new and edited messages are already covered by the trigger:
+--
+--   psql "$DATABASE_URL" -f migrations/manual/2026_10_19_backfill_message_pairs_search_vector.sql
+--
+-- The backfill walks the primary key in batches and commits each one, so no lock is held for
+-- long. The index is then built without blocking writes. Both steps can be rerun; if the index
+-- build fails, drop the invalid idx_message_pairs_search_vector before running it again.
+DO $$
+DECLARE
+    batch_start bigint;
+    last_id bigint;
+BEGIN
+    SELECT min(id), max(id) INTO batch_start, last_id FROM public.message_pairs;
+    WHILE batch_start <= last_id LOOP
+        UPDATE public.message_pairs
+        SET search_vector = to_tsvector('english', coalesce("user", '') || ' ' || coalesce(bot, ''))
+        WHERE id >= batch_start
+          AND id < batch_start + 5000
+          AND search_vector IS NULL;
+        COMMIT;
+        batch_start := batch_start + 5000;
+    END LOOP;
+END $$;
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_message_pairs_search_vector
+    ON public.message_pairs USING GIN (search_vector);
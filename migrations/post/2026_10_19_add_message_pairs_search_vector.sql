@@ -0,0 +1,36 @@
+-- Full-text search over message text for the conversations list (?q=).
+-- search_vector is kept up to date by a trigger instead of being a generated column, which would
+-- rewrite message_pairs under an exclusive lock. A nullable column without a default only changes
+-- the catalog, and both steps are skipped once done so startups do not lock the table again.
+-- Older rows are backfilled, and the GIN index built, out of band by
+-- migrations/manual/2026_10_19_backfill_message_pairs_search_vector.sql.
+CREATE OR REPLACE FUNCTION message_pairs_search_vector_update() RETURNS trigger AS $fn$
+BEGIN
+    NEW.search_vector := to_tsvector('english', coalesce(NEW."user", '') || ' ' || coalesce(NEW.bot, ''));
+    RETURN NEW;
+END;
+$fn$ LANGUAGE plpgsql;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1
+        FROM information_schema.columns
+        WHERE table_schema = 'public'
+          AND table_name = 'message_pairs'
+          AND column_name = 'search_vector'
+    ) THEN
+        ALTER TABLE public.message_pairs ADD COLUMN search_vector tsvector;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM pg_trigger
+        WHERE tgrelid = 'public.message_pairs'::regclass
+          AND tgname = 'message_pairs_search_vector'
+    ) THEN
+        CREATE TRIGGER message_pairs_search_vector
+            BEFORE INSERT OR UPDATE OF "user", bot ON public.message_pairs
+            FOR EACH ROW EXECUTE FUNCTION message_pairs_search_vector_update();
+    END IF;
+END $$;
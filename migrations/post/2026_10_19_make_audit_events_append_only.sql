@@ -0,0 +1,12 @@
+-- audit_events is append-only: refuse updates. Deletes stay allowed for the retention job.
+-- This runs after GORM has created audit_events, so the trigger exists from the first start.
+CREATE OR REPLACE FUNCTION audit_events_refuse_update() RETURNS trigger AS $fn$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$fn$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_refuse_update();
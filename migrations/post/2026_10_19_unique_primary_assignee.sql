@@ -0,0 +1,29 @@
+-- One primary assignee per conversation. Concurrent automatic assignments could link two, so keep
+-- the earliest primary link and demote the others, in the links and their open history periods.
+UPDATE auth_user_conversation l
+SET is_primary = FALSE
+WHERE l.is_primary
+  AND l.deleted_at IS NULL
+  AND EXISTS (
+      SELECT 1 FROM auth_user_conversation earlier
+      WHERE earlier.conversation_id = l.conversation_id
+        AND earlier.is_primary
+        AND earlier.deleted_at IS NULL
+        AND earlier.id < l.id
+  );
+
+UPDATE conversation_assignments a
+SET is_primary = FALSE
+WHERE a.is_primary
+  AND a.unassigned_at IS NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM auth_user_conversation l
+      WHERE l.conversation_id = a.conversation_id
+        AND l.auth_user_id = a.auth_user_id
+        AND l.is_primary
+        AND l.deleted_at IS NULL
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_user_conversation_primary
+    ON auth_user_conversation (conversation_id)
+    WHERE is_primary AND deleted_at IS NULL;
@@ -0,0 +1,29 @@
+-- One live user per mobile. Concurrent WhatsApp webhooks could create duplicates, so merge them
+-- into the oldest row first: move their sessions, OTP challenges and nudges over, keep the
+-- earliest opt-out, and soft-delete the rest.
+CREATE TEMP TABLE duplicate_users ON COMMIT DROP AS
+SELECT id, MIN(id) OVER (PARTITION BY mobile) AS keep_id
+FROM users
+WHERE deleted_at IS NULL;
+
+DELETE FROM duplicate_users WHERE id = keep_id;
+
+UPDATE sessions s SET user_id = d.keep_id FROM duplicate_users d WHERE s.user_id = d.id;
+UPDATE otp_challenges o SET user_id = d.keep_id FROM duplicate_users d WHERE o.user_id = d.id;
+UPDATE reengagement_nudges n SET user_id = d.keep_id FROM duplicate_users d WHERE n.user_id = d.id;
+
+UPDATE users u
+SET reengagement_opted_out_at = merged.opted_out_at
+FROM (
+    SELECT d.keep_id, MIN(dup.reengagement_opted_out_at) AS opted_out_at
+    FROM duplicate_users d
+    JOIN users dup ON dup.id = d.id
+    GROUP BY d.keep_id
+) merged
+WHERE u.id = merged.keep_id
+  AND merged.opted_out_at IS NOT NULL
+  AND (u.reengagement_opted_out_at IS NULL OR u.reengagement_opted_out_at > merged.opted_out_at);
+
+UPDATE users u SET deleted_at = NOW() FROM duplicate_users d WHERE u.id = d.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_mobile_unique ON users (mobile) WHERE deleted_at IS NULL;
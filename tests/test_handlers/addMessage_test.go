@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/conversation"
+	"smart-chat/tests/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clientConversationResponse struct {
+	ConversationHistory []struct {
+		UserMessage string `json:"UserMessage"`
+		BotMessage  string `json:"BotMessage"`
+		SentBy      string `json:"SentBy"`
+		Agent       *struct {
+			UserID uint    `json:"user_id"`
+			Name   *string `json:"name"`
+		} `json:"Agent"`
+	} `json:"conversationHistory"`
+}
+
+func TestAddMessage_AttributesAgentMessages(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-add-message-agent", "Message Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: agent.UserID, ConversationID: conv.ID}).Error)
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-add-message-agent"})
+	recorder := clientJSON(router, http.MethodPost, "/v2/client/add-message", map[string]any{
+		"conversation_id": conv.ID, "message": "I have held two seats for you",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var stored models.MessagePair
+	require.NoError(t, db.Where("conversation_id = ? AND type = ?", conv.ID, models.MessageTypeAgentAssumedAssistant).First(&stored).Error)
+	require.NotNil(t, stored.AuthorAuthUserID)
+	assert.Equal(t, agent.UserID, *stored.AuthorAuthUserID)
+
+	// The client view tells bot replies from agent messages and names the agent.
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/conversation/"+strconv.FormatUint(uint64(conv.ID), 10), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	history := decodeJSON[clientConversationResponse](t, recorder).ConversationHistory
+	require.Len(t, history, 2)
+	assert.Equal(t, "bot", history[0].SentBy)
+	assert.Nil(t, history[0].Agent)
+	assert.Equal(t, "agent", history[1].SentBy)
+	require.NotNil(t, history[1].Agent)
+	assert.Equal(t, agent.UserID, history[1].Agent.UserID)
+	require.NotNil(t, history[1].Agent.Name)
+	assert.Equal(t, "Message Agent", *history[1].Agent.Name)
+
+	// The LLM sees the agent message as a named assistant turn with no empty user turn before it.
+	messages, err := conversation.NewConversationHistory(db).FetchHistory(conv.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, openai.ChatMessageRoleUser, messages[0].Role)
+	assert.Equal(t, openai.ChatMessageRoleAssistant, messages[1].Role)
+	assert.Empty(t, messages[1].Name)
+	assert.Equal(t, openai.ChatMessageRoleAssistant, messages[2].Role)
+	assert.Equal(t, conversation.HumanAgentName, messages[2].Name)
+	assert.Equal(t, `{"content":"I have held two seats for you"}`, messages[2].Content)
+}
@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type agentStatusResponse struct {
+	Agent authUserConversation.AgentStatus `json:"agent"`
+}
+
+func TestAssignment_RoundRobinSkipsAwayAndFullAgents(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	first := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rr-first", "First Agent")
+	second := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rr-second", "Second Agent")
+	away := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rr-away", "Away Agent")
+	setupAuthUserWithRole(t, db, "VIEWER", "zitadel-rr-viewer", "Viewer")
+
+	engine := authUserConversation.NewEngine(db, authUserConversation.EngineSettings{
+		Strategy:        authUserConversation.StrategyRoundRobin,
+		Triggers:        map[authUserConversation.Trigger]bool{authUserConversation.TriggerLead: true},
+		MaxOpenPerAgent: 2,
+	})
+	_, err := engine.SetAvailability(away.UserID, "Away")
+	require.NoError(t, err)
+
+	var picked []uint
+	for i := 0; i < 5; i++ {
+		_, _, conv, _ := utils.SetupTestEntities(db)
+		agent, err := engine.AssignOn(authUserConversation.TriggerLead, conv.ID)
+		require.NoError(t, err)
+		if agent == nil {
+			picked = append(picked, 0)
+			continue
+		}
+		picked = append(picked, agent.UserID)
+	}
+	assert.Equal(t, []uint{first.UserID, second.UserID, first.UserID, second.UserID, 0}, picked)
+
+	// Disabled triggers assign nothing, and assigned conversations keep their agent.
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	agent, err := engine.AssignOn(authUserConversation.TriggerStart, conv.ID)
+	require.NoError(t, err)
+	assert.Nil(t, agent)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: away.UserID, ConversationID: conv.ID}).Error)
+	agent, err = engine.Assign(conv.ID)
+	require.NoError(t, err)
+	require.NotNil(t, agent)
+	assert.Equal(t, away.UserID, agent.UserID)
+}
+
+func TestAssignment_RulesMatchSourcePackageAndLanguage(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	general := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rules-general", "General Agent")
+	whatsappDesk := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rules-whatsapp", "WhatsApp Agent")
+	himalaya := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rules-himalaya", "Himalaya Agent")
+	hindi := setupAuthUserWithRole(t, db, "AGENT", "zitadel-rules-hindi", "Hindi Agent")
+
+	engine := authUserConversation.NewEngine(db, authUserConversation.EngineSettings{
+		Strategy: authUserConversation.StrategyRules,
+		Rules: []authUserConversation.Rule{
+			{PackageIDs: []int{42}, AgentIDs: []uint{himalaya.UserID}},
+			{Language: "hi", AgentIDs: []uint{hindi.UserID}},
+			{Source: "whatsapp", AgentIDs: []uint{whatsappDesk.UserID}},
+		},
+	})
+
+	_, session, viaWhatsApp, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Model(&session).Update("source", "whatsapp").Error)
+	_, _, lookedAtPackage, pair := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.FunctionCall{
+		ConversationID: lookedAtPackage.ID,
+		MessageID:      pair.ID,
+		Name:           "get_package_details",
+		Args:           []byte(`{"package_id":42}`),
+	}).Error)
+	_, _, inHindi, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Model(&inHindi).Update("language", "hi").Error)
+	_, _, unmatched, _ := utils.SetupTestEntities(db)
+
+	for conversationID, expected := range map[uint]uint{
+		viaWhatsApp.ID:     whatsappDesk.UserID,
+		lookedAtPackage.ID: himalaya.UserID,
+		inHindi.ID:         hindi.UserID,
+		unmatched.ID:       general.UserID,
+	} {
+		agent, err := engine.Assign(conversationID)
+		require.NoError(t, err)
+		require.NotNil(t, agent)
+		assert.Equal(t, expected, agent.UserID, "conversation %d", conversationID)
+	}
+}
+
+func TestAssignment_AgentSetsAvailability(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-availability-agent", "Availability Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: agent.UserID, ConversationID: conv.ID}).Error)
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-availability-agent"})
+
+	recorder := clientJSON(router, http.MethodGet, "/v2/client/agents/me/availability", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	status := decodeJSON[agentStatusResponse](t, recorder).Agent
+	assert.Equal(t, models.AgentAvailable, status.Availability)
+	assert.Equal(t, int64(1), status.OpenConversations)
+
+	recorder = clientJSON(router, http.MethodPatch, "/v2/client/agents/me/availability", map[string]any{"availability": "away"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, models.AgentAway, decodeJSON[agentStatusResponse](t, recorder).Agent.Availability)
+
+	var stored models.AuthUser
+	require.NoError(t, db.First(&stored, agent.UserID).Error)
+	assert.Equal(t, models.AgentAway, stored.Availability)
+	assert.NotNil(t, stored.AvailabilityChangedAt)
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ?", audit.ActionAuthUserAvailability).First(&event).Error)
+	assert.JSONEq(t, `{"availability":{"before":"available","after":"away"}}`, string(event.Changes))
+
+	recorder = clientJSON(router, http.MethodPatch, "/v2/client/agents/me/availability", map[string]any{"availability": "busy"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,195 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/handlers"
+	middleware "smart-chat/internal/middlewares"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/conversation"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x00}, 32)...)
+
+func setupChatAttachmentRouter(t *testing.T, db *gorm.DB, maxBytes int64) *gin.Engine {
+	t.Helper()
+
+	attachmentService := attachment.NewService(db, blobstore.NewLocalStore(t.TempDir()), maxBytes)
+	conversationService := conversation.NewConversationService(db)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/", middleware.AuthSessionMiddleware(db))
+	group.POST("/attachments", handlers.UploadChatAttachmentHandler(conversationService, attachmentService))
+	group.GET("/attachments/:id", handlers.GetChatAttachmentHandler(attachmentService))
+	return router
+}
+
+func multipartUpload(t *testing.T, fileName, contentType string, content []byte, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		require.NoError(t, writer.WriteField(key, value))
+	}
+	if content != nil {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, fileName))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return body, writer.FormDataContentType()
+}
+
+func uploadChatAttachment(t *testing.T, router *gin.Engine, token string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "/attachments", body)
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestUploadChatAttachmentHandler_StoresAndServesImage(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, conv, _ := utils.SetupTestEntities(db)
+	router := setupChatAttachmentRouter(t, db, 1<<20)
+
+	body, contentType := multipartUpload(t, "rohtang.png", "image/png", testPNG, map[string]string{"caption": "Rohtang pass"})
+	recorder := uploadChatAttachment(t, router, session.AuthToken, body, contentType)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	var response struct {
+		Attachment struct {
+			ID       uint   `json:"id"`
+			Kind     string `json:"kind"`
+			FileName string `json:"file_name"`
+			MimeType string `json:"mime_type"`
+		} `json:"attachment"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "image", response.Attachment.Kind)
+	assert.Equal(t, "rohtang.png", response.Attachment.FileName)
+	assert.Equal(t, "image/png", response.Attachment.MimeType)
+
+	var stored models.MessageAttachment
+	require.NoError(t, db.First(&stored, response.Attachment.ID).Error)
+	assert.Equal(t, conv.ID, stored.ConversationID)
+	assert.Nil(t, stored.MessagePairID)
+	assert.Equal(t, models.AttachmentUploaderUser, stored.UploadedBy)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/attachments/%d", stored.ID), nil)
+	req.Header.Set("Authorization", session.AuthToken)
+	download := httptest.NewRecorder()
+	router.ServeHTTP(download, req)
+
+	require.Equal(t, http.StatusOK, download.Code)
+	assert.Equal(t, "image/png", download.Header().Get("Content-Type"))
+	assert.Contains(t, download.Header().Get("Content-Disposition"), "rohtang.png")
+	assert.Equal(t, testPNG, download.Body.Bytes())
+}
+
+func TestUploadChatAttachmentHandler_RejectsUnsupportedType(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, _, _ := utils.SetupTestEntities(db)
+	router := setupChatAttachmentRouter(t, db, 1<<20)
+
+	// A declared image type does not help when the content is not an image.
+	body, contentType := multipartUpload(t, "notes.png", "image/png", []byte("#!/bin/sh\necho hello\n"), nil)
+	recorder := uploadChatAttachment(t, router, session.AuthToken, body, contentType)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+
+	var count int64
+	require.NoError(t, db.Model(&models.MessageAttachment{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestUploadChatAttachmentHandler_RejectsOversizedFile(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, _, _ := utils.SetupTestEntities(db)
+	router := setupChatAttachmentRouter(t, db, 16)
+
+	body, contentType := multipartUpload(t, "rohtang.png", "image/png", testPNG, nil)
+	recorder := uploadChatAttachment(t, router, session.AuthToken, body, contentType)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestUploadChatAttachmentHandler_StoresLocation(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, _, _ := utils.SetupTestEntities(db)
+	router := setupChatAttachmentRouter(t, db, 1<<20)
+
+	body, contentType := multipartUpload(t, "", "", nil, map[string]string{
+		"latitude":      "30.7346",
+		"longitude":     "79.0669",
+		"location_name": "Kedarnath",
+	})
+	recorder := uploadChatAttachment(t, router, session.AuthToken, body, contentType)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	var stored models.MessageAttachment
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, models.AttachmentKindLocation, stored.Kind)
+	assert.Equal(t, "Kedarnath", stored.LocationName)
+	assert.Empty(t, stored.StorageKey)
+}
+
+func TestGetChatAttachmentHandler_HidesOtherUsersAttachments(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, _, _ := utils.SetupTestEntities(db)
+	router := setupChatAttachmentRouter(t, db, 1<<20)
+
+	body, contentType := multipartUpload(t, "rohtang.png", "image/png", testPNG, nil)
+	recorder := uploadChatAttachment(t, router, session.AuthToken, body, contentType)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var stored models.MessageAttachment
+	require.NoError(t, db.First(&stored).Error)
+
+	other := models.User{Name: "Other", Mobile: "+919999999999", AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&other).Error)
+	otherSession := models.Session{UserID: other.ID, AuthToken: "other_token", ExpireAt: time.Now().Add(time.Hour)}
+	require.NoError(t, db.Create(&otherSession).Error)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/attachments/%d", stored.ID), nil)
+	req.Header.Set("Authorization", otherSession.AuthToken)
+	download := httptest.NewRecorder()
+	router.ServeHTTP(download, req)
+
+	assert.Equal(t, http.StatusNotFound, download.Code)
+}
@@ -0,0 +1,158 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"smart-chat/internal/authservice/local"
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/handlers"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/slack"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const clientTestPassword = "correct horse battery"
+
+func setupClientLoginRouter(db *gorm.DB, slackService *slack.SlackService) (*gin.Engine, *local.Service) {
+	localAuth := local.NewService(db, local.Settings{SessionTTL: time.Hour, MaxAttempts: 3, Lockout: 15 * time.Minute}, slackService)
+	// Zitadel rejects everything, so only local tokens get through.
+	validator := zitadel.Chain{localAuth, mockTokenValidator{err: errors.New("zitadel rejected token")}}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v2/client/login", handlers.ClientAdminLoginHandler(localAuth))
+	router.POST("/v2/client/logout", handlers.ClientAdminLogoutHandler(localAuth))
+	router.GET("/v2/client/agents", authorize(db, validator, rbac.AgentsRead), handlers.GetAgentsHandler(authUserConversation.NewService(db)))
+	return router, localAuth
+}
+
+func clientLogin(router *gin.Engine, username, password string) *httptest.ResponseRecorder {
+	return postAuthJSON(router, "/v2/client/login", "203.0.113.50", map[string]string{"username": username, "password": password})
+}
+
+func TestClientAdminLogin_IssuesTokenAcceptedByClientRoutes(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	admin := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-local-admin", "Local Admin")
+	router, localAuth := setupClientLoginRouter(db, nil)
+	require.NoError(t, localAuth.SetPassword("Zitadel-Local-Admin@example.com", clientTestPassword))
+
+	var stored models.AuthUser
+	require.NoError(t, db.First(&stored, admin.UserID).Error)
+	require.NotNil(t, stored.PasswordHash)
+	assert.NotContains(t, *stored.PasswordHash, clientTestPassword)
+
+	logs := captureLog(t)
+	recorder := clientLogin(router, " zitadel-local-admin@EXAMPLE.com", clientTestPassword)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	result := decodeJSON[local.LoginResult](t, recorder)
+	require.NotEmpty(t, result.AuthToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), result.ExpiresAt, time.Minute)
+	assert.NotContains(t, logs.String(), clientTestPassword)
+
+	var session models.AuthUserSession
+	require.NoError(t, db.Where("auth_user_id = ?", admin.UserID).First(&session).Error)
+	assert.NotEqual(t, result.AuthToken, session.Token)
+
+	recorder = authedRequest(router, http.MethodGet, "/v2/client/agents", "Bearer "+result.AuthToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Local Admin")
+
+	user, err := localAuth.ValidateToken(context.Background(), result.AuthToken)
+	require.NoError(t, err)
+	assert.Equal(t, "zitadel-local-admin", *user.ID)
+	assert.Equal(t, "ADMIN", *user.Role)
+
+	// Logging out revokes the token.
+	recorder = authedRequest(router, http.MethodPost, "/v2/client/logout", "Bearer "+result.AuthToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = authedRequest(router, http.MethodGet, "/v2/client/agents", "Bearer "+result.AuthToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// A random token was never valid.
+	recorder = authedRequest(router, http.MethodGet, "/v2/client/agents", "Bearer not-a-real-token")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestClientAdminLogin_RejectsWithoutRevealingWhy(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-local-admin", "Local Admin")
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-no-password", "No Password")
+	router, localAuth := setupClientLoginRouter(db, nil)
+	require.NoError(t, localAuth.SetPassword("zitadel-local-admin@example.com", clientTestPassword))
+
+	logs := captureLog(t)
+	var responses []string
+	for _, attempt := range [][2]string{
+		{"zitadel-local-admin@example.com", "wrong password!"},
+		{"nobody@example.com", clientTestPassword},
+		{"zitadel-no-password@example.com", clientTestPassword},
+	} {
+		recorder := clientLogin(router, attempt[0], attempt[1])
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		responses = append(responses, recorder.Body.String())
+	}
+	for _, response := range responses {
+		assert.JSONEq(t, `{"error":"Invalid username or password"}`, response)
+	}
+	assert.NotContains(t, logs.String(), "wrong password!")
+	assert.NotContains(t, logs.String(), clientTestPassword)
+
+	recorder := clientLogin(router, "zitadel-local-admin@example.com", "")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	assert.ErrorIs(t, localAuth.SetPassword("zitadel-local-admin@example.com", "short"), local.ErrPasswordTooShort)
+}
+
+func TestClientAdminLogin_LocksOutAfterFailedPasswords(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-lockout-agent", "Lockout Agent")
+	router, localAuth := setupClientLoginRouter(db, slackService)
+	require.NoError(t, localAuth.SetPassword("zitadel-lockout-agent@example.com", clientTestPassword))
+
+	for i := 0; i < 3; i++ {
+		recorder := clientLogin(router, "zitadel-lockout-agent@example.com", "guess-number-"+string(rune('a'+i)))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+	alert := expectAlert(t, alerts)
+	assert.Contains(t, alert, "Client login lockout")
+	assert.Contains(t, alert, "203.0.113.50")
+	assert.NotContains(t, alert, "guess-number")
+
+	// The right password does not work while locked.
+	recorder := clientLogin(router, "zitadel-lockout-agent@example.com", clientTestPassword)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	var stored models.AuthUser
+	require.NoError(t, db.First(&stored, agent.UserID).Error)
+	require.NotNil(t, stored.LockedUntil)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), *stored.LockedUntil, time.Minute)
+
+	// Once the lockout has passed the user can log in again, and the failure count is reset.
+	require.NoError(t, db.Model(&stored).UpdateColumn("locked_until", time.Now().Add(-time.Second)).Error)
+	recorder = clientLogin(router, "zitadel-lockout-agent@example.com", clientTestPassword)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var unlocked models.AuthUser
+	require.NoError(t, db.First(&unlocked, agent.UserID).Error)
+	assert.Zero(t, unlocked.FailedLoginAttempts)
+	assert.Nil(t, unlocked.LockedUntil)
+	assert.NotNil(t, unlocked.LastLoginAt)
+}
@@ -0,0 +1,139 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditEventsResponse struct {
+	Events     []audit.Event `json:"events"`
+	Pagination struct {
+		Page  int   `json:"page"`
+		Limit int   `json:"limit"`
+		Total int64 `json:"total"`
+	} `json:"pagination"`
+}
+
+func TestAudit_TrackingUpdateRecordsOverwrittenValues(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-audit-agent", "Audit Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{
+		AuthUserID: agent.UserID, ConversationID: conv.ID, Comments: "called the customer",
+	}).Error)
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-audit-agent"})
+	recorder := clientJSON(router, http.MethodPatch, "/v2/client/conversations/tracking", map[string]any{
+		"conversation_id": conv.ID, "started": true, "comments": "booked",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ?", audit.ActionConversationTracking).First(&event).Error)
+	require.NotNil(t, event.ActorAuthUserID)
+	assert.Equal(t, agent.UserID, *event.ActorAuthUserID)
+	assert.Equal(t, "zitadel-audit-agent", event.ActorZitadelUserID)
+	assert.Equal(t, "AGENT", event.ActorRole)
+	assert.Equal(t, audit.TargetConversation, event.TargetType)
+	assert.Equal(t, strconv.FormatUint(uint64(conv.ID), 10), event.TargetID)
+
+	var changes map[string]audit.Change
+	require.NoError(t, json.Unmarshal(event.Changes, &changes))
+	assert.Equal(t, audit.Change{Before: "called the customer", After: "booked"}, changes["comments"])
+	assert.Equal(t, audit.Change{Before: false, After: true}, changes["started"])
+	assert.NotContains(t, changes, "resolved")
+}
+
+func TestAudit_ListFiltersAndRequiresAdmin(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	admin := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-audit-admin", "Audit Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-audit-agent-2", "Audit Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-audit-admin"})
+	recorder := clientJSON(router, http.MethodPost, "/v2/client/conversations/link", map[string]any{
+		"user_id": agent.UserID, "conversation_ids": []uint{conv.ID},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-users/"+strconv.FormatUint(uint64(agent.UserID), 10)+"/disable", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/audit?action="+audit.ActionConversationsLink, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	resp := decodeJSON[auditEventsResponse](t, recorder)
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, int64(1), resp.Pagination.Total)
+	assert.Equal(t, audit.TargetAuthUser, resp.Events[0].TargetType)
+	require.NotNil(t, resp.Events[0].ActorAuthUserID)
+	assert.Equal(t, admin.UserID, *resp.Events[0].ActorAuthUserID)
+
+	// Newest first, one per page.
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/audit?actor_id="+strconv.FormatUint(uint64(admin.UserID), 10)+"&limit=1", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	resp = decodeJSON[auditEventsResponse](t, recorder)
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, int64(2), resp.Pagination.Total)
+	assert.Equal(t, audit.ActionAuthUserDisable, resp.Events[0].Action)
+	var changes map[string]audit.Change
+	require.NoError(t, json.Unmarshal(resp.Events[0].Changes, &changes))
+	assert.Equal(t, audit.Change{Before: false, After: true}, changes["disabled"])
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/audit?from="+future, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, decodeJSON[auditEventsResponse](t, recorder).Events)
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/audit?from=yesterday", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-audit-agent-3", "Other Agent")
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-audit-agent-3"})
+	recorder = clientJSON(agentRouter, http.MethodGet, "/v2/client/audit", nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestAudit_PruneRemovesOnlyExpiredEvents(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	now := time.Now()
+	require.NoError(t, db.Create(&[]models.AuditEvent{
+		{CreatedAt: now.Add(-48 * time.Hour), Action: "old"},
+		{CreatedAt: now.Add(-time.Hour), Action: "recent"},
+	}).Error)
+
+	deleted, err := audit.NewService(db, 24*time.Hour, nil).Prune(now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var remaining []models.AuditEvent
+	require.NoError(t, db.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "recent", remaining[0].Action)
+}
+
+func TestAudit_DiffReportsChangedFieldsOnly(t *testing.T) {
+	changes := audit.Diff(
+		map[string]any{"role": "AGENT", "name": "A", "email": "a@example.com"},
+		map[string]any{"role": "ADMIN", "name": "A", "disabled": true},
+	)
+	assert.Equal(t, map[string]audit.Change{
+		"role":     {Before: "AGENT", After: "ADMIN"},
+		"disabled": {Before: nil, After: true},
+		"email":    {Before: "a@example.com", After: nil},
+	}, changes)
+}
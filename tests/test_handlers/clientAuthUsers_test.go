@@ -0,0 +1,254 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	authUserService "smart-chat/internal/services/auth_user"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identityValidator accepts any token as the given identity.
+type identityValidator struct {
+	identity zitadel.ValidateTokenUser
+}
+
+func (v identityValidator) ValidateToken(_ context.Context, _ string) (*zitadel.ValidateTokenUser, error) {
+	identity := v.identity
+	return &identity, nil
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func clientJSON(router *gin.Engine, method, path string, payload any) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if payload != nil {
+		_ = json.NewEncoder(&body).Encode(payload)
+	}
+	req, _ := http.NewRequest(method, path, &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer client-token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+type authUserResponse struct {
+	AuthUser authUserService.AuthUser `json:"auth_user"`
+}
+
+func TestAuthUsers_JITProvisioningAndProfileSync(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	authUsers := authUserService.NewService(db, authUserService.Settings{JITEnabled: true, DefaultRole: "agent"}, slackService)
+
+	// An unknown identity is provisioned with the default role on its first request.
+	router := setupClientRoutesWith(db, identityValidator{zitadel.ValidateTokenUser{
+		ID: strPtr("zitadel-jit-1"), Name: strPtr("Jit Agent"), Email: strPtr("jit@example.com"),
+	}}, authUsers)
+	recorder := clientJSON(router, http.MethodGet, "/v2/client/conversations", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var user models.AuthUser
+	require.NoError(t, db.Where("zitadel_user_id = ?", "zitadel-jit-1").First(&user).Error)
+	assert.Equal(t, "Jit Agent", *user.Name)
+	assert.Equal(t, "jit@example.com", *user.Email)
+	var role models.AuthRole
+	require.NoError(t, db.First(&role, user.RoleID).Error)
+	assert.Equal(t, rbac.RoleAgent, role.Name)
+	assert.Contains(t, expectAlert(t, alerts), "Auth user provisioned: zitadel-jit-1")
+
+	// Name and email follow the token on later requests; a role claim no longer changes the role.
+	router = setupClientRoutesWith(db, identityValidator{zitadel.ValidateTokenUser{
+		ID: strPtr("zitadel-jit-1"), Name: strPtr("Renamed Agent"), Email: strPtr("renamed@example.com"), Role: strPtr("ADMIN"),
+	}}, authUsers)
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/agents", nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	var synced models.AuthUser
+	require.NoError(t, db.First(&synced, user.UserID).Error)
+	assert.Equal(t, "Renamed Agent", *synced.Name)
+	assert.Equal(t, "renamed@example.com", *synced.Email)
+	assert.Equal(t, user.RoleID, synced.RoleID)
+
+	// A known role claim is honoured when the user is provisioned.
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-existing-admin", "Existing Admin")
+	router = setupClientRoutesWith(db, identityValidator{zitadel.ValidateTokenUser{
+		ID: strPtr("zitadel-jit-admin"), Role: strPtr("admin"),
+	}}, authUsers)
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/agents", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	// Disabled users are refused even though their token is valid.
+	require.NoError(t, db.Model(&models.AuthUser{}).Where("user_id = ?", user.UserID).Update("disabled_at", time.Now()).Error)
+	router = setupClientRoutesWith(db, identityValidator{zitadel.ValidateTokenUser{ID: strPtr("zitadel-jit-1")}}, authUsers)
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/conversations", nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, `{"error":"auth user disabled"}`, recorder.Body.String())
+}
+
+func TestAuthUsers_ZitadelRoleClaim(t *testing.T) {
+	server := newJWKSServer(t)
+	key := newRSAKey(t)
+	server.publish(http.StatusOK, rsaJWK("key-1", key))
+	validator, err := zitadel.NewJWKSValidator(zitadel.JWKSConfig{JWKSURL: server.URL, Issuer: testIssuer})
+	require.NoError(t, err)
+
+	claims := validClaims("zitadel-role-claim")
+	claims["urn:zitadel:iam:org:project:roles"] = map[string]any{
+		"agent": map[string]string{"org-1": "example.com"},
+		"admin": map[string]string{"org-1": "example.com"},
+	}
+	user, err := validator.ValidateToken(context.Background(), signJWT(t, "key-1", key, claims))
+	require.NoError(t, err)
+	require.NotNil(t, user.Role)
+	assert.Equal(t, rbac.RoleAdmin, *user.Role)
+}
+
+func TestAuthUsers_AdminAPI(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	admin := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-users-admin", "Users Admin")
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-users-agent", "Users Agent")
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-users-admin"})
+
+	recorder := clientJSON(router, http.MethodPost, "/v2/client/auth-users", map[string]any{
+		"email": "New.Agent@example.com", "name": "New Agent", "role": "agent",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	created := decodeJSON[authUserResponse](t, recorder).AuthUser
+	assert.Equal(t, "local:new.agent@example.com", created.ZitadelUserID)
+	assert.Equal(t, rbac.RoleAgent, created.Role)
+	assert.False(t, created.Disabled)
+	userPath := "/v2/client/auth-users/" + strconv.FormatUint(uint64(created.UserID), 10)
+
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-users", map[string]any{"email": "new.agent@example.com", "role": "AGENT"})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-users", map[string]any{"email": "x@example.com", "role": "NOPE"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/auth-users", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	listed := decodeJSON[struct {
+		AuthUsers []authUserService.AuthUser `json:"auth_users"`
+	}](t, recorder)
+	assert.Len(t, listed.AuthUsers, 3)
+
+	recorder = clientJSON(router, http.MethodPatch, userPath+"/role", map[string]string{"role": "admin"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, rbac.RoleAdmin, decodeJSON[authUserResponse](t, recorder).AuthUser.Role)
+
+	// Disabling revokes the user's local-credentials sessions.
+	require.NoError(t, db.Create(&models.AuthUserSession{AuthUserID: created.UserID, Token: "hashed", ExpiresAt: time.Now().Add(time.Hour)}).Error)
+	recorder = clientJSON(router, http.MethodPost, userPath+"/disable", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.True(t, decodeJSON[authUserResponse](t, recorder).AuthUser.Disabled)
+	var session models.AuthUserSession
+	require.NoError(t, db.Where("auth_user_id = ?", created.UserID).First(&session).Error)
+	assert.NotNil(t, session.RevokedAt)
+
+	recorder = clientJSON(router, http.MethodPost, userPath+"/enable", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, decodeJSON[authUserResponse](t, recorder).AuthUser.Disabled)
+
+	// Admins cannot lock themselves out.
+	selfPath := "/v2/client/auth-users/" + strconv.FormatUint(uint64(admin.UserID), 10)
+	recorder = clientJSON(router, http.MethodPost, selfPath+"/disable", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = clientJSON(router, http.MethodPatch, selfPath+"/role", map[string]string{"role": "AGENT"})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-users/9999/disable", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// Agents cannot manage auth users.
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-users-agent"})
+	recorder = clientJSON(agentRouter, http.MethodGet, "/v2/client/auth-users", nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, `{"error":"admin role required"}`, recorder.Body.String())
+}
+
+func TestAuthUsers_RolesAPI(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-roles-admin", "Roles Admin")
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-roles-agent", "Roles Agent")
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-roles-admin"})
+
+	type roleResponse struct {
+		Role authUserService.Role `json:"role"`
+	}
+	recorder := clientJSON(router, http.MethodPost, "/v2/client/auth-roles", map[string]string{"name": " supervisor "})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	supervisor := decodeJSON[roleResponse](t, recorder).Role
+	assert.Equal(t, "SUPERVISOR", supervisor.Name)
+	assert.Empty(t, supervisor.Permissions)
+
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-roles", map[string]string{"name": "Supervisor"})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-roles", map[string]string{"name": "team lead!"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/auth-roles", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	roles := decodeJSON[struct {
+		Roles []authUserService.Role `json:"roles"`
+	}](t, recorder).Roles
+	byName := map[string]authUserService.Role{}
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+	assert.Equal(t, int64(1), byName["AGENT"].UserCount)
+	assert.Contains(t, byName["ADMIN"].Permissions, rbac.AuthUsersManage)
+
+	// Built-in roles and roles in use cannot be deleted.
+	recorder = clientJSON(router, http.MethodDelete, "/v2/client/auth-roles/"+strconv.FormatUint(uint64(byName["ADMIN"].RoleID), 10), nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/auth-users", map[string]any{"zitadel_user_id": "zitadel-supervisor", "role": "SUPERVISOR"})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	supervisorPath := "/v2/client/auth-roles/" + strconv.FormatUint(uint64(supervisor.RoleID), 10)
+	recorder = clientJSON(router, http.MethodDelete, supervisorPath, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	require.NoError(t, db.Where("zitadel_user_id = ?", "zitadel-supervisor").Delete(&models.AuthUser{}).Error)
+	recorder = clientJSON(router, http.MethodDelete, supervisorPath, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = clientJSON(router, http.MethodDelete, supervisorPath, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestAuthUsers_LastAdminIsKept(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	admin := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-last-admin", "Last Admin")
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-last-agent", "Last Agent")
+	service := authUserService.NewService(db, authUserService.Settings{}, nil)
+
+	_, err := service.SetRole(admin.UserID, rbac.RoleAgent, 0)
+	assert.ErrorIs(t, err, authUserService.ErrLastAdmin)
+	_, err = service.Disable(admin.UserID, 0)
+	assert.ErrorIs(t, err, authUserService.ErrLastAdmin)
+
+	second := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-second-admin", "Second Admin")
+	_, err = service.Disable(admin.UserID, second.UserID)
+	require.NoError(t, err)
+	_, err = service.SetRole(second.UserID, rbac.RoleAgent, 0)
+	assert.ErrorIs(t, err, authUserService.ErrLastAdmin, "disabled admins do not count")
+}
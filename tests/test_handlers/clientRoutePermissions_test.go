@@ -0,0 +1,179 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/rbac"
+	"smart-chat/internal/routes"
+	"smart-chat/internal/services/analytics"
+	"smart-chat/internal/services/audit"
+	authUserService "smart-chat/internal/services/auth_user"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	convHistory "smart-chat/internal/services/conversation_history"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/internal/services/escalation"
+	"smart-chat/internal/services/export"
+	"smart-chat/internal/services/human"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/note"
+	"smart-chat/internal/services/sla"
+	"smart-chat/internal/services/tag"
+	userService "smart-chat/internal/services/user"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupClientRoutes(db *gorm.DB, validator zitadel.TokenValidator) *gin.Engine {
+	return setupClientRoutesWith(db, validator, authUserService.NewService(db, authUserService.Settings{}, nil))
+}
+
+// setupClientRoutesWith mounts the client routes resolving callers through authUsers.
+func setupClientRoutesWith(db *gorm.DB, validator zitadel.TokenValidator, authUsers *authUserService.Service) *gin.Engine {
+	exports := export.NewService(db, blobstore.NewLocalStore(os.TempDir()), export.Settings{})
+	return mountClientRoutes(db, validator, authUsers, exports)
+}
+
+// mountClientRoutes mounts the client routes with the given export service.
+func mountClientRoutes(db *gorm.DB, validator zitadel.TokenValidator, authUsers *authUserService.Service, exports *export.Service) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	modes := conversationMode.NewService(db, conversationMode.Settings{}, nil)
+	assignments := authUserConversation.NewEngine(db, authUserConversation.EngineSettings{})
+	routes.ClientRoutes(
+		router.Group("/v2/client"),
+		convHistory.NewConvHistoryService(db),
+		analytics.NewAnalyticsService(db),
+		userService.NewUserService(db),
+		human.NewHumanService(db),
+		nil,
+		nil,
+		authUserConversation.NewService(db),
+		nil,
+		nil,
+		nil,
+		nil,
+		authUsers,
+		audit.NewService(db, 0, nil),
+		modes,
+		escalation.NewService(db, escalation.Settings{}, assignments, modes, nil),
+		assignments,
+		sla.NewService(db, sla.Settings{}, nil),
+		inbox.NewHub(db, inbox.HubSettings{}),
+		tag.NewService(db, nil),
+		exports,
+		note.NewService(db),
+		validator,
+	)
+	return router
+}
+
+func TestClientRoutesDeclarePermissions(t *testing.T) {
+	router := setupClientRoutes(nil, nil)
+
+	registered := map[string]bool{}
+	var undeclared []string
+	for _, route := range router.Routes() {
+		key := route.Method + " " + strings.TrimPrefix(route.Path, "/v2/client")
+		registered[key] = true
+		if _, ok := routes.ClientRoutePermissions[key]; !ok {
+			undeclared = append(undeclared, key)
+		}
+	}
+	sort.Strings(undeclared)
+	assert.Empty(t, undeclared, "client routes without a declared permission in routes.ClientRoutePermissions")
+
+	var stale []string
+	for key, permission := range routes.ClientRoutePermissions {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+		if permission != rbac.Public {
+			assert.NotEmpty(t, rbac.RolesWith(permission), "no role holds %s, required by %s", permission, key)
+		}
+	}
+	sort.Strings(stale)
+	assert.Empty(t, stale, "declared permissions for routes that are not registered")
+}
+
+func TestRBAC_PermissionMatrix(t *testing.T) {
+	for _, permission := range rbac.RolePermissions[rbac.RoleAgent] {
+		assert.True(t, rbac.Allows("admin", permission), "admins should hold every agent permission, missing %s", permission)
+	}
+	assert.True(t, rbac.Allows(" agent ", rbac.ConversationsReadAssigned))
+	assert.False(t, rbac.Allows(rbac.RoleAgent, rbac.ConversationsReadAll))
+	assert.False(t, rbac.Allows(rbac.RoleAgent, rbac.AnalyticsRead))
+	assert.False(t, rbac.Allows("VIEWER", rbac.ConversationsReadAssigned))
+	assert.True(t, rbac.Allows("VIEWER", rbac.Public))
+	assert.Equal(t, []string{rbac.RoleAgent, rbac.RoleAdmin}, rbac.RolesWith(rbac.ConversationsWriteAssigned))
+}
+
+func TestClientRoutes_PreviouslyOpenRoutesRequireAuth(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-rbac-agent", "RBAC Agent")
+	setupAuthUserWithRole(t, db, "VIEWER", "zitadel-rbac-viewer", "RBAC Viewer")
+	convID := strconv.FormatUint(uint64(conv.ID), 10)
+	addMessage := `{"conversation_id":` + convID + `,"message":"hello"}`
+
+	request := func(router *gin.Engine, method, path, body, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-rbac-agent"})
+	for _, path := range []string{
+		"/v2/client/analytics/dashboard/conversations-summary",
+		"/v2/client/analytics/conversations/last-30-days",
+		"/v2/client/analytics/reengagement",
+		"/v2/client/userdetails?conv_id=" + convID,
+	} {
+		recorder := request(agentRouter, http.MethodGet, path, "", "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, path)
+	}
+	recorder := request(agentRouter, http.MethodPost, "/v2/client/add-message", addMessage, "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// Agents cannot read analytics.
+	recorder = request(agentRouter, http.MethodGet, "/v2/client/analytics/dashboard/conversations-summary", "", "agent-token")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, `{"error":"admin role required"}`, recorder.Body.String())
+
+	// Agents only reach conversations assigned to them.
+	recorder = request(agentRouter, http.MethodPost, "/v2/client/add-message", addMessage, "agent-token")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = request(agentRouter, http.MethodGet, "/v2/client/userdetails?conv_id="+convID, "", "agent-token")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// Roles outside the matrix hold no permissions.
+	viewerRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-rbac-viewer"})
+	recorder = request(viewerRouter, http.MethodPost, "/v2/client/add-message", addMessage, "viewer-token")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, `{"error":"agent or admin role required"}`, recorder.Body.String())
+
+	// Unknown auth users are refused before any handler runs.
+	strangerRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-rbac-stranger"})
+	recorder = request(strangerRouter, http.MethodGet, "/v2/client/conversations", "", "stranger-token")
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "auth user not found")
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"smart-chat/internal/models"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type cursorPageResponse struct {
+	Conversations []struct {
+		ID uint `json:"id"`
+	} `json:"conversations"`
+	Pagination map[string]any `json:"pagination"`
+}
+
+func (r cursorPageResponse) ids() []uint {
+	ids := make([]uint, 0, len(r.Conversations))
+	for _, conv := range r.Conversations {
+		ids = append(ids, conv.ID)
+	}
+	return ids
+}
+
+func (r cursorPageResponse) nextCursor(t *testing.T) string {
+	t.Helper()
+	cursor, ok := r.Pagination["next_cursor"].(string)
+	require.True(t, ok, "expected a next_cursor in %v", r.Pagination)
+	return cursor
+}
+
+func conversationAt(t *testing.T, db *gorm.DB, createdAt time.Time) uint {
+	t.Helper()
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Model(&models.Conversation{}).Where("id = ?", conv.ID).Update("created_at", createdAt).Error)
+	return conv.ID
+}
+
+func TestConversationList_KeysetCursorPagination(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-cursor-admin", "Cursor Admin")
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-cursor-admin"})
+	list := func(query string) cursorPageResponse {
+		t.Helper()
+		recorder := clientJSON(router, http.MethodGet, "/v2/client/conversations?"+query, nil)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		return decodeJSON[cursorPageResponse](t, recorder)
+	}
+
+	base := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	first := conversationAt(t, db, base)
+	tiedA := conversationAt(t, db, base.Add(time.Hour))
+	tiedB := conversationAt(t, db, base.Add(time.Hour))
+	fourth := conversationAt(t, db, base.Add(2*time.Hour))
+	last := conversationAt(t, db, base.Add(3*time.Hour))
+
+	// Page and limit keep working and now also hand out a cursor.
+	page := list("limit=2&sort=asc")
+	assert.Equal(t, []uint{first, tiedA}, page.ids())
+	assert.EqualValues(t, 1, page.Pagination["page"])
+	assert.EqualValues(t, 5, page.Pagination["total"])
+
+	page = list("limit=2&cursor=" + url.QueryEscape(page.nextCursor(t)))
+	assert.Equal(t, []uint{tiedB, fourth}, page.ids())
+	assert.NotContains(t, page.Pagination, "total")
+	assert.NotContains(t, page.Pagination, "page")
+
+	// Conversations arriving before the cursor position do not shift later pages.
+	earlier := conversationAt(t, db, base.Add(-time.Hour))
+	page = list("limit=2&cursor=" + url.QueryEscape(page.nextCursor(t)))
+	assert.Equal(t, []uint{last}, page.ids())
+	assert.Nil(t, page.Pagination["next_cursor"])
+
+	page = list("limit=3&sort=desc")
+	assert.Equal(t, []uint{last, fourth, tiedB}, page.ids())
+	cursor := page.nextCursor(t)
+	page = list("limit=3&include_total=true&sort=desc&cursor=" + url.QueryEscape(cursor))
+	assert.Equal(t, []uint{tiedA, first, earlier}, page.ids())
+	assert.EqualValues(t, 6, page.Pagination["total"])
+	assert.Nil(t, page.Pagination["next_cursor"])
+
+	recorder := clientJSON(router, http.MethodGet, "/v2/client/conversations?sort=asc&cursor="+url.QueryEscape(cursor), nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/conversations?cursor=not-a-cursor", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"smart-chat/cache"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	"smart-chat/internal/services/conversation"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type conversationModeResponse struct {
+	Conversation conversationMode.State `json:"conversation"`
+}
+
+func TestConversationMode_AgentTogglesAssignedConversation(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-mode-agent", "Mode Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	_, _, other, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: agent.UserID, ConversationID: conv.ID}).Error)
+	path := "/v2/client/conversation/" + strconv.FormatUint(uint64(conv.ID), 10) + "/mode"
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-mode-agent"})
+	recorder := clientJSON(router, http.MethodPatch, path, map[string]any{"mode": "Human"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	state := decodeJSON[conversationModeResponse](t, recorder).Conversation
+	assert.Equal(t, models.ConversationModeHuman, state.Mode)
+	require.NotNil(t, state.ChangedBy)
+	assert.Equal(t, agent.UserID, *state.ChangedBy)
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ?", audit.ActionConversationMode).First(&event).Error)
+	assert.JSONEq(t, `{"mode":{"before":"bot","after":"human"}}`, string(event.Changes))
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/conversation/"+strconv.FormatUint(uint64(conv.ID), 10), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, models.ConversationModeHuman, decodeJSON[map[string]any](t, recorder)["mode"])
+
+	recorder = clientJSON(router, http.MethodPatch, path, map[string]any{"mode": "silent"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = clientJSON(router, http.MethodPatch, "/v2/client/conversation/"+strconv.FormatUint(uint64(other.ID), 10)+"/mode", map[string]any{"mode": "human"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestConversationMode_HumanModeHoldsMessagesForAgent(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-mode-holder", "Holding Agent")
+	_, session, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: agent.UserID, ConversationID: conv.ID}).Error)
+
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	modes := conversationMode.NewService(db, conversationMode.Settings{
+		Timeout:    time.Hour,
+		AckMessage: "An executive will reply shortly.",
+	}, slackService)
+	conversationService := conversation.NewConversationService(db)
+	conversationService.Receiver.Modes = modes
+	// Nothing listens here; the user details cache invalidation just fails.
+	cache.Initialize("127.0.0.1:1")
+
+	_, err := modes.Set(conv.ID, models.ConversationModeHuman, agent.UserID)
+	require.NoError(t, err)
+
+	// The first message is acknowledged, later ones are only stored; the LLM is never called.
+	response, err := conversationService.HandleSession(session.ID, "Can I change my dates?", models.MessageTypeUserSent, true)
+	require.NoError(t, err)
+	assert.Equal(t, `{"content":"An executive will reply shortly."}`, response)
+	assert.Contains(t, expectAlert(t, alerts), "assigned: *Holding Agent*")
+
+	response, err = conversationService.HandleSession(session.ID, "To the 14th", models.MessageTypeUserSent, true)
+	require.NoError(t, err)
+	assert.Empty(t, response)
+	assert.Contains(t, expectAlert(t, alerts), `"To the 14th"`)
+
+	var held []models.MessagePair
+	require.NoError(t, db.Where("conversation_id = ? AND type = ?", conv.ID, models.MessageTypeUserAwaitingAgent).Order("id").Find(&held).Error)
+	require.Len(t, held, 2)
+	assert.Equal(t, "Can I change my dates?", held[0].User)
+	assert.True(t, held[1].Visible)
+
+	// The held messages reach the LLM history as user turns with no empty replies.
+	messages, err := conversation.NewConversationHistory(db).FetchHistory(conv.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 5)
+	assert.Equal(t, "To the 14th", messages[4].Content)
+}
+
+func TestConversationMode_ReturnsToBotAfterTimeout(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	_, _, stale, _ := utils.SetupTestEntities(db)
+	modes := conversationMode.NewService(db, conversationMode.Settings{Timeout: time.Hour}, nil)
+
+	state, err := modes.Set(conv.ID, models.ConversationModePaired, 1)
+	require.NoError(t, err)
+	require.NotNil(t, state.ExpiresAt)
+	_, err = modes.Set(stale.ID, models.ConversationModeHuman, 1)
+	require.NoError(t, err)
+
+	returned, err := modes.ReturnExpired(time.Now().Add(30 * time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, returned)
+
+	require.NoError(t, db.Model(&models.Conversation{}).Where("id = ?", stale.ID).
+		Update("mode_expires_at", time.Now().Add(-time.Minute)).Error)
+	state, err = modes.Get(stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConversationModeBot, state.Mode)
+	assert.Nil(t, state.ExpiresAt)
+
+	returned, err = modes.ReturnExpired(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), returned)
+	state, err = modes.Get(conv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConversationModeBot, state.Mode)
+}
@@ -0,0 +1,158 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/internal/services/note"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type conversationNoteResponse struct {
+	Note note.Note `json:"note"`
+}
+
+type conversationNotesResponse struct {
+	Notes []note.Note `json:"notes"`
+}
+
+type noteHistoryResponse struct {
+	History []note.Revision `json:"history"`
+}
+
+func notePath(conversationID, noteID uint, suffix string) string {
+	return "/v2/client/conversations/" + strconv.FormatUint(uint64(conversationID), 10) + "/notes/" + strconv.FormatUint(uint64(noteID), 10) + suffix
+}
+
+func TestConversationNotes_ThreadsEditsPinsAndMentions(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	admin := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-notes-admin", "Notes Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-notes-agent", "Notes Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	_, err := authUserConversation.NewService(db).LinkConversations(agent.UserID, []uint{conv.ID}, 0)
+	require.NoError(t, err)
+	notesPath := "/v2/client/conversations/" + strconv.FormatUint(uint64(conv.ID), 10) + "/notes"
+
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-notes-agent"})
+	adminRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-notes-admin"})
+
+	recorder := clientJSON(agentRouter, http.MethodPost, notesPath, map[string]any{"body": "Wants a quote for 6; @zitadel-notes-admin@example.com can you approve the discount?"})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	first := decodeJSON[conversationNoteResponse](t, recorder).Note
+	assert.Equal(t, agent.UserID, first.Author.ID)
+	require.Len(t, first.Mentions, 1)
+	assert.Equal(t, admin.UserID, first.Mentions[0].ID)
+
+	var event models.InboxEvent
+	require.NoError(t, db.Where("type = ?", inbox.EventNoteCreated).First(&event).Error)
+	assert.Equal(t, conv.ID, event.ConversationID)
+	assert.JSONEq(t, "["+strconv.FormatUint(uint64(admin.UserID), 10)+"]", string(event.Audience))
+
+	recorder = clientJSON(adminRouter, http.MethodPost, notesPath, map[string]any{"body": "Approved up to 10%.", "parent_id": first.ID})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	reply := decodeJSON[conversationNoteResponse](t, recorder).Note
+	recorder = clientJSON(agentRouter, http.MethodPost, notesPath, map[string]any{"body": "Thanks", "parent_id": reply.ID})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = clientJSON(agentRouter, http.MethodPost, notesPath, map[string]any{"body": "Second thread"})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	second := decodeJSON[conversationNoteResponse](t, recorder).Note
+
+	// Only the author edits; the old body goes to the history.
+	recorder = clientJSON(adminRouter, http.MethodPatch, notePath(conv.ID, first.ID, ""), map[string]any{"body": "changed"})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = clientJSON(agentRouter, http.MethodPatch, notePath(conv.ID, first.ID, ""), map[string]any{"body": "Wants a quote for 6 people."})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	edited := decodeJSON[conversationNoteResponse](t, recorder).Note
+	assert.NotNil(t, edited.EditedAt)
+	assert.Empty(t, edited.Mentions)
+	require.Len(t, edited.Replies, 1)
+	recorder = clientJSON(agentRouter, http.MethodGet, notePath(conv.ID, first.ID, "/history"), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	history := decodeJSON[noteHistoryResponse](t, recorder).History
+	require.Len(t, history, 1)
+	assert.Contains(t, history[0].Body, "can you approve the discount?")
+	assert.Equal(t, agent.UserID, history[0].EditedBy.ID)
+
+	// Pinned notes come first.
+	recorder = clientJSON(agentRouter, http.MethodPut, notePath(conv.ID, reply.ID, "/pin"), nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = clientJSON(agentRouter, http.MethodPut, notePath(conv.ID, second.ID, "/pin"), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.True(t, decodeJSON[conversationNoteResponse](t, recorder).Note.Pinned)
+
+	recorder = clientJSON(agentRouter, http.MethodGet, "/v2/client/conversation/"+strconv.FormatUint(uint64(conv.ID), 10), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var detail struct {
+		Notes []note.Note `json:"notes"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &detail))
+	require.Len(t, detail.Notes, 2)
+	assert.Equal(t, second.ID, detail.Notes[0].ID)
+	assert.Equal(t, first.ID, detail.Notes[1].ID)
+	require.Len(t, detail.Notes[1].Replies, 1)
+	assert.Equal(t, reply.ID, detail.Notes[1].Replies[0].ID)
+
+	recorder = clientJSON(agentRouter, http.MethodDelete, notePath(conv.ID, second.ID, "/pin"), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.False(t, decodeJSON[conversationNoteResponse](t, recorder).Note.Pinned)
+
+	// Agents delete only their own notes; admins any, with its replies.
+	recorder = clientJSON(agentRouter, http.MethodDelete, notePath(conv.ID, reply.ID, ""), nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = clientJSON(adminRouter, http.MethodDelete, notePath(conv.ID, first.ID, ""), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = clientJSON(agentRouter, http.MethodGet, notesPath, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	notes := decodeJSON[conversationNotesResponse](t, recorder).Notes
+	require.Len(t, notes, 1)
+	assert.Equal(t, second.ID, notes[0].ID)
+	recorder = clientJSON(agentRouter, http.MethodGet, notePath(conv.ID, reply.ID, "/history"), nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	var deleted models.AuditEvent
+	require.NoError(t, db.Where("action = ? AND target_id = ?", audit.ActionConversationNoteDelete, strconv.FormatUint(uint64(conv.ID), 10)).First(&deleted).Error)
+	assert.Equal(t, admin.UserID, *deleted.ActorAuthUserID)
+}
+
+func TestConversationNotes_RejectsInvalidMentionsAndUnassignedAgents(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-notes-admin", "Notes Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-notes-agent", "Notes Agent")
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-notes-other", "Other Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	_, err := authUserConversation.NewService(db).LinkConversations(agent.UserID, []uint{conv.ID}, 0)
+	require.NoError(t, err)
+	notesPath := "/v2/client/conversations/" + strconv.FormatUint(uint64(conv.ID), 10) + "/notes"
+
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-notes-agent"})
+	recorder := clientJSON(agentRouter, http.MethodPost, notesPath, map[string]any{"body": "@zitadel-notes-other@example.com please take a look"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "zitadel-notes-other@example.com")
+	recorder = clientJSON(agentRouter, http.MethodPost, notesPath, map[string]any{"body": "@nobody@example.com hello"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = clientJSON(agentRouter, http.MethodPost, notesPath, map[string]any{"body": "   "})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	otherRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-notes-other"})
+	recorder = clientJSON(otherRouter, http.MethodGet, notesPath, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = clientJSON(otherRouter, http.MethodPost, notesPath, map[string]any{"body": "hello"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	var count int64
+	require.NoError(t, db.Model(&models.ConversationNote{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	conversationMode "smart-chat/internal/services/conversation_mode"
+	"smart-chat/internal/services/escalation"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type escalationsResponse struct {
+	Escalations []escalation.QueueItem `json:"escalations"`
+	Pagination  struct {
+		Total int64 `json:"total"`
+	} `json:"pagination"`
+}
+
+func escalationAssigner(db *gorm.DB) *authUserConversation.Engine {
+	return authUserConversation.NewEngine(db, authUserConversation.EngineSettings{
+		Strategy: authUserConversation.StrategyLeastOpen,
+		Triggers: map[authUserConversation.Trigger]bool{authUserConversation.TriggerEscalation: true},
+	})
+}
+
+func TestEscalation_AssignsLeastLoadedAgentAndHandsOver(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	busy := setupAuthUserWithRole(t, db, "AGENT", "zitadel-escalation-busy", "Busy Agent")
+	free := setupAuthUserWithRole(t, db, "AGENT", "zitadel-escalation-free", "Free Agent")
+	_, _, assigned, _ := utils.SetupTestEntities(db)
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: busy.UserID, ConversationID: assigned.ID}).Error)
+
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	modes := conversationMode.NewService(db, conversationMode.Settings{}, nil)
+	escalations := escalation.NewService(db, escalation.Settings{
+		HandoffMessage:   "An executive will join shortly.",
+		ClientAppBaseURL: "https://app.example.com",
+	}, escalationAssigner(db), modes, slackService)
+
+	escalated, err := escalations.Escalate(escalation.Request{
+		ConversationID:  conv.ID,
+		Reason:          "Wants to change travel dates",
+		Urgency:         "Normal",
+		LastUserMessage: "Can I move my trip?",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.EscalationUrgencyNormal, escalated.Urgency)
+	require.NotNil(t, escalated.AssignedAuthUserID)
+	assert.Equal(t, free.UserID, *escalated.AssignedAuthUserID)
+	assert.Equal(t, `{"content":"An executive will join shortly."}`, escalations.HandoffMessage())
+
+	notification := expectAlert(t, alerts)
+	assert.Contains(t, notification, "assigned: *Free Agent*")
+	assert.Contains(t, notification, "Wants to change travel dates")
+	assert.Contains(t, notification, "https://app.example.com/conversations/"+strconv.FormatUint(uint64(conv.ID), 10))
+
+	state, err := modes.Get(conv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConversationModeHuman, state.Mode)
+	assert.Nil(t, state.ChangedBy)
+
+	var stored models.Conversation
+	require.NoError(t, db.First(&stored, conv.ID).Error)
+	assert.NotNil(t, stored.EscalatedAt)
+
+	// A second request updates the open escalation and keeps the assignee.
+	again, err := escalations.Escalate(escalation.Request{ConversationID: conv.ID, Reason: "Now says it is urgent", Urgency: "high"})
+	require.NoError(t, err)
+	expectAlert(t, alerts)
+	assert.Equal(t, escalated.ID, again.ID)
+	assert.Equal(t, models.EscalationUrgencyHigh, again.Urgency)
+
+	var count int64
+	require.NoError(t, db.Model(&models.Escalation{}).Where("conversation_id = ?", conv.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, db.Model(&models.AuthUserConversation{}).Where("conversation_id = ?", conv.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestEscalation_QueueIsScopedAndResolvable(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-queue-agent", "Queue Agent")
+	other := setupAuthUserWithRole(t, db, "AGENT", "zitadel-queue-other", "Other Agent")
+	_, _, mine, _ := utils.SetupTestEntities(db)
+	_, _, theirs, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: agent.UserID, ConversationID: mine.ID}).Error)
+	require.NoError(t, db.Create(&models.AuthUserConversation{AuthUserID: other.UserID, ConversationID: theirs.ID}).Error)
+
+	escalations := escalation.NewService(db, escalation.Settings{}, escalationAssigner(db), nil, nil)
+	low, err := escalations.Escalate(escalation.Request{ConversationID: mine.ID, Reason: "Asked for a call back", Urgency: "low"})
+	require.NoError(t, err)
+	theirsEscalation, err := escalations.Escalate(escalation.Request{ConversationID: theirs.ID, Reason: "Payment failed", Urgency: "high"})
+	require.NoError(t, err)
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-queue-agent"})
+	recorder := clientJSON(router, http.MethodGet, "/v2/client/escalations", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	queue := decodeJSON[escalationsResponse](t, recorder)
+	require.Len(t, queue.Escalations, 1)
+	assert.Equal(t, low.ID, queue.Escalations[0].ID)
+	assert.Equal(t, "Test User", queue.Escalations[0].UserName)
+	require.NotNil(t, queue.Escalations[0].AssigneeName)
+	assert.Equal(t, "Queue Agent", *queue.Escalations[0].AssigneeName)
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/escalations?status=stale", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/escalations/"+strconv.FormatUint(uint64(theirsEscalation.ID), 10)+"/resolve", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = clientJSON(router, http.MethodPost, "/v2/client/escalations/"+strconv.FormatUint(uint64(low.ID), 10)+"/resolve", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var stored models.Conversation
+	require.NoError(t, db.First(&stored, mine.ID).Error)
+	assert.Nil(t, stored.EscalatedAt)
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ?", audit.ActionEscalationResolve).First(&event).Error)
+	assert.JSONEq(t, `{"status":{"before":"open","after":"resolved"}}`, string(event.Changes))
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/escalations", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, decodeJSON[escalationsResponse](t, recorder).Escalations)
+
+	// Admins see every conversation's escalations, most urgent first.
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-queue-admin", "Queue Admin")
+	router = setupClientRoutes(db, mockTokenValidator{userID: "zitadel-queue-admin"})
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/escalations?status=all", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	queue = decodeJSON[escalationsResponse](t, recorder)
+	require.Len(t, queue.Escalations, 2)
+	assert.Equal(t, int64(2), queue.Pagination.Total)
+	assert.Equal(t, theirsEscalation.ID, queue.Escalations[0].ID)
+	assert.Equal(t, models.EscalationStatusResolved, queue.Escalations[1].Status)
+}
@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	authUserService "smart-chat/internal/services/auth_user"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/export"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type exportResponse struct {
+	Export export.Job `json:"export"`
+}
+
+type exportsResponse struct {
+	Exports []export.Job `json:"exports"`
+}
+
+// exportedRow is the subset of the Parquet columns the tests read back.
+type exportedRow struct {
+	ConversationID int64  `parquet:"conversation_id"`
+	Transcript     string `parquet:"transcript"`
+}
+
+// runExport creates an export, runs the worker and returns the completed job.
+func runExport(t *testing.T, router *gin.Engine, exports *export.Service, format, query string) export.Job {
+	t.Helper()
+	recorder := clientJSON(router, http.MethodPost, "/v2/client/exports"+query, map[string]any{"format": format})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	job := decodeJSON[exportResponse](t, recorder).Export
+	assert.Equal(t, models.ExportStatusQueued, job.Status)
+
+	exports.RunPending(context.Background())
+
+	recorder = clientJSON(router, http.MethodGet, "/v2/client/exports/"+strconv.FormatUint(uint64(job.ID), 10), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	job = decodeJSON[exportResponse](t, recorder).Export
+	require.Equal(t, models.ExportStatusCompleted, job.Status, job.Error)
+	require.NotEmpty(t, job.DownloadURL)
+	return job
+}
+
+// download opens a download link without an access token.
+func download(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func setupExportRoutes(db *gorm.DB, zitadelID string, exports *export.Service) *gin.Engine {
+	return mountClientRoutes(db, mockTokenValidator{userID: zitadelID}, authUserService.NewService(db, authUserService.Settings{}, nil), exports)
+}
+
+func TestExports_WriteEachFormatThroughSignedLinks(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-export-admin", "Export Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-export-agent", "Export Agent")
+	_, _, assigned, _ := utils.SetupTestEntities(db)
+	_, _, other, _ := utils.SetupTestEntities(db)
+	addMessage(t, db, assigned.ID, "Is Kedarnath open in May?", "Yes, from early May.", true)
+	addMessage(t, db, assigned.ID, "internal", "hidden", false)
+	_, err := authUserConversation.NewService(db).LinkConversations(agent.UserID, []uint{assigned.ID}, 0)
+	require.NoError(t, err)
+
+	exports := export.NewService(db, blobstore.NewLocalStore(t.TempDir()), export.Settings{LinkKey: []byte("test-link-key")})
+	agentRouter := setupExportRoutes(db, "zitadel-export-agent", exports)
+	admin := setupExportRoutes(db, "zitadel-export-admin", exports)
+
+	// Agents export only the conversations assigned to them.
+	job := runExport(t, agentRouter, exports, models.ExportFormatCSV, "")
+	assert.Equal(t, 1, job.ConversationCount)
+	recorder := download(agentRouter, job.DownloadURL)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), ".csv")
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "conversation_id", rows[0][0])
+	assert.Equal(t, strconv.FormatUint(uint64(assigned.ID), 10), rows[1][0])
+	assert.Contains(t, rows[1][8], "User: Is Kedarnath open in May?")
+	assert.NotContains(t, rows[1][8], "hidden")
+
+	// Admins export every conversation matching the filters.
+	job = runExport(t, admin, exports, models.ExportFormatJSONL, "?conversationid="+strconv.FormatUint(uint64(other.ID), 10))
+	recorder = download(admin, job.DownloadURL)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var records []export.Record
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var record export.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 1)
+	assert.Equal(t, other.ID, records[0].ConversationID)
+	assert.Equal(t, "Hello", records[0].Messages[0].User)
+
+	job = runExport(t, admin, exports, models.ExportFormatParquet, "")
+	assert.Equal(t, 2, job.ConversationCount)
+	recorder = download(admin, job.DownloadURL)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	body := recorder.Body.Bytes()
+	parquetRows, err := parquet.Read[exportedRow](bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	require.Len(t, parquetRows, 2)
+	assert.Equal(t, int64(assigned.ID), parquetRows[0].ConversationID)
+	assert.Contains(t, parquetRows[0].Transcript, "Bot: Yes, from early May.")
+
+	recorder = clientJSON(admin, http.MethodGet, "/v2/client/exports", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, decodeJSON[exportsResponse](t, recorder).Exports, 2)
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ? AND target_id = ?", audit.ActionExportCreate, strconv.FormatUint(uint64(job.ID), 10)).First(&event).Error)
+	assert.Equal(t, audit.TargetExport, event.TargetType)
+}
+
+func TestExports_RejectBadRequestsAndTamperedLinks(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-export-admin", "Export Admin")
+	utils.SetupTestEntities(db)
+
+	exports := export.NewService(db, blobstore.NewLocalStore(t.TempDir()), export.Settings{LinkKey: []byte("test-link-key")})
+	admin := setupExportRoutes(db, "zitadel-export-admin", exports)
+
+	recorder := clientJSON(admin, http.MethodPost, "/v2/client/exports", map[string]any{"format": "xlsx"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = clientJSON(admin, http.MethodPost, "/v2/client/exports?conversationid=abc", map[string]any{"format": "csv"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	job := runExport(t, admin, exports, models.ExportFormatCSV, "")
+	tampered := strings.Replace(job.DownloadURL, "signature=", "signature=0", 1)
+	assert.Equal(t, http.StatusForbidden, download(admin, tampered).Code)
+
+	recorder = clientJSON(admin, http.MethodGet, "/v2/client/exports/9999", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestExports_CSVQuotesFormulaCells(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-export-admin", "Export Admin")
+	user, _, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Model(&user).Updates(map[string]any{"name": `=HYPERLINK("https://example.com","Asha")`, "mobile": "+919876543210"}).Error)
+
+	exports := export.NewService(db, blobstore.NewLocalStore(t.TempDir()), export.Settings{LinkKey: []byte("test-link-key")})
+	admin := setupExportRoutes(db, "zitadel-export-admin", exports)
+
+	job := runExport(t, admin, exports, models.ExportFormatCSV, "?conversationid="+strconv.FormatUint(uint64(conv.ID), 10))
+	recorder := download(admin, job.DownloadURL)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, `'=HYPERLINK("https://example.com","Asha")`, rows[1][5])
+	assert.Equal(t, "'+919876543210", rows[1][6])
+	assert.Equal(t, strconv.FormatUint(uint64(conv.ID), 10), rows[1][0])
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"smart-chat/internal/handlers"
+	"smart-chat/internal/rbac"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	"smart-chat/tests/utils"
 
@@ -27,7 +28,7 @@ func TestGetAgentsHandler_UnauthorizedWithoutToken(t *testing.T) {
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.GET("/agents", handlers.GetAgentsHandler(service, mockTokenValidator{userID: "zitadel-admin"}))
+	router.GET("/agents", authorize(db, mockTokenValidator{userID: "zitadel-admin"}, rbac.AgentsRead), handlers.GetAgentsHandler(service))
 
 	req, _ := http.NewRequest(http.MethodGet, "/agents", nil)
 	recorder := httptest.NewRecorder()
@@ -46,7 +47,7 @@ func TestGetAgentsHandler_ForbiddenForNonAdmin(t *testing.T) {
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.GET("/agents", handlers.GetAgentsHandler(service, mockTokenValidator{userID: "zitadel-agent-only"}))
+	router.GET("/agents", authorize(db, mockTokenValidator{userID: "zitadel-agent-only"}, rbac.AgentsRead), handlers.GetAgentsHandler(service))
 
 	req, _ := http.NewRequest(http.MethodGet, "/agents", nil)
 	req.Header.Set("Authorization", "Bearer token")
@@ -67,7 +68,7 @@ func TestGetAgentsHandler_SuccessForAdmin(t *testing.T) {
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.GET("/agents", handlers.GetAgentsHandler(service, mockTokenValidator{userID: "zitadel-admin-list"}))
+	router.GET("/agents", authorize(db, mockTokenValidator{userID: "zitadel-admin-list"}, rbac.AgentsRead), handlers.GetAgentsHandler(service))
 
 	req, _ := http.NewRequest(http.MethodGet, "/agents", nil)
 	req.Header.Set("Authorization", "Bearer token")
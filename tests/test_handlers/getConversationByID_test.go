@@ -9,8 +9,11 @@ import (
 
 	"smart-chat/internal/handlers"
 	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/note"
+	"smart-chat/internal/services/sla"
 	"smart-chat/tests/utils"
 
 	"github.com/gin-gonic/gin"
@@ -37,10 +40,12 @@ func setupConversationByIDRouter(db *gorm.DB, zitadelUserID string) *gin.Engine
 	router := gin.New()
 	router.GET(
 		"/conversation/:id",
+		authorize(db, mockTokenValidator{userID: zitadelUserID}, rbac.ConversationsReadAssigned),
 		handlers.GetConversationByIDHandler(
 			historyService,
 			authUserConversationService,
-			mockTokenValidator{userID: zitadelUserID},
+			sla.NewService(db, sla.Settings{}, nil),
+			note.NewService(db),
 		),
 	)
 
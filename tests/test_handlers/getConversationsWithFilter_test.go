@@ -12,9 +12,14 @@ import (
 	"smart-chat/internal/authservice/zitadel"
 	"smart-chat/internal/constants"
 	"smart-chat/internal/handlers"
+	middleware "smart-chat/internal/middlewares"
 	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	authUserService "smart-chat/internal/services/auth_user"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/sla"
+	"smart-chat/internal/services/tag"
 	"smart-chat/tests/utils"
 
 	"github.com/gin-gonic/gin"
@@ -41,6 +46,11 @@ func (m mockTokenValidator) ValidateToken(_ context.Context, _ string) (*zitadel
 	return &zitadel.ValidateTokenUser{ID: &uid}, nil
 }
 
+// authorize mounts the client rbac middleware for permission in front of a handler.
+func authorize(db *gorm.DB, validator zitadel.TokenValidator, permission rbac.Permission) gin.HandlerFunc {
+	return middleware.NewAuthorizer(authUserService.NewService(db, authUserService.Settings{}, nil), validator).Require(permission)
+}
+
 func setupAdminAuthUser(t *testing.T, db *gorm.DB, zitadelUserID string) {
 	t.Helper()
 
@@ -92,10 +102,12 @@ func setupRouter(db *gorm.DB, zitadelUserID string) *gin.Engine {
 	router := gin.New()
 	router.GET(
 		"/conversations",
+		authorize(db, mockTokenValidator{userID: zitadelUserID}, rbac.ConversationsReadAssigned),
 		handlers.GetConversationsWithFiltersHandler(
 			historyService,
 			authUserConversationService,
-			mockTokenValidator{userID: zitadelUserID},
+			sla.NewService(db, sla.Settings{}, nil),
+			tag.NewService(db, nil),
 		),
 	)
 
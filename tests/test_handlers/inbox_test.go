@@ -0,0 +1,232 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-chat/internal/handlers"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/human"
+	"smart-chat/internal/services/inbox"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type sseFrame struct {
+	ID    string
+	Event string
+	Data  inbox.Event
+}
+
+type inboxStream struct {
+	frames chan sseFrame
+	close  func()
+}
+
+// openInbox connects to the inbox stream as the auth user, resuming after cursor when it is not empty.
+func openInbox(t *testing.T, db *gorm.DB, hub *inbox.Hub, zitadelUserID, cursor string) *inboxStream {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/inbox/events", authorize(db, mockTokenValidator{userID: zitadelUserID}, rbac.ConversationsReadAssigned), handlers.GetInboxEventsHandler(hub))
+	server := httptest.NewServer(router)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/inbox/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer test-token")
+	if cursor != "" {
+		req.Header.Set("Last-Event-ID", cursor)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	frames := make(chan sseFrame, 16)
+	go func() {
+		defer close(frames)
+		reader := bufio.NewReader(resp.Body)
+		var frame sseFrame
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case line == "":
+				if frame.Event != "" {
+					frames <- frame
+				}
+				frame = sseFrame{}
+			case strings.HasPrefix(line, "id: "):
+				frame.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				frame.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame.Data)
+			}
+		}
+	}()
+
+	stream := &inboxStream{frames: frames}
+	stream.close = func() {
+		resp.Body.Close()
+		server.CloseClientConnections()
+		server.Close()
+	}
+	t.Cleanup(stream.close)
+	return stream
+}
+
+func (s *inboxStream) next(t *testing.T) sseFrame {
+	t.Helper()
+	select {
+	case frame, ok := <-s.frames:
+		require.True(t, ok, "inbox stream closed")
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an inbox event")
+		return sseFrame{}
+	}
+}
+
+func startInboxHub(t *testing.T, db *gorm.DB) *inbox.Hub {
+	t.Helper()
+	// The hub polls from its own goroutine; one connection keeps the shared in-memory SQLite
+	// database from reporting lock conflicts.
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	hub := inbox.NewHub(db, inbox.HubSettings{PollInterval: 20 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, hub.Start(ctx))
+	return hub
+}
+
+func TestInbox_StreamsEventsScopedToAssignees(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-inbox-admin", "Inbox Admin")
+	first := setupAuthUserWithRole(t, db, "AGENT", "zitadel-inbox-first", "First Agent")
+	second := setupAuthUserWithRole(t, db, "AGENT", "zitadel-inbox-second", "Second Agent")
+	_, _, assigned, _ := utils.SetupTestEntities(db)
+	_, _, other, _ := utils.SetupTestEntities(db)
+	assignments := authUserConversation.NewService(db)
+	_, err := assignments.LinkConversations(first.UserID, []uint{assigned.ID}, 0)
+	require.NoError(t, err)
+
+	hub := startInboxHub(t, db)
+	admin := openInbox(t, db, hub, "zitadel-inbox-admin", "")
+	agent := openInbox(t, db, hub, "zitadel-inbox-first", "")
+
+	humanService := human.NewHumanService(db)
+	require.NoError(t, humanService.AddMessage(assigned.ID, first.UserID, "Hello from your executive"))
+	require.NoError(t, humanService.AddMessage(other.ID, 0, "Message on someone else's conversation"))
+
+	frame := admin.next(t)
+	assert.Equal(t, inbox.EventMessageCreated, frame.Event)
+	assert.Equal(t, assigned.ID, frame.Data.ConversationID)
+	assert.Equal(t, strconv.FormatUint(uint64(frame.Data.ID), 10), frame.ID)
+	frame = admin.next(t)
+	assert.Equal(t, other.ID, frame.Data.ConversationID)
+
+	frame = agent.next(t)
+	assert.Equal(t, inbox.EventMessageCreated, frame.Event)
+	assert.Equal(t, assigned.ID, frame.Data.ConversationID)
+	var message map[string]any
+	require.NoError(t, json.Unmarshal(frame.Data.Data, &message))
+	assert.EqualValues(t, models.MessageTypeAgentAssumedAssistant, message["type"])
+	assert.EqualValues(t, first.UserID, message["author_auth_user_id"])
+
+	// The agent hears about losing the conversation, and nothing on it afterwards.
+	require.NoError(t, assignments.Reassign(authUserConversation.ReassignInput{
+		ConversationID: assigned.ID,
+		ToUserID:       second.UserID,
+		CarryTracking:  true,
+	}))
+	require.NoError(t, humanService.AddMessage(assigned.ID, second.UserID, "Taking over"))
+	_, err = assignments.LinkConversations(first.UserID, []uint{other.ID}, 0)
+	require.NoError(t, err)
+
+	frame = agent.next(t)
+	assert.Equal(t, inbox.EventAssignmentChanged, frame.Event)
+	assert.Equal(t, assigned.ID, frame.Data.ConversationID)
+	var change map[string]any
+	require.NoError(t, json.Unmarshal(frame.Data.Data, &change))
+	assert.Equal(t, authUserConversation.AssignmentActionReassigned, change["action"])
+	assert.EqualValues(t, second.UserID, change["auth_user_id"])
+
+	frame = agent.next(t)
+	assert.Equal(t, inbox.EventAssignmentChanged, frame.Event)
+	assert.Equal(t, other.ID, frame.Data.ConversationID)
+}
+
+func TestInbox_ResumesFromCursor(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-inbox-resume", "Resume Agent")
+	_, _, assigned, _ := utils.SetupTestEntities(db)
+	_, _, other, _ := utils.SetupTestEntities(db)
+	assignments := authUserConversation.NewService(db)
+	_, err := assignments.LinkConversations(agent.UserID, []uint{assigned.ID}, 0)
+	require.NoError(t, err)
+
+	hub := startInboxHub(t, db)
+	stream := openInbox(t, db, hub, "zitadel-inbox-resume", "")
+	started := true
+	_, err = assignments.UpdateConversationTracking(authUserConversation.UpdateConversationTrackingInput{
+		AuthUserID:     agent.UserID,
+		ConversationID: assigned.ID,
+		Started:        &started,
+	})
+	require.NoError(t, err)
+	frame := stream.next(t)
+	assert.Equal(t, inbox.EventTrackingUpdated, frame.Event)
+	stream.close()
+
+	// Missed while disconnected: one event on the agent's conversation and one on another.
+	humanService := human.NewHumanService(db)
+	require.NoError(t, humanService.AddMessage(other.ID, 0, "Not for this agent"))
+	require.NoError(t, humanService.AddMessage(assigned.ID, 0, "Sent while the console was offline"))
+
+	stream = openInbox(t, db, hub, "zitadel-inbox-resume", frame.ID)
+	resumed := stream.next(t)
+	assert.Equal(t, inbox.EventMessageCreated, resumed.Event)
+	assert.Equal(t, assigned.ID, resumed.Data.ConversationID)
+
+	// Live events keep flowing after the replay.
+	require.NoError(t, humanService.AddMessage(assigned.ID, 0, "Live again"))
+	live := stream.next(t)
+	assert.Greater(t, live.Data.ID, resumed.Data.ID)
+
+	// A cursor whose events were pruned asks the client to reload.
+	require.NoError(t, db.Where("id <= ?", resumed.Data.ID).Delete(&models.InboxEvent{}).Error)
+	stream = openInbox(t, db, hub, "zitadel-inbox-resume", frame.ID)
+	assert.Equal(t, "reset", stream.next(t).Event)
+
+	req := httptest.NewRequest(http.MethodGet, "/inbox/events?cursor=latest", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	recorder := httptest.NewRecorder()
+	router := gin.New()
+	router.GET("/inbox/events", authorize(db, mockTokenValidator{userID: "zitadel-inbox-resume"}, rbac.ConversationsReadAssigned), handlers.GetInboxEventsHandler(hub))
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -9,6 +9,7 @@ import (
 
 	"smart-chat/internal/handlers"
 	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	"smart-chat/tests/utils"
 
@@ -22,7 +23,7 @@ func TestLinkAuthUserConversationsHandler_UnauthorizedWithoutToken(t *testing.T)
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.POST("/conversations/link", handlers.LinkAuthUserConversationsHandler(service, mockTokenValidator{userID: "zitadel-admin"}))
+	router.POST("/conversations/link", authorize(db, mockTokenValidator{userID: "zitadel-admin"}, rbac.ConversationsAssign), handlers.LinkAuthUserConversationsHandler(service, nil))
 
 	payload := map[string]any{"user_id": 1, "conversation_ids": []uint{1}}
 	body, _ := json.Marshal(payload)
@@ -45,7 +46,7 @@ func TestLinkAuthUserConversationsHandler_ForbiddenForNonAdmin(t *testing.T) {
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.POST("/conversations/link", handlers.LinkAuthUserConversationsHandler(service, mockTokenValidator{userID: "zitadel-agent-link"}))
+	router.POST("/conversations/link", authorize(db, mockTokenValidator{userID: "zitadel-agent-link"}, rbac.ConversationsAssign), handlers.LinkAuthUserConversationsHandler(service, nil))
 
 	payload := map[string]any{"user_id": agent.UserID, "conversation_ids": []uint{conv.ID}}
 	body, _ := json.Marshal(payload)
@@ -70,7 +71,7 @@ func TestLinkAuthUserConversationsHandler_SuccessForAdmin(t *testing.T) {
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.POST("/conversations/link", handlers.LinkAuthUserConversationsHandler(service, mockTokenValidator{userID: "zitadel-admin-link"}))
+	router.POST("/conversations/link", authorize(db, mockTokenValidator{userID: "zitadel-admin-link"}, rbac.ConversationsAssign), handlers.LinkAuthUserConversationsHandler(service, nil))
 
 	payload := map[string]any{"user_id": targetAgent.UserID, "conversation_ids": []uint{conv.ID}}
 	body, _ := json.Marshal(payload)
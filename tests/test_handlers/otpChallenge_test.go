@@ -0,0 +1,294 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"smart-chat/auth"
+	"smart-chat/config"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/slack"
+	"smart-chat/internal/tokenhash"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// recordingOTPSender keeps the last code sent to each mobile.
+type recordingOTPSender struct {
+	mu    sync.Mutex
+	codes map[string]string
+	sent  int
+}
+
+func (s *recordingOTPSender) Name() string { return "recording" }
+
+func (s *recordingOTPSender) Send(_ context.Context, mobile, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.codes == nil {
+		s.codes = map[string]string{}
+	}
+	s.codes[mobile] = code
+	s.sent++
+	return nil
+}
+
+func (s *recordingOTPSender) code(mobile string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.codes[mobile]
+}
+
+func newSlackAlertRecorder(t *testing.T, db *gorm.DB) (*slack.SlackService, chan string) {
+	alerts := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		alerts <- payload["text"]
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return slack.NewSlackService(&config.Config{SlackNotificationURL: server.URL, SlackAlertURL: server.URL}, db), alerts
+}
+
+func newOTPChallengeService(db *gorm.DB, sender *recordingOTPSender, slackService *slack.SlackService) *auth.AuthV2Service {
+	return &auth.AuthV2Service{
+		DB:         db,
+		OTPSender:  sender,
+		OTPHashKey: "test-otp-key",
+		OTPLimits: auth.OTPLimits{
+			Expiry:         5 * time.Minute,
+			MaxAttempts:    3,
+			Lockout:        30 * time.Minute,
+			ResendCooldown: time.Minute,
+			DailyLimit:     2,
+			IPDailyLimit:   3,
+		},
+		Slack: slackService,
+	}
+}
+
+func setupOTPAuthRouter(service *auth.AuthV2Service) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auth.RegisterV2AuthRoutes(router.Group("/v2/auth"), service)
+	return router
+}
+
+func postAuthJSON(router *gin.Engine, path, ip string, payload any) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":40000"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func initOTPLogin(t *testing.T, router *gin.Engine, mobile, ip string) (int, map[string]any) {
+	recorder := postAuthJSON(router, "/v2/auth/init-login", ip, map[string]string{"name": "Asha", "mobile": mobile})
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	return recorder.Code, body
+}
+
+func expectAlert(t *testing.T, alerts chan string) string {
+	select {
+	case msg := <-alerts:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Slack alert")
+		return ""
+	}
+}
+
+func TestOTPChallenge_CodeIsHashedAndSingleUse(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, nil))
+
+	status, body := initOTPLogin(t, router, "98765 43210", "203.0.113.10")
+	require.Equal(t, http.StatusOK, status)
+	token := body["authToken"].(string)
+	code := sender.code("+919876543210")
+	require.Len(t, code, 4)
+
+	var challenge models.OTPChallenge
+	require.NoError(t, db.Where("token = ?", tokenhash.Default().Hash(token)).First(&challenge).Error)
+	assert.Equal(t, "+919876543210", challenge.Mobile)
+	assert.Equal(t, "203.0.113.10", challenge.IPAddress)
+	assert.Len(t, challenge.CodeHash, 64)
+	assert.NotContains(t, challenge.CodeHash, code)
+
+	var user models.User
+	require.NoError(t, db.First(&user, challenge.UserID).Error)
+	assert.Empty(t, user.OTP)
+
+	recorder := postAuthJSON(router, "/v2/auth/validate-login", "203.0.113.10", map[string]string{"token": token, "otp": code})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "accessToken")
+
+	recorder = postAuthJSON(router, "/v2/auth/validate-login", "203.0.113.10", map[string]string{"token": token, "otp": code})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, `{"error":"Invalid OTP or expired","success":false}`, recorder.Body.String())
+}
+
+func TestOTPChallenge_LocksOutAfterFailedAttempts(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, slackService))
+
+	_, body := initOTPLogin(t, router, "+919876543210", "203.0.113.11")
+	token := body["authToken"].(string)
+	code := sender.code("+919876543210")
+	wrong := "0000"
+	if code == wrong {
+		wrong = "1111"
+	}
+
+	var responses []string
+	for i := 0; i < 3; i++ {
+		recorder := postAuthJSON(router, "/v2/auth/validate-login", "203.0.113.11", map[string]string{"token": token, "otp": wrong})
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		responses = append(responses, recorder.Body.String())
+	}
+
+	alert := expectAlert(t, alerts)
+	assert.Contains(t, alert, "OTP lockout")
+	assert.Contains(t, alert, "*********3210")
+	assert.NotContains(t, alert, "9876543210")
+
+	// The right code no longer works, and the response is the same as for a wrong one.
+	recorder := postAuthJSON(router, "/v2/auth/validate-login", "203.0.113.11", map[string]string{"token": token, "otp": code})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	responses = append(responses, recorder.Body.String())
+	for _, response := range responses {
+		assert.Equal(t, responses[0], response)
+	}
+
+	var challenge models.OTPChallenge
+	require.NoError(t, db.Where("token = ?", tokenhash.Default().Hash(token)).First(&challenge).Error)
+	assert.Equal(t, 3, challenge.Attempts)
+	require.NotNil(t, challenge.LockedUntil)
+
+	// No new code is sent to a locked-out mobile, even from another IP.
+	status, body := initOTPLogin(t, router, "+919876543210", "198.51.100.20")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "Too many OTP requests, please try again later", body["error"])
+	assert.Equal(t, 1, sender.sent)
+}
+
+func TestOTPChallenge_ResendCooldownPerMobileAndIP(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, nil))
+
+	status, _ := initOTPLogin(t, router, "+919876543210", "203.0.113.12")
+	require.Equal(t, http.StatusOK, status)
+
+	// Same mobile spelled differently, from a different IP.
+	status, throttledMobile := initOTPLogin(t, router, "9876543210", "198.51.100.21")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// Same IP, different mobile.
+	status, throttledIP := initOTPLogin(t, router, "+919812345678", "203.0.113.12")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, throttledMobile, throttledIP)
+
+	status, _ = initOTPLogin(t, router, "+919812345678", "198.51.100.22")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, sender.sent)
+}
+
+func TestOTPChallenge_UsesTheE164User(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	// A WhatsApp user, stored as +<wa_id>, and a user from an older login stored as typed.
+	whatsappUser := models.User{Name: "Asha", Mobile: "+919876543210", AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&whatsappUser).Error)
+	legacyUser := models.User{Name: "Ravi", Mobile: "9812345678", AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&legacyUser).Error)
+
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, nil))
+
+	status, _ := initOTPLogin(t, router, "98765 43210", "203.0.113.14")
+	require.Equal(t, http.StatusOK, status)
+	status, _ = initOTPLogin(t, router, "98123-45678", "203.0.113.15")
+	require.Equal(t, http.StatusOK, status)
+
+	var challenges []models.OTPChallenge
+	require.NoError(t, db.Order("id").Find(&challenges).Error)
+	require.Len(t, challenges, 2)
+	assert.Equal(t, whatsappUser.ID, challenges[0].UserID)
+	assert.Equal(t, legacyUser.ID, challenges[1].UserID)
+
+	var users []models.User
+	require.NoError(t, db.Order("id").Find(&users).Error)
+	require.Len(t, users, 2)
+	assert.Equal(t, "+919812345678", users[1].Mobile)
+}
+
+func TestOTPChallenge_DailyLimitAlertsAndBlocks(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	sender := &recordingOTPSender{}
+	service := newOTPChallengeService(db, sender, slackService)
+	router := setupOTPAuthRouter(service)
+
+	// Age the first code past the cooldown so only the daily limit applies.
+	status, _ := initOTPLogin(t, router, "+919876543210", "203.0.113.13")
+	require.Equal(t, http.StatusOK, status)
+	require.NoError(t, db.Model(&models.OTPChallenge{}).Where("mobile = ?", "+919876543210").
+		UpdateColumn("created_at", time.Now().Add(-time.Hour)).Error)
+
+	status, _ = initOTPLogin(t, router, "+919876543210", "198.51.100.23")
+	require.Equal(t, http.StatusOK, status)
+	alert := expectAlert(t, alerts)
+	assert.Contains(t, alert, "OTP daily limit reached: 2 codes sent to *********3210")
+
+	require.NoError(t, db.Model(&models.OTPChallenge{}).Where("mobile = ?", "+919876543210").
+		UpdateColumn("created_at", time.Now().Add(-time.Hour)).Error)
+	status, _ = initOTPLogin(t, router, "+919876543210", "198.51.100.24")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, 2, sender.sent)
+
+	// Codes older than 24 hours no longer count.
+	require.NoError(t, db.Model(&models.OTPChallenge{}).Where("mobile = ?", "+919876543210").
+		UpdateColumn("created_at", time.Now().Add(-25*time.Hour)).Error)
+	status, _ = initOTPLogin(t, router, "+919876543210", "198.51.100.24")
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestOTPChallenge_InvalidMobileIsRejected(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, nil))
+
+	status, body := initOTPLogin(t, router, "12ab", "203.0.113.14")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Invalid mobile number", body["error"])
+	assert.Zero(t, sender.sent)
+}
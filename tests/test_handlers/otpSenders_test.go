@@ -0,0 +1,302 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"smart-chat/auth"
+	"smart-chat/config"
+	cloudapi "smart-chat/external/whatsapp"
+	"smart-chat/internal/otp"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOTPCode = "482913"
+
+// otpProviderCase describes how a gateway-backed OTPSender talks to its gateway, so the same
+// conformance checks can run against every provider.
+type otpProviderCase struct {
+	name      string
+	newSender func(t *testing.T, gatewayURL string) otp.OTPSender
+	okBody    string
+	// rejectBody is a 200 response in which the gateway refuses the message. Empty when the
+	// provider only signals failure through the status code.
+	rejectBody string
+	// delivered extracts the recipient and code from a gateway request.
+	delivered func(t *testing.T, req utils.OTPGatewayRequest) (string, string)
+	recipient string
+}
+
+func otpProviderCases() []otpProviderCase {
+	return []otpProviderCase{
+		{
+			name: otp.ProviderFast2SMS,
+			newSender: func(t *testing.T, gatewayURL string) otp.OTPSender {
+				return otp.NewFast2SMSSender(gatewayURL+"/dev/bulkV2", "fast2sms-key")
+			},
+			okBody:     `{"return":true,"request_id":"req-1","message":["SMS sent successfully."]}`,
+			rejectBody: `{"return":false,"status_code":412,"message":"Invalid Authentication, Check Authorization Key"}`,
+			delivered: func(t *testing.T, req utils.OTPGatewayRequest) (string, string) {
+				assert.Equal(t, http.MethodGet, req.Method)
+				assert.Equal(t, "/dev/bulkV2", req.Path)
+				assert.Equal(t, "fast2sms-key", req.Query.Get("authorization"))
+				assert.Equal(t, "otp", req.Query.Get("route"))
+				return req.Query.Get("numbers"), req.Query.Get("variables_values")
+			},
+			recipient: "9876543210",
+		},
+		{
+			name: otp.ProviderHTTPTemplate,
+			newSender: func(t *testing.T, gatewayURL string) otp.OTPSender {
+				sender, err := otp.NewHTTPTemplateSender(
+					http.MethodPost,
+					gatewayURL+"/v1/otp?to={{urlquery .Digits}}",
+					`{"X-Api-Key":"gateway-key"}`,
+					`{"mobile": {{json .E164}}, "otp": {{json .Code}}}`,
+				)
+				require.NoError(t, err)
+				return sender
+			},
+			okBody: `{"status":"queued"}`,
+			delivered: func(t *testing.T, req utils.OTPGatewayRequest) (string, string) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "/v1/otp", req.Path)
+				assert.Equal(t, "gateway-key", req.Header.Get("X-Api-Key"))
+				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+				assert.Equal(t, "919876543210", req.Query.Get("to"))
+
+				var body struct {
+					Mobile string `json:"mobile"`
+					OTP    string `json:"otp"`
+				}
+				require.NoError(t, json.Unmarshal(req.Body, &body))
+				return body.Mobile, body.OTP
+			},
+			recipient: "+919876543210",
+		},
+		{
+			name: otp.ProviderWhatsApp,
+			newSender: func(t *testing.T, gatewayURL string) otp.OTPSender {
+				return otp.NewWhatsAppSender(gatewayURL, "1234567890", "graph-token", "login_code", "en")
+			},
+			okBody:     `{"messaging_product":"whatsapp","messages":[{"id":"wamid.otp-1"}]}`,
+			rejectBody: `{"messaging_product":"whatsapp","messages":[]}`,
+			delivered: func(t *testing.T, req utils.OTPGatewayRequest) (string, string) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "/1234567890/messages", req.Path)
+				assert.Equal(t, "Bearer graph-token", req.Header.Get("Authorization"))
+
+				var message cloudapi.SendMessageRequest
+				require.NoError(t, json.Unmarshal(req.Body, &message))
+				assert.Equal(t, "template", message.Type)
+				require.NotNil(t, message.Template)
+				assert.Equal(t, "login_code", message.Template.Name)
+				require.Len(t, message.Template.Components, 2)
+				assert.Equal(t, "button", message.Template.Components[1].Type)
+				assert.Equal(t, testOTPCode, message.Template.Components[1].Parameters[0].Text)
+				return message.To, message.Template.Components[0].Parameters[0].Text
+			},
+			recipient: "919876543210",
+		},
+	}
+}
+
+func TestOTPSenders_Conformance(t *testing.T) {
+	for _, tc := range otpProviderCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("delivers the code", func(t *testing.T) {
+				gateway := utils.NewFakeOTPGateway()
+				defer gateway.Close()
+				gateway.Respond(http.StatusOK, tc.okBody)
+				sender := tc.newSender(t, gateway.URL())
+
+				assert.Equal(t, tc.name, sender.Name())
+				require.NoError(t, sender.Send(context.Background(), "+919876543210", testOTPCode))
+				// Numbers stored without a country code are treated as Indian.
+				require.NoError(t, sender.Send(context.Background(), "98765 43210", testOTPCode))
+
+				requests := gateway.Requests()
+				require.Len(t, requests, 2)
+				for _, req := range requests {
+					recipient, code := tc.delivered(t, req)
+					assert.Equal(t, tc.recipient, recipient)
+					assert.Equal(t, testOTPCode, code)
+				}
+			})
+
+			t.Run("fails on gateway errors without leaking the code", func(t *testing.T) {
+				gateway := utils.NewFakeOTPGateway()
+				defer gateway.Close()
+				gateway.Respond(http.StatusServiceUnavailable, `{"error":"upstream unavailable"}`)
+				sender := tc.newSender(t, gateway.URL())
+
+				err := sender.Send(context.Background(), "+919876543210", testOTPCode)
+				require.Error(t, err)
+				assert.NotContains(t, err.Error(), testOTPCode)
+			})
+
+			if tc.rejectBody != "" {
+				t.Run("fails when the gateway rejects the message", func(t *testing.T) {
+					gateway := utils.NewFakeOTPGateway()
+					defer gateway.Close()
+					gateway.Respond(http.StatusOK, tc.rejectBody)
+					sender := tc.newSender(t, gateway.URL())
+
+					err := sender.Send(context.Background(), "+919876543210", testOTPCode)
+					require.Error(t, err)
+					assert.NotContains(t, err.Error(), testOTPCode)
+				})
+			}
+
+			t.Run("rejects invalid numbers without calling the gateway", func(t *testing.T) {
+				gateway := utils.NewFakeOTPGateway()
+				defer gateway.Close()
+				sender := tc.newSender(t, gateway.URL())
+
+				for _, mobile := range []string{"", "+91", "not-a-number", "+91987654321098765"} {
+					assert.ErrorIs(t, sender.Send(context.Background(), mobile, testOTPCode), otp.ErrInvalidMobile, mobile)
+				}
+				assert.Empty(t, gateway.Requests())
+			})
+
+			t.Run("stops when the context is cancelled", func(t *testing.T) {
+				gateway := utils.NewFakeOTPGateway()
+				defer gateway.Close()
+				gateway.Respond(http.StatusOK, tc.okBody)
+				sender := tc.newSender(t, gateway.URL())
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				err := sender.Send(ctx, "+919876543210", testOTPCode)
+				assert.ErrorIs(t, err, context.Canceled)
+				assert.Empty(t, gateway.Requests())
+			})
+		})
+	}
+}
+
+func TestFast2SMSSender_RefusesNonIndianNumbers(t *testing.T) {
+	gateway := utils.NewFakeOTPGateway()
+	defer gateway.Close()
+
+	sender := otp.NewFast2SMSSender(gateway.URL(), "fast2sms-key")
+	assert.ErrorIs(t, sender.Send(context.Background(), "+14155550100", testOTPCode), otp.ErrUnsupportedMobile)
+	assert.Empty(t, gateway.Requests())
+}
+
+func TestFailover_UsesNextProviderWhenOneFails(t *testing.T) {
+	sms := utils.NewFakeOTPGateway()
+	defer sms.Close()
+	sms.Respond(http.StatusInternalServerError, `{}`)
+
+	graph := utils.NewFakeOTPGateway()
+	defer graph.Close()
+	graph.Respond(http.StatusOK, `{"messaging_product":"whatsapp","messages":[{"id":"wamid.otp-1"}]}`)
+
+	sender := otp.NewFailover(
+		otp.NewFast2SMSSender(sms.URL(), "fast2sms-key"),
+		otp.NewWhatsAppSender(graph.URL(), "1234567890", "graph-token", "login_code", "en"),
+	)
+	assert.Equal(t, "failover(fast2sms,whatsapp)", sender.Name())
+
+	require.NoError(t, sender.Send(context.Background(), "+919876543210", testOTPCode))
+	assert.Len(t, sms.Requests(), 1)
+	assert.Len(t, graph.Requests(), 1)
+
+	// Numbers Fast2SMS cannot reach go straight to the next provider.
+	require.NoError(t, sender.Send(context.Background(), "+14155550100", testOTPCode))
+	assert.Len(t, sms.Requests(), 1)
+	assert.Len(t, graph.Requests(), 2)
+
+	graph.Respond(http.StatusBadRequest, `{"error":{"message":"Template name does not exist"}}`)
+	err := sender.Send(context.Background(), "+919876543210", testOTPCode)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fast2sms:")
+	assert.Contains(t, err.Error(), "whatsapp:")
+	assert.NotContains(t, err.Error(), testOTPCode)
+}
+
+func TestConsoleAndFileSenders_WriteCodesLocally(t *testing.T) {
+	var out bytes.Buffer
+	console := otp.NewConsoleSender(&out)
+	require.NoError(t, console.Send(context.Background(), "9876543210", testOTPCode))
+	assert.Contains(t, out.String(), "+919876543210")
+	assert.Contains(t, out.String(), testOTPCode)
+
+	path := filepath.Join(t.TempDir(), "otp", "codes.log")
+	file := otp.NewFileSender(path)
+	require.NoError(t, file.Send(context.Background(), "+919876543210", testOTPCode))
+	require.NoError(t, file.Send(context.Background(), "+919876543210", "111111"))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], "\t+919876543210\t"+testOTPCode))
+	assert.True(t, strings.HasSuffix(lines[1], "\t111111"))
+}
+
+func TestOTPNew_BuildsConfiguredProviders(t *testing.T) {
+	cfg := &config.Config{
+		OTPProviders:     "fast2sms, console",
+		FAST2SMS_API_KEY: "fast2sms-key",
+	}
+	sender, err := otp.New(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "failover(fast2sms,console)", sender.Name())
+
+	cfg.OTPProviders = "carrier-pigeon"
+	_, err = otp.New(cfg)
+	assert.Error(t, err)
+
+	cfg.OTPProviders = "whatsapp"
+	_, err = otp.New(cfg)
+	assert.Error(t, err, "the whatsapp provider needs a template")
+
+	cfg.OTPProviders = "http"
+	cfg.OTPHTTPURL = "https://sms.example.com/send"
+	cfg.OTPHTTPHeaders = "Authorization: Bearer x"
+	_, err = otp.New(cfg)
+	assert.Error(t, err, "headers must be a JSON object")
+
+	t.Setenv("SMART_CHAT_ENV", "prod")
+	cfg.OTPProviders = "console"
+	_, err = otp.New(cfg)
+	assert.Error(t, err, "plain text sinks are refused in production")
+}
+
+type failingOTPSender struct{}
+
+func (failingOTPSender) Name() string { return "failing" }
+
+func (failingOTPSender) Send(context.Context, string, string) error {
+	return errors.New("gateway down")
+}
+
+func TestAuthV2Service_InitLoginSendsCodeThroughOTPSender(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	var out bytes.Buffer
+	service := &auth.AuthV2Service{DB: db, OTPSender: otp.NewConsoleSender(&out)}
+
+	response, err := service.InitLogin(auth.UserLoginInfo{Name: "Asha", Mobile: "+919876543210"}, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Equal(t, true, response["success"])
+	assert.Regexp(t, `code for \+919876543210: \d{4}\n$`, out.String())
+
+	service.OTPSender = failingOTPSender{}
+	response, err = service.InitLogin(auth.UserLoginInfo{Name: "Ravi", Mobile: "+919812345678"}, "203.0.113.8")
+	require.Error(t, err)
+	assert.Equal(t, "failed to send OTP", response["error"])
+}
@@ -0,0 +1,153 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type assigneesResponse struct {
+	Assignees []authUserConversation.Assignee `json:"assignees"`
+}
+
+type assignmentsResponse struct {
+	Assignees   []authUserConversation.Assignee         `json:"assignees"`
+	Assignments []authUserConversation.AssignmentRecord `json:"assignments"`
+}
+
+func conversationPath(conversationID uint, suffix string) string {
+	return "/v2/client/conversation/" + strconv.FormatUint(uint64(conversationID), 10) + suffix
+}
+
+func TestReassignment_MovesPrimaryAndArchivesTracking(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	admin := setupAuthUserWithRole(t, db, "ADMIN", "zitadel-reassign-admin", "Reassign Admin")
+	first := setupAuthUserWithRole(t, db, "AGENT", "zitadel-reassign-first", "First Agent")
+	second := setupAuthUserWithRole(t, db, "AGENT", "zitadel-reassign-second", "Second Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+
+	service := authUserConversation.NewService(db)
+	_, err := service.LinkConversations(first.UserID, []uint{conv.ID}, admin.UserID)
+	require.NoError(t, err)
+	started := true
+	_, err = service.UpdateConversationTracking(authUserConversation.UpdateConversationTrackingInput{
+		AuthUserID:     first.UserID,
+		ConversationID: conv.ID,
+		Started:        &started,
+		Comments:       strPtr("Called the user"),
+	})
+	require.NoError(t, err)
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-reassign-admin"})
+	recorder := clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/reassign"), map[string]any{"to_user_id": second.UserID})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assignees := decodeJSON[assigneesResponse](t, recorder).Assignees
+	require.Len(t, assignees, 1)
+	assert.Equal(t, second.UserID, assignees[0].UserID)
+	assert.True(t, assignees[0].Primary)
+	assert.True(t, assignees[0].Started)
+	assert.Equal(t, "Called the user", assignees[0].Comments)
+
+	recorder = clientJSON(router, http.MethodGet, conversationPath(conv.ID, "/assignments"), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	history := decodeJSON[assignmentsResponse](t, recorder).Assignments
+	require.Len(t, history, 2)
+	assert.Equal(t, first.UserID, history[0].UserID)
+	assert.Equal(t, models.AssignmentEndReassigned, history[0].EndReason)
+	assert.True(t, history[0].Started)
+	assert.Equal(t, "Called the user", history[0].Comments)
+	require.NotNil(t, history[0].UnassignedBy)
+	assert.Equal(t, admin.UserID, *history[0].UnassignedBy)
+	assert.Equal(t, second.UserID, history[1].UserID)
+	assert.Nil(t, history[1].UnassignedAt)
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ?", audit.ActionConversationReassign).First(&event).Error)
+	assert.JSONEq(t, `{"assignees":{"before":[`+strconv.FormatUint(uint64(first.UserID), 10)+`],"after":[`+strconv.FormatUint(uint64(second.UserID), 10)+`]},"carry_tracking":{"before":null,"after":true}}`, string(event.Changes))
+
+	// Without carrying tracking the new assignee starts fresh.
+	recorder = clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/reassign"), map[string]any{"to_user_id": first.UserID, "carry_tracking": false})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assignees = decodeJSON[assigneesResponse](t, recorder).Assignees
+	require.Len(t, assignees, 1)
+	assert.False(t, assignees[0].Started)
+	assert.Empty(t, assignees[0].Comments)
+
+	recorder = clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/reassign"), map[string]any{"to_user_id": first.UserID})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/reassign"), map[string]any{"to_user_id": second.UserID, "from_user_id": admin.UserID})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestReassignment_UnassignPromotesNextAssignee(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-unassign-admin", "Unassign Admin")
+	first := setupAuthUserWithRole(t, db, "AGENT", "zitadel-unassign-first", "First Agent")
+	second := setupAuthUserWithRole(t, db, "AGENT", "zitadel-unassign-second", "Second Agent")
+	third := setupAuthUserWithRole(t, db, "AGENT", "zitadel-unassign-third", "Third Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+
+	service := authUserConversation.NewService(db)
+	for _, agent := range []uint{first.UserID, second.UserID, third.UserID} {
+		_, err := service.LinkConversations(agent, []uint{conv.ID}, 0)
+		require.NoError(t, err)
+	}
+
+	router := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-unassign-admin"})
+	recorder := clientJSON(router, http.MethodPut, conversationPath(conv.ID, "/primary"), map[string]any{"user_id": third.UserID})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assignees := decodeJSON[assigneesResponse](t, recorder).Assignees
+	require.Len(t, assignees, 3)
+	assert.Equal(t, third.UserID, assignees[0].UserID)
+	assert.True(t, assignees[0].Primary)
+	assert.False(t, assignees[1].Primary)
+
+	agents, err := service.GetAssignedAgentsByConversationIDs([]uint{conv.ID})
+	require.NoError(t, err)
+	assert.Equal(t, third.UserID, agents[conv.ID].UserID)
+	tracking, err := service.GetConversationTracking(conv.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, third.UserID, tracking.AuthUserID)
+
+	recorder = clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/unassign"), map[string]any{"user_id": third.UserID})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assignees = decodeJSON[assigneesResponse](t, recorder).Assignees
+	require.Len(t, assignees, 2)
+	assert.Equal(t, first.UserID, assignees[0].UserID)
+	assert.True(t, assignees[0].Primary)
+
+	recorder = clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/unassign"), map[string]any{"user_id": third.UserID})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// Unassigned agents can be linked again and open a new period.
+	_, err = service.LinkConversations(third.UserID, []uint{conv.ID}, 0)
+	require.NoError(t, err)
+	history, err := service.History(conv.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	assert.Equal(t, models.AssignmentEndUnassigned, history[2].EndReason)
+	assert.Equal(t, third.UserID, history[3].UserID)
+	assert.False(t, history[3].Primary)
+
+	// Agents cannot reassign, and only see history of their own conversations.
+	router = setupClientRoutes(db, mockTokenValidator{userID: "zitadel-unassign-first"})
+	recorder = clientJSON(router, http.MethodPost, conversationPath(conv.ID, "/reassign"), map[string]any{"to_user_id": second.UserID})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = clientJSON(router, http.MethodGet, conversationPath(conv.ID, "/assignments"), nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	_, _, other, _ := utils.SetupTestEntities(db)
+	recorder = clientJSON(router, http.MethodGet, conversationPath(other.ID, "/assignments"), nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
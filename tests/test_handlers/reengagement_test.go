@@ -0,0 +1,281 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"smart-chat/external/notification"
+	"smart-chat/internal/constants"
+	"smart-chat/internal/handlers"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/reengagement"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type stubNudgeGenerator struct {
+	text string
+	err  error
+}
+
+func (g stubNudgeGenerator) GenerateNudge(models.Conversation) (string, error) {
+	return g.text, g.err
+}
+
+type recordingSender struct {
+	mu       sync.Mutex
+	payloads []notification.Payload
+	err      error
+}
+
+func (s *recordingSender) SendMessageEvent(payload notification.Payload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.payloads = append(s.payloads, payload)
+	return nil
+}
+
+func (s *recordingSender) sent() []notification.Payload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]notification.Payload(nil), s.payloads...)
+}
+
+var ist = time.FixedZone("IST", 5*60*60+30*60)
+
+func reengagementSettings() reengagement.Settings {
+	return reengagement.Settings{
+		Enabled:        true,
+		IdleAfter:      4 * time.Hour,
+		MaxIdle:        23 * time.Hour,
+		QuietStartHour: 21,
+		QuietEndHour:   9,
+		Location:       ist,
+		MaxPerUser:     2,
+		CapWindow:      7 * 24 * time.Hour,
+	}
+}
+
+// seedDroppedConversation creates a WhatsApp conversation whose last message is the given bot reply.
+func seedDroppedConversation(t *testing.T, db *gorm.DB, user models.User, bot string, at time.Time) models.Conversation {
+	t.Helper()
+
+	session := models.Session{UserID: user.ID, Source: constants.WhatsAppSource, ExpireAt: at.Add(24 * time.Hour)}
+	require.NoError(t, db.Create(&session).Error)
+	conversation := models.Conversation{SessionID: session.ID}
+	require.NoError(t, db.Create(&conversation).Error)
+
+	pair := models.MessagePair{
+		ConversationID: conversation.ID,
+		User:           "How much is the Kedarnath trek?",
+		Bot:            bot,
+		Visible:        true,
+		Type:           models.MessageTypeUserSent,
+	}
+	pair.CreatedAt = at
+	require.NoError(t, db.Create(&pair).Error)
+	return conversation
+}
+
+func seedWhatsAppUser(t *testing.T, db *gorm.DB, mobile string) models.User {
+	t.Helper()
+
+	user := models.User{Name: "Asha", Mobile: mobile, AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&user).Error)
+	return user
+}
+
+func TestReengagementService_NudgesAndRecordsRecovery(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, ist)
+	user := seedWhatsAppUser(t, db, "+919800000010")
+	conversation := seedDroppedConversation(t, db, user, `{"content":"It is ₹8,500 per person. Which dates work for you?"}`, now.Add(-5*time.Hour))
+
+	sender := &recordingSender{}
+	service := reengagement.NewReengagementService(db, reengagementSettings(), stubNudgeGenerator{text: "Still thinking about Kedarnath? I can hold a spot for your dates."}, sender, nil)
+
+	result, err := service.RunAt(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Sent)
+
+	payloads := sender.sent()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, conversation.ID, payloads[0].ConversationID)
+	assert.Equal(t, user.Mobile, payloads[0].Mobile)
+	assert.Equal(t, "Still thinking about Kedarnath? I can hold a spot for your dates.", payloads[0].MessagePair.Bot)
+
+	var nudge models.ReengagementNudge
+	require.NoError(t, db.First(&nudge).Error)
+	assert.Equal(t, models.NudgeStatusSent, nudge.Status)
+	assert.Equal(t, models.NudgeOutcomePending, nudge.Outcome)
+	require.NotNil(t, nudge.NudgeMessagePairID)
+
+	var nudgePair models.MessagePair
+	require.NoError(t, db.First(&nudgePair, *nudge.NudgeMessagePairID).Error)
+	assert.Equal(t, models.MessageTypeReengagementNudge, nudgePair.Type)
+
+	// The same drop-off is never nudged twice.
+	result, err = service.RunAt(now.Add(15 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Sent)
+	assert.Len(t, sender.sent(), 1)
+
+	reply := models.MessagePair{
+		ConversationID: conversation.ID,
+		User:           "25th October, 2 people",
+		Bot:            `{"content":"Great!"}`,
+		Visible:        true,
+		Type:           models.MessageTypeUserSent,
+	}
+	reply.CreatedAt = now.Add(30 * time.Minute)
+	require.NoError(t, db.Create(&reply).Error)
+
+	result, err = service.RunAt(now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Recovered)
+
+	require.NoError(t, db.First(&nudge, nudge.ID).Error)
+	assert.Equal(t, models.NudgeOutcomeRecovered, nudge.Outcome)
+	require.NotNil(t, nudge.RespondedAt)
+
+	summary, err := service.GetSummary(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), summary.Sent)
+	assert.Equal(t, int64(1), summary.Recovered)
+	assert.Equal(t, 1.0, summary.RecoveryRate)
+}
+
+func TestReengagementService_RespectsQuietHours(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	now := time.Date(2026, 10, 19, 22, 30, 0, 0, ist)
+	user := seedWhatsAppUser(t, db, "+919800000011")
+	seedDroppedConversation(t, db, user, `{"content":"Shall I share the itinerary?"}`, now.Add(-5*time.Hour))
+
+	sender := &recordingSender{}
+	service := reengagement.NewReengagementService(db, reengagementSettings(), stubNudgeGenerator{text: "Hi again!"}, sender, nil)
+
+	result, err := service.RunAt(now)
+	require.NoError(t, err)
+	assert.True(t, result.QuietHours)
+	assert.Empty(t, sender.sent())
+
+	// Quiet hours are evaluated in IST whatever zone the clock reports: 03:30 UTC is 09:00 IST.
+	assert.True(t, service.InQuietHours(time.Date(2026, 10, 20, 8, 59, 0, 0, ist)))
+	assert.False(t, service.InQuietHours(time.Date(2026, 10, 20, 9, 0, 0, 0, ist)))
+	assert.True(t, service.InQuietHours(time.Date(2026, 10, 20, 3, 29, 0, 0, time.UTC)))
+	assert.False(t, service.InQuietHours(time.Date(2026, 10, 20, 3, 30, 0, 0, time.UTC)))
+}
+
+func TestReengagementService_AppliesFrequencyCapAndOptOut(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, ist)
+	capped := seedWhatsAppUser(t, db, "+919800000012")
+	seedDroppedConversation(t, db, capped, `{"content":"Which month are you planning for?"}`, now.Add(-6*time.Hour))
+	seedDroppedConversation(t, db, capped, `{"content":"How many travellers?"}`, now.Add(-5*time.Hour))
+
+	optedOut := seedWhatsAppUser(t, db, "+919800000013")
+	seedDroppedConversation(t, db, optedOut, `{"content":"Do you want the Chopta package?"}`, now.Add(-5*time.Hour))
+
+	statement := seedWhatsAppUser(t, db, "+919800000014")
+	seedDroppedConversation(t, db, statement, `{"content":"Have a great trip!"}`, now.Add(-5*time.Hour))
+
+	settings := reengagementSettings()
+	settings.MaxPerUser = 1
+	sender := &recordingSender{}
+	service := reengagement.NewReengagementService(db, settings, stubNudgeGenerator{text: "Still there?"}, sender, nil)
+
+	reply, handled := service.HandleKeyword(optedOut.ID, " stop ")
+	require.True(t, handled)
+	assert.Contains(t, reply, "won't receive")
+
+	result, err := service.RunAt(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Sent)
+	assert.Equal(t, 1, result.Capped)
+
+	payloads := sender.sent()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, capped.Mobile, payloads[0].Mobile)
+
+	// START only counts as a keyword for users who opted out.
+	_, handled = service.HandleKeyword(capped.ID, "start")
+	assert.False(t, handled)
+	_, handled = service.HandleKeyword(optedOut.ID, "START")
+	assert.True(t, handled)
+
+	var user models.User
+	require.NoError(t, db.First(&user, optedOut.ID).Error)
+	assert.Nil(t, user.ReengagementOptedOutAt)
+}
+
+func TestReengagementService_RecordsFailedSends(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, ist)
+	user := seedWhatsAppUser(t, db, "+919800000015")
+	seedDroppedConversation(t, db, user, `{"content":"Shall I book it?"}`, now.Add(-5*time.Hour))
+
+	sender := &recordingSender{err: errors.New("notification service unavailable")}
+	service := reengagement.NewReengagementService(db, reengagementSettings(), stubNudgeGenerator{text: "Still keen?"}, sender, nil)
+
+	result, err := service.RunAt(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+
+	var nudge models.ReengagementNudge
+	require.NoError(t, db.First(&nudge).Error)
+	assert.Equal(t, models.NudgeStatusFailed, nudge.Status)
+	assert.Contains(t, nudge.Error, "notification service unavailable")
+
+	var nudgePairs int64
+	require.NoError(t, db.Model(&models.MessagePair{}).Where("type = ?", models.MessageTypeReengagementNudge).Count(&nudgePairs).Error)
+	assert.Equal(t, int64(0), nudgePairs)
+}
+
+func TestGetReengagementSummaryHandler(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	service := reengagement.NewReengagementService(db, reengagementSettings(), stubNudgeGenerator{}, &recordingSender{}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/analytics/reengagement", handlers.GetReengagementSummaryHandler(service))
+
+	req, _ := http.NewRequest(http.MethodGet, "/analytics/reengagement?days=7", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		Days    int                  `json:"days"`
+		Summary reengagement.Summary `json:"summary"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, 7, response.Days)
+	assert.Equal(t, int64(0), response.Summary.Sent)
+
+	req, _ = http.NewRequest(http.MethodGet, "/analytics/reengagement?days=0", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
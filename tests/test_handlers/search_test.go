@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"smart-chat/internal/models"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type searchedConversationsResponse struct {
+	Conversations []struct {
+		ID      uint                     `json:"id"`
+		Matches *convHistory.TextMatches `json:"matches"`
+	} `json:"conversations"`
+	Pagination struct {
+		Total int64 `json:"total"`
+	} `json:"pagination"`
+}
+
+func addMessage(t *testing.T, db *gorm.DB, conversationID uint, user, bot string, visible bool) models.MessagePair {
+	t.Helper()
+	pair := models.MessagePair{ConversationID: conversationID, User: user, Bot: bot, Visible: visible}
+	require.NoError(t, db.Create(&pair).Error)
+	return pair
+}
+
+func TestConversationSearch_MatchesMessageTextWithSnippets(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-search-admin", "Search Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-search-agent", "Search Agent")
+	_, _, kedarnath, _ := utils.SetupTestEntities(db)
+	_, _, other, _ := utils.SetupTestEntities(db)
+	_, _, unassigned, _ := utils.SetupTestEntities(db)
+	_, err := authUserConversation.NewService(db).LinkConversations(agent.UserID, []uint{kedarnath.ID, other.ID}, 0)
+	require.NoError(t, err)
+
+	first := addMessage(t, db, kedarnath.ID, "We are 12 people going to Kedarnath in June", "Great! I can help with Kedarnath packages.", true)
+	second := addMessage(t, db, kedarnath.ID, "Can we get a Tempo Traveller for the trip to <Kedarnath>?", "Yes, a 12 seater tempo traveller is available.", true)
+	addMessage(t, db, kedarnath.ID, "kedarnath tempo traveller", "", false)
+	addMessage(t, db, other.ID, "I want a tempo traveller to Manali", "Sure, Manali it is.", true)
+	addMessage(t, db, unassigned.ID, "Kedarnath by tempo traveller please", "", true)
+
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-search-agent"})
+	search := func(query string) searchedConversationsResponse {
+		t.Helper()
+		recorder := clientJSON(agentRouter, http.MethodGet, "/v2/client/conversations?q="+url.QueryEscape(query), nil)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		return decodeJSON[searchedConversationsResponse](t, recorder)
+	}
+
+	// Every word has to appear in the same visible message, and agents only search their own conversations.
+	result := search("Kedarnath tempo traveller")
+	require.Len(t, result.Conversations, 1)
+	assert.EqualValues(t, 1, result.Pagination.Total)
+	assert.Equal(t, kedarnath.ID, result.Conversations[0].ID)
+	matches := result.Conversations[0].Matches
+	require.NotNil(t, matches)
+	assert.Equal(t, []uint{second.ID}, matches.MessageIDs)
+	require.Len(t, matches.Snippets, 1)
+	assert.Equal(t, second.ID, matches.Snippets[0].MessagePairID)
+	assert.Contains(t, matches.Snippets[0].Snippet, "a <mark>Tempo</mark> <mark>Traveller</mark> for the trip to &lt;<mark>Kedarnath</mark>&gt;?")
+
+	result = search("kedarnath")
+	require.Len(t, result.Conversations, 1)
+	assert.Equal(t, []uint{first.ID, second.ID}, result.Conversations[0].Matches.MessageIDs)
+	assert.Len(t, result.Conversations[0].Matches.Snippets, 2)
+
+	result = search("tempo traveller")
+	assert.Len(t, result.Conversations, 2)
+
+	result = search("ladakh")
+	assert.Empty(t, result.Conversations)
+
+	recorder := clientJSON(agentRouter, http.MethodGet, "/v2/client/conversations?q="+url.QueryEscape("?!"), nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Without a query the list has no matches.
+	recorder = clientJSON(agentRouter, http.MethodGet, "/v2/client/conversations", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), `"matches"`)
+}
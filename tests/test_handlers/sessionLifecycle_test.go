@@ -0,0 +1,250 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-chat/internal/constants"
+	"smart-chat/internal/handlers"
+	"smart-chat/internal/models"
+	"smart-chat/internal/otp"
+	"smart-chat/internal/rbac"
+	sessionService "smart-chat/internal/services/session"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type sessionTokens struct {
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+	Error            string    `json:"error"`
+}
+
+type activeSessions struct {
+	Sessions []sessionService.ActiveSession `json:"sessions"`
+}
+
+func decodeJSON[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &value), recorder.Body.String())
+	return value
+}
+
+// loginWithOTP runs init-login and validate-login and returns the issued tokens.
+func loginWithOTP(t *testing.T, router *gin.Engine, sender *recordingOTPSender, mobile, ip string) sessionTokens {
+	t.Helper()
+	recipient, err := otp.ParseMobile(mobile)
+	require.NoError(t, err)
+	status, body := initOTPLogin(t, router, mobile, ip)
+	require.Equal(t, http.StatusOK, status)
+	recorder := postAuthJSON(router, "/v2/auth/validate-login", ip, map[string]string{
+		"token": body["authToken"].(string),
+		"otp":   sender.code(recipient.E164),
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	return decodeJSON[sessionTokens](t, recorder)
+}
+
+func authedRequest(router *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", token)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestSessionLifecycle_ExpirySlidesOnActivity(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, nil))
+	tokens := loginWithOTP(t, router, sender, "+919876543210", "203.0.113.40")
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), tokens.ExpiresAt, time.Minute)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), tokens.RefreshExpiresAt, time.Minute)
+
+	var session models.Session
+	require.NoError(t, db.Last(&session).Error)
+	require.NoError(t, db.Model(&session).UpdateColumns(map[string]any{
+		"expire_at":    time.Now().Add(5 * time.Minute),
+		"last_seen_at": time.Now().Add(-55 * time.Minute),
+	}).Error)
+
+	recorder := sessionRequest(setupSessionRouter(db), tokens.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	require.NoError(t, db.First(&session, session.ID).Error)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpireAt, time.Minute)
+	require.NotNil(t, session.LastSeenAt)
+	assert.WithinDuration(t, time.Now(), *session.LastSeenAt, time.Minute)
+
+	// Without activity the access token lapses.
+	require.NoError(t, db.Model(&session).UpdateColumn("expire_at", time.Now().Add(-time.Second)).Error)
+	recorder = sessionRequest(setupSessionRouter(db), tokens.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "session expired")
+}
+
+func TestSessionLifecycle_RefreshRotatesAndDetectsReuse(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	router := setupOTPAuthRouter(newOTPChallengeService(db, sender, nil))
+	first := loginWithOTP(t, router, sender, "+919876543210", "203.0.113.41")
+
+	// An expired access token is renewed with the refresh token.
+	require.NoError(t, db.Model(&models.Session{}).Where("1 = 1").UpdateColumn("expire_at", time.Now().Add(-time.Minute)).Error)
+	recorder := postAuthJSON(router, "/v2/auth/refresh", "203.0.113.41", map[string]string{"refreshToken": first.RefreshToken})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	second := decodeJSON[sessionTokens](t, recorder)
+	assert.NotEqual(t, first.AccessToken, second.AccessToken)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	sessionRouter := setupSessionRouter(db)
+	assert.Equal(t, http.StatusOK, sessionRequest(sessionRouter, second.AccessToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, sessionRequest(sessionRouter, first.AccessToken).Code)
+
+	// The access token is not a refresh token.
+	recorder = postAuthJSON(router, "/v2/auth/refresh", "203.0.113.41", map[string]string{"refreshToken": second.AccessToken})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// Replaying the first refresh token means it leaked: the whole session is revoked.
+	recorder = postAuthJSON(router, "/v2/auth/refresh", "203.0.113.41", map[string]string{"refreshToken": first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "refresh token reused")
+
+	recorder = sessionRequest(sessionRouter, second.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "session revoked")
+	recorder = postAuthJSON(router, "/v2/auth/refresh", "203.0.113.41", map[string]string{"refreshToken": second.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestSessionLifecycle_LogoutAndListSessions(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	service := newOTPChallengeService(db, sender, nil)
+	service.SecretToken = "wa-secret"
+	router := setupOTPAuthRouter(service)
+	web := loginWithOTP(t, router, sender, "+919876543210", "203.0.113.42")
+
+	waLogin := postAuthJSON(router, "/v2/auth/login-for-whatsapp", "203.0.113.42", map[string]string{
+		"name": "Asha", "mobile": "+919876543210", "secret_token": "wa-secret",
+	})
+	require.Equal(t, http.StatusOK, waLogin.Code)
+	wa := decodeJSON[sessionTokens](t, waLogin)
+
+	recorder := authedRequest(router, http.MethodGet, "/v2/auth/sessions", wa.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	listed := decodeJSON[activeSessions](t, recorder)
+	require.Len(t, listed.Sessions, 2)
+	sources := map[string]bool{}
+	for _, session := range listed.Sessions {
+		sources[session.Source] = session.Current
+		assert.NotNil(t, session.LastSeenAt)
+	}
+	assert.Equal(t, map[string]bool{constants.WhatsAppSource: true, constants.WebsiteSource: false}, sources)
+
+	recorder = authedRequest(router, http.MethodPost, "/v2/auth/logout", web.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"success":true}`, recorder.Body.String())
+
+	recorder = sessionRequest(setupSessionRouter(db), web.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "session revoked")
+	recorder = postAuthJSON(router, "/v2/auth/refresh", "203.0.113.42", map[string]string{"refreshToken": web.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = authedRequest(router, http.MethodGet, "/v2/auth/sessions", wa.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, decodeJSON[activeSessions](t, recorder).Sessions, 1)
+
+	recorder = authedRequest(router, http.MethodPost, "/v2/auth/logout", "unknown-token")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// The WhatsApp refresh rotates tokens before expiry instead of answering "session not expired".
+	req, _ := http.NewRequest(http.MethodPost, "/v2/auth/refresh-token", strings.NewReader(`{"mobile":"+919876543210","secret_token":"wa-secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", wa.AccessToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	rotated := decodeJSON[sessionTokens](t, recorder)
+	assert.NotEmpty(t, rotated.AccessToken)
+	assert.NotEqual(t, wa.AccessToken, rotated.AccessToken)
+}
+
+func setupClientSessionsRouter(db *gorm.DB, zitadelUserID string) *gin.Engine {
+	sessions := sessionService.NewService(db, sessionService.DefaultPolicy)
+	validator := mockTokenValidator{userID: zitadelUserID}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/sessions", authorize(db, validator, rbac.SessionsManage), handlers.GetUserSessionsHandler(sessions))
+	router.POST("/sessions/revoke", authorize(db, validator, rbac.SessionsManage), handlers.RevokeUserSessionsHandler(sessions, nil))
+	return router
+}
+
+func TestClientSessions_AdminListsAndRevokesByMobile(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-admin-sessions", "Admin Sessions")
+	setupAuthUserWithRole(t, db, "AGENT", "zitadel-agent-sessions", "Agent Sessions")
+
+	sender := &recordingOTPSender{}
+	authService := newOTPChallengeService(db, sender, nil)
+	router := setupOTPAuthRouter(authService)
+	tokens := loginWithOTP(t, router, sender, "9876543210", "203.0.113.43")
+	other, err := authService.Sessions.Issue(createUserWithMobile(t, db, "1234509876"), constants.WebsiteSource)
+	require.NoError(t, err)
+
+	agentRouter := setupClientSessionsRouter(db, "zitadel-agent-sessions")
+	recorder := authedRequest(agentRouter, http.MethodGet, "/sessions?mobile=9876543210", "Bearer agent")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	adminRouter := setupClientSessionsRouter(db, "zitadel-admin-sessions")
+	recorder = authedRequest(adminRouter, http.MethodGet, "/sessions?mobile=%2B919876543210", "Bearer admin")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	listed := decodeJSON[activeSessions](t, recorder)
+	require.Len(t, listed.Sessions, 1)
+	assert.Equal(t, "+919876543210", listed.Sessions[0].Mobile)
+	assert.Equal(t, constants.WebsiteSource, listed.Sessions[0].Source)
+
+	recorder = authedRequest(adminRouter, http.MethodGet, "/sessions", "Bearer admin")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	req, _ := http.NewRequest(http.MethodPost, "/sessions/revoke", strings.NewReader(`{"mobile":"+91 98765 43210"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer admin")
+	recorder = httptest.NewRecorder()
+	adminRouter.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"status":"revoked","revoked_count":1}`, recorder.Body.String())
+
+	sessionRouter := setupSessionRouter(db)
+	assert.Equal(t, http.StatusUnauthorized, sessionRequest(sessionRouter, tokens.AccessToken).Code)
+	assert.Equal(t, http.StatusOK, sessionRequest(sessionRouter, other.AccessToken).Code, "other users keep their sessions")
+}
+
+func createUserWithMobile(t *testing.T, db *gorm.DB, mobile string) uint {
+	t.Helper()
+	user := models.User{Name: "Other", Mobile: mobile, AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&user).Error)
+	return user.ID
+}
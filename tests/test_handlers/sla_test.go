@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"smart-chat/internal/handlers"
+	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	convHistory "smart-chat/internal/services/conversation_history"
+	"smart-chat/internal/services/note"
+	"smart-chat/internal/services/sla"
+	"smart-chat/internal/services/tag"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type slaListResponse struct {
+	Conversations []struct {
+		ID  uint        `json:"id"`
+		SLA *sla.Status `json:"sla"`
+	} `json:"conversations"`
+}
+
+type slaDetailResponse struct {
+	SLA *sla.Status `json:"sla"`
+}
+
+var testSLASettings = sla.Settings{
+	Policies: []sla.Policy{
+		{Source: "whatsapp", FirstResponseMinutes: 10, ResolutionMinutes: 60},
+		{FirstResponseMinutes: 30, ResolutionMinutes: 120},
+	},
+	WarnPercent:      80,
+	ClientAppBaseURL: "https://app.example.com",
+}
+
+// assignAt links the conversation to the agent as if it had been assigned at the given time.
+func assignAt(t *testing.T, db *gorm.DB, agentID, conversationID uint, at time.Time) {
+	t.Helper()
+	_, err := authUserConversation.NewService(db).LinkConversations(agentID, []uint{conversationID}, 0)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.AuthUserConversation{}).Where("conversation_id = ?", conversationID).Update("created_at", at).Error)
+	require.NoError(t, db.Model(&models.ConversationAssignment{}).Where("conversation_id = ?", conversationID).Update("assigned_at", at).Error)
+}
+
+func setupSLARouter(db *gorm.DB, zitadelUserID string) *gin.Engine {
+	historyService := convHistory.NewConvHistoryService(db)
+	authUserConversationService := authUserConversation.NewService(db)
+	slaService := sla.NewService(db, testSLASettings, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auth := authorize(db, mockTokenValidator{userID: zitadelUserID}, rbac.ConversationsReadAssigned)
+	router.GET("/conversations", auth, handlers.GetConversationsWithFiltersHandler(historyService, authUserConversationService, slaService, tag.NewService(db, nil)))
+	router.GET("/conversation/:id", auth, handlers.GetConversationByIDHandler(historyService, authUserConversationService, slaService, note.NewService(db)))
+	return router
+}
+
+func TestSLA_ListAndDetailReportResponseAndResolutionTimes(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-sla-admin", "SLA Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-sla-agent", "SLA Agent")
+	now := time.Now()
+
+	_, _, answered, _ := utils.SetupTestEntities(db)
+	assignAt(t, db, agent.UserID, answered.ID, now.Add(-20*time.Minute))
+	require.NoError(t, db.Create(&models.MessagePair{
+		ConversationID: answered.ID,
+		Bot:            "Hello, this is your travel executive.",
+		Visible:        true,
+		Type:           models.MessageTypeAgentAssumedAssistant,
+		Model:          gorm.Model{CreatedAt: now.Add(-15 * time.Minute)},
+	}).Error)
+
+	_, session, waiting, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Model(&session).Update("source", "whatsapp").Error)
+	assignAt(t, db, agent.UserID, waiting.ID, now.Add(-9*time.Minute))
+
+	_, _, unassigned, _ := utils.SetupTestEntities(db)
+
+	_, _, resolvedLate, _ := utils.SetupTestEntities(db)
+	assignAt(t, db, agent.UserID, resolvedLate.ID, now.Add(-3*time.Hour))
+	resolved := true
+	_, err := authUserConversation.NewService(db).UpdateConversationTracking(authUserConversation.UpdateConversationTrackingInput{
+		AuthUserID:     agent.UserID,
+		ConversationID: resolvedLate.ID,
+		Resolved:       &resolved,
+	})
+	require.NoError(t, err)
+
+	router := setupSLARouter(db, "zitadel-sla-admin")
+	req := httptest.NewRequest(http.MethodGet, "/conversations?limit=10", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	byID := make(map[uint]*sla.Status)
+	for _, conv := range decodeJSON[slaListResponse](t, recorder).Conversations {
+		byID[conv.ID] = conv.SLA
+	}
+	require.Contains(t, byID, unassigned.ID)
+	assert.Nil(t, byID[unassigned.ID])
+
+	require.NotNil(t, byID[answered.ID])
+	assert.Equal(t, sla.StatusMet, byID[answered.ID].FirstResponseStatus)
+	require.NotNil(t, byID[answered.ID].FirstResponseSeconds)
+	assert.InDelta(t, 300, *byID[answered.ID].FirstResponseSeconds, 2)
+	assert.Equal(t, sla.StatusPending, byID[answered.ID].ResolutionStatus)
+	assert.Nil(t, byID[answered.ID].ResolutionSeconds)
+
+	require.NotNil(t, byID[waiting.ID])
+	assert.Equal(t, sla.StatusAtRisk, byID[waiting.ID].FirstResponseStatus)
+	require.NotNil(t, byID[waiting.ID].FirstResponseDueAt)
+	assert.WithinDuration(t, now.Add(time.Minute), *byID[waiting.ID].FirstResponseDueAt, 2*time.Second)
+
+	req = httptest.NewRequest(http.MethodGet, "/conversation/"+strconv.FormatUint(uint64(resolvedLate.ID), 10), nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	detail := decodeJSON[slaDetailResponse](t, recorder).SLA
+	require.NotNil(t, detail)
+	assert.Equal(t, sla.StatusBreached, detail.FirstResponseStatus)
+	assert.Equal(t, sla.StatusBreached, detail.ResolutionStatus)
+	require.NotNil(t, detail.ResolutionSeconds)
+	assert.InDelta(t, 3*60*60, *detail.ResolutionSeconds, 2)
+}
+
+func TestSLA_JobWarnsAndEscalatesOnce(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-sla-job-admin", "Duty Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-sla-job-agent", "Job Agent")
+	now := time.Now()
+
+	_, session, nearDue, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Model(&session).Update("source", "whatsapp").Error)
+	assignAt(t, db, agent.UserID, nearDue.ID, now.Add(-9*time.Minute))
+	_, _, overdue, _ := utils.SetupTestEntities(db)
+	assignAt(t, db, agent.UserID, overdue.ID, now.Add(-40*time.Minute))
+	_, _, stale, _ := utils.SetupTestEntities(db)
+	assignAt(t, db, agent.UserID, stale.ID, now.Add(-72*time.Hour))
+
+	slackService, alerts := newSlackAlertRecorder(t, db)
+	service := sla.NewService(db, testSLASettings, slackService)
+	warned, breached, err := service.CheckDeadlines(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, warned)
+	assert.Equal(t, 1, breached)
+
+	messages := []string{expectAlert(t, alerts), expectAlert(t, alerts)}
+	assert.Contains(t, messages, "service:indian_travellers_cms -- SLA warning: first response for conversation ID: *"+
+		strconv.FormatUint(uint64(nearDue.ID), 10)+"* is due in 1m0s | assigned: *Job Agent* | https://app.example.com/conversations/"+
+		strconv.FormatUint(uint64(nearDue.ID), 10))
+	assert.Contains(t, messages, "service:smart_chat_backend -- SLA breached: first response for conversation ID: *"+
+		strconv.FormatUint(uint64(overdue.ID), 10)+"* was due 10m0s ago | assigned: *Job Agent* | admins: *Duty Admin* | https://app.example.com/conversations/"+
+		strconv.FormatUint(uint64(overdue.ID), 10))
+
+	warned, breached, err = service.CheckDeadlines(now)
+	require.NoError(t, err)
+	assert.Zero(t, warned)
+	assert.Zero(t, breached)
+
+	var count int64
+	require.NoError(t, db.Model(&models.SLAAlert{}).Where("conversation_id = ?", stale.ID).Count(&count).Error)
+	assert.Zero(t, count)
+}
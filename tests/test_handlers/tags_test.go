@@ -0,0 +1,168 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/audit"
+	authUserConversation "smart-chat/internal/services/auth_user_conversation"
+	"smart-chat/internal/services/tag"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type conversationTagsResponse struct {
+	Tags []tag.ConversationTag `json:"tags"`
+}
+
+type taggedConversationsResponse struct {
+	Conversations []struct {
+		ID   uint     `json:"id"`
+		Tags []string `json:"tags"`
+	} `json:"conversations"`
+}
+
+type fixedSuggester []string
+
+func (s fixedSuggester) SuggestTags(models.Conversation, []string) ([]string, error) {
+	return s, nil
+}
+
+func TestTags_TagConversationsAndFilterByAnyOrAll(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-tags-admin", "Tags Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-tags-agent", "Tags Agent")
+	_, _, both, _ := utils.SetupTestEntities(db)
+	_, _, honeymoonOnly, _ := utils.SetupTestEntities(db)
+	_, _, untagged, _ := utils.SetupTestEntities(db)
+	_, err := authUserConversation.NewService(db).LinkConversations(agent.UserID, []uint{both.ID}, 0)
+	require.NoError(t, err)
+
+	admin := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-tags-admin"})
+	recorder := clientJSON(admin, http.MethodPost, "/v2/client/tags", map[string]any{"name": "  Honeymoon "})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	recorder = clientJSON(admin, http.MethodPost, "/v2/client/tags", map[string]any{"name": "honeymoon"})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-tags-agent"})
+	recorder = clientJSON(agentRouter, http.MethodPost, "/v2/client/tags", map[string]any{"name": "corporate"})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = clientJSON(agentRouter, http.MethodPost, conversationPath(both.ID, "/tags"), map[string]any{"tags": []string{"honeymoon", "Price  Objection"}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	tags := decodeJSON[conversationTagsResponse](t, recorder).Tags
+	require.Len(t, tags, 2)
+	assert.Equal(t, "honeymoon", tags[0].Name)
+	assert.True(t, tags[0].Vocabulary)
+	assert.Equal(t, "price objection", tags[1].Name)
+	assert.False(t, tags[1].Vocabulary)
+	assert.Equal(t, models.TagSourceManual, tags[1].Source)
+	require.NotNil(t, tags[1].AddedBy)
+	assert.Equal(t, agent.UserID, *tags[1].AddedBy)
+
+	recorder = clientJSON(agentRouter, http.MethodPost, conversationPath(honeymoonOnly.ID, "/tags"), map[string]any{"tags": []string{"honeymoon"}})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = clientJSON(admin, http.MethodPost, conversationPath(honeymoonOnly.ID, "/tags"), map[string]any{"tags": []string{"honeymoon"}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = clientJSON(admin, http.MethodPost, conversationPath(untagged.ID, "/tags"), map[string]any{"tags": []string{"bad,name"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ? AND target_id = ?", audit.ActionConversationTagsAdd, strconv.FormatUint(uint64(both.ID), 10)).First(&event).Error)
+	assert.JSONEq(t, `{"tags":{"before":null,"after":["honeymoon","price objection"]}}`, string(event.Changes))
+
+	listIDs := func(query string) map[uint][]string {
+		t.Helper()
+		recorder := clientJSON(admin, http.MethodGet, "/v2/client/conversations?limit=10&"+query, nil)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		tagsByID := make(map[uint][]string)
+		for _, conv := range decodeJSON[taggedConversationsResponse](t, recorder).Conversations {
+			tagsByID[conv.ID] = conv.Tags
+		}
+		return tagsByID
+	}
+
+	anyMatch := listIDs("tags=" + url.QueryEscape("Honeymoon,price objection"))
+	assert.Len(t, anyMatch, 2)
+	assert.Equal(t, []string{"honeymoon", "price objection"}, anyMatch[both.ID])
+	assert.Equal(t, []string{"honeymoon"}, anyMatch[honeymoonOnly.ID])
+
+	allMatch := listIDs("tags_match=all&tags=" + url.QueryEscape("honeymoon,price objection"))
+	assert.Len(t, allMatch, 1)
+	assert.Contains(t, allMatch, both.ID)
+
+	unfiltered := listIDs("")
+	assert.Equal(t, []string{}, unfiltered[untagged.ID])
+
+	recorder = clientJSON(admin, http.MethodGet, "/v2/client/conversations?tags=honeymoon&tags_match=most", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Agents remove tags from their own conversations.
+	path := conversationPath(both.ID, "/tags/"+strconv.FormatUint(uint64(tags[1].ID), 10))
+	recorder = clientJSON(agentRouter, http.MethodDelete, path, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Len(t, decodeJSON[conversationTagsResponse](t, recorder).Tags, 1)
+	recorder = clientJSON(agentRouter, http.MethodDelete, path, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestTags_SuggestionsComeFromTheVocabulary(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-suggest-admin", "Suggest Admin")
+	agent := setupAuthUserWithRole(t, db, "AGENT", "zitadel-suggest-agent", "Suggest Agent")
+	_, _, conv, _ := utils.SetupTestEntities(db)
+	_, err := authUserConversation.NewService(db).LinkConversations(agent.UserID, []uint{conv.ID}, 0)
+	require.NoError(t, err)
+
+	service := tag.NewService(db, fixedSuggester{"Honeymoon", "made up", "corporate", "honeymoon"})
+	added, err := service.Suggest(conv)
+	require.NoError(t, err)
+	assert.Empty(t, added, "nothing is suggested without a vocabulary")
+
+	for _, name := range []string{"honeymoon", "corporate", "price objection"} {
+		_, err := service.Create(name, 0)
+		require.NoError(t, err)
+	}
+	added, err = service.Suggest(conv)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"corporate", "honeymoon"}, added)
+
+	agentRouter := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-suggest-agent"})
+	recorder := clientJSON(agentRouter, http.MethodGet, conversationPath(conv.ID, "/tags"), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	tags := decodeJSON[conversationTagsResponse](t, recorder).Tags
+	require.Len(t, tags, 2)
+	assert.Equal(t, models.TagSourceSuggested, tags[1].Source)
+	assert.Nil(t, tags[1].AddedBy)
+
+	// Adding a suggested tag again confirms it.
+	recorder = clientJSON(agentRouter, http.MethodPost, conversationPath(conv.ID, "/tags"), map[string]any{"tags": []string{"honeymoon"}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	tags = decodeJSON[conversationTagsResponse](t, recorder).Tags
+	assert.Equal(t, models.TagSourceSuggested, tags[0].Source)
+	assert.Equal(t, models.TagSourceManual, tags[1].Source)
+
+	admin := setupClientRoutes(db, mockTokenValidator{userID: "zitadel-suggest-admin"})
+	recorder = clientJSON(admin, http.MethodDelete, "/v2/client/tags/"+strconv.FormatUint(uint64(tags[0].ID), 10), nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = clientJSON(admin, http.MethodGet, "/v2/client/tags?vocabulary=true", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	vocabulary := decodeJSON[struct {
+		Tags []tag.Tag `json:"tags"`
+	}](t, recorder).Tags
+	require.Len(t, vocabulary, 2)
+	assert.Equal(t, "honeymoon", vocabulary[0].Name)
+	assert.EqualValues(t, 1, vocabulary[0].ConversationCount)
+	assert.Equal(t, "price objection", vocabulary[1].Name)
+	assert.Zero(t, vocabulary[1].ConversationCount)
+}
@@ -0,0 +1,186 @@
+package handlers_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-chat/auth"
+	middleware "smart-chat/internal/middlewares"
+	"smart-chat/internal/models"
+	"smart-chat/internal/tokenhash"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupSessionRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/whoami", middleware.AuthSessionMiddleware(db), func(c *gin.Context) {
+		session := c.MustGet("session").(models.Session)
+		c.JSON(http.StatusOK, gin.H{"sessionId": session.ID})
+	})
+	return router
+}
+
+func sessionRequest(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", token)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestTokenHasher_HashesAndRotatesPeppers(t *testing.T) {
+	for _, spec := range []string{"", "nokey", ":secret", "id:", "a:1,a:2", "bad$id:secret"} {
+		_, err := tokenhash.New(spec)
+		assert.Error(t, err, spec)
+	}
+
+	old, err := tokenhash.New("2025:old-secret")
+	require.NoError(t, err)
+	rotated, err := tokenhash.New("2026:new-secret, 2025:old-secret")
+	require.NoError(t, err)
+
+	hash := rotated.Hash("session-token")
+	assert.True(t, strings.HasPrefix(hash, "2026$"))
+	assert.True(t, tokenhash.IsHash(hash))
+	assert.NotContains(t, hash, "session-token")
+	assert.Equal(t, hash, rotated.Hash("session-token"))
+
+	// Hashes under the retiring pepper, and plaintext tokens, are still found but need upgrading.
+	assert.Contains(t, rotated.Candidates("session-token"), old.Hash("session-token"))
+	assert.Contains(t, rotated.Candidates("session-token"), "session-token")
+	assert.True(t, rotated.NeedsUpgrade(old.Hash("session-token")))
+	assert.True(t, rotated.NeedsUpgrade("session-token"))
+	assert.False(t, rotated.NeedsUpgrade(hash))
+
+	// A stored hash presented as a token never matches itself.
+	assert.NotContains(t, rotated.Candidates(hash), hash)
+}
+
+func TestTokenHasher_UpgradeRehashesWithCurrentPepper(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	old, err := tokenhash.New("2025:old-secret")
+	require.NoError(t, err)
+	rotated, err := tokenhash.New("2026:new-secret,2025:old-secret")
+	require.NoError(t, err)
+
+	user, _, _, _ := utils.SetupTestEntities(db)
+	session := models.Session{UserID: user.ID, AuthToken: old.Hash("rotating-token"), ExpireAt: time.Now().Add(time.Hour)}
+	require.NoError(t, db.Create(&session).Error)
+
+	var found models.Session
+	require.NoError(t, db.Where("auth_token IN ?", rotated.Candidates("rotating-token")).First(&found).Error)
+	assert.Equal(t, session.ID, found.ID)
+	require.NoError(t, rotated.Upgrade(db, &found, "auth_token", found.AuthToken, "rotating-token"))
+
+	require.NoError(t, db.First(&found, session.ID).Error)
+	assert.Equal(t, rotated.Hash("rotating-token"), found.AuthToken)
+}
+
+func TestAuthSessionMiddleware_MigratesPlaintextSessionOnUse(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, _, _ := utils.SetupTestEntities(db)
+	router := setupSessionRouter(db)
+
+	recorder := sessionRequest(router, "valid_token")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var stored models.Session
+	require.NoError(t, db.First(&stored, session.ID).Error)
+	assert.Equal(t, tokenhash.Default().Hash("valid_token"), stored.AuthToken)
+
+	var plaintext int64
+	require.NoError(t, db.Model(&models.Session{}).Where("auth_token = ?", "valid_token").Count(&plaintext).Error)
+	assert.Zero(t, plaintext)
+
+	// The client keeps using the same token.
+	recorder = sessionRequest(router, "valid_token")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// Someone holding a database snapshot cannot use the stored value.
+	recorder = sessionRequest(router, stored.AuthToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestAuthSessionMiddleware_DoesNotLogTokens(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	utils.SetupTestEntities(db)
+	logs := captureLog(t)
+	// Log every query, with parameters, to the same buffer.
+	db = db.Session(&gorm.Session{Logger: logger.New(log.New(logs, "", 0), logger.Config{LogLevel: logger.Info})})
+	router := setupSessionRouter(db)
+
+	recorder := sessionRequest(router, "leaked-looking-token")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = sessionRequest(router, "valid_token")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Contains(t, logs.String(), "auth_token IN")
+	assert.NotContains(t, logs.String(), "leaked-looking-token")
+	assert.NotContains(t, logs.String(), "valid_token")
+}
+
+func TestAuthV2Service_StoresIssuedTokensHashed(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	sender := &recordingOTPSender{}
+	service := newOTPChallengeService(db, sender, nil)
+	logs := captureLog(t)
+
+	response, err := service.InitLogin(auth.UserLoginInfo{Name: "Asha", Mobile: "+919876543210"}, "203.0.113.30")
+	require.NoError(t, err)
+	challengeToken := response["authToken"].(string)
+
+	response, err = service.ValidateLogin(challengeToken, sender.code("+919876543210"))
+	require.NoError(t, err)
+	sessionToken := response["accessToken"].(string)
+
+	var challenge models.OTPChallenge
+	require.NoError(t, db.Last(&challenge).Error)
+	assert.Equal(t, tokenhash.Default().Hash(challengeToken), challenge.Token)
+
+	var session models.Session
+	require.NoError(t, db.Last(&session).Error)
+	assert.Equal(t, tokenhash.Default().Hash(sessionToken), session.AuthToken)
+
+	recorder := sessionRequest(setupSessionRouter(db), sessionToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	response, err = service.NewLoginWA(auth.UserLoginInfoWA{Name: "Asha", Mobile: "+919876543210", SecretToken: service.SecretToken})
+	require.NoError(t, err)
+	waToken := response["accessToken"].(string)
+
+	var user models.User
+	require.NoError(t, db.Where("mobile = ?", "+919876543210").First(&user).Error)
+	assert.Equal(t, tokenhash.Default().Hash(waToken), user.AccessToken)
+
+	for _, token := range []string{challengeToken, sessionToken, waToken} {
+		assert.NotContains(t, logs.String(), token)
+	}
+}
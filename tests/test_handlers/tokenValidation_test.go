@@ -0,0 +1,379 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smart-chat/internal/authservice/zitadel"
+	"smart-chat/tests/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://auth.example.com"
+
+// jwksServer publishes whichever keys are currently set and counts fetches.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	status  int
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+	server := &jwksServer{status: http.StatusOK}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.fetches.Add(1)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(server.status)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": server.keys})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *jwksServer) publish(status int, keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.keys = keys
+}
+
+func b64(raw []byte) string {
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "use": "sig", "crv": "P-256",
+		"x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// signJWT builds a compact JWS. key is an *rsa.PrivateKey (RS256) or *ecdsa.PrivateKey (ES256).
+func signJWT(t *testing.T, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+		signature = sig
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + b64(signature)
+}
+
+func validClaims(subject string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss": testIssuer,
+		"sub": subject,
+		"aud": []string{"smart-chat", "other-project"},
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+// countingValidator stands in for auth service introspection.
+type countingValidator struct {
+	calls atomic.Int32
+	delay time.Duration
+	err   error
+}
+
+func (v *countingValidator) ValidateToken(_ context.Context, rawToken string) (*zitadel.ValidateTokenUser, error) {
+	v.calls.Add(1)
+	time.Sleep(v.delay)
+	if v.err != nil {
+		return nil, v.err
+	}
+	id := "introspected-" + rawToken
+	return &zitadel.ValidateTokenUser{ID: &id}, nil
+}
+
+func TestJWKSValidator_VerifiesTokensAcrossKeyRotation(t *testing.T) {
+	server := newJWKSServer(t)
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	server.publish(http.StatusOK, rsaJWK("key-1", oldKey))
+
+	validator, err := zitadel.NewJWKSValidator(zitadel.JWKSConfig{
+		JWKSURL:            server.URL,
+		Issuer:             testIssuer,
+		Audience:           "smart-chat",
+		MinRefreshInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	user, err := validator.ValidateToken(ctx, signJWT(t, "key-1", oldKey, validClaims("zitadel-user-1")))
+	require.NoError(t, err)
+	assert.Equal(t, "zitadel-user-1", *user.ID)
+	_, err = validator.ValidateToken(ctx, signJWT(t, "key-1", oldKey, validClaims("zitadel-user-1")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), server.fetches.Load(), "keys should be cached between tokens")
+
+	// The issuer rotates to a new key; the unknown kid triggers one refetch.
+	server.publish(http.StatusOK, rsaJWK("key-2", newKey))
+	time.Sleep(60 * time.Millisecond)
+	user, err = validator.ValidateToken(ctx, signJWT(t, "key-2", newKey, validClaims("zitadel-user-2")))
+	require.NoError(t, err)
+	assert.Equal(t, "zitadel-user-2", *user.ID)
+	assert.Equal(t, int32(2), server.fetches.Load())
+
+	// The retired key is gone, and repeated unknown kids do not hammer the JWKS endpoint.
+	_, err = validator.ValidateToken(ctx, signJWT(t, "key-1", oldKey, validClaims("zitadel-user-1")))
+	assert.ErrorIs(t, err, zitadel.ErrUnknownSigningKey)
+	_, err = validator.ValidateToken(ctx, signJWT(t, "key-9", oldKey, validClaims("zitadel-user-1")))
+	assert.ErrorIs(t, err, zitadel.ErrUnknownSigningKey)
+	assert.Equal(t, int32(2), server.fetches.Load())
+
+	// A key published under the old kid does not let a forged signature through.
+	_, err = validator.ValidateToken(ctx, signJWT(t, "key-2", oldKey, validClaims("zitadel-user-1")))
+	assert.ErrorIs(t, err, zitadel.ErrInvalidSignature)
+}
+
+func TestJWKSValidator_Claims(t *testing.T) {
+	server := newJWKSServer(t)
+	rsaKey := newRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	server.publish(http.StatusOK, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey))
+
+	validator, err := zitadel.NewJWKSValidator(zitadel.JWKSConfig{
+		JWKSURL:   server.URL,
+		Issuer:    testIssuer,
+		Audience:  "smart-chat",
+		ClockSkew: time.Minute,
+	})
+	require.NoError(t, err)
+	now := time.Now()
+
+	cases := []struct {
+		name   string
+		mutate func(claims map[string]any)
+		want   error
+	}{
+		{"valid", func(map[string]any) {}, nil},
+		{"expired within skew", func(c map[string]any) { c["exp"] = now.Add(-30 * time.Second).Unix() }, nil},
+		{"expired beyond skew", func(c map[string]any) { c["exp"] = now.Add(-2 * time.Minute).Unix() }, zitadel.ErrTokenExpired},
+		{"missing exp", func(c map[string]any) { delete(c, "exp") }, zitadel.ErrTokenExpired},
+		{"nbf within skew", func(c map[string]any) { c["nbf"] = now.Add(30 * time.Second).Unix() }, nil},
+		{"nbf beyond skew", func(c map[string]any) { c["nbf"] = now.Add(5 * time.Minute).Unix() }, zitadel.ErrTokenNotYetValid},
+		{"issued in the future", func(c map[string]any) { c["iat"] = now.Add(5 * time.Minute).Unix() }, zitadel.ErrTokenNotYetValid},
+		{"other issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }, zitadel.ErrInvalidIssuer},
+		{"single audience", func(c map[string]any) { c["aud"] = "smart-chat" }, nil},
+		{"other audience", func(c map[string]any) { c["aud"] = []string{"other-project"} }, zitadel.ErrInvalidAudience},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, signer := range []struct {
+				kid string
+				key crypto.Signer
+			}{{"rsa", rsaKey}, {"ec", ecKey}} {
+				claims := validClaims("zitadel-claims-user")
+				tc.mutate(claims)
+				_, err := validator.ValidateToken(context.Background(), signJWT(t, signer.kid, signer.key, claims))
+				if tc.want == nil {
+					assert.NoError(t, err, signer.kid)
+				} else {
+					assert.ErrorIs(t, err, tc.want, signer.kid)
+				}
+			}
+		})
+	}
+
+	token := signJWT(t, "rsa", rsaKey, validClaims("zitadel-claims-user"))
+	_, err = validator.ValidateToken(context.Background(), token[:len(token)-4]+"AAAA")
+	assert.ErrorIs(t, err, zitadel.ErrInvalidSignature)
+
+	unsigned := b64([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + b64([]byte(`{"sub":"x"}`)) + "."
+	_, err = validator.ValidateToken(context.Background(), unsigned)
+	assert.ErrorIs(t, err, zitadel.ErrInvalidSignature)
+
+	_, err = validator.ValidateToken(context.Background(), "opaque-token")
+	assert.ErrorIs(t, err, zitadel.ErrMalformedToken)
+}
+
+func TestTiered_RoutesTokensToJWKSOrCachedIntrospection(t *testing.T) {
+	server := newJWKSServer(t)
+	key := newRSAKey(t)
+	server.publish(http.StatusOK, rsaJWK("key-1", key))
+	jwks, err := zitadel.NewJWKSValidator(zitadel.JWKSConfig{JWKSURL: server.URL, Issuer: testIssuer})
+	require.NoError(t, err)
+
+	introspection := &countingValidator{delay: 50 * time.Millisecond}
+	validator := zitadel.Tiered{
+		JWT:           jwks,
+		Introspection: zitadel.NewCachingValidator(introspection, zitadel.CacheConfig{TTL: time.Minute}),
+	}
+	ctx := context.Background()
+
+	// Concurrent requests with the same opaque token share a single introspection call.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := validator.ValidateToken(ctx, "opaque-token")
+			assert.NoError(t, err)
+			if assert.NotNil(t, user) {
+				assert.Equal(t, "introspected-opaque-token", *user.ID)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), introspection.calls.Load())
+
+	_, err = validator.ValidateToken(ctx, "opaque-token")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), introspection.calls.Load(), "cached result should be reused")
+
+	// JWTs are verified offline, and a bad JWT is not retried against introspection.
+	user, err := validator.ValidateToken(ctx, signJWT(t, "key-1", key, validClaims("zitadel-jwt-user")))
+	require.NoError(t, err)
+	assert.Equal(t, "zitadel-jwt-user", *user.ID)
+	expired := validClaims("zitadel-jwt-user")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = validator.ValidateToken(ctx, signJWT(t, "key-1", key, expired))
+	assert.ErrorIs(t, err, zitadel.ErrTokenExpired)
+	assert.Equal(t, int32(1), introspection.calls.Load())
+
+	// When the keys cannot be fetched at all, JWTs fall back to introspection.
+	downServer := newJWKSServer(t)
+	downServer.publish(http.StatusServiceUnavailable)
+	downJWKS, err := zitadel.NewJWKSValidator(zitadel.JWKSConfig{JWKSURL: downServer.URL, Issuer: testIssuer})
+	require.NoError(t, err)
+	fallback := zitadel.Tiered{JWT: downJWKS, Introspection: introspection}
+	token := signJWT(t, "key-1", key, validClaims("zitadel-jwt-user"))
+	user, err = fallback.ValidateToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "introspected-"+token, *user.ID)
+	assert.Equal(t, int32(2), introspection.calls.Load())
+}
+
+func TestCachingValidator_CachesRejectionsButNotOutages(t *testing.T) {
+	var status atomic.Int32
+	var calls atomic.Int32
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		code := int(status.Load())
+		w.WriteHeader(code)
+		if code == http.StatusOK {
+			_, _ = fmt.Fprint(w, `{"error":"token is not active"}`)
+		}
+	}))
+	defer authService.Close()
+
+	introspection, err := zitadel.NewService(context.Background(), zitadel.ZitadelConfig{AuthServiceBaseURL: authService.URL})
+	require.NoError(t, err)
+	validator := zitadel.NewCachingValidator(introspection, zitadel.CacheConfig{TTL: time.Minute, NegativeTTL: 100 * time.Millisecond})
+	ctx := context.Background()
+
+	// Outages are not cached: every call reaches the auth service.
+	status.Store(http.StatusServiceUnavailable)
+	for i := 0; i < 2; i++ {
+		_, err = validator.ValidateToken(ctx, "outage-token")
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, zitadel.ErrTokenRejected))
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Rejections are cached for the negative TTL and keep the auth service's message.
+	status.Store(http.StatusOK)
+	for i := 0; i < 2; i++ {
+		_, err = validator.ValidateToken(ctx, "inactive-token")
+		require.ErrorIs(t, err, zitadel.ErrTokenRejected)
+		assert.EqualError(t, err, "token is not active")
+	}
+	assert.Equal(t, int32(3), calls.Load())
+
+	status.Store(http.StatusUnauthorized)
+	_, err = validator.ValidateToken(ctx, "revoked-token")
+	assert.ErrorIs(t, err, zitadel.ErrTokenRejected)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = validator.ValidateToken(ctx, "inactive-token")
+	assert.ErrorIs(t, err, zitadel.ErrTokenRejected)
+	assert.Equal(t, int32(5), calls.Load(), "expired rejections should be rechecked")
+}
+
+func TestClientRoutes_AcceptOfflineVerifiedJWT(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+	setupAuthUserWithRole(t, db, "ADMIN", "zitadel-jwt-admin", "JWT Admin")
+
+	server := newJWKSServer(t)
+	key := newRSAKey(t)
+	server.publish(http.StatusOK, rsaJWK("key-1", key))
+	jwks, err := zitadel.NewJWKSValidator(zitadel.JWKSConfig{JWKSURL: server.URL, Issuer: testIssuer, Audience: "smart-chat"})
+	require.NoError(t, err)
+	introspection := &countingValidator{err: fmt.Errorf("%w: unknown token", zitadel.ErrTokenRejected)}
+	router := setupClientRoutes(db, zitadel.Tiered{JWT: jwks, Introspection: introspection})
+
+	request := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/v2/client/conversations", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := request(signJWT(t, "key-1", key, validClaims("zitadel-jwt-admin")))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	claims := validClaims("zitadel-jwt-admin")
+	claims["aud"] = "other-project"
+	recorder = request(signJWT(t, "key-1", key, claims))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, `{"error":"invalid access token"}`, recorder.Body.String())
+	assert.Equal(t, int32(0), introspection.calls.Load())
+}
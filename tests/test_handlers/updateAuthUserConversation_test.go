@@ -11,6 +11,7 @@ import (
 	"smart-chat/config"
 	"smart-chat/internal/handlers"
 	"smart-chat/internal/models"
+	"smart-chat/internal/rbac"
 	authUserConversation "smart-chat/internal/services/auth_user_conversation"
 	"smart-chat/internal/services/slack"
 	"smart-chat/tests/utils"
@@ -26,7 +27,7 @@ func TestUpdateAuthUserConversationHandler_UnauthorizedWithoutToken(t *testing.T
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.PATCH("/conversations/tracking", handlers.UpdateAuthUserConversationHandler(service, mockTokenValidator{userID: "zitadel-agent-track"}, nil))
+	router.PATCH("/conversations/tracking", authorize(db, mockTokenValidator{userID: "zitadel-agent-track"}, rbac.ConversationsWriteAssigned), handlers.UpdateAuthUserConversationHandler(service, nil, nil))
 
 	payload := map[string]any{"conversation_id": 1, "started": true}
 	body, _ := json.Marshal(payload)
@@ -50,7 +51,7 @@ func TestUpdateAuthUserConversationHandler_ForbiddenForViewer(t *testing.T) {
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.PATCH("/conversations/tracking", handlers.UpdateAuthUserConversationHandler(service, mockTokenValidator{userID: "zitadel-viewer-track"}, nil))
+	router.PATCH("/conversations/tracking", authorize(db, mockTokenValidator{userID: "zitadel-viewer-track"}, rbac.ConversationsWriteAssigned), handlers.UpdateAuthUserConversationHandler(service, nil, nil))
 
 	payload := map[string]any{"conversation_id": conv.ID, "started": true}
 	body, _ := json.Marshal(payload)
@@ -90,7 +91,7 @@ func TestUpdateAuthUserConversationHandler_SuccessAndSlackNotification(t *testin
 
 	service := authUserConversation.NewService(db)
 	router := gin.New()
-	router.PATCH("/conversations/tracking", handlers.UpdateAuthUserConversationHandler(service, mockTokenValidator{userID: "zitadel-agent-track"}, slackService))
+	router.PATCH("/conversations/tracking", authorize(db, mockTokenValidator{userID: "zitadel-agent-track"}, rbac.ConversationsWriteAssigned), handlers.UpdateAuthUserConversationHandler(service, slackService, nil))
 
 	payload := map[string]any{
 		"conversation_id": conv.ID,
@@ -0,0 +1,253 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	middleware "smart-chat/internal/middlewares"
+	"smart-chat/internal/models"
+	"smart-chat/internal/routes"
+	"smart-chat/internal/services/conversation"
+	legacyImport "smart-chat/internal/services/legacy_import"
+	"smart-chat/internal/store"
+	"smart-chat/internal/tokenhash"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var testV1DeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+func setupV1ChatRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v1 := router.Group("/v1", middleware.DeprecationMiddleware(testV1DeprecatedAt, "/v2"))
+	chatGroup := v1.Group("/chat")
+	chatGroup.Use(middleware.AuthMiddleware(db))
+	routes.RegisterRoutes(chatGroup, conversation.NewConversationService(db))
+	return router
+}
+
+func v1Request(router *gin.Engine, method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+type v1History struct {
+	ConversationHistory []struct {
+		UserMessage string
+		BotMessage  string
+	} `json:"conversationHistory"`
+}
+
+func TestV1AuthMiddleware_UsesSessions(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	user, _, _, _ := utils.SetupTestEntities(db)
+	expired := models.Session{UserID: user.ID, AuthToken: "expired_token", ExpireAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, db.Create(&expired).Error)
+
+	router := setupV1ChatRouter(db)
+
+	recorder := v1Request(router, http.MethodGet, "/v1/chat/receive", "", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, `{"error":"authorization required"}`, recorder.Body.String())
+
+	recorder = v1Request(router, http.MethodGet, "/v1/chat/receive", "unknown_token", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.JSONEq(t, `{"error":"conversation not found"}`, recorder.Body.String())
+
+	recorder = v1Request(router, http.MethodGet, "/v1/chat/receive", expired.AuthToken, "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, `{"error":"access token expired"}`, recorder.Body.String())
+}
+
+func TestV1Routes_SendDeprecationHeaders(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	router := setupV1ChatRouter(db)
+	recorder := v1Request(router, http.MethodGet, "/v1/chat/ping", "", "")
+
+	// The ping route sits behind the auth middleware, but errors are deprecated responses too.
+	assert.Equal(t, "@1792368000", recorder.Header().Get("Deprecation"))
+	assert.Equal(t, `</v2>; rel="successor-version"`, recorder.Header().Get("Link"))
+}
+
+func TestV1ReceiveMessageHandler_ReturnsPlainTextHistory(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, conv, _ := utils.SetupTestEntities(db)
+	require.NoError(t, db.Create(&models.MessagePair{
+		ConversationID: conv.ID,
+		User:           "Any treks in June?",
+		Bot:            `{"content":"Yes! Hampta Pass runs all through June."}`,
+		Visible:        true,
+		Type:           models.MessageTypeUserSent,
+	}).Error)
+	require.NoError(t, db.Create(&models.MessagePair{
+		ConversationID: conv.ID,
+		Bot:            "function call",
+		Visible:        false,
+		Type:           models.MessageTypeFunctionCall,
+	}).Error)
+
+	router := setupV1ChatRouter(db)
+	recorder := v1Request(router, http.MethodGet, "/v1/chat/receive", session.AuthToken, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var history v1History
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &history))
+	require.Len(t, history.ConversationHistory, 2)
+	assert.Equal(t, "Hello", history.ConversationHistory[0].UserMessage)
+	assert.Equal(t, "Hi there!", history.ConversationHistory[0].BotMessage)
+	assert.Equal(t, "Any treks in June?", history.ConversationHistory[1].UserMessage)
+	assert.Equal(t, "Yes! Hampta Pass runs all through June.", history.ConversationHistory[1].BotMessage)
+}
+
+func TestV1SendMessageHandler_EnforcesMessageLimit(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	_, session, conv, _ := utils.SetupTestEntities(db)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Create(&models.MessagePair{
+			ConversationID: conv.ID,
+			User:           "question",
+			Bot:            `{"content":"answer"}`,
+			Visible:        true,
+			Type:           models.MessageTypeUserSent,
+		}).Error)
+	}
+
+	router := setupV1ChatRouter(db)
+
+	recorder := v1Request(router, http.MethodPost, "/v1/chat/send", session.AuthToken, `{}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = v1Request(router, http.MethodPost, "/v1/chat/send", session.AuthToken, `{"message":"One more?"}`)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.JSONEq(t, `{"error":"Exceeded 10 of conversations"}`, recorder.Body.String())
+}
+
+type fakeLegacySource struct {
+	conversations []store.Conversation
+	deleted       []string
+}
+
+func (f *fakeLegacySource) FetchAllConversations() ([]store.Conversation, error) {
+	return f.conversations, nil
+}
+
+func (f *fakeLegacySource) DeleteConversation(accessToken string) error {
+	f.deleted = append(f.deleted, accessToken)
+	return nil
+}
+
+func TestLegacyImporter_ImportsMemcacheConversations(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	existing := models.User{Name: "Asha", Mobile: "+919800000030", AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&existing).Error)
+
+	source := &fakeLegacySource{conversations: []store.Conversation{
+		{
+			AccessToken:           "v1-token-asha",
+			AccessTokenExpireTime: time.Now().Add(time.Hour),
+			UserName:              "Asha",
+			UserMobile:            "+919800000030",
+			Messages: []store.MessagePair{
+				{UserMessage: "Chopta in December?", BotMessage: "Yes, with snow most weekends."},
+				{UserMessage: "Price?", BotMessage: "₹7,999 per person."},
+			},
+			TotalTokens: 420,
+		},
+		{
+			AccessToken:           "v1-token-ravi",
+			AccessTokenExpireTime: time.Now().Add(-time.Hour),
+			UserName:              "Ravi",
+			UserMobile:            "+919800000031",
+			Messages:              []store.MessagePair{{UserMessage: "Hi", BotMessage: "Hello!"}},
+		},
+	}}
+
+	importer := legacyImport.NewImporter(db, source)
+	result, err := importer.Import(true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 3, result.Messages)
+	assert.Equal(t, 2, result.Deleted)
+	assert.ElementsMatch(t, []string{"v1-token-asha", "v1-token-ravi"}, source.deleted)
+
+	var users int64
+	require.NoError(t, db.Model(&models.User{}).Count(&users).Error)
+	assert.Equal(t, int64(2), users, "the existing user is reused")
+
+	var session models.Session
+	require.NoError(t, db.Where("auth_token = ?", tokenhash.Default().Hash("v1-token-asha")).First(&session).Error)
+	assert.Equal(t, existing.ID, session.UserID)
+
+	// The imported token keeps working on the v1 routes.
+	router := setupV1ChatRouter(db)
+	recorder := v1Request(router, http.MethodGet, "/v1/chat/receive", "v1-token-asha", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var history v1History
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &history))
+	require.Len(t, history.ConversationHistory, 2)
+	assert.Equal(t, "₹7,999 per person.", history.ConversationHistory[1].BotMessage)
+
+	// A second run does not duplicate anything.
+	result, err = importer.Import(false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Imported)
+	assert.Equal(t, 2, result.Skipped)
+
+	var pairs int64
+	require.NoError(t, db.Model(&models.MessagePair{}).Count(&pairs).Error)
+	assert.Equal(t, int64(3), pairs)
+}
+
+func TestLegacyImporter_AttachesNationalMobilesToTheE164User(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	existing := models.User{Name: "Meera", Mobile: "+919800000032", AccessExpireAt: time.Now()}
+	require.NoError(t, db.Create(&existing).Error)
+
+	source := &fakeLegacySource{conversations: []store.Conversation{{
+		AccessToken:           "v1-token-meera",
+		AccessTokenExpireTime: time.Now().Add(time.Hour),
+		UserName:              "Meera",
+		UserMobile:            "9800000032",
+		Messages:              []store.MessagePair{{UserMessage: "Hi", BotMessage: "Hello!"}},
+	}}}
+
+	result, err := legacyImport.NewImporter(db, source).Import(false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Imported)
+
+	var users int64
+	require.NoError(t, db.Model(&models.User{}).Count(&users).Error)
+	assert.Equal(t, int64(1), users, "no second user is created for the national spelling")
+
+	var session models.Session
+	require.NoError(t, db.Where("auth_token = ?", tokenhash.Default().Hash("v1-token-meera")).First(&session).Error)
+	assert.Equal(t, existing.ID, session.UserID)
+}
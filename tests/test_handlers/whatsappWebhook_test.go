@@ -0,0 +1,411 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smart-chat/config"
+	cloudapi "smart-chat/external/whatsapp"
+	"smart-chat/internal/blobstore"
+	"smart-chat/internal/constants"
+	"smart-chat/internal/handlers"
+	"smart-chat/internal/models"
+	"smart-chat/internal/services/attachment"
+	"smart-chat/internal/services/reengagement"
+	"smart-chat/internal/services/whatsapp"
+	"smart-chat/tests/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testWhatsAppVerifyToken = "verify-me"
+	testWhatsAppAppSecret   = "app-secret"
+)
+
+// stubConversationHandler stands in for ConversationService so the webhook can be
+// exercised without calling the LLM. The first failures calls return an error, and
+// maxActive records how many calls ever overlapped.
+type stubConversationHandler struct {
+	db            *gorm.DB
+	response      string
+	failures      int32
+	calls         atomic.Int32
+	active        atomic.Int32
+	maxActive     atomic.Int32
+	attachmentIDs []uint
+}
+
+func (s *stubConversationHandler) HandleSessionWithAttachments(sessionID uint, _ string, attachmentIDs []uint, _ models.MessageType, _ bool) (string, error) {
+	call := s.calls.Add(1)
+	active := s.active.Add(1)
+	defer s.active.Add(-1)
+	if active > s.maxActive.Load() {
+		s.maxActive.Store(active)
+	}
+	if call <= s.failures {
+		return "", errors.New("llm unavailable")
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.attachmentIDs = attachmentIDs
+	conversation := models.Conversation{SessionID: sessionID}
+	if err := s.db.FirstOrCreate(&conversation, models.Conversation{SessionID: sessionID}).Error; err != nil {
+		return "", err
+	}
+	return s.response, nil
+}
+
+func setupWhatsAppService(db *gorm.DB, graph *utils.FakeGraphAPI, conversations whatsapp.ConversationHandler) *whatsapp.WhatsAppService {
+	return setupWhatsAppServiceWithStore(db, graph, conversations, blobstore.NewLocalStore(os.TempDir()))
+}
+
+func setupWhatsAppServiceWithStore(db *gorm.DB, graph *utils.FakeGraphAPI, conversations whatsapp.ConversationHandler, store blobstore.Store) *whatsapp.WhatsAppService {
+	cfg := &config.Config{
+		WhatsAppVerifyToken:    testWhatsAppVerifyToken,
+		WhatsAppAppSecret:      testWhatsAppAppSecret,
+		WhatsAppAccessToken:    graph.AccessToken,
+		WhatsAppPhoneNumberID:  graph.PhoneNumberID,
+		WhatsAppGraphBaseURL:   graph.URL(),
+		WhatsAppOutboundSender: whatsapp.SenderGraph,
+	}
+	sender := whatsapp.NewOutboundSender(cfg, nil)
+	attachments := attachment.NewService(db, store, 1<<20)
+	return whatsapp.NewWhatsAppService(cfg, db, conversations, sender, attachments, nil, nil)
+}
+
+func setupWhatsAppRouter(service *whatsapp.WhatsAppService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/webhook", handlers.WhatsAppWebhookVerifyHandler(service))
+	router.POST("/webhook", handlers.WhatsAppWebhookHandler(service))
+	return router
+}
+
+func whatsappTextPayload(messageID, waID, name, text string) cloudapi.WebhookPayload {
+	return cloudapi.WebhookPayload{
+		Object: "whatsapp_business_account",
+		Entry: []cloudapi.Entry{{
+			ID: "waba-1",
+			Changes: []cloudapi.Change{{
+				Field: "messages",
+				Value: cloudapi.Value{
+					MessagingProduct: "whatsapp",
+					Contacts:         []cloudapi.Contact{{WaID: waID, Profile: cloudapi.Profile{Name: name}}},
+					Messages: []cloudapi.Message{{
+						ID:   messageID,
+						From: waID,
+						Type: "text",
+						Text: &cloudapi.TextBody{Body: text},
+					}},
+				},
+			}},
+		}},
+	}
+}
+
+func signWhatsAppBody(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testWhatsAppAppSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWhatsAppWebhookVerifyHandler_EchoesChallenge(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	router := setupWhatsAppRouter(setupWhatsAppService(db, graph, &stubConversationHandler{db: db}))
+
+	req, _ := http.NewRequest(http.MethodGet, "/webhook?hub.mode=subscribe&hub.verify_token="+testWhatsAppVerifyToken+"&hub.challenge=1158201444", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "1158201444", recorder.Body.String())
+}
+
+func TestWhatsAppWebhookVerifyHandler_RejectsWrongToken(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	router := setupWhatsAppRouter(setupWhatsAppService(db, graph, &stubConversationHandler{db: db}))
+
+	req, _ := http.NewRequest(http.MethodGet, "/webhook?hub.mode=subscribe&hub.verify_token=wrong&hub.challenge=1158201444", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestWhatsAppWebhookHandler_RejectsInvalidSignature(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	conversations := &stubConversationHandler{db: db, response: `{"content":"Hello"}`}
+	router := setupWhatsAppRouter(setupWhatsAppService(db, graph, conversations))
+
+	body, _ := json.Marshal(whatsappTextPayload("wamid.in-1", "919876543210", "Asha", "Hi"))
+	req, _ := http.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Signature-256", "sha256=deadbeef")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, int32(0), conversations.calls.Load())
+}
+
+func TestWhatsAppWebhookHandler_RepliesThroughGraphAPI(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	conversations := &stubConversationHandler{db: db, response: `{"content":"Namaste Asha! Where would you like to travel?"}`}
+	router := setupWhatsAppRouter(setupWhatsAppService(db, graph, conversations))
+
+	body, _ := json.Marshal(whatsappTextPayload("wamid.in-1", "919876543210", "Asha", "Hi"))
+	req, _ := http.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Signature-256", signWhatsAppBody(body))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	select {
+	case sent := <-graph.Messages:
+		assert.Equal(t, "919876543210", sent.To)
+		require.NotNil(t, sent.Text)
+		assert.Equal(t, "Namaste Asha! Where would you like to travel?", sent.Text.Body)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reply to be sent to the graph api")
+	}
+
+	var user models.User
+	require.NoError(t, db.Where("mobile = ?", "+919876543210").First(&user).Error)
+	assert.Equal(t, "Asha", user.Name)
+
+	var session models.Session
+	require.NoError(t, db.Where("user_id = ?", user.ID).First(&session).Error)
+	assert.Equal(t, constants.WhatsAppSource, session.Source)
+}
+
+func TestWhatsAppService_IgnoresRedeliveredMessages(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	conversations := &stubConversationHandler{db: db, response: `{"content":"Hello again"}`}
+	service := setupWhatsAppService(db, graph, conversations)
+
+	payload := whatsappTextPayload("wamid.in-dup", "919812345678", "Ravi", "Any trips to Kedarnath?")
+	require.NoError(t, service.ProcessWebhook(payload))
+	require.NoError(t, service.ProcessWebhook(payload))
+
+	assert.Equal(t, int32(1), conversations.calls.Load())
+	assert.Len(t, graph.Messages, 1)
+
+	var sessionCount int64
+	require.NoError(t, db.Model(&models.Session{}).Count(&sessionCount).Error)
+	assert.Equal(t, int64(1), sessionCount)
+}
+
+func TestWhatsAppService_StoresInboundImage(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	image := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0x01}, 64)...)
+	graph.AddMedia("media-1", "image/jpeg", image)
+
+	store := blobstore.NewLocalStore(t.TempDir())
+	conversations := &stubConversationHandler{db: db, response: `{"content":"What a view!"}`}
+	service := setupWhatsAppServiceWithStore(db, graph, conversations, store)
+
+	payload := whatsappTextPayload("wamid.in-img", "919800000001", "Meera", "")
+	message := &payload.Entry[0].Changes[0].Value.Messages[0]
+	message.Type = "image"
+	message.Text = nil
+	message.Image = &cloudapi.Media{ID: "media-1", MimeType: "image/jpeg", Caption: "Is this Spiti?"}
+
+	require.NoError(t, service.ProcessWebhook(payload))
+
+	var stored models.MessageAttachment
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, models.AttachmentKindImage, stored.Kind)
+	assert.Equal(t, "image/jpeg", stored.MimeType)
+	assert.Equal(t, int64(len(image)), stored.SizeBytes)
+	assert.Equal(t, []uint{stored.ID}, conversations.attachmentIDs)
+
+	reader, err := store.Get(context.Background(), stored.StorageKey)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, image, content)
+
+	select {
+	case sent := <-graph.Messages:
+		require.NotNil(t, sent.Text)
+		assert.Equal(t, "What a view!", sent.Text.Body)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reply to be sent to the graph api")
+	}
+}
+
+func TestWhatsAppService_StoresSharedLocation(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	conversations := &stubConversationHandler{db: db, response: `{"content":"Thanks!"}`}
+	service := setupWhatsAppService(db, graph, conversations)
+
+	payload := whatsappTextPayload("wamid.in-loc", "919800000002", "Kabir", "")
+	message := &payload.Entry[0].Changes[0].Value.Messages[0]
+	message.Type = "location"
+	message.Text = nil
+	message.Location = &cloudapi.Location{Latitude: 32.2396, Longitude: 77.1887, Name: "Manali"}
+
+	require.NoError(t, service.ProcessWebhook(payload))
+
+	var stored models.MessageAttachment
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, models.AttachmentKindLocation, stored.Kind)
+	assert.Equal(t, "Manali", stored.LocationName)
+	require.NotNil(t, stored.Latitude)
+	assert.InDelta(t, 32.2396, *stored.Latitude, 1e-9)
+	assert.Equal(t, []uint{stored.ID}, conversations.attachmentIDs)
+}
+
+func TestWhatsAppService_StopKeywordOptsOutWithoutCallingTheBot(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	cfg := &config.Config{
+		WhatsAppAccessToken:    graph.AccessToken,
+		WhatsAppPhoneNumberID:  graph.PhoneNumberID,
+		WhatsAppGraphBaseURL:   graph.URL(),
+		WhatsAppOutboundSender: whatsapp.SenderGraph,
+	}
+	conversations := &stubConversationHandler{db: db, response: `{"content":"unused"}`}
+	keywords := reengagement.NewReengagementService(db, reengagementSettings(), stubNudgeGenerator{}, &recordingSender{}, nil)
+	attachments := attachment.NewService(db, blobstore.NewLocalStore(t.TempDir()), 1<<20)
+	service := whatsapp.NewWhatsAppService(cfg, db, conversations, whatsapp.NewOutboundSender(cfg, nil), attachments, keywords, nil)
+
+	require.NoError(t, service.ProcessWebhook(whatsappTextPayload("wamid.in-stop", "919800000020", "Meera", "STOP")))
+
+	assert.Equal(t, int32(0), conversations.calls.Load())
+	select {
+	case sent := <-graph.Messages:
+		require.NotNil(t, sent.Text)
+		assert.Contains(t, sent.Text.Body, "Reply START")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the opt-out confirmation to be sent")
+	}
+
+	var user models.User
+	require.NoError(t, db.Where("mobile = ?", "+919800000020").First(&user).Error)
+	assert.NotNil(t, user.ReengagementOptedOutAt)
+}
+
+func TestWhatsAppService_SerialisesMessagesFromOneSender(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	conversations := &stubConversationHandler{db: db, response: `{"content":"Got it"}`}
+	service := setupWhatsAppService(db, graph, conversations)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := whatsappTextPayload(fmt.Sprintf("wamid.in-burst-%d", i), "919800000030", "Isha", "Hello")
+			assert.NoError(t, service.ProcessWebhook(payload))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), conversations.calls.Load())
+	assert.Equal(t, int32(1), conversations.maxActive.Load())
+
+	var userCount, sessionCount int64
+	require.NoError(t, db.Model(&models.User{}).Where("mobile = ?", "+919800000030").Count(&userCount).Error)
+	assert.Equal(t, int64(1), userCount)
+	require.NoError(t, db.Model(&models.Session{}).Count(&sessionCount).Error)
+	assert.Equal(t, int64(1), sessionCount)
+}
+
+func TestWhatsAppService_RetriesFailedMessages(t *testing.T) {
+	db, teardown := utils.SetupTestDB()
+	defer teardown()
+
+	graph := utils.NewFakeGraphAPI("1234567890", "graph-token")
+	defer graph.Close()
+
+	conversations := &stubConversationHandler{db: db, response: `{"content":"Second time lucky"}`, failures: 1}
+	service := setupWhatsAppService(db, graph, conversations)
+
+	require.Error(t, service.ProcessWebhook(whatsappTextPayload("wamid.in-retry", "919800000040", "Dev", "Any trips to Ladakh?")))
+
+	var stored models.WhatsAppMessage
+	require.NoError(t, db.Where("wa_message_id = ?", "wamid.in-retry").First(&stored).Error)
+	assert.Equal(t, "failed", stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Empty(t, graph.Messages)
+
+	service.RetryPending()
+
+	require.NoError(t, db.Where("wa_message_id = ?", "wamid.in-retry").First(&stored).Error)
+	assert.Equal(t, "processed", stored.Status)
+	assert.Equal(t, int32(2), conversations.calls.Load())
+	select {
+	case sent := <-graph.Messages:
+		require.NotNil(t, sent.Text)
+		assert.Equal(t, "Second time lucky", sent.Text.Body)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the retried message to be answered")
+	}
+}
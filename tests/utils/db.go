@@ -23,9 +23,26 @@ func SetupTestDB() (*gorm.DB, func()) {
 		&models.Conversation{},
 		&models.MessagePair{},
 		&models.FunctionCall{},
+		&models.ConvAnalysis{},
 		&models.AuthRole{},
 		&models.AuthUser{},
 		&models.AuthUserConversation{},
+		&models.WhatsAppMessage{},
+		&models.MessageAttachment{},
+		&models.ReengagementNudge{},
+		&models.OTPChallenge{},
+		&models.AuthUserSession{},
+		&models.AuditEvent{},
+		&models.Escalation{},
+		&models.ConversationAssignment{},
+		&models.SLAAlert{},
+		&models.InboxEvent{},
+		&models.Tag{},
+		&models.ConversationTag{},
+		&models.ExportJob{},
+		&models.ConversationNote{},
+		&models.ConversationNoteRevision{},
+		&models.ConversationNoteMention{},
 	); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
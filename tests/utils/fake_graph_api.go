@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"smart-chat/external/whatsapp"
+)
+
+// FakeGraphAPI is a local stand-in for the WhatsApp Cloud API. It accepts
+// POST /{phone-number-id}/messages, checks the bearer token and publishes every
+// accepted message on Messages. Media registered with AddMedia is served through
+// GET /{media-id} and its download URL.
+type FakeGraphAPI struct {
+	Server        *httptest.Server
+	Messages      chan whatsapp.SendMessageRequest
+	PhoneNumberID string
+	AccessToken   string
+
+	sent  atomic.Int64
+	mu    sync.Mutex
+	media map[string]fakeMedia
+}
+
+type fakeMedia struct {
+	mimeType string
+	content  []byte
+}
+
+// NewFakeGraphAPI starts a fake Graph API server. Call Close when done.
+func NewFakeGraphAPI(phoneNumberID, accessToken string) *FakeGraphAPI {
+	fake := &FakeGraphAPI{
+		Messages:      make(chan whatsapp.SendMessageRequest, 16),
+		PhoneNumberID: phoneNumberID,
+		AccessToken:   accessToken,
+		media:         make(map[string]fakeMedia),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+phoneNumberID+"/messages", fake.handleMessages)
+	mux.HandleFunc("GET /{mediaID}", fake.handleMediaInfo)
+	mux.HandleFunc("GET /media/{mediaID}", fake.handleMediaDownload)
+	fake.Server = httptest.NewServer(mux)
+
+	return fake
+}
+
+// URL returns the base URL to configure as WhatsAppGraphBaseURL.
+func (f *FakeGraphAPI) URL() string {
+	return f.Server.URL
+}
+
+func (f *FakeGraphAPI) Close() {
+	f.Server.Close()
+}
+
+// AddMedia registers inbound media that the service can download by ID.
+func (f *FakeGraphAPI) AddMedia(mediaID, mimeType string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.media[mediaID] = fakeMedia{mimeType: mimeType, content: content}
+}
+
+func (f *FakeGraphAPI) lookupMedia(w http.ResponseWriter, r *http.Request) (fakeMedia, bool) {
+	if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != f.AccessToken {
+		writeGraphError(w, http.StatusUnauthorized, "Invalid OAuth access token.")
+		return fakeMedia{}, false
+	}
+
+	f.mu.Lock()
+	media, ok := f.media[r.PathValue("mediaID")]
+	f.mu.Unlock()
+	if !ok {
+		writeGraphError(w, http.StatusNotFound, "Unsupported get request.")
+		return fakeMedia{}, false
+	}
+	return media, true
+}
+
+func (f *FakeGraphAPI) handleMediaInfo(w http.ResponseWriter, r *http.Request) {
+	media, ok := f.lookupMedia(w, r)
+	if !ok {
+		return
+	}
+
+	mediaID := r.PathValue("mediaID")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(whatsapp.MediaInfo{
+		ID:       mediaID,
+		URL:      f.URL() + "/media/" + mediaID,
+		MimeType: media.mimeType,
+		FileSize: int64(len(media.content)),
+	})
+}
+
+func (f *FakeGraphAPI) handleMediaDownload(w http.ResponseWriter, r *http.Request) {
+	media, ok := f.lookupMedia(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", media.mimeType)
+	_, _ = w.Write(media.content)
+}
+
+func (f *FakeGraphAPI) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != f.AccessToken {
+		writeGraphError(w, http.StatusUnauthorized, "Invalid OAuth access token.")
+		return
+	}
+
+	var request whatsapp.SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeGraphError(w, http.StatusBadRequest, "Invalid JSON payload.")
+		return
+	}
+	if request.MessagingProduct != "whatsapp" || request.To == "" {
+		writeGraphError(w, http.StatusBadRequest, "Invalid parameter.")
+		return
+	}
+
+	messageID := fmt.Sprintf("wamid.fake-%d", f.sent.Add(1))
+	f.Messages <- request
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"messaging_product": "whatsapp",
+		"contacts":          []map[string]string{{"input": request.To, "wa_id": request.To}},
+		"messages":          []map[string]string{{"id": messageID}},
+	})
+}
+
+func writeGraphError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": "OAuthException", "code": status},
+	})
+}
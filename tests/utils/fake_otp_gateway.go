@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+// OTPGatewayRequest is a request received by FakeOTPGateway.
+type OTPGatewayRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// FakeOTPGateway is a local stand-in for SMS and OTP gateways. It records every request
+// and answers with the status and body set by Respond.
+type FakeOTPGateway struct {
+	Server *httptest.Server
+
+	mu       sync.Mutex
+	requests []OTPGatewayRequest
+	status   int
+	body     string
+}
+
+// NewFakeOTPGateway starts a gateway that answers 200 with an empty JSON object. Call Close when done.
+func NewFakeOTPGateway() *FakeOTPGateway {
+	gateway := &FakeOTPGateway{status: http.StatusOK, body: "{}"}
+	gateway.Server = httptest.NewServer(http.HandlerFunc(gateway.handle))
+	return gateway
+}
+
+func (g *FakeOTPGateway) URL() string {
+	return g.Server.URL
+}
+
+func (g *FakeOTPGateway) Close() {
+	g.Server.Close()
+}
+
+// Respond sets the status and JSON body returned for the following requests.
+func (g *FakeOTPGateway) Respond(status int, body string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status = status
+	g.body = body
+}
+
+// Requests returns the requests received so far.
+func (g *FakeOTPGateway) Requests() []OTPGatewayRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]OTPGatewayRequest(nil), g.requests...)
+}
+
+func (g *FakeOTPGateway) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	g.mu.Lock()
+	g.requests = append(g.requests, OTPGatewayRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	status, response := g.status, g.body
+	g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(response))
+}